@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"log"
+	"time"
 
 	"github.com/todomyday/backend/internal/config"
 	"github.com/todomyday/backend/internal/crypto"
@@ -9,6 +11,7 @@ import (
 	"github.com/todomyday/backend/internal/repository"
 	"github.com/todomyday/backend/internal/router"
 	"github.com/todomyday/backend/internal/services"
+	"github.com/todomyday/backend/internal/tokenizer"
 )
 
 func main() {
@@ -18,6 +21,11 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Exact token counts rely on the vocabularies embedded at build time
+	if err := tokenizer.Check(); err != nil {
+		log.Printf("Warning: token counts will be estimated: %v", err)
+	}
+
 	// Validate required config for Supabase
 	if cfg.SupabaseURL == "" {
 		log.Fatal("SUPABASE_URL environment variable is required")
@@ -86,6 +94,12 @@ func main() {
 	aiProviderRepo := repository.NewAIProviderRepository(db)
 	memoryRepo := repository.NewMemoryRepository(db)
 	chatRepo := repository.NewChatRepository(db)
+	promptTemplateRepo := repository.NewPromptTemplateRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	timeEntryRepo := repository.NewTimeEntryRepository(db)
+	boardRepo := repository.NewBoardRepository(db)
+	calendarRepo := repository.NewCalendarRepository(db)
+	davRepo := repository.NewDAVRepository(db)
 
 	// Initialize encryptor for API keys
 	encryptor := crypto.NewEncryptor(cfg.EncryptionKey)
@@ -103,6 +117,13 @@ func main() {
 	aiService := services.NewAIService(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, cfg.OpenAIModel)
 	aiProviderService := services.NewAIProviderService(aiProviderRepo, encryptor)
 	groupService := services.NewGroupService(groupRepo)
+	promptTemplateService := services.NewPromptTemplateService(promptTemplateRepo, memoryRepo)
+
+	// Enable LLM response cache for deterministic tasks (opt-in)
+	if cfg.LLMCacheEnabled {
+		services.EnableResponseCache(cfg.LLMCacheTTL, cfg.LLMCacheMaxEntries)
+		log.Printf("LLM response cache enabled (ttl=%s, max_entries=%d)", cfg.LLMCacheTTL, cfg.LLMCacheMaxEntries)
+	}
 
 	// Initialize scraper service (optional - for web search)
 	var scraperService *services.ScraperService
@@ -122,17 +143,41 @@ func main() {
 	var ragService *services.RAGService
 	var vectorRepo *repository.VectorRepository
 
-	if cfg.RAGEnabled && cfg.NIMAPIKey != "" {
-		log.Println("Initializing RAG service with NVIDIA NIM embeddings...")
+	useOllamaEmbeddings := cfg.EmbeddingProvider == "ollama"
+	if cfg.RAGEnabled && (cfg.NIMAPIKey != "" || useOllamaEmbeddings) {
+		var embeddingService *services.EmbeddingService
+		if useOllamaEmbeddings {
+			log.Printf("Initializing RAG service with Ollama embeddings at %s...", cfg.OllamaBaseURL)
+
+			// Create Ollama embedding service (no API key needed)
+			embeddingService = services.NewOllamaEmbeddingService(
+				cfg.OllamaBaseURL,
+				cfg.OllamaEmbeddingModel,
+				cfg.OllamaEmbeddingDim,
+			)
 
-		// Create NIM embedding service
-		embeddingService := services.NewEmbeddingService(
-			cfg.NIMBaseURL,
-			cfg.NIMAPIKey,
-			cfg.NIMModel,
-			cfg.NIMRPMLimit,
-			cfg.NIMEmbeddingDim,
-		)
+			// Pull the embedding model in the background so startup isn't blocked
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+				defer cancel()
+				if err := embeddingService.EnsureModel(ctx); err != nil {
+					log.Printf("Warning: Failed to pull Ollama embedding model %s: %v", cfg.OllamaEmbeddingModel, err)
+				} else {
+					log.Printf("Ollama embedding model ready: %s", cfg.OllamaEmbeddingModel)
+				}
+			}()
+		} else {
+			log.Println("Initializing RAG service with NVIDIA NIM embeddings...")
+
+			// Create NIM embedding service
+			embeddingService = services.NewEmbeddingService(
+				cfg.NIMBaseURL,
+				cfg.NIMAPIKey,
+				cfg.NIMModel,
+				cfg.NIMRPMLimit,
+				cfg.NIMEmbeddingDim,
+			)
+		}
 
 		// Create FTS repository and initialize tables
 		ftsRepo := repository.NewFTSRepository(db)
@@ -167,17 +212,53 @@ func main() {
 				aiService,
 				aiProviderService,
 				scraperService,
+				promptTemplateService,
 			)
-			log.Printf("RAG service initialized with NIM embedding model: %s (dim=%d, rpm=%d)",
-				cfg.NIMModel, cfg.NIMEmbeddingDim, cfg.NIMRPMLimit)
+			log.Printf("RAG service initialized with %s embedding model: %s (dim=%d)",
+				embeddingService.GetProvider(), embeddingService.GetModel(), embeddingService.GetDimension())
 		}
 	} else {
-		log.Println("RAG service not enabled - set NIM_API_KEY to enable")
+		log.Println("RAG service not enabled - set NIM_API_KEY or EMBEDDING_PROVIDER=ollama to enable")
 	}
 
 	// Initialize todo and memory services (with RAG integration)
-	todoService := services.NewTodoService(todoRepo, aiService, aiProviderService, ragService)
-	memoryService := services.NewMemoryService(memoryRepo, todoRepo, aiService, aiProviderService, scraperService, ragService)
+	todoService := services.NewTodoService(todoRepo, reminderRepo, timeEntryRepo, boardRepo, groupRepo, memoryRepo, aiService, aiProviderService, ragService, promptTemplateService)
+	memoryService := services.NewMemoryService(memoryRepo, todoRepo, groupRepo, aiService, aiProviderService, scraperService, ragService, promptTemplateService)
+
+	// Initialize digest email delivery (optional - requires SMTP)
+	emailService := services.NewEmailService(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+	digestMailer := services.NewDigestMailer(emailService, userRepo, todoRepo, cfg.PublicURL)
+	if digestMailer.IsConfigured() {
+		log.Printf("Digest emails enabled via SMTP %s:%d", cfg.SMTPHost, cfg.SMTPPort)
+	}
+
+	// Generate digests in the background as each user's period ends
+	if cfg.DigestSchedulerEnabled {
+		digestScheduler := services.NewDigestScheduler(memoryService, digestMailer, cfg.DigestBackfillPeriods)
+		go digestScheduler.Run(context.Background(), cfg.DigestSchedulerInterval)
+		log.Printf("Digest scheduler enabled (interval=%s, backfill=%d periods)", cfg.DigestSchedulerInterval, cfg.DigestBackfillPeriods)
+	}
+
+	// Initialize Web Push for reminders (optional - requires a VAPID key)
+	webPush, err := services.NewWebPush(cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+	if err != nil {
+		log.Fatalf("Failed to configure Web Push: %v", err)
+	}
+	if webPush.IsConfigured() {
+		log.Println("Web Push reminders enabled")
+	}
+	notificationService := services.NewNotificationService(reminderRepo, webPush)
+
+	// Send due reminders in the background
+	if cfg.ReminderSchedulerEnabled {
+		reminderScheduler := services.NewReminderScheduler(reminderRepo, todoRepo,
+			services.NewEmailReminderChannel(emailService, userRepo, reminderRepo),
+			services.NewWebhookReminderChannel(reminderRepo),
+			services.NewPushReminderChannel(webPush, reminderRepo),
+		)
+		go reminderScheduler.Run(context.Background(), cfg.ReminderSchedulerInterval)
+		log.Printf("Reminder scheduler enabled (interval=%s)", cfg.ReminderSchedulerInterval)
+	}
 
 	// Initialize user data service (for data management)
 	userDataService := services.NewUserDataService(memoryRepo, todoRepo, groupRepo, vectorRepo, ragService)
@@ -188,19 +269,23 @@ func main() {
 	// Initialize upload job service
 	uploadJobService := services.NewUploadJobService()
 
-	// Initialize vision service for image processing (GLM-4.5V)
-	visionService := services.NewVisionService(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, "glm-4.5v")
+	// Initialize vision service for image processing (per-user vision model, GLM-4.5V fallback)
+	visionService := services.NewVisionService(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, "glm-4.5v", aiProviderService, promptTemplateService)
 	if visionService.IsConfigured() {
-		log.Println("Vision service configured with GLM-4.5V for image processing")
+		log.Println("Vision service configured with GLM-4.5V fallback for image processing")
 	} else {
-		log.Println("Vision service not configured - image upload will be unavailable")
+		log.Println("Vision service fallback not configured - image upload requires a vision model in AI provider settings")
 	}
 
 	// Initialize chat service
 	chatService := services.NewChatService(chatRepo)
 
+	// Initialize iCalendar feed and import, and CalDAV
+	calendarService := services.NewCalendarService(calendarRepo, todoRepo, groupRepo, todoService, cfg.PublicURL)
+	caldavService := services.NewCalDAVService(davRepo, userRepo, todoRepo, groupRepo, todoService, cfg.PublicURL)
+
 	// Setup router
-	r := router.Setup(supabaseAuthService, userRepo, todoService, groupService, aiProviderService, memoryService, ragService, userDataService, fileParserService, uploadJobService, visionService, chatService, cfg.AllowedOrigins)
+	r := router.Setup(supabaseAuthService, userRepo, todoService, groupService, aiProviderService, memoryService, ragService, userDataService, fileParserService, uploadJobService, visionService, chatService, promptTemplateService, notificationService, calendarService, caldavService, cfg.AllowedOrigins)
 
 	// Start server
 	log.Printf("Server starting on port %s", cfg.Port)
@@ -0,0 +1,356 @@
+// Package caldav reads and writes the XML bodies of the WebDAV (RFC 4918),
+// CalDAV (RFC 4791) and collection sync (RFC 6578) requests memlane serves.
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// XML namespaces of the properties memlane knows
+const (
+	NSDAV            = "DAV:"
+	NSCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NSCalendarServer = "http://calendarserver.org/ns/"
+	NSApple          = "http://apple.com/ns/ical/"
+)
+
+// prefixes are declared on every response, so property values can use them
+var prefixes = map[string]string{
+	NSDAV:            "d",
+	NSCalDAV:         "c",
+	NSCalendarServer: "cs",
+	NSApple:          "a",
+}
+
+// Request bodies
+var (
+	Propfind         = xml.Name{Space: NSDAV, Local: "propfind"}
+	PropertyUpdate   = xml.Name{Space: NSDAV, Local: "propertyupdate"}
+	CalendarQuery    = xml.Name{Space: NSCalDAV, Local: "calendar-query"}
+	CalendarMultiget = xml.Name{Space: NSCalDAV, Local: "calendar-multiget"}
+	SyncCollection   = xml.Name{Space: NSDAV, Local: "sync-collection"}
+)
+
+// ErrInvalid is returned for request bodies that can't be read or aren't
+// supported
+var ErrInvalid = errors.New("invalid WebDAV request")
+
+// Request is a PROPFIND, PROPPATCH or REPORT body
+type Request struct {
+	Type xml.Name
+	// Props are the properties asked for, or set and removed by a PROPPATCH.
+	// AllProp asks for all of them and PropName for just their names.
+	Props    []xml.Name
+	AllProp  bool
+	PropName bool
+	// Hrefs are the resources a calendar-multiget asks for
+	Hrefs []string
+	// SyncToken is the token a sync-collection report syncs from, empty for
+	// the first sync
+	SyncToken string
+	// Components are the components a calendar-query filters on, such as
+	// VTODO; empty if it doesn't filter
+	Components []string
+}
+
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []element  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (e *element) attr(local string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+var (
+	propName       = xml.Name{Space: NSDAV, Local: "prop"}
+	allPropName    = xml.Name{Space: NSDAV, Local: "allprop"}
+	propNameName   = xml.Name{Space: NSDAV, Local: "propname"}
+	hrefName       = xml.Name{Space: NSDAV, Local: "href"}
+	syncTokenName  = xml.Name{Space: NSDAV, Local: "sync-token"}
+	setName        = xml.Name{Space: NSDAV, Local: "set"}
+	removeName     = xml.Name{Space: NSDAV, Local: "remove"}
+	filterName     = xml.Name{Space: NSCalDAV, Local: "filter"}
+	compFilterName = xml.Name{Space: NSCalDAV, Local: "comp-filter"}
+)
+
+// ParseRequest reads a request body. An empty body is a PROPFIND for all
+// properties.
+func ParseRequest(r io.Reader) (*Request, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Request{Type: Propfind, AllProp: true}, nil
+	}
+
+	var root element
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	switch root.XMLName {
+	case Propfind, PropertyUpdate, CalendarQuery, CalendarMultiget, SyncCollection:
+	default:
+		return nil, fmt.Errorf("%w: unsupported %s", ErrInvalid, root.XMLName.Local)
+	}
+
+	req := &Request{Type: root.XMLName}
+	for _, child := range root.Children {
+		switch child.XMLName {
+		case propName:
+			req.Props = append(req.Props, childNames(&child)...)
+		case setName, removeName:
+			for _, prop := range child.Children {
+				if prop.XMLName == propName {
+					req.Props = append(req.Props, childNames(&prop)...)
+				}
+			}
+		case allPropName:
+			req.AllProp = true
+		case propNameName:
+			req.PropName = true
+		case hrefName:
+			req.Hrefs = append(req.Hrefs, strings.TrimSpace(child.Text))
+		case syncTokenName:
+			req.SyncToken = strings.TrimSpace(child.Text)
+		case filterName:
+			req.Components = filterComponents(&child)
+		}
+	}
+	if req.Props == nil && !req.PropName && root.XMLName != PropertyUpdate {
+		req.AllProp = true
+	}
+	return req, nil
+}
+
+func childNames(e *element) []xml.Name {
+	names := make([]xml.Name, 0, len(e.Children))
+	for _, child := range e.Children {
+		names = append(names, child.XMLName)
+	}
+	return names
+}
+
+// filterComponents returns the components under the VCALENDAR comp-filter
+func filterComponents(filter *element) []string {
+	var names []string
+	for _, calendar := range filter.Children {
+		if calendar.XMLName != compFilterName || !strings.EqualFold(calendar.attr("name"), "VCALENDAR") {
+			continue
+		}
+		for _, component := range calendar.Children {
+			if component.XMLName == compFilterName {
+				names = append(names, strings.ToUpper(component.attr("name")))
+			}
+		}
+	}
+	return names
+}
+
+// Requested reports whether the request names a property explicitly.
+// Expensive properties such as calendar-data are only returned if it does.
+func (r *Request) Requested(name xml.Name) bool {
+	for _, prop := range r.Props {
+		if prop == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WantsComponent reports whether a calendar-query matches a component
+func (r *Request) WantsComponent(name string) bool {
+	if len(r.Components) == 0 {
+		return true
+	}
+	for _, component := range r.Components {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Property is a property of a resource and its value as XML
+type Property struct {
+	Name  xml.Name
+	Inner string
+}
+
+// Text returns a property with a text value
+func Text(name xml.Name, value string) Property {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return Property{Name: name, Inner: b.String()}
+}
+
+// Hrefs returns a property whose value is a list of hrefs
+func Hrefs(name xml.Name, hrefs ...string) Property {
+	var b strings.Builder
+	for _, href := range hrefs {
+		b.WriteString("<d:href>")
+		xml.EscapeText(&b, []byte(href))
+		b.WriteString("</d:href>")
+	}
+	return Property{Name: name, Inner: b.String()}
+}
+
+// Element returns an element as XML, with an attribute if attr is given as
+// a name and value. Elements nest through inner.
+func Element(name xml.Name, inner string, attr ...string) string {
+	open, end := tag(name)
+	if len(attr) == 2 {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(attr[1]))
+		open += fmt.Sprintf(` %s="%s"`, attr[0], b.String())
+	}
+	if inner == "" {
+		return "<" + open + "/>"
+	}
+	return "<" + open + ">" + inner + "</" + end + ">"
+}
+
+// tag returns the opening and closing tag names for name, declaring its
+// namespace if it has no common prefix
+func tag(name xml.Name) (open, end string) {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local, prefix + ":" + name.Local
+	}
+	if name.Space == "" {
+		return name.Local, name.Local
+	}
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(name.Space))
+	return fmt.Sprintf(`x:%s xmlns:x="%s"`, name.Local, b.String()), "x:" + name.Local
+}
+
+// Select picks the properties asked for from those a resource has, and lists
+// the ones asked for that it doesn't have
+func (r *Request) Select(props []Property) (found []Property, missing []xml.Name) {
+	switch {
+	case r.AllProp:
+		return props, nil
+	case r.PropName:
+		for _, prop := range props {
+			found = append(found, Property{Name: prop.Name})
+		}
+		return found, nil
+	}
+	for _, name := range r.Props {
+		ok := false
+		for _, prop := range props {
+			if prop.Name == name {
+				found = append(found, prop)
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	return found, missing
+}
+
+// Response describes one resource in a multistatus body. Status is set
+// instead of properties for resources that can't be described, such as
+// those deleted since a sync-token. Denied lists properties that can't be
+// changed.
+type Response struct {
+	Href    string
+	Status  int
+	Found   []Property
+	Missing []xml.Name
+	Denied  []xml.Name
+}
+
+// Multistatus is a 207 Multi-Status body
+type Multistatus struct {
+	Responses []Response
+	// SyncToken is set in sync-collection reports
+	SyncToken string
+}
+
+// Encode writes the body as XML
+func (m *Multistatus) Encode(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus`)
+	for _, space := range []string{NSDAV, NSCalDAV, NSCalendarServer, NSApple} {
+		fmt.Fprintf(&b, ` xmlns:%s="%s"`, prefixes[space], space)
+	}
+	b.WriteString(">")
+
+	for _, resp := range m.Responses {
+		b.WriteString("<d:response><d:href>")
+		xml.EscapeText(&b, []byte(resp.Href))
+		b.WriteString("</d:href>")
+		if resp.Status != 0 {
+			writeStatus(&b, resp.Status)
+		} else {
+			if len(resp.Found) > 0 || (len(resp.Missing) == 0 && len(resp.Denied) == 0) {
+				b.WriteString("<d:propstat><d:prop>")
+				for _, prop := range resp.Found {
+					b.WriteString(Element(prop.Name, prop.Inner))
+				}
+				b.WriteString("</d:prop>")
+				writeStatus(&b, http.StatusOK)
+				b.WriteString("</d:propstat>")
+			}
+			writeNames(&b, resp.Missing, http.StatusNotFound)
+			writeNames(&b, resp.Denied, http.StatusForbidden)
+		}
+		b.WriteString("</d:response>")
+	}
+
+	if m.SyncToken != "" {
+		b.WriteString("<d:sync-token>")
+		xml.EscapeText(&b, []byte(m.SyncToken))
+		b.WriteString("</d:sync-token>")
+	}
+	b.WriteString("</d:multistatus>")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeNames(b *strings.Builder, names []xml.Name, status int) {
+	if len(names) == 0 {
+		return
+	}
+	b.WriteString("<d:propstat><d:prop>")
+	for _, name := range names {
+		b.WriteString(Element(name, ""))
+	}
+	b.WriteString("</d:prop>")
+	writeStatus(b, status)
+	b.WriteString("</d:propstat>")
+}
+
+func writeStatus(b *strings.Builder, status int) {
+	fmt.Fprintf(b, "<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+// Error returns a DAV:error body naming the precondition a request failed
+func Error(condition xml.Name) []byte {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<d:error xmlns:d="%s" xmlns:c="%s">`, NSDAV, NSCalDAV)
+	b.WriteString(Element(condition, ""))
+	b.WriteString("</d:error>")
+	return []byte(b.String())
+}
@@ -0,0 +1,96 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest(strings.NewReader(`<?xml version="1.0"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"/></C:comp-filter></C:filter>
+</C:calendar-query>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Type != CalendarQuery || !req.Requested(xml.Name{Space: NSCalDAV, Local: "calendar-data"}) || req.AllProp {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if req.WantsComponent("VTODO") || !req.WantsComponent("VEVENT") {
+		t.Errorf("expected a query for events only, got %v", req.Components)
+	}
+
+	req, err = ParseRequest(strings.NewReader(`<propertyupdate xmlns="DAV:" xmlns:A="http://apple.com/ns/ical/">
+  <set><prop><A:calendar-order>2</A:calendar-order></prop></set>
+  <remove><prop><displayname/></prop></remove>
+</propertyupdate>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []xml.Name{{Space: NSApple, Local: "calendar-order"}, {Space: NSDAV, Local: "displayname"}}
+	if !reflect.DeepEqual(req.Props, want) {
+		t.Errorf("expected %v, got %v", want, req.Props)
+	}
+
+	if req, err = ParseRequest(strings.NewReader("  ")); err != nil || !req.AllProp {
+		t.Errorf("expected an empty body to ask for all properties, got %+v, %v", req, err)
+	}
+	if _, err = ParseRequest(strings.NewReader(`<D:lockinfo xmlns:D="DAV:"/>`)); err == nil {
+		t.Error("expected unsupported bodies to be rejected")
+	}
+}
+
+func TestMultistatusEncode(t *testing.T) {
+	req := &Request{Type: Propfind, Props: []xml.Name{
+		{Space: NSDAV, Local: "displayname"},
+		{Space: "urn:example", Local: "unknown"},
+	}}
+	found, missing := req.Select([]Property{
+		Text(xml.Name{Space: NSDAV, Local: "displayname"}, "Bills & <stuff>"),
+		Hrefs(xml.Name{Space: NSDAV, Local: "owner"}, "/caldav/principals/1/"),
+	})
+	ms := &Multistatus{
+		Responses: []Response{
+			{Href: "/caldav/calendars/1/inbox/", Found: found, Missing: missing},
+			{Href: "/caldav/calendars/1/inbox/gone.ics", Status: http.StatusNotFound},
+		},
+		SyncToken: "urn:memlane:sync:7",
+	}
+	var buf bytes.Buffer
+	if err := ms.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Responses []struct {
+			Href     string `xml:"href"`
+			Status   string `xml:"status"`
+			Propstat []struct {
+				Prop struct {
+					Inner string `xml:",innerxml"`
+				} `xml:"prop"`
+				Status string `xml:"status"`
+			} `xml:"propstat"`
+		} `xml:"response"`
+		SyncToken string `xml:"sync-token"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if len(decoded.Responses) != 2 || decoded.SyncToken != "urn:memlane:sync:7" {
+		t.Fatalf("unexpected body %s", buf.String())
+	}
+	first := decoded.Responses[0]
+	if len(first.Propstat) != 2 || !strings.Contains(first.Propstat[0].Prop.Inner, "Bills &amp; &lt;stuff&gt;") ||
+		!strings.Contains(first.Propstat[1].Status, "404") || strings.Contains(buf.String(), "owner") {
+		t.Errorf("unexpected propstats %s", buf.String())
+	}
+	if !strings.Contains(decoded.Responses[1].Status, "404 Not Found") {
+		t.Errorf("expected a 404 status, got %q", decoded.Responses[1].Status)
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/mail"
 	"os"
 	"strconv"
 	"strings"
@@ -30,6 +31,33 @@ type Config struct {
 	NIMModel        string
 	NIMRPMLimit     int
 	NIMEmbeddingDim int
+	// Embedding provider: "nim" (default) or "ollama" for fully self-hosted installs
+	EmbeddingProvider    string
+	OllamaBaseURL        string
+	OllamaEmbeddingModel string
+	OllamaEmbeddingDim   int
+	// LLM response cache (opt-in) for deterministic AI tasks
+	LLMCacheEnabled    bool
+	LLMCacheTTL        time.Duration
+	LLMCacheMaxEntries int
+	// Background digest generation
+	DigestSchedulerEnabled  bool
+	DigestSchedulerInterval time.Duration
+	DigestBackfillPeriods   int
+	// SMTP delivery for digest emails (disabled when SMTPHost is empty)
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	// PublicURL is where the backend is reachable from outside, used in email links
+	PublicURL string
+	// Background reminder delivery
+	ReminderSchedulerEnabled  bool
+	ReminderSchedulerInterval time.Duration
+	// Web Push for reminders (disabled when VAPIDPrivateKey is empty)
+	VAPIDPrivateKey string
+	VAPIDSubject    string
 	// Supabase settings
 	SupabaseURL           string
 	SupabaseAnonKey       string
@@ -135,6 +163,102 @@ func Load() (*Config, error) {
 		}
 	}
 
+	// Ollama settings (self-hosted embeddings)
+	embeddingProvider := strings.ToLower(os.Getenv("EMBEDDING_PROVIDER"))
+	if embeddingProvider == "" {
+		embeddingProvider = "nim"
+	}
+
+	ollamaBaseURL := os.Getenv("OLLAMA_BASE_URL")
+	if ollamaBaseURL == "" {
+		ollamaBaseURL = "http://localhost:11434"
+	}
+
+	ollamaEmbeddingModel := os.Getenv("OLLAMA_EMBEDDING_MODEL")
+	if ollamaEmbeddingModel == "" {
+		ollamaEmbeddingModel = "nomic-embed-text"
+	}
+
+	ollamaEmbeddingDim := 768
+	if dimStr := os.Getenv("OLLAMA_EMBEDDING_DIM"); dimStr != "" {
+		if dim, err := strconv.Atoi(dimStr); err == nil && dim > 0 {
+			ollamaEmbeddingDim = dim
+		}
+	}
+
+	// LLM response cache settings
+	llmCacheEnabled := os.Getenv("LLM_CACHE_ENABLED") == "true"
+
+	llmCacheTTL := 7 * 24 * time.Hour
+	if ttlStr := os.Getenv("LLM_CACHE_TTL"); ttlStr != "" {
+		if ttl, err := time.ParseDuration(ttlStr); err == nil && ttl > 0 {
+			llmCacheTTL = ttl
+		}
+	}
+
+	llmCacheMaxEntries := 5000
+	if maxStr := os.Getenv("LLM_CACHE_MAX_ENTRIES"); maxStr != "" {
+		if max, err := strconv.Atoi(maxStr); err == nil && max > 0 {
+			llmCacheMaxEntries = max
+		}
+	}
+
+	// Digest scheduler settings
+	digestSchedulerEnabled := os.Getenv("DIGEST_SCHEDULER_ENABLED") != "false"
+
+	digestSchedulerInterval := time.Hour
+	if intervalStr := os.Getenv("DIGEST_SCHEDULER_INTERVAL"); intervalStr != "" {
+		if interval, err := time.ParseDuration(intervalStr); err == nil && interval > 0 {
+			digestSchedulerInterval = interval
+		}
+	}
+
+	digestBackfillPeriods := 4
+	if periodsStr := os.Getenv("DIGEST_BACKFILL_PERIODS"); periodsStr != "" {
+		if periods, err := strconv.Atoi(periodsStr); err == nil && periods > 0 {
+			digestBackfillPeriods = periods
+		}
+	}
+
+	// SMTP settings
+	smtpPort := 587
+	if portStr := os.Getenv("SMTP_PORT"); portStr != "" {
+		if p, err := strconv.Atoi(portStr); err == nil && p > 0 {
+			smtpPort = p
+		}
+	}
+
+	smtpFrom := os.Getenv("SMTP_FROM")
+	if smtpFrom == "" {
+		smtpFrom = os.Getenv("SMTP_USERNAME")
+	}
+
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	// Reminder scheduler settings
+	reminderSchedulerEnabled := os.Getenv("REMINDER_SCHEDULER_ENABLED") != "false"
+
+	reminderSchedulerInterval := time.Minute
+	if intervalStr := os.Getenv("REMINDER_SCHEDULER_INTERVAL"); intervalStr != "" {
+		if interval, err := time.ParseDuration(intervalStr); err == nil && interval > 0 {
+			reminderSchedulerInterval = interval
+		}
+	}
+
+	// Push services contact the subject about problems; default to the sender address
+	vapidSubject := os.Getenv("VAPID_SUBJECT")
+	if vapidSubject == "" {
+		if from, err := mail.ParseAddress(smtpFrom); err == nil {
+			vapidSubject = "mailto:" + from.Address
+		}
+	}
+	if vapidSubject == "" {
+		vapidSubject = publicURL
+	}
+
 	return &Config{
 		Port:                  port,
 		DatabasePath:          dbPath,
@@ -154,6 +278,26 @@ func Load() (*Config, error) {
 		NIMModel:              nimModel,
 		NIMRPMLimit:           nimRPMLimit,
 		NIMEmbeddingDim:       nimEmbeddingDim,
+		EmbeddingProvider:     embeddingProvider,
+		OllamaBaseURL:         ollamaBaseURL,
+		OllamaEmbeddingModel:  ollamaEmbeddingModel,
+		OllamaEmbeddingDim:    ollamaEmbeddingDim,
+		LLMCacheEnabled:       llmCacheEnabled,
+		LLMCacheTTL:           llmCacheTTL,
+		LLMCacheMaxEntries:    llmCacheMaxEntries,
+		DigestSchedulerEnabled:  digestSchedulerEnabled,
+		DigestSchedulerInterval: digestSchedulerInterval,
+		DigestBackfillPeriods:   digestBackfillPeriods,
+		SMTPHost:                os.Getenv("SMTP_HOST"),
+		SMTPPort:                smtpPort,
+		SMTPUsername:            os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:            os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:                smtpFrom,
+		PublicURL:               publicURL,
+		ReminderSchedulerEnabled:  reminderSchedulerEnabled,
+		ReminderSchedulerInterval: reminderSchedulerInterval,
+		VAPIDPrivateKey:           os.Getenv("VAPID_PRIVATE_KEY"),
+		VAPIDSubject:              vapidSubject,
 		SupabaseURL:           os.Getenv("SUPABASE_URL"),
 		SupabaseAnonKey:       os.Getenv("SUPABASE_ANON_KEY"),
 		SupabaseServiceRoleKey: os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
@@ -1,13 +1,16 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/todomyday/backend/internal/fracindex"
 	_ "modernc.org/sqlite"
 )
 
@@ -18,16 +21,13 @@ func Connect(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Foreign keys are enabled per connection, so they're set in the DSN for
+	// every connection the pool opens
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
-	}
-
 	// Enable WAL mode for better concurrency
 	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
 		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
@@ -75,22 +75,149 @@ func runMigrations(db *sql.DB) error {
 		description TEXT,
 		due_date DATETIME,
 		priority TEXT DEFAULT 'medium' CHECK(priority IN ('low', 'medium', 'high')),
-		status TEXT DEFAULT 'pending' CHECK(status IN ('pending', 'completed')),
+		status TEXT DEFAULT 'pending' CHECK(status IN ('pending', 'in_progress', 'blocked', 'completed', 'cancelled')),
 		position TEXT DEFAULT '1000',
 		tags TEXT DEFAULT '[]',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME,
+		series_id TEXT REFERENCES todo_series(id) ON DELETE SET NULL,
+		occurrence TEXT,
+		parent_id TEXT REFERENCES todos(id) ON DELETE CASCADE,
+		auto_complete INTEGER DEFAULT 0,
+		resume_status TEXT,
+		ical_uid TEXT
+	);
+
+	-- Todo dependencies (todo_id is blocked until blocker_id is done)
+	CREATE TABLE IF NOT EXISTS todo_dependencies (
+		todo_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		blocker_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (todo_id, blocker_id)
+	);
+
+	-- Recurring todo series (template and RRULE for the todos linked to it)
+	CREATE TABLE IF NOT EXISTS todo_series (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		rrule TEXT NOT NULL,
+		dtstart TEXT NOT NULL,
+		due_time TEXT DEFAULT '',
+		title TEXT NOT NULL,
+		description TEXT,
+		priority TEXT DEFAULT 'medium',
+		group_id TEXT REFERENCES groups(id) ON DELETE SET NULL,
+		tags TEXT DEFAULT '[]',
+		exdates TEXT DEFAULT '[]',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Kanban columns of a user's board for a group. Columns with a status hold
+	-- the todos with that status; columns without one are custom lanes.
+	CREATE TABLE IF NOT EXISTS board_columns (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		status TEXT,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Todo reminders (fire_at is remind_at, or offset_minutes before the due date)
+	CREATE TABLE IF NOT EXISTS todo_reminders (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		remind_at DATETIME,
+		offset_minutes INTEGER,
+		fire_at DATETIME,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'sending', 'sent', 'failed', 'skipped')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		retry_at DATETIME,
+		claimed_at DATETIME,
+		last_error TEXT,
+		sent_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Reminder deliveries that succeeded, so retries only resend what failed
+	CREATE TABLE IF NOT EXISTS reminder_deliveries (
+		reminder_id TEXT NOT NULL REFERENCES todo_reminders(id) ON DELETE CASCADE,
+		channel TEXT NOT NULL,
+		target TEXT NOT NULL,
+		delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (reminder_id, channel, target)
+	);
+
+	-- Time tracked on todos, from timers or entered by hand. A running timer
+	-- has no ended_at; idx_time_entries_running allows one per user.
+	CREATE TABLE IF NOT EXISTS time_entries (
+		id TEXT PRIMARY KEY,
+		todo_id TEXT NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME,
+		note TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Notification settings (where reminders are sent)
+	CREATE TABLE IF NOT EXISTS notification_settings (
+		user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		email_enabled INTEGER DEFAULT 1,
+		webhook_url TEXT,
+		webhook_secret TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Web Push subscriptions, one per browser
+	CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		endpoint TEXT NOT NULL UNIQUE,
+		p256dh TEXT NOT NULL,
+		auth TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- iCalendar feeds, one secret URL per user
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		token TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- CalDAV app passwords, one per user
+	CREATE TABLE IF NOT EXISTS dav_credentials (
+		user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Todo changes for CalDAV sync-tokens, recorded by triggers. A todo moved
+	-- to another group is deleted from the old group's collection.
+	CREATE TABLE IF NOT EXISTS todo_changes (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		group_id TEXT,
+		todo_id TEXT NOT NULL,
+		uid TEXT NOT NULL,
+		deleted INTEGER NOT NULL DEFAULT 0
+	);
+
 	-- AI Providers table (stores provider configurations)
 	CREATE TABLE IF NOT EXISTS ai_providers (
 		id TEXT PRIMARY KEY,
 		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 		name TEXT NOT NULL,
-		provider_type TEXT NOT NULL CHECK(provider_type IN ('openai', 'anthropic', 'google', 'custom')),
+		provider_type TEXT NOT NULL CHECK(provider_type IN ('openai', 'anthropic', 'google', 'custom', 'ollama', 'mock')),
 		base_url TEXT NOT NULL,
 		api_key_encrypted TEXT NOT NULL,
 		selected_model TEXT,
+		vision_model TEXT,
 		is_default INTEGER DEFAULT 0,
 		is_enabled INTEGER DEFAULT 1,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -103,6 +230,12 @@ func runMigrations(db *sql.DB) error {
 		provider_id TEXT NOT NULL REFERENCES ai_providers(id) ON DELETE CASCADE,
 		model_id TEXT NOT NULL,
 		model_name TEXT NOT NULL,
+		context_window INTEGER DEFAULT 0,
+		supports_vision INTEGER DEFAULT 0,
+		supports_tools INTEGER DEFAULT 0,
+		supports_json INTEGER DEFAULT 0,
+		supports_streaming INTEGER DEFAULT 0,
+		supports_embedding INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(provider_id, model_id)
 	);
@@ -135,15 +268,57 @@ func runMigrations(db *sql.DB) error {
 		UNIQUE(user_id, name)
 	);
 
-	-- Memory digests table (weekly AI summaries)
+	-- Memory digests table (daily, weekly or monthly AI summaries)
 	CREATE TABLE IF NOT EXISTS memory_digests (
 		id TEXT PRIMARY KEY,
 		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		period TEXT NOT NULL DEFAULT 'weekly' CHECK(period IN ('daily', 'weekly', 'monthly')),
 		week_start DATE NOT NULL,
 		week_end DATE NOT NULL,
 		digest_content TEXT NOT NULL,
+		sections TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(user_id, week_start)
+		UNIQUE(user_id, period, week_start)
+	);
+
+	-- Spaced repetition schedule of memories marked to learn
+	CREATE TABLE IF NOT EXISTS memory_reviews (
+		memory_id TEXT PRIMARY KEY REFERENCES memories(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		learn INTEGER DEFAULT 1,
+		ease REAL DEFAULT 2.5,
+		interval_days INTEGER DEFAULT 0,
+		repetitions INTEGER DEFAULT 0,
+		lapses INTEGER DEFAULT 0,
+		review_count INTEGER DEFAULT 0,
+		due_date DATE NOT NULL,
+		last_outcome TEXT,
+		last_reviewed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Review history of memories marked to learn
+	CREATE TABLE IF NOT EXISTS memory_review_log (
+		id TEXT PRIMARY KEY,
+		memory_id TEXT NOT NULL REFERENCES memories(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		outcome TEXT NOT NULL CHECK(outcome IN ('again', 'hard', 'good', 'easy')),
+		interval_days INTEGER NOT NULL,
+		due_date DATE NOT NULL,
+		reviewed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Digest schedule per user (users without a row get the defaults)
+	CREATE TABLE IF NOT EXISTS digest_settings (
+		user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		enabled INTEGER DEFAULT 1,
+		cadence TEXT NOT NULL DEFAULT 'weekly' CHECK(cadence IN ('daily', 'weekly', 'monthly')),
+		timezone TEXT NOT NULL DEFAULT 'UTC',
+		week_start INTEGER NOT NULL DEFAULT 0 CHECK(week_start BETWEEN 0 AND 6),
+		email_enabled INTEGER DEFAULT 0,
+		unsubscribe_token TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
 	-- Chat threads table
@@ -165,6 +340,17 @@ func runMigrations(db *sql.DB) error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Prompt template overrides (one row per saved version)
+	CREATE TABLE IF NOT EXISTS prompt_templates (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		template TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, name, version)
+	);
+
 	-- Indexes
 	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 	-- Note: idx_users_supabase_id is created in runDataMigrations after ensuring column exists
@@ -172,6 +358,16 @@ func runMigrations(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_todos_group_id ON todos(group_id);
 	CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(status);
 	CREATE INDEX IF NOT EXISTS idx_todos_position ON todos(position);
+	-- Note: idx_todos_series_occurrence and idx_todos_parent_id are created in runDataMigrations after ensuring columns exist
+	CREATE INDEX IF NOT EXISTS idx_todo_series_user_id ON todo_series(user_id);
+	CREATE INDEX IF NOT EXISTS idx_todo_dependencies_blocker_id ON todo_dependencies(blocker_id);
+	CREATE INDEX IF NOT EXISTS idx_todo_reminders_todo_id ON todo_reminders(todo_id);
+	CREATE INDEX IF NOT EXISTS idx_todo_reminders_due ON todo_reminders(status, fire_at);
+	CREATE INDEX IF NOT EXISTS idx_board_columns_group_id ON board_columns(user_id, group_id, position);
+	CREATE INDEX IF NOT EXISTS idx_time_entries_todo_id ON time_entries(todo_id);
+	CREATE INDEX IF NOT EXISTS idx_time_entries_user_id ON time_entries(user_id, started_at);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entries_running ON time_entries(user_id) WHERE ended_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user_id ON push_subscriptions(user_id);
 	CREATE INDEX IF NOT EXISTS idx_groups_user_id ON groups(user_id);
 	CREATE INDEX IF NOT EXISTS idx_groups_is_default ON groups(is_default);
 	CREATE INDEX IF NOT EXISTS idx_ai_providers_user_id ON ai_providers(user_id);
@@ -184,9 +380,12 @@ func runMigrations(db *sql.DB) error {
 	-- Note: idx_memories_position is created in runDataMigrations after ensuring column exists
 	CREATE INDEX IF NOT EXISTS idx_memory_categories_user_id ON memory_categories(user_id);
 	CREATE INDEX IF NOT EXISTS idx_memory_digests_user_id ON memory_digests(user_id);
+	CREATE INDEX IF NOT EXISTS idx_memory_reviews_due ON memory_reviews(user_id, learn, due_date);
+	CREATE INDEX IF NOT EXISTS idx_memory_review_log_memory_id ON memory_review_log(memory_id);
 	CREATE INDEX IF NOT EXISTS idx_chat_threads_user_id ON chat_threads(user_id);
 	CREATE INDEX IF NOT EXISTS idx_chat_messages_thread_id ON chat_messages(thread_id);
 	CREATE INDEX IF NOT EXISTS idx_chat_messages_created_at ON chat_messages(created_at);
+	CREATE INDEX IF NOT EXISTS idx_prompt_templates_user_id ON prompt_templates(user_id);
 	`
 
 	if _, err := db.Exec(schema); err != nil {
@@ -295,6 +494,250 @@ func runDataMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Check if ai_providers.vision_model column exists, add it if not.
+	// Runs before migrateAIProviderTypes, whose table copy includes the column.
+	var visionModelCount int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM pragma_table_info('ai_providers') WHERE name = 'vision_model'
+	`).Scan(&visionModelCount)
+	if err != nil {
+		return fmt.Errorf("failed to check for vision_model column: %w", err)
+	}
+
+	if visionModelCount == 0 {
+		if _, err := db.Exec(`
+			ALTER TABLE ai_providers ADD COLUMN vision_model TEXT;
+		`); err != nil {
+			return fmt.Errorf("failed to add vision_model column to ai_providers: %w", err)
+		}
+		log.Println("Added vision_model column to ai_providers table")
+	}
+
+	// Add model capability columns to ai_provider_models. Models cached before
+	// these existed read back as all-zero and are resolved from the built-in table.
+	capabilityColumns := []string{
+		"context_window",
+		"supports_vision",
+		"supports_tools",
+		"supports_json",
+		"supports_streaming",
+		"supports_embedding",
+	}
+	for _, column := range capabilityColumns {
+		var columnCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM pragma_table_info('ai_provider_models') WHERE name = ?
+		`, column).Scan(&columnCount)
+		if err != nil {
+			return fmt.Errorf("failed to check for %s column: %w", column, err)
+		}
+
+		if columnCount == 0 {
+			if _, err := db.Exec(fmt.Sprintf(`
+				ALTER TABLE ai_provider_models ADD COLUMN %s INTEGER DEFAULT 0;
+			`, column)); err != nil {
+				return fmt.Errorf("failed to add %s column to ai_provider_models: %w", column, err)
+			}
+			log.Printf("Added %s column to ai_provider_models table", column)
+		}
+	}
+
+	// Widen the ai_providers provider_type CHECK constraint for newer provider types
+	if err := migrateAIProviderTypes(db); err != nil {
+		return err
+	}
+
+	// Key digests by period so daily, weekly and monthly digests can share a start date
+	if err := migrateMemoryDigestPeriods(db); err != nil {
+		return err
+	}
+
+	// Add the structured todo and insight sections to memory_digests
+	var sectionsCount int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM pragma_table_info('memory_digests') WHERE name = 'sections'
+	`).Scan(&sectionsCount)
+	if err != nil {
+		return fmt.Errorf("failed to check for sections column: %w", err)
+	}
+
+	if sectionsCount == 0 {
+		if _, err := db.Exec(`
+			ALTER TABLE memory_digests ADD COLUMN sections TEXT;
+		`); err != nil {
+			return fmt.Errorf("failed to add sections column to memory_digests: %w", err)
+		}
+		log.Println("Added sections column to memory_digests table")
+	}
+
+	// Track when todos are completed so digests can report a period's completions
+	var completedAtCount int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM pragma_table_info('todos') WHERE name = 'completed_at'
+	`).Scan(&completedAtCount)
+	if err != nil {
+		return fmt.Errorf("failed to check for completed_at column: %w", err)
+	}
+
+	if completedAtCount == 0 {
+		if _, err := db.Exec(`
+			ALTER TABLE todos ADD COLUMN completed_at DATETIME;
+		`); err != nil {
+			return fmt.Errorf("failed to add completed_at column to todos: %w", err)
+		}
+
+		// The last update is the best guess for todos completed before the column existed
+		if _, err := db.Exec(`
+			UPDATE todos SET completed_at = updated_at WHERE status = 'completed';
+		`); err != nil {
+			return fmt.Errorf("failed to backfill completed_at for todos: %w", err)
+		}
+		log.Println("Added completed_at column to todos table")
+	}
+
+	// Link recurring todos to their series and subtasks to their parents, and
+	// remember the status automatically blocked todos go back to.
+	// Runs before migrateTodoStatuses, whose table copy includes the columns.
+	todoColumns := []struct{ name, definition string }{
+		{"series_id", "TEXT REFERENCES todo_series(id) ON DELETE SET NULL"},
+		{"occurrence", "TEXT"},
+		{"parent_id", "TEXT REFERENCES todos(id) ON DELETE CASCADE"},
+		{"auto_complete", "INTEGER DEFAULT 0"},
+		{"resume_status", "TEXT"},
+		{"ical_uid", "TEXT"},
+		{"estimate_minutes", "INTEGER"},
+		{"column_id", "TEXT REFERENCES board_columns(id) ON DELETE SET NULL"},
+		{"column_position", "INTEGER"},
+	}
+	for _, column := range todoColumns {
+		var columnCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM pragma_table_info('todos') WHERE name = ?
+		`, column.name).Scan(&columnCount)
+		if err != nil {
+			return fmt.Errorf("failed to check for %s column: %w", column.name, err)
+		}
+
+		if columnCount == 0 {
+			if _, err := db.Exec(fmt.Sprintf(`
+				ALTER TABLE todos ADD COLUMN %s %s;
+			`, column.name, column.definition)); err != nil {
+				return fmt.Errorf("failed to add %s column to todos: %w", column.name, err)
+			}
+			log.Printf("Added %s column to todos table", column.name)
+		}
+	}
+
+	// Each occurrence of a series is generated at most once
+	if _, err := db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_series_occurrence ON todos(series_id, occurrence) WHERE series_id IS NOT NULL;
+	`); err != nil {
+		return fmt.Errorf("failed to create series_occurrence index: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+	`); err != nil {
+		return fmt.Errorf("failed to create parent_id index: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_todos_column_id ON todos(column_id);
+	`); err != nil {
+		return fmt.Errorf("failed to create column_id index: %w", err)
+	}
+
+	// Todos imported from calendars keep their UID, so importing again doesn't duplicate them
+	if _, err := db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_ical_uid ON todos(user_id, ical_uid) WHERE ical_uid IS NOT NULL;
+	`); err != nil {
+		return fmt.Errorf("failed to create ical_uid index: %w", err)
+	}
+
+	// Widen the todos status CHECK constraint for the newer statuses
+	if err := migrateTodoStatuses(db); err != nil {
+		return err
+	}
+
+	// Give todos and memories fractional index keys in place of the integer
+	// positions they were ordered by
+	for _, list := range []struct{ table, order string }{
+		{"todos", "created_at ASC"},
+		{"memories", "created_at DESC"},
+	} {
+		if err := migratePositionKeys(db, list.table, list.order); err != nil {
+			return err
+		}
+	}
+
+	// Record todo changes for CalDAV sync. Created after migrateTodoStatuses,
+	// since rebuilding todos drops its triggers. Reordering isn't a change.
+	if _, err := db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_todo_changes_user_id ON todo_changes(user_id, seq);
+
+		CREATE TRIGGER IF NOT EXISTS todos_changes_ai AFTER INSERT ON todos BEGIN
+			INSERT INTO todo_changes (user_id, group_id, todo_id, uid)
+			VALUES (NEW.user_id, NEW.group_id, NEW.id, COALESCE(NEW.ical_uid, NEW.id || '@memlane'));
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS todos_changes_ad AFTER DELETE ON todos BEGIN
+			INSERT INTO todo_changes (user_id, group_id, todo_id, uid, deleted)
+			VALUES (OLD.user_id, OLD.group_id, OLD.id, COALESCE(OLD.ical_uid, OLD.id || '@memlane'), 1);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS todos_changes_au AFTER UPDATE OF
+			group_id, title, description, due_date, priority, status, tags, updated_at, completed_at, series_id, occurrence, parent_id
+		ON todos BEGIN
+			INSERT INTO todo_changes (user_id, group_id, todo_id, uid, deleted)
+			SELECT OLD.user_id, OLD.group_id, OLD.id, COALESCE(OLD.ical_uid, OLD.id || '@memlane'), 1
+			WHERE OLD.group_id IS NOT NEW.group_id;
+			INSERT INTO todo_changes (user_id, group_id, todo_id, uid)
+			VALUES (NEW.user_id, NEW.group_id, NEW.id, COALESCE(NEW.ical_uid, NEW.id || '@memlane'));
+		END;
+	`); err != nil {
+		return fmt.Errorf("failed to create todo change triggers: %w", err)
+	}
+
+	// Learnings and quotes are always marked to learn; this covers memories saved
+	// before reviews existed. Unmarked memories keep their row, so they stay unmarked.
+	if _, err := db.Exec(`
+		INSERT OR IGNORE INTO memory_reviews (memory_id, user_id, due_date)
+		SELECT id, user_id, date('now', 'localtime') FROM memories
+		WHERE category IN ('Learnings', 'Quotes')
+	`); err != nil {
+		return fmt.Errorf("failed to schedule learnings for review: %w", err)
+	}
+
+	// Add digest email opt-in columns to digest_settings
+	digestEmailColumns := []struct{ name, definition string }{
+		{"email_enabled", "INTEGER DEFAULT 0"},
+		{"unsubscribe_token", "TEXT"},
+	}
+	for _, column := range digestEmailColumns {
+		var columnCount int
+		err = db.QueryRow(`
+			SELECT COUNT(*) FROM pragma_table_info('digest_settings') WHERE name = ?
+		`, column.name).Scan(&columnCount)
+		if err != nil {
+			return fmt.Errorf("failed to check for %s column: %w", column.name, err)
+		}
+
+		if columnCount == 0 {
+			if _, err := db.Exec(fmt.Sprintf(`
+				ALTER TABLE digest_settings ADD COLUMN %s %s;
+			`, column.name, column.definition)); err != nil {
+				return fmt.Errorf("failed to add %s column to digest_settings: %w", column.name, err)
+			}
+			log.Printf("Added %s column to digest_settings table", column.name)
+		}
+	}
+
+	if _, err := db.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_digest_settings_unsubscribe_token ON digest_settings(unsubscribe_token) WHERE unsubscribe_token IS NOT NULL;
+	`); err != nil {
+		return fmt.Errorf("failed to create unsubscribe_token index: %w", err)
+	}
+
 	// Make password_hash nullable if it's not already (for Supabase users)
 	var passwordHashNullable int
 	err = db.QueryRow(`
@@ -419,3 +862,367 @@ func runDataMigrations(db *sql.DB) error {
 
 	return nil
 }
+
+// aiProviderTypes lists every provider_type allowed by the ai_providers CHECK constraint.
+// Keep in sync with the CREATE TABLE statement in runMigrations.
+var aiProviderTypes = []string{"openai", "anthropic", "google", "custom", "ollama", "mock"}
+
+// migrateAIProviderTypes rebuilds ai_providers when its CHECK constraint is missing
+// provider types. SQLite can't alter constraints, so the table is copied.
+func migrateAIProviderTypes(db *sql.DB) error {
+	var tableSQL string
+	err := db.QueryRow(`
+		SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'ai_providers'
+	`).Scan(&tableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to read ai_providers schema: %w", err)
+	}
+
+	missing := false
+	for _, providerType := range aiProviderTypes {
+		if !strings.Contains(tableSQL, "'"+providerType+"'") {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	log.Println("Migrating ai_providers table to allow new provider types...")
+
+	// Foreign keys must be off while the table is swapped, otherwise dropping
+	// ai_providers would cascade-delete ai_provider_models. The pragma is
+	// per-connection and a no-op inside a transaction, so pin one connection.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("failed to disable foreign keys: %w", err)
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	quoted := make([]string, len(aiProviderTypes))
+	for i, providerType := range aiProviderTypes {
+		quoted[i] = "'" + providerType + "'"
+	}
+
+	if _, err := tx.Exec(`
+		CREATE TABLE ai_providers_new (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			provider_type TEXT NOT NULL CHECK(provider_type IN (` + strings.Join(quoted, ", ") + `)),
+			base_url TEXT NOT NULL,
+			api_key_encrypted TEXT NOT NULL,
+			selected_model TEXT,
+			vision_model TEXT,
+			is_default INTEGER DEFAULT 0,
+			is_enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create new ai_providers table: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO ai_providers_new (id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at)
+		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at
+		FROM ai_providers
+	`); err != nil {
+		return fmt.Errorf("failed to copy ai_providers: %w", err)
+	}
+
+	if _, err := tx.Exec("DROP TABLE ai_providers"); err != nil {
+		return fmt.Errorf("failed to drop old ai_providers table: %w", err)
+	}
+
+	if _, err := tx.Exec("ALTER TABLE ai_providers_new RENAME TO ai_providers"); err != nil {
+		return fmt.Errorf("failed to rename ai_providers_new table: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_ai_providers_user_id ON ai_providers(user_id);
+		CREATE INDEX IF NOT EXISTS idx_ai_providers_is_default ON ai_providers(is_default);
+	`); err != nil {
+		return fmt.Errorf("failed to recreate ai_providers indexes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ai_providers migration: %w", err)
+	}
+
+	log.Println("Successfully migrated ai_providers provider types")
+	return nil
+}
+
+// migrateMemoryDigestPeriods rebuilds memory_digests with a period column and a
+// unique key that includes it. Existing digests were all weekly.
+func migrateMemoryDigestPeriods(db *sql.DB) error {
+	var periodCount int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM pragma_table_info('memory_digests') WHERE name = 'period'
+	`).Scan(&periodCount)
+	if err != nil {
+		return fmt.Errorf("failed to check for period column: %w", err)
+	}
+	if periodCount > 0 {
+		return nil
+	}
+
+	log.Println("Migrating memory_digests table to add digest periods...")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		CREATE TABLE memory_digests_new (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			period TEXT NOT NULL DEFAULT 'weekly' CHECK(period IN ('daily', 'weekly', 'monthly')),
+			week_start DATE NOT NULL,
+			week_end DATE NOT NULL,
+			digest_content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, period, week_start)
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create new memory_digests table: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO memory_digests_new (id, user_id, period, week_start, week_end, digest_content, created_at)
+		SELECT id, user_id, 'weekly', week_start, week_end, digest_content, created_at
+		FROM memory_digests
+	`); err != nil {
+		return fmt.Errorf("failed to copy memory_digests: %w", err)
+	}
+
+	if _, err := tx.Exec("DROP TABLE memory_digests"); err != nil {
+		return fmt.Errorf("failed to drop old memory_digests table: %w", err)
+	}
+
+	if _, err := tx.Exec("ALTER TABLE memory_digests_new RENAME TO memory_digests"); err != nil {
+		return fmt.Errorf("failed to rename memory_digests_new table: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_memory_digests_user_id ON memory_digests(user_id);
+	`); err != nil {
+		return fmt.Errorf("failed to recreate memory_digests indexes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit memory_digests migration: %w", err)
+	}
+
+	log.Println("Successfully migrated memory_digests periods")
+	return nil
+}
+
+// todoStatuses lists every status allowed by the todos CHECK constraint.
+// Keep in sync with the CREATE TABLE statement in runMigrations.
+var todoStatuses = []string{"pending", "in_progress", "blocked", "completed", "cancelled"}
+
+// migrateTodoStatuses rebuilds todos when its CHECK constraint is missing
+// statuses. SQLite can't alter constraints, so the table is copied.
+func migrateTodoStatuses(db *sql.DB) error {
+	var tableSQL string
+	err := db.QueryRow(`
+		SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'todos'
+	`).Scan(&tableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to read todos schema: %w", err)
+	}
+
+	missing := false
+	for _, status := range todoStatuses {
+		if !strings.Contains(tableSQL, "'"+status+"'") {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	log.Println("Migrating todos table to allow new statuses...")
+
+	// Foreign keys must be off while the table is swapped, otherwise dropping
+	// todos would cascade-delete subtasks and dependencies. The pragma is
+	// per-connection and a no-op inside a transaction, so pin one connection.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("failed to disable foreign keys: %w", err)
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	quoted := make([]string, len(todoStatuses))
+	for i, status := range todoStatuses {
+		quoted[i] = "'" + status + "'"
+	}
+
+	if _, err := tx.Exec(`
+		CREATE TABLE todos_new (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			group_id TEXT REFERENCES groups(id) ON DELETE SET NULL,
+			title TEXT NOT NULL,
+			description TEXT,
+			due_date DATETIME,
+			priority TEXT DEFAULT 'medium' CHECK(priority IN ('low', 'medium', 'high')),
+			status TEXT DEFAULT 'pending' CHECK(status IN (` + strings.Join(quoted, ", ") + `)),
+			position TEXT DEFAULT '1000',
+			tags TEXT DEFAULT '[]',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME,
+			series_id TEXT REFERENCES todo_series(id) ON DELETE SET NULL,
+			occurrence TEXT,
+			parent_id TEXT REFERENCES todos(id) ON DELETE CASCADE,
+			auto_complete INTEGER DEFAULT 0,
+			resume_status TEXT,
+			ical_uid TEXT,
+			estimate_minutes INTEGER,
+			column_id TEXT REFERENCES board_columns(id) ON DELETE SET NULL,
+			column_position INTEGER
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create new todos table: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO todos_new (id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at, completed_at, series_id, occurrence, parent_id, auto_complete, resume_status, ical_uid, estimate_minutes, column_id, column_position)
+		SELECT id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at, completed_at, series_id, occurrence, parent_id, auto_complete, resume_status, ical_uid, estimate_minutes, column_id, column_position
+		FROM todos
+	`); err != nil {
+		return fmt.Errorf("failed to copy todos: %w", err)
+	}
+
+	if _, err := tx.Exec("DROP TABLE todos"); err != nil {
+		return fmt.Errorf("failed to drop old todos table: %w", err)
+	}
+
+	if _, err := tx.Exec("ALTER TABLE todos_new RENAME TO todos"); err != nil {
+		return fmt.Errorf("failed to rename todos_new table: %w", err)
+	}
+
+	// Dropping the table also dropped the keyword search triggers, which are
+	// recreated when the FTS tables are initialized
+	if _, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_todos_user_id ON todos(user_id);
+		CREATE INDEX IF NOT EXISTS idx_todos_group_id ON todos(group_id);
+		CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(status);
+		CREATE INDEX IF NOT EXISTS idx_todos_position ON todos(position);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_series_occurrence ON todos(series_id, occurrence) WHERE series_id IS NOT NULL;
+		CREATE INDEX IF NOT EXISTS idx_todos_parent_id ON todos(parent_id);
+		CREATE INDEX IF NOT EXISTS idx_todos_column_id ON todos(column_id);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_ical_uid ON todos(user_id, ical_uid) WHERE ical_uid IS NOT NULL;
+	`); err != nil {
+		return fmt.Errorf("failed to recreate todos indexes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit todos migration: %w", err)
+	}
+
+	log.Println("Successfully migrated todos statuses")
+	return nil
+}
+
+// migratePositionKeys renumbers the lists of users whose todos or memories
+// still have integer positions (stringified multiples of 1000), which don't
+// sort as text. Keys never end in 0 or hold other characters, so those lists
+// are the ones with such positions. Each list keeps the order it had, with
+// ties broken by tiebreak.
+func migratePositionKeys(db *sql.DB, table, tiebreak string) error {
+	rows, err := db.Query(`
+		SELECT DISTINCT user_id FROM ` + table + `
+		WHERE position IS NULL OR position = '' OR position GLOB '*0' OR position GLOB '*[^0-9A-Za-z]*'
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find %s with integer positions: %w", table, err)
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	log.Printf("Migrating %s positions to fractional index keys for %d users...", table, len(userIDs))
+
+	for _, userID := range userIDs {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`
+			SELECT id FROM `+table+` WHERE user_id = ?
+			ORDER BY CAST(position AS INTEGER) ASC, `+tiebreak, userID)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to read %s positions: %w", table, err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		for i, position := range fracindex.Spread(len(ids)) {
+			if _, err := tx.Exec("UPDATE "+table+" SET position = ? WHERE id = ?", position, ids[i]); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to set %s position: %w", table, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit %s positions: %w", table, err)
+		}
+	}
+
+	log.Printf("Successfully migrated %s positions", table)
+	return nil
+}
@@ -0,0 +1,83 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// AnthropicServer fakes the Anthropic Messages API, including tool use.
+// Point a provider's base URL at URL.
+type AnthropicServer struct {
+	llmServer
+	URL string // base URL including /v1
+}
+
+func NewAnthropicServer() *AnthropicServer {
+	s := &AnthropicServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", s.handleMessages)
+
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL + "/v1"
+	return s
+}
+
+func (s *AnthropicServer) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-api-key") == "" {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"type":  "error",
+			"error": map[string]interface{}{"type": "authentication_error", "message": "missing x-api-key"},
+		})
+		return
+	}
+
+	req, reply := s.record(r, lastMessageText)
+	if reply.Status != 0 {
+		writeError(w, reply.Status)
+		return
+	}
+
+	// A forced tool choice (structured output) answers with that tool,
+	// using the scripted text as its JSON input
+	if choice, ok := req.Body["tool_choice"].(map[string]interface{}); ok && choice["type"] == "tool" && len(reply.ToolCalls) == 0 {
+		name, _ := choice["name"].(string)
+		var input map[string]interface{}
+		if err := json.Unmarshal([]byte(reply.Text), &input); err == nil {
+			reply.ToolCalls = []ToolCall{{Name: name, Arguments: input}}
+			reply.Text = ""
+		}
+	}
+
+	content := []map[string]interface{}{}
+	if reply.Text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": reply.Text})
+	}
+	for i, call := range reply.ToolCalls {
+		args := call.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    fmt.Sprintf("toolu_%d", i),
+			"name":  call.Name,
+			"input": args,
+		})
+	}
+
+	stopReason := "end_turn"
+	if len(reply.ToolCalls) > 0 {
+		stopReason = "tool_use"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":          "msg_fake",
+		"type":        "message",
+		"role":        "assistant",
+		"content":     content,
+		"stop_reason": stopReason,
+	})
+}
@@ -0,0 +1,54 @@
+package fakes
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/services"
+)
+
+// userSyncer maps verified claims to a local user (SupabaseAuthService implements it)
+type userSyncer interface {
+	SyncUserFromToken(claims *services.SupabaseClaims) (*models.User, error)
+}
+
+// AuthVerifier accepts tokens registered with AddUser instead of verifying
+// Supabase JWTs. Users are synced to the local database by the wrapped syncer,
+// so the rest of the auth flow runs unchanged.
+type AuthVerifier struct {
+	syncer userSyncer
+
+	mu     sync.Mutex
+	tokens map[string]*services.SupabaseClaims
+}
+
+func NewAuthVerifier(syncer userSyncer) *AuthVerifier {
+	return &AuthVerifier{
+		syncer: syncer,
+		tokens: make(map[string]*services.SupabaseClaims),
+	}
+}
+
+// AddUser registers a bearer token for a Supabase user ID and email
+func (v *AuthVerifier) AddUser(token, supabaseID, email string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens[token] = &services.SupabaseClaims{Sub: supabaseID, Email: email}
+}
+
+func (v *AuthVerifier) VerifyToken(tokenString string) (*services.SupabaseClaims, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	claims, ok := v.tokens[tokenString]
+	if !ok {
+		return nil, fmt.Errorf("unknown token")
+	}
+	copied := *claims
+	return &copied, nil
+}
+
+func (v *AuthVerifier) SyncUserFromToken(claims *services.SupabaseClaims) (*models.User, error) {
+	return v.syncer.SyncUserFromToken(claims)
+}
@@ -0,0 +1,106 @@
+package fakes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// FakeInputTokenLimit is the context window the Gemini model listing reports
+const FakeInputTokenLimit = 32768
+
+// GoogleServer fakes the Gemini generateContent API, including function calling.
+// Point a provider's base URL at URL.
+type GoogleServer struct {
+	llmServer
+	URL string // base URL including /v1beta
+}
+
+func NewGoogleServer() *GoogleServer {
+	s := &GoogleServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1beta/models", s.handleModels)
+	mux.HandleFunc("POST /v1beta/models/{action}", s.handleGenerate)
+
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL + "/v1beta"
+	return s
+}
+
+func (s *GoogleServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("key") == "" {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	modelList := []map[string]interface{}{}
+	for _, id := range s.modelList() {
+		modelList = append(modelList, map[string]interface{}{
+			"name":                       "models/" + id,
+			"inputTokenLimit":            FakeInputTokenLimit,
+			"supportedGenerationMethods": []string{"generateContent"},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"models": modelList})
+}
+
+func (s *GoogleServer) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.PathValue("action"), ":generateContent") {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("key") == "" {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	_, reply := s.record(r, googlePromptText)
+	if reply.Status != 0 {
+		writeError(w, reply.Status)
+		return
+	}
+
+	parts := []map[string]interface{}{}
+	if reply.Text != "" {
+		parts = append(parts, map[string]interface{}{"text": reply.Text})
+	}
+	for _, call := range reply.ToolCalls {
+		args := call.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		parts = append(parts, map[string]interface{}{
+			"functionCall": map[string]interface{}{"name": call.Name, "args": args},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"candidates": []map[string]interface{}{
+			{
+				"content":      map[string]interface{}{"role": "model", "parts": parts},
+				"finishReason": "STOP",
+			},
+		},
+	})
+}
+
+// googlePromptText joins the text parts of the last entry in contents
+func googlePromptText(body map[string]interface{}) string {
+	contents, _ := body["contents"].([]interface{})
+	if len(contents) == 0 {
+		return ""
+	}
+	content, _ := contents[len(contents)-1].(map[string]interface{})
+	partList, _ := content["parts"].([]interface{})
+
+	var texts []string
+	for _, part := range partList {
+		if p, ok := part.(map[string]interface{}); ok {
+			if text, ok := p["text"].(string); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,169 @@
+// Package fakes provides in-process HTTP fakes of the external APIs the backend
+// talks to (OpenAI-compatible, Anthropic, Google Gemini, NVIDIA NIM embeddings,
+// SearXNG) and a fake auth verifier, so handlers and services can be exercised
+// end to end without network access.
+package fakes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// DefaultReply is returned by the LLM fakes when no scripted reply matches a prompt
+const DefaultReply = "fake response"
+
+// Reply is one scripted model response. Replies are checked in the order they were
+// added and the first whose Match text appears in the prompt answers it.
+type Reply struct {
+	Match     string     // substring the prompt must contain; empty matches every prompt
+	Text      string     // text content of the response
+	ToolCalls []ToolCall // function calls returned instead of (or alongside) text
+	Status    int        // non-zero returns this HTTP status with an error body
+	Times     int        // how many requests this reply answers; 0 means unlimited
+
+	used int
+}
+
+// ToolCall is a scripted function call
+type ToolCall struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Request is a request received by an LLM fake
+type Request struct {
+	Path   string
+	Prompt string                 // text of the last user message
+	Body   map[string]interface{} // decoded JSON body
+}
+
+// llmServer holds the reply script and request log shared by the provider fakes
+type llmServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	replies  []*Reply
+	requests []Request
+	models   []string
+}
+
+// Reply adds scripted replies
+func (s *llmServer) Reply(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range replies {
+		reply := replies[i]
+		s.replies = append(s.replies, &reply)
+	}
+}
+
+// SetModels sets the model IDs returned by the models endpoint
+func (s *llmServer) SetModels(models ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = models
+}
+
+// Requests returns the generation requests received so far, oldest first
+func (s *llmServer) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Prompts returns the prompts received so far, oldest first
+func (s *llmServer) Prompts() []string {
+	requests := s.Requests()
+	prompts := make([]string, len(requests))
+	for i, req := range requests {
+		prompts[i] = req.Prompt
+	}
+	return prompts
+}
+
+func (s *llmServer) modelList() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.models) == 0 {
+		return []string{"fake-model"}
+	}
+	return append([]string(nil), s.models...)
+}
+
+// record decodes a generation request, logs it and returns the reply that answers it
+func (s *llmServer) record(r *http.Request, prompt func(body map[string]interface{}) string) (Request, Reply) {
+	data, _ := io.ReadAll(r.Body)
+	var body map[string]interface{}
+	json.Unmarshal(data, &body)
+
+	req := Request{Path: r.URL.Path, Body: body, Prompt: prompt(body)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	for _, reply := range s.replies {
+		if reply.Times > 0 && reply.used >= reply.Times {
+			continue
+		}
+		if reply.Match != "" && !strings.Contains(req.Prompt, reply.Match) {
+			continue
+		}
+		reply.used++
+		return req, *reply
+	}
+	return req, Reply{Text: DefaultReply}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": http.StatusText(status),
+			"type":    "fake_error",
+		},
+	})
+}
+
+// lastMessageText returns the text of the last entry in a messages array
+// (OpenAI and Anthropic request format)
+func lastMessageText(body map[string]interface{}) string {
+	messages, _ := body["messages"].([]interface{})
+	if len(messages) == 0 {
+		return ""
+	}
+	message, _ := messages[len(messages)-1].(map[string]interface{})
+	switch content := message["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		// Multimodal content: join the text parts
+		var parts []string
+		for _, part := range content {
+			if p, ok := part.(map[string]interface{}); ok {
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+func argumentsJSON(args map[string]interface{}) string {
+	if args == nil {
+		return "{}"
+	}
+	data, _ := json.Marshal(args)
+	return string(data)
+}
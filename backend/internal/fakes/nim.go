@@ -0,0 +1,107 @@
+package fakes
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NIMServer fakes the NVIDIA NIM embeddings API. Embeddings are a hashed bag of
+// words, so texts that share words are close and results are deterministic.
+type NIMServer struct {
+	*httptest.Server
+	URL       string // base URL including /v1
+	Dimension int
+
+	mu     sync.Mutex
+	inputs []string
+}
+
+func NewNIMServer(dimension int) *NIMServer {
+	s := &NIMServer{Dimension: dimension}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /v1/embeddings", s.handleEmbeddings)
+
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL + "/v1"
+	return s
+}
+
+// Inputs returns the texts embedded so far, oldest first
+func (s *NIMServer) Inputs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.inputs...)
+}
+
+func (s *NIMServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": []map[string]interface{}{{"id": "nvidia/nv-embedqa-e5-v5"}},
+	})
+}
+
+func (s *NIMServer) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Model     string `json:"model"`
+		Input     string `json:"input"`
+		InputType string `json:"input_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Input == "" {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.inputs = append(s.inputs, req.Input)
+	s.mu.Unlock()
+
+	tokens := len(strings.Fields(req.Input))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"model":  req.Model,
+		"data": []map[string]interface{}{
+			{"object": "embedding", "index": 0, "embedding": HashEmbedding(req.Input, s.Dimension)},
+		},
+		"usage": map[string]interface{}{"prompt_tokens": tokens, "total_tokens": tokens},
+	})
+}
+
+// HashEmbedding returns a normalized bag-of-words vector for text
+func HashEmbedding(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vector[h.Sum32()%uint32(dimension)]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v * v)
+	}
+	if norm == 0 {
+		vector[0] = 1
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
@@ -0,0 +1,75 @@
+package fakes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// OpenAIServer fakes an OpenAI-compatible API (chat completions with tool calls, model listing).
+// Point a provider's base URL at URL.
+type OpenAIServer struct {
+	llmServer
+	URL string // base URL including /v1
+}
+
+func NewOpenAIServer() *OpenAIServer {
+	s := &OpenAIServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
+
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL + "/v1"
+	return s
+}
+
+func (s *OpenAIServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	data := []map[string]interface{}{}
+	for _, id := range s.modelList() {
+		data = append(data, map[string]interface{}{"id": id, "object": "model"})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": data})
+}
+
+func (s *OpenAIServer) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	_, reply := s.record(r, lastMessageText)
+	if reply.Status != 0 {
+		writeError(w, reply.Status)
+		return
+	}
+
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": reply.Text,
+	}
+	finishReason := "stop"
+
+	if len(reply.ToolCalls) > 0 {
+		toolCalls := make([]map[string]interface{}, 0, len(reply.ToolCalls))
+		for i, call := range reply.ToolCalls {
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   fmt.Sprintf("call_%d", i),
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      call.Name,
+					"arguments": argumentsJSON(call.Arguments),
+				},
+			})
+		}
+		message["tool_calls"] = toolCalls
+		if reply.Text == "" {
+			message["content"] = nil
+		}
+		finishReason = "tool_calls"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":     "chatcmpl-fake",
+		"object": "chat.completion",
+		"choices": []map[string]interface{}{
+			{"index": 0, "message": message, "finish_reason": finishReason},
+		},
+	})
+}
@@ -0,0 +1,183 @@
+package fakes
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// PushSubscription is a subscription as a browser would hand it to the app
+type PushSubscription struct {
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// PushMessage is a message received by PushServer, decrypted with the keys of
+// the subscription it was sent to
+type PushMessage struct {
+	Endpoint      string
+	Authorization string
+	Payload       []byte
+}
+
+type pushSubscriber struct {
+	key     *ecdh.PrivateKey
+	auth    []byte
+	expired bool
+}
+
+// PushServer fakes a Web Push service. Subscribe creates browser-side keys,
+// and messages sent to their endpoints are decrypted as a browser would
+// (RFC 8291 aes128gcm), so the encryption is checked end to end.
+type PushServer struct {
+	*httptest.Server
+	URL string
+
+	mu          sync.Mutex
+	subscribers map[string]*pushSubscriber
+	messages    []PushMessage
+}
+
+func NewPushServer() *PushServer {
+	s := &PushServer{subscribers: make(map[string]*pushSubscriber)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.Server.URL
+	return s
+}
+
+// Subscribe creates a subscription with fresh keys
+func (s *PushServer) Subscribe() PushSubscription {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		panic("fakes: failed to generate push key: " + err.Error())
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	endpoint := s.URL + "/push/" + uuid.New().String()
+	s.mu.Lock()
+	s.subscribers[endpoint] = &pushSubscriber{key: key, auth: auth}
+	s.mu.Unlock()
+
+	return PushSubscription{
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     base64.RawURLEncoding.EncodeToString(auth),
+	}
+}
+
+// Expire makes the push service answer 410 Gone for a subscription, as it does
+// once a browser unsubscribes
+func (s *PushServer) Expire(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub := s.subscribers[endpoint]; sub != nil {
+		sub.expired = true
+	}
+}
+
+// Messages returns the messages delivered so far, oldest first
+func (s *PushServer) Messages() []PushMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PushMessage(nil), s.messages...)
+}
+
+func (s *PushServer) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := s.URL + r.URL.Path
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := s.subscribers[endpoint]
+	switch {
+	case sub == nil:
+		writeError(w, http.StatusNotFound)
+		return
+	case sub.expired:
+		writeError(w, http.StatusGone)
+		return
+	case r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" ||
+		!strings.HasPrefix(r.Header.Get("Authorization"), "vapid t="):
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	payload, err := decryptPush(sub, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+	s.messages = append(s.messages, PushMessage{
+		Endpoint:      endpoint,
+		Authorization: r.Header.Get("Authorization"),
+		Payload:       payload,
+	})
+	w.WriteHeader(http.StatusCreated)
+}
+
+// decryptPush reverses the aes128gcm encryption of a single-record message
+func decryptPush(sub *pushSubscriber, body []byte) ([]byte, error) {
+	if len(body) < 21 || len(body) < 21+int(body[20]) {
+		return nil, errors.New("short message")
+	}
+	salt, idLen := body[:16], int(body[20])
+	serverKey, ciphertext := body[21:21+idLen], body[21+idLen:]
+
+	serverPublic, err := ecdh.P256().NewPublicKey(serverKey)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := sub.key.ECDH(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(sub.key.PublicKey().Bytes()) + string(serverKey)
+	ikm, err := hkdf.Key(sha256.New, shared, sub.auth, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Strip the padding and the last-record delimiter
+	plaintext = []byte(strings.TrimRight(string(plaintext), "\x00"))
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		return nil, errors.New("missing record delimiter")
+	}
+	return plaintext[:len(plaintext)-1], nil
+}
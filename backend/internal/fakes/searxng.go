@@ -0,0 +1,119 @@
+package fakes
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Page is a web page served by SearXNGServer. Pages double as search results.
+type Page struct {
+	Path    string // served at URL + Path
+	Title   string
+	Snippet string // search result content
+	Body    string // page body text, wrapped in <p> tags
+	Match   string // returned by searches whose query contains this (case-insensitive); empty matches every query
+	Status  int    // non-zero serves the page with this HTTP status
+}
+
+// SearXNGServer fakes a SearXNG instance's JSON search API and serves the
+// pages its results link to, so search and scraping can be tested together
+type SearXNGServer struct {
+	*httptest.Server
+	URL string
+
+	mu      sync.Mutex
+	pages   []Page
+	queries []string
+}
+
+func NewSearXNGServer() *SearXNGServer {
+	s := &SearXNGServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /", s.handlePage)
+
+	s.Server = httptest.NewServer(mux)
+	s.URL = s.Server.URL
+	return s
+}
+
+// AddPage serves a page and returns its URL
+func (s *SearXNGServer) AddPage(page Page) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = append(s.pages, page)
+	return s.URL + page.Path
+}
+
+// Queries returns the search queries received so far, oldest first
+func (s *SearXNGServer) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *SearXNGServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if r.URL.Query().Get("format") != "json" {
+		writeError(w, http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	results := []map[string]interface{}{}
+	for _, page := range s.pages {
+		if page.Match != "" && !strings.Contains(strings.ToLower(query), strings.ToLower(page.Match)) {
+			continue
+		}
+		results = append(results, map[string]interface{}{
+			"title":   page.Title,
+			"url":     s.URL + page.Path,
+			"content": page.Snippet,
+		})
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query,
+		"results": results,
+	})
+}
+
+func (s *SearXNGServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var found *Page
+	for i := range s.pages {
+		if s.pages[i].Path == r.URL.Path {
+			found = &s.pages[i]
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if found.Status != 0 {
+		http.Error(w, http.StatusText(found.Status), found.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<title>%s</title>
+<meta name="description" content="%s">
+</head>
+<body>
+<main><p>%s</p></main>
+</body>
+</html>`, html.EscapeString(found.Title), html.EscapeString(found.Snippet), html.EscapeString(found.Body))
+}
@@ -0,0 +1,175 @@
+package fakes
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// SMTPMessage is a message received by SMTPServer
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string // raw message, headers included
+}
+
+// Header returns a header of the message
+func (m SMTPMessage) Header(key string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	return msg.Header.Get(key)
+}
+
+// Body returns the decoded body part with the given media type (e.g. "text/html"),
+// looking inside multipart messages
+func (m SMTPMessage) Body(mediaType string) string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	contentType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "multipart/") {
+		if contentType == mediaType {
+			return decodePart(msg.Body, msg.Header.Get("Content-Transfer-Encoding"))
+		}
+		return ""
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			return ""
+		}
+		if partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type")); partType == mediaType {
+			return decodePart(part, part.Header.Get("Content-Transfer-Encoding"))
+		}
+	}
+}
+
+func decodePart(r io.Reader, encoding string) string {
+	if strings.EqualFold(encoding, "quoted-printable") {
+		r = quotedprintable.NewReader(r)
+	}
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+// SMTPServer is a minimal local SMTP server that accepts every message and keeps
+// it for inspection. It offers neither STARTTLS nor AUTH, so clients must be
+// configured without credentials.
+type SMTPServer struct {
+	Host string
+	Port int
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []SMTPMessage
+}
+
+func NewSMTPServer() *SMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("fakes: failed to listen for SMTP: " + err.Error())
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &SMTPServer{
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		listener: listener,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Messages returns the messages received so far, oldest first
+func (s *SMTPServer) Messages() []SMTPMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMTPMessage(nil), s.messages...)
+}
+
+func (s *SMTPServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *SMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *SMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP ready")
+
+	var current SMTPMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 fake")
+		case "MAIL":
+			current = SMTPMessage{From: addressArg(arg)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, addressArg(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(bufio.NewReader(tp.DotReader()))
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK: queued")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// addressArg extracts the address from "FROM:<a@b>" or "TO:<a@b>"
+func addressArg(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
@@ -0,0 +1,60 @@
+package fakes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// WebhookRequest is a request received by WebhookServer
+type WebhookRequest struct {
+	Header http.Header
+	Body   []byte
+}
+
+// WebhookServer receives webhook deliveries and keeps them for inspection. It
+// can be told to fail, to test retries.
+type WebhookServer struct {
+	*httptest.Server
+	URL string
+
+	mu       sync.Mutex
+	requests []WebhookRequest
+	failures int
+}
+
+func NewWebhookServer() *WebhookServer {
+	s := &WebhookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.Server.URL
+	return s
+}
+
+// FailNext answers the next n requests with 500 Internal Server Error
+func (s *WebhookServer) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+// Requests returns the requests answered successfully so far, oldest first
+func (s *WebhookServer) Requests() []WebhookRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WebhookRequest(nil), s.requests...)
+}
+
+func (s *WebhookServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		writeError(w, http.StatusInternalServerError)
+		return
+	}
+	s.requests = append(s.requests, WebhookRequest{Header: r.Header.Clone(), Body: body})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+// Package fracindex generates fractional index keys: strings that sort in list
+// order, where a key can always be made between any two others. Moving an
+// item only rewrites its own key, never its neighbours'.
+//
+// Keys are strings of base-62 digits (0-9, A-Z, a-z), read as the fraction
+// after a radix point, so "V" is about half and "0V" about a sixty-fourth.
+// They compare with plain byte order, as SQLite compares TEXT. A key never
+// ends in 0, since "V0" would be the same fraction as "V" and leave no room
+// between them.
+package fracindex
+
+import (
+	"errors"
+	"strings"
+)
+
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// ErrOrder is returned when asked for a key between two that aren't in order
+var ErrOrder = errors.New("fracindex: keys out of order")
+
+// ErrInvalidKey is returned for keys with other characters or a trailing 0
+var ErrInvalidKey = errors.New("fracindex: invalid key")
+
+func digit(c byte) int {
+	return strings.IndexByte(digits, c)
+}
+
+// Valid reports whether key is a key this package could have made
+func Valid(key string) bool {
+	if key == "" || key[len(key)-1] == digits[0] {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if digit(key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Between returns a short key sorting after a and before b. An empty a means
+// the start of the list and an empty b its end, so Between("", "") is the key
+// of the only item in a list.
+func Between(a, b string) (string, error) {
+	if (a != "" && !Valid(a)) || (b != "" && !Valid(b)) {
+		return "", ErrInvalidKey
+	}
+	switch {
+	case a == "" && b == "":
+		return string(digits[base/2]), nil
+	case b == "":
+		return after(a), nil
+	case a == "":
+		return before(b), nil
+	case a >= b:
+		return "", ErrOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// after returns a key after a, which is not empty. Keys grow by a digit only
+// once their first digit runs out, so items appended one by one keep short
+// keys until the list is rebalanced.
+func after(a string) string {
+	if d := digit(a[0]); d < base-1 {
+		return string(digits[d+1])
+	}
+	if len(a) == 1 {
+		return a + digits[1:2]
+	}
+	return a[:1] + after(a[1:])
+}
+
+// before returns a key before b, which is valid and so has room before it
+func before(b string) string {
+	if b == "" {
+		return string(digits[base/2])
+	}
+	if d := digit(b[0]); d > 1 {
+		return string(digits[d-1])
+	}
+	if b[0] == digits[1] {
+		return digits[:1] + string(digits[base/2])
+	}
+	return b[:1] + before(b[1:])
+}
+
+// midpoint returns a key between a and b, where a < b and a may be empty
+func midpoint(a, b string) string {
+	// Skip the digits a and b share, reading a missing digit of a as 0
+	n := 0
+	for n < len(b) {
+		c := digits[0]
+		if n < len(a) {
+			c = a[n]
+		}
+		if c != b[n] {
+			break
+		}
+		n++
+	}
+	if n > 0 {
+		rest := ""
+		if n < len(a) {
+			rest = a[n:]
+		}
+		return b[:n] + midpoint(rest, b[n:])
+	}
+
+	da, db := 0, digit(b[0])
+	if a != "" {
+		da = digit(a[0])
+	}
+	if db-da > 1 {
+		return string(digits[(da+db)/2])
+	}
+	// The first digits are adjacent: b's first digit alone fits when b has
+	// more after it, else keep a's and go after the rest of a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	if len(a) > 1 {
+		return a[:1] + after(a[1:])
+	}
+	return string(digits[da]) + string(digits[base/2])
+}
+
+// Spread returns n keys in order, evenly spaced and as short as n allows
+// while leaving room to insert between them. It is used to rebalance a list
+// whose keys have grown long.
+func Spread(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	// Use one digit more than n needs, so each gap fits a digit's worth of
+	// inserts before keys grow
+	length, capacity := 1, uint64(base)
+	for capacity < uint64(n+1)*uint64(base) && length < 10 {
+		length++
+		capacity *= uint64(base)
+	}
+	step := capacity / uint64(n+1)
+
+	keys := make([]string, n)
+	buf := make([]byte, length)
+	for i := range keys {
+		value := step * uint64(i+1)
+		for j := length - 1; j >= 0; j-- {
+			buf[j] = digits[value%uint64(base)]
+			value /= uint64(base)
+		}
+		keys[i] = strings.TrimRight(string(buf), digits[:1])
+	}
+	return keys
+}
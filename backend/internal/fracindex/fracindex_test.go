@@ -0,0 +1,106 @@
+package fracindex
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"", "", "V"},
+		{"V", "", "W"},
+		{"z", "", "z1"},
+		{"zz", "", "zz1"},
+		{"", "V", "U"},
+		{"", "1", "0V"},
+		{"", "01", "00V"},
+		{"A", "C", "B"},
+		{"A", "B", "AV"},
+		{"1", "101", "100V"},
+		{"Az", "B", "Az1"},
+		{"V", "V1", "V0V"},
+	}
+
+	for _, tt := range tests {
+		got, err := Between(tt.a, tt.b)
+		if err != nil {
+			t.Fatalf("between %q and %q: %v", tt.a, tt.b, err)
+		}
+		if got != tt.want {
+			t.Errorf("between %q and %q: expected %q, got %q", tt.a, tt.b, tt.want, got)
+		}
+	}
+
+	if _, err := Between("B", "A"); err != ErrOrder {
+		t.Errorf("expected keys out of order to fail, got %v", err)
+	}
+	if _, err := Between("1000", ""); err != ErrInvalidKey {
+		t.Errorf("expected a trailing 0 to fail, got %v", err)
+	}
+	if _, err := Between("", "a-b"); err != ErrInvalidKey {
+		t.Errorf("expected other characters to fail, got %v", err)
+	}
+}
+
+func TestBetweenKeepsOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	keys := []string{}
+	for i := 0; i < 2000; i++ {
+		at := rng.Intn(len(keys) + 1)
+		a, b := "", ""
+		if at > 0 {
+			a = keys[at-1]
+		}
+		if at < len(keys) {
+			b = keys[at]
+		}
+		key, err := Between(a, b)
+		if err != nil {
+			t.Fatalf("between %q and %q: %v", a, b, err)
+		}
+		if !Valid(key) || (a != "" && key <= a) || (b != "" && key >= b) {
+			t.Fatalf("between %q and %q: got %q", a, b, key)
+		}
+		keys = append(keys[:at], append([]string{key}, keys[at:]...)...)
+	}
+}
+
+func TestAppendingStaysShort(t *testing.T) {
+	key := ""
+	for i := 0; i < 1000; i++ {
+		next, err := Between(key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = next
+	}
+	if len(key) > 20 {
+		t.Errorf("expected appended keys to stay short, got %q", key)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	for _, n := range []int{1, 2, 61, 62, 1000, 100000} {
+		keys := Spread(n)
+		if len(keys) != n {
+			t.Fatalf("spread %d: got %d keys", n, len(keys))
+		}
+		if !sort.StringsAreSorted(keys) {
+			t.Fatalf("spread %d: keys out of order", n)
+		}
+		for i, key := range keys {
+			if !Valid(key) || (i > 0 && key == keys[i-1]) {
+				t.Fatalf("spread %d: bad key %q", n, key)
+			}
+		}
+		if n == 1 && keys[0] != "V" {
+			t.Errorf("expected a lone key in the middle, got %q", keys[0])
+		}
+	}
+	if got := len(Spread(1000)[999]); got > 3 {
+		t.Errorf("expected spread keys of 3 digits for 1000 items, got %d", got)
+	}
+}
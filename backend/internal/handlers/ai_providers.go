@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/todomyday/backend/internal/middleware"
@@ -75,6 +78,10 @@ func (h *AIProviderHandler) Update(c *gin.Context) {
 	}
 
 	provider, err := h.service.Update(id, userID, &input)
+	if errors.Is(err, services.ErrVisionNotSupported) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -140,3 +147,49 @@ func (h *AIProviderHandler) GetModels(c *gin.Context) {
 
 	c.JSON(http.StatusOK, providerModels)
 }
+
+// PullModel downloads a model onto an Ollama provider's server
+func (h *AIProviderHandler) PullModel(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	id := c.Param("id")
+	var input models.PullModelRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Pulls can take minutes for large models
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Minute)
+	defer cancel()
+
+	providerModels, err := h.service.PullModel(ctx, id, userID, input.Model)
+	if errors.Is(err, services.ErrProviderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrModelPullNotSupported) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if providerModels == nil {
+		providerModels = []models.AIProviderModel{}
+	}
+
+	c.JSON(http.StatusOK, providerModels)
+}
+
+// GetStats returns the user's structured output counters for each model and response cache usage
+func (h *AIProviderHandler) GetStats(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"structured_output": services.GetStructuredOutputStats(userID),
+		"response_cache":    services.GetResponseCacheStats(),
+	})
+}
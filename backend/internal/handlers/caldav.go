@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/caldav"
+	"github.com/todomyday/backend/internal/middleware"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/services"
+)
+
+// maxDAVResource is the largest todo a CalDAV client may PUT
+const maxDAVResource = 1 << 20
+
+// davBase is where the CalDAV routes are mounted
+const davBase = "/caldav"
+
+// Properties served to CalDAV clients
+var (
+	davResourceType       = xml.Name{Space: caldav.NSDAV, Local: "resourcetype"}
+	davDisplayName        = xml.Name{Space: caldav.NSDAV, Local: "displayname"}
+	davCurrentPrincipal   = xml.Name{Space: caldav.NSDAV, Local: "current-user-principal"}
+	davPrincipalURL       = xml.Name{Space: caldav.NSDAV, Local: "principal-URL"}
+	davOwner              = xml.Name{Space: caldav.NSDAV, Local: "owner"}
+	davPrivilegeSet       = xml.Name{Space: caldav.NSDAV, Local: "current-user-privilege-set"}
+	davSupportedReports   = xml.Name{Space: caldav.NSDAV, Local: "supported-report-set"}
+	davSyncToken          = xml.Name{Space: caldav.NSDAV, Local: "sync-token"}
+	davETag               = xml.Name{Space: caldav.NSDAV, Local: "getetag"}
+	davContentType        = xml.Name{Space: caldav.NSDAV, Local: "getcontenttype"}
+	davCalendarHome       = xml.Name{Space: caldav.NSCalDAV, Local: "calendar-home-set"}
+	davCalendarAddresses  = xml.Name{Space: caldav.NSCalDAV, Local: "calendar-user-address-set"}
+	davComponentSet       = xml.Name{Space: caldav.NSCalDAV, Local: "supported-calendar-component-set"}
+	davCalendarData       = xml.Name{Space: caldav.NSCalDAV, Local: "calendar-data"}
+	davCTag               = xml.Name{Space: caldav.NSCalendarServer, Local: "getctag"}
+	davCalendarColor      = xml.Name{Space: caldav.NSApple, Local: "calendar-color"}
+	davValidSyncToken     = xml.Name{Space: caldav.NSDAV, Local: "valid-sync-token"}
+	davValidCalendarData  = xml.Name{Space: caldav.NSCalDAV, Local: "valid-calendar-data"}
+	davValidCalendarEntry = xml.Name{Space: caldav.NSCalDAV, Local: "valid-calendar-object-resource"}
+	davNoUIDConflict      = xml.Name{Space: caldav.NSCalDAV, Local: "no-uid-conflict"}
+	davNeedPrivileges     = xml.Name{Space: caldav.NSDAV, Local: "need-privileges"}
+)
+
+type CalDAVHandler struct {
+	caldavService *services.CalDAVService
+}
+
+func NewCalDAVHandler(caldavService *services.CalDAVService) *CalDAVHandler {
+	return &CalDAVHandler{
+		caldavService: caldavService,
+	}
+}
+
+// GetCredentials returns the user's CalDAV URL and username, or null if they
+// haven't created an app password
+func (h *CalDAVHandler) GetCredentials(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	credentials, err := h.caldavService.GetCredentials(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch CalDAV credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"credentials": credentials,
+	})
+}
+
+// CreatePassword creates an app password, replacing the old one. The
+// response is the only time the password is shown.
+func (h *CalDAVHandler) CreatePassword(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	credentials, err := h.caldavService.CreatePassword(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create CalDAV password"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"credentials": credentials,
+	})
+}
+
+// DeleteCredentials signs out all of the user's CalDAV clients
+func (h *CalDAVHandler) DeleteCredentials(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	ok, err := h.caldavService.DeleteCredentials(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete CalDAV credentials"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "CalDAV credentials not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "CalDAV credentials deleted successfully",
+	})
+}
+
+// WellKnown points clients looking for the CalDAV service at it (RFC 6764)
+func (h *CalDAVHandler) WellKnown(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, davBase+"/")
+}
+
+// Options advertises CalDAV support. It doesn't need a password.
+func (h *CalDAVHandler) Options(c *gin.Context) {
+	c.Header("DAV", "1, 3, calendar-access")
+	c.Header("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, PROPPATCH, REPORT")
+	c.Status(http.StatusOK)
+}
+
+type davKind int
+
+const (
+	davRoot davKind = iota
+	davPrincipal
+	davHome
+	davCollection
+	davResource
+)
+
+// davTarget is what a CalDAV path points to
+type davTarget struct {
+	kind       davKind
+	collection string
+	name       string
+}
+
+// target reads the request's path, which only reaches the signed-in user's
+// principal and calendars
+func (h *CalDAVHandler) target(c *gin.Context) (davTarget, bool) {
+	userID := middleware.GetUserID(c)
+	p := strings.Trim(c.Param("path"), "/")
+	if p == "" {
+		return davTarget{kind: davRoot}, true
+	}
+	segments := strings.Split(p, "/")
+	if len(segments) < 2 || segments[1] != userID {
+		return davTarget{}, false
+	}
+	switch {
+	case segments[0] == "principals" && len(segments) == 2:
+		return davTarget{kind: davPrincipal}, true
+	case segments[0] == "calendars" && len(segments) == 2:
+		return davTarget{kind: davHome}, true
+	case segments[0] == "calendars" && len(segments) == 3:
+		return davTarget{kind: davCollection, collection: segments[2]}, true
+	case segments[0] == "calendars" && len(segments) == 4:
+		return davTarget{kind: davResource, collection: segments[2], name: segments[3]}, true
+	}
+	return davTarget{}, false
+}
+
+func principalHref(userID string) string {
+	return davBase + "/principals/" + url.PathEscape(userID) + "/"
+}
+
+func homeHref(userID string) string {
+	return davBase + "/calendars/" + url.PathEscape(userID) + "/"
+}
+
+func collectionHref(userID, collectionID string) string {
+	return homeHref(userID) + url.PathEscape(collectionID) + "/"
+}
+
+func resourceHref(userID, collectionID, name string) string {
+	return collectionHref(userID, collectionID) + url.PathEscape(name)
+}
+
+func principalProps(user *models.User) []caldav.Property {
+	displayName := user.Email
+	if user.FullName != nil && *user.FullName != "" {
+		displayName = *user.FullName
+	}
+	return []caldav.Property{
+		{Name: davResourceType, Inner: caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "principal"}, "")},
+		caldav.Text(davDisplayName, displayName),
+		caldav.Hrefs(davCurrentPrincipal, principalHref(user.ID)),
+		caldav.Hrefs(davPrincipalURL, principalHref(user.ID)),
+		caldav.Hrefs(davCalendarHome, homeHref(user.ID)),
+		caldav.Hrefs(davCalendarAddresses, "mailto:"+user.Email),
+	}
+}
+
+func homeProps(userID string) []caldav.Property {
+	return []caldav.Property{
+		{Name: davResourceType, Inner: caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "collection"}, "")},
+		caldav.Text(davDisplayName, "Memlane"),
+		caldav.Hrefs(davCurrentPrincipal, principalHref(userID)),
+		caldav.Hrefs(davOwner, principalHref(userID)),
+	}
+}
+
+func collectionProps(userID string, collection *services.DAVCollection) []caldav.Property {
+	privileges := ""
+	for _, privilege := range []string{"read", "write", "write-content", "bind", "unbind", "read-current-user-privilege-set"} {
+		privileges += caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "privilege"}, caldav.Element(xml.Name{Space: caldav.NSDAV, Local: privilege}, ""))
+	}
+	reports := ""
+	for _, report := range []xml.Name{caldav.CalendarQuery, caldav.CalendarMultiget, caldav.SyncCollection} {
+		reports += caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "supported-report"}, caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "report"}, caldav.Element(report, "")))
+	}
+
+	props := []caldav.Property{
+		{Name: davResourceType, Inner: caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "collection"}, "") + caldav.Element(xml.Name{Space: caldav.NSCalDAV, Local: "calendar"}, "")},
+		caldav.Text(davDisplayName, collection.Name),
+		{Name: davComponentSet, Inner: caldav.Element(xml.Name{Space: caldav.NSCalDAV, Local: "comp"}, "", "name", "VTODO")},
+		caldav.Text(davCTag, collection.SyncToken),
+		caldav.Text(davSyncToken, collection.SyncToken),
+		caldav.Hrefs(davCurrentPrincipal, principalHref(userID)),
+		caldav.Hrefs(davOwner, principalHref(userID)),
+		{Name: davPrivilegeSet, Inner: privileges},
+		{Name: davSupportedReports, Inner: reports},
+	}
+	if collection.Color != "" {
+		props = append(props, caldav.Text(davCalendarColor, collection.Color))
+	}
+	return props
+}
+
+// resourceProps returns a todo's properties, with its data if it was asked for
+func resourceProps(resource *services.DAVResource, req *caldav.Request) []caldav.Property {
+	props := []caldav.Property{
+		caldav.Text(davETag, resource.ETag),
+		caldav.Text(davContentType, "text/calendar; charset=utf-8; component=VTODO"),
+		{Name: davResourceType},
+	}
+	if req.Requested(davCalendarData) {
+		props = append(props, caldav.Text(davCalendarData, string(resource.Data)))
+	}
+	return props
+}
+
+func davResponse(href string, props []caldav.Property, req *caldav.Request) caldav.Response {
+	found, missing := req.Select(props)
+	return caldav.Response{Href: href, Found: found, Missing: missing}
+}
+
+func writeMultistatus(c *gin.Context, ms *caldav.Multistatus) {
+	c.Header("Content-Type", "application/xml; charset=utf-8")
+	c.Status(http.StatusMultiStatus)
+	if err := ms.Encode(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+func writeDAVError(c *gin.Context, status int, condition xml.Name) {
+	c.Data(status, "application/xml; charset=utf-8", caldav.Error(condition))
+}
+
+// Propfind describes the principal, the calendar home, collections and
+// todos. A Depth other than 0 includes the children of collections.
+func (h *CalDAVHandler) Propfind(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	target, ok := h.target(c)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	req, err := caldav.ParseRequest(c.Request.Body)
+	if err != nil || req.Type != caldav.Propfind {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	children := c.GetHeader("Depth") != "0"
+
+	ms := &caldav.Multistatus{}
+	switch target.kind {
+	case davRoot:
+		ms.Responses = append(ms.Responses, davResponse(davBase+"/", []caldav.Property{
+			{Name: davResourceType, Inner: caldav.Element(xml.Name{Space: caldav.NSDAV, Local: "collection"}, "")},
+			caldav.Hrefs(davCurrentPrincipal, principalHref(userID)),
+		}, req))
+
+	case davPrincipal:
+		user, err := h.caldavService.GetUser(userID)
+		if err != nil || user == nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		ms.Responses = append(ms.Responses, davResponse(principalHref(userID), principalProps(user), req))
+
+	case davHome:
+		ms.Responses = append(ms.Responses, davResponse(homeHref(userID), homeProps(userID), req))
+		if children {
+			collections, err := h.caldavService.Collections(userID)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			for i := range collections {
+				ms.Responses = append(ms.Responses, davResponse(collectionHref(userID, collections[i].ID), collectionProps(userID, &collections[i]), req))
+			}
+		}
+
+	case davCollection:
+		collection, err := h.caldavService.Collection(userID, target.collection)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if collection == nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		ms.Responses = append(ms.Responses, davResponse(collectionHref(userID, collection.ID), collectionProps(userID, collection), req))
+		if children {
+			resources, err := h.caldavService.Resources(userID, collection.ID)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			for i := range resources {
+				ms.Responses = append(ms.Responses, davResponse(resourceHref(userID, collection.ID, resources[i].Name), resourceProps(&resources[i], req), req))
+			}
+		}
+
+	case davResource:
+		resource, err := h.caldavService.Resource(userID, target.collection, target.name)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if resource == nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		ms.Responses = append(ms.Responses, davResponse(resourceHref(userID, target.collection, resource.Name), resourceProps(resource, req), req))
+	}
+
+	writeMultistatus(c, ms)
+}
+
+// Proppatch refuses to change properties; groups are renamed and recolored
+// in the app
+func (h *CalDAVHandler) Proppatch(c *gin.Context) {
+	if _, ok := h.target(c); !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	req, err := caldav.ParseRequest(c.Request.Body)
+	if err != nil || req.Type != caldav.PropertyUpdate {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	writeMultistatus(c, &caldav.Multistatus{Responses: []caldav.Response{{Href: c.Request.URL.Path, Denied: req.Props}}})
+}
+
+// Report answers calendar-query, calendar-multiget and sync-collection
+// reports on a collection
+func (h *CalDAVHandler) Report(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	target, ok := h.target(c)
+	if !ok || target.kind != davCollection {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	req, err := caldav.ParseRequest(c.Request.Body)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	collection, err := h.caldavService.Collection(userID, target.collection)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	ms := &caldav.Multistatus{}
+	switch req.Type {
+	case caldav.CalendarQuery:
+		// Collections only hold VTODOs
+		if req.WantsComponent("VTODO") {
+			resources, err := h.caldavService.Resources(userID, collection.ID)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			for i := range resources {
+				ms.Responses = append(ms.Responses, davResponse(resourceHref(userID, collection.ID, resources[i].Name), resourceProps(&resources[i], req), req))
+			}
+		}
+
+	case caldav.CalendarMultiget:
+		for _, href := range req.Hrefs {
+			name := ""
+			if u, err := url.Parse(href); err == nil && path.Base(path.Dir(u.Path)) == collection.ID {
+				name = path.Base(u.Path)
+			}
+			var resource *services.DAVResource
+			if name != "" {
+				if resource, err = h.caldavService.Resource(userID, collection.ID, name); err != nil {
+					c.Status(http.StatusInternalServerError)
+					return
+				}
+			}
+			if resource == nil {
+				ms.Responses = append(ms.Responses, caldav.Response{Href: href, Status: http.StatusNotFound})
+				continue
+			}
+			ms.Responses = append(ms.Responses, davResponse(resourceHref(userID, collection.ID, resource.Name), resourceProps(resource, req), req))
+		}
+
+	case caldav.SyncCollection:
+		resources, deleted, token, err := h.caldavService.Changes(userID, collection.ID, req.SyncToken)
+		if errors.Is(err, services.ErrInvalidSyncToken) {
+			writeDAVError(c, http.StatusForbidden, davValidSyncToken)
+			return
+		}
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		for i := range resources {
+			ms.Responses = append(ms.Responses, davResponse(resourceHref(userID, collection.ID, resources[i].Name), resourceProps(&resources[i], req), req))
+		}
+		for _, name := range deleted {
+			ms.Responses = append(ms.Responses, caldav.Response{Href: resourceHref(userID, collection.ID, name), Status: http.StatusNotFound})
+		}
+		ms.SyncToken = token
+
+	default:
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	writeMultistatus(c, ms)
+}
+
+// Get serves a todo as an iCalendar object
+func (h *CalDAVHandler) Get(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	target, ok := h.target(c)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if target.kind != davResource {
+		c.Header("Allow", "OPTIONS, PROPFIND, PROPPATCH, REPORT")
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	resource, err := h.caldavService.Resource(userID, target.collection, target.name)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if resource == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("ETag", resource.ETag)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", resource.Data)
+}
+
+// Put creates or updates a todo from the VTODO a client sends
+func (h *CalDAVHandler) Put(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	target, ok := h.target(c)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if target.kind != davResource {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+	collection, err := h.caldavService.Collection(userID, target.collection)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		c.Status(http.StatusConflict)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxDAVResource)
+	resource, created, err := h.caldavService.Put(userID, collection.ID, target.name, body, c.GetHeader("If-Match"), c.GetHeader("If-None-Match"))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		c.Status(http.StatusRequestEntityTooLarge)
+	case errors.Is(err, services.ErrPreconditionFailed):
+		c.Status(http.StatusPreconditionFailed)
+	case errors.Is(err, services.ErrUIDConflict):
+		writeDAVError(c, http.StatusForbidden, davNoUIDConflict)
+	case errors.Is(err, services.ErrInvalidCalendar):
+		writeDAVError(c, http.StatusForbidden, davValidCalendarData)
+	case errors.Is(err, services.ErrResourceName) || errors.Is(err, services.ErrInvalidRecurrence) || errors.Is(err, services.ErrInvalidParent):
+		writeDAVError(c, http.StatusForbidden, davValidCalendarEntry)
+	case err != nil:
+		c.Status(http.StatusInternalServerError)
+	default:
+		c.Header("ETag", resource.ETag)
+		if created {
+			c.Status(http.StatusCreated)
+		} else {
+			c.Status(http.StatusNoContent)
+		}
+	}
+}
+
+// Delete deletes a todo. Collections are groups, which are deleted in the app.
+func (h *CalDAVHandler) Delete(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	target, ok := h.target(c)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if target.kind != davResource {
+		writeDAVError(c, http.StatusForbidden, davNeedPrivileges)
+		return
+	}
+
+	err := h.caldavService.Delete(userID, target.collection, target.name, c.GetHeader("If-Match"))
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, services.ErrPreconditionFailed):
+		c.Status(http.StatusPreconditionFailed)
+	case err != nil:
+		c.Status(http.StatusInternalServerError)
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// MakeCollection refuses to create calendars; groups are created in the app
+func (h *CalDAVHandler) MakeCollection(c *gin.Context) {
+	writeDAVError(c, http.StatusForbidden, davNeedPrivileges)
+}
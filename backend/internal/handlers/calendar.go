@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/middleware"
+	"github.com/todomyday/backend/internal/services"
+)
+
+// maxCalendarUpload is the largest iCalendar file ImportTodos accepts
+const maxCalendarUpload = 5 << 20
+
+type CalendarHandler struct {
+	calendarService *services.CalendarService
+}
+
+func NewCalendarHandler(calendarService *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{
+		calendarService: calendarService,
+	}
+}
+
+// GetFeed returns the user's iCalendar feed URLs, or null if the feed is off
+func (h *CalendarHandler) GetFeed(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	feed, err := h.calendarService.GetFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"feed": feed,
+	})
+}
+
+// CreateFeed turns the feed on, or replaces its URL if it is already on
+func (h *CalendarHandler) CreateFeed(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	feed, err := h.calendarService.CreateFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"feed": feed,
+	})
+}
+
+// DeleteFeed turns the feed off
+func (h *CalendarHandler) DeleteFeed(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	ok, err := h.calendarService.DeleteFeed(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete calendar feed"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "calendar feed not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "calendar feed deleted successfully",
+	})
+}
+
+// ServeFeed serves a user's todos as an .ics file for calendar subscriptions.
+// It is public: the token in the URL identifies the user.
+func (h *CalendarHandler) ServeFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	kind := services.FeedEvents
+	switch c.Query("type") {
+	case "", string(services.FeedEvents):
+	case string(services.FeedTodos):
+		kind = services.FeedTodos
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be events or todos"})
+		return
+	}
+
+	data, err := h.calendarService.Feed(token, kind, c.Query("group_id"))
+	if errors.Is(err, services.ErrCalendarFeedNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render calendar feed"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// ImportTodos creates todos from the VTODOs of an uploaded .ics file, sent as
+// the "file" field of a multipart form or as the request body
+func (h *CalendarHandler) ImportTodos(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarUpload)
+
+	var data io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "calendar file is too large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		defer f.Close()
+		data = f
+	}
+
+	result, err := h.calendarService.Import(userID, data)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "calendar file is too large"})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidCalendar) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import todos"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 
@@ -202,7 +205,7 @@ func (h *MemoryHandler) ConvertToTodo(c *gin.Context) {
 	})
 }
 
-// GetDigest returns the weekly digest
+// GetDigest returns the digest of the current period
 func (h *MemoryHandler) GetDigest(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -217,7 +220,7 @@ func (h *MemoryHandler) GetDigest(c *gin.Context) {
 	})
 }
 
-// GenerateDigest regenerates the weekly digest
+// GenerateDigest regenerates the digest of the current period
 func (h *MemoryHandler) GenerateDigest(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -232,6 +235,250 @@ func (h *MemoryHandler) GenerateDigest(c *gin.Context) {
 	})
 }
 
+// ListDigests returns the digest history, newest first
+func (h *MemoryHandler) ListDigests(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	period := models.DigestPeriod(c.Query("period"))
+	switch period {
+	case "", models.DigestDaily, models.DigestWeekly, models.DigestMonthly:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be daily, weekly or monthly"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	digests, err := h.memoryService.ListDigests(userID, period, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch digests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"digests": digests,
+	})
+}
+
+// GetDigestByID returns a single digest from the history
+func (h *MemoryHandler) GetDigestByID(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	digest, err := h.memoryService.GetDigestByID(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch digest"})
+		return
+	}
+	if digest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "digest not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"digest": digest,
+	})
+}
+
+// GetDigestSettings returns the digest schedule
+func (h *MemoryHandler) GetDigestSettings(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	settings, err := h.memoryService.GetDigestSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch digest settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+	})
+}
+
+// UpdateDigestSettings changes the digest cadence, timezone or week start
+func (h *MemoryHandler) UpdateDigestSettings(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.DigestSettingsUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.memoryService.UpdateDigestSettings(userID, &req)
+	if errors.Is(err, services.ErrInvalidTimezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update digest settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+	})
+}
+
+// ConfirmUnsubscribeDigest shows the page an email's unsubscribe link opens,
+// asking to confirm. Opening the link changes nothing, as mail scanners and
+// link prefetchers follow links too.
+func (h *MemoryHandler) ConfirmUnsubscribeDigest(c *gin.Context) {
+	token := c.Query("token")
+
+	ok, err := h.memoryService.CheckDigestUnsubscribeToken(token)
+	if err != nil {
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", unsubscribePage("Something went wrong. Please try again later."))
+		return
+	}
+	if !ok {
+		c.Data(http.StatusNotFound, "text/html; charset=utf-8", unsubscribePage("This unsubscribe link is invalid or has expired."))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", unsubscribeConfirmPage(token))
+}
+
+// UnsubscribeDigest turns off digest emails from an email's unsubscribe link.
+// It is public: the token identifies the user. It answers the confirmation
+// page's form and one-click unsubscribe (RFC 8058 List-Unsubscribe-Post).
+func (h *MemoryHandler) UnsubscribeDigest(c *gin.Context) {
+	token := c.Query("token")
+
+	ok, err := h.memoryService.UnsubscribeDigestEmail(token)
+	if err != nil {
+		c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", unsubscribePage("Something went wrong. Please try again later."))
+		return
+	}
+	if !ok {
+		c.Data(http.StatusNotFound, "text/html; charset=utf-8", unsubscribePage("This unsubscribe link is invalid or has expired."))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", unsubscribePage("You won't receive digest emails anymore. You can turn them back on in your settings."))
+}
+
+func unsubscribePage(message string) []byte {
+	return unsubscribeHTML(`<p>` + message + `</p>`)
+}
+
+// unsubscribeConfirmPage asks to confirm with a form posting the token back
+func unsubscribeConfirmPage(token string) []byte {
+	return unsubscribeHTML(`<p>Stop receiving digest emails?</p>` +
+		`<form method="post" action="?token=` + html.EscapeString(url.QueryEscape(token)) + `">` +
+		`<button type="submit" style="padding:8px 16px;font-size:14px;">Unsubscribe</button></form>`)
+}
+
+func unsubscribeHTML(body string) []byte {
+	return []byte(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>Digest emails</title></head>` +
+		`<body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;padding:48px;text-align:center;color:#111827;">` +
+		body + `</body></html>`)
+}
+
+// GetResurfaceFeed returns memories from this day in past years and the
+// memories marked to learn that are due for review
+func (h *MemoryHandler) GetResurfaceFeed(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	date := c.Query("date")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	feed, err := h.memoryService.GetResurfaceFeed(userID, &date, limit)
+	if errors.Is(err, services.ErrInvalidDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch resurfaced memories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, feed)
+}
+
+// GetLearnState returns a memory's review schedule and review history
+func (h *MemoryHandler) GetLearnState(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	memory, err := h.memoryService.GetByID(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch memory"})
+		return
+	}
+	if memory == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "memory not found"})
+		return
+	}
+
+	review, history, err := h.memoryService.GetLearnState(userID, memory.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch review schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review":  review,
+		"history": history,
+	})
+}
+
+// MarkLearn adds a memory to the spaced repetition schedule
+func (h *MemoryHandler) MarkLearn(c *gin.Context) {
+	h.setLearn(c, true)
+}
+
+// UnmarkLearn takes a memory off the spaced repetition schedule
+func (h *MemoryHandler) UnmarkLearn(c *gin.Context) {
+	h.setLearn(c, false)
+}
+
+func (h *MemoryHandler) setLearn(c *gin.Context, learn bool) {
+	userID := middleware.GetUserID(c)
+
+	review, err := h.memoryService.SetLearn(userID, c.Param("id"), learn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update review schedule"})
+		return
+	}
+	if review == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "memory not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review": review,
+	})
+}
+
+// ReviewMemory records a review of a memory marked to learn and reschedules it
+func (h *MemoryHandler) ReviewMemory(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.MemoryReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := h.memoryService.ReviewMemory(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrInvalidDate) || errors.Is(err, services.ErrNotLearning) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record review"})
+		return
+	}
+	if review == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "memory not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"review": review,
+	})
+}
+
 // WebSearch searches the web using SearXNG
 func (h *MemoryHandler) WebSearch(c *gin.Context) {
 	var req models.WebSearchRequest
@@ -271,6 +518,35 @@ func (h *MemoryHandler) Reorder(c *gin.Context) {
 	})
 }
 
+// MoveAfter puts a memory right after another in the list, or first
+func (h *MemoryHandler) MoveAfter(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.MemoryMoveAfterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memory, err := h.memoryService.MoveAfter(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to move memory"})
+		return
+	}
+	if memory == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "memory not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"memory": memory,
+	})
+}
+
 // GetStats returns memory statistics
 func (h *MemoryHandler) GetStats(c *gin.Context) {
 	userID := middleware.GetUserID(c)
@@ -386,12 +662,12 @@ func (h *MemoryHandler) GetUploadJobStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
-// UploadImage handles image upload and extracts notes/details using GLM-4.5V
+// UploadImage handles image upload and extracts notes/details using the user's vision model
 func (h *MemoryHandler) UploadImage(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
 	// Check if vision service is configured
-	if h.visionService == nil || !h.visionService.IsConfigured() {
+	if h.visionService == nil || !h.visionService.IsConfiguredForUser(userID) {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Vision service not configured"})
 		return
 	}
@@ -456,7 +732,7 @@ func (h *MemoryHandler) UploadImage(c *gin.Context) {
 	log.Printf("[UploadImage] Processing image for user %s: %s (%s, %d bytes)", userID, file.Filename, contentType, len(imageData))
 
 	// Process image with vision service
-	visionResult, err := h.visionService.ProcessImage(imageData, contentType)
+	visionResult, err := h.visionService.ProcessImage(userID, imageData, contentType)
 	if err != nil {
 		log.Printf("[UploadImage] Vision processing failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process image: %v", err)})
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/middleware"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/services"
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+// GetSettings returns where reminders are sent
+func (h *NotificationHandler) GetSettings(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	settings, err := h.notificationService.GetSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch notification settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+	})
+}
+
+// UpdateSettings turns reminder emails on or off and sets the webhook URL
+func (h *NotificationHandler) UpdateSettings(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.NotificationSettingsUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.notificationService.UpdateSettings(userID, &req)
+	if errors.Is(err, services.ErrInvalidWebhookURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update notification settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings": settings,
+	})
+}
+
+// GetPushSubscriptions lists the browsers subscribed for Web Push
+func (h *NotificationHandler) GetPushSubscriptions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	subs, err := h.notificationService.GetPushSubscriptions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch push subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscriptions": subs,
+	})
+}
+
+// Subscribe registers a browser's PushSubscription
+func (h *NotificationHandler) Subscribe(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.PushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub, err := h.notificationService.Subscribe(userID, &req)
+	if errors.Is(err, services.ErrPushNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPushSubscription) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save push subscription"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"subscription": sub,
+	})
+}
+
+// Unsubscribe removes a push subscription
+func (h *NotificationHandler) Unsubscribe(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	ok, err := h.notificationService.Unsubscribe(userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete push subscription"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "push subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "push subscription deleted successfully",
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/middleware"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/services"
+)
+
+type PromptTemplateHandler struct {
+	service *services.PromptTemplateService
+}
+
+func NewPromptTemplateHandler(service *services.PromptTemplateService) *PromptTemplateHandler {
+	return &PromptTemplateHandler{service: service}
+}
+
+// GetAll returns the active prompt template for every AI task
+func (h *PromptTemplateHandler) GetAll(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	templates, err := h.service.GetAll(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetByName returns the active template for one task
+func (h *PromptTemplateHandler) GetByName(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	template, err := h.service.Get(userID, c.Param("name"))
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// GetVersions returns the user's saved versions of a template
+func (h *PromptTemplateHandler) GetVersions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	versions, err := h.service.GetVersions(userID, c.Param("name"))
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+
+	if versions == nil {
+		versions = []models.PromptTemplate{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// Update saves a new version of the user's override for a template
+func (h *PromptTemplateHandler) Update(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.PromptTemplateUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.service.Update(userID, c.Param("name"), req.Template)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// Reset removes the user's overrides so the built-in default is used
+func (h *PromptTemplateHandler) Reset(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	template, err := h.service.Reset(userID, c.Param("name"))
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+// Preview renders a template against a sample or existing memory without saving it
+func (h *PromptTemplateHandler) Preview(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.PromptPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, err := h.service.Preview(userID, c.Param("name"), &req)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func respondPromptTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownPromptTemplate), errors.Is(err, services.ErrPreviewMemoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidPromptTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
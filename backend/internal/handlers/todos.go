@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/todomyday/backend/internal/middleware"
@@ -19,18 +22,87 @@ func NewTodoHandler(todoService *services.TodoService) *TodoHandler {
 	}
 }
 
+// GetAll lists the user's todos. Query parameters filter them (status,
+// priority, group_id, tags, due_from, due_to, overdue, q), order them (sort,
+// "-" first for descending) and page them (limit, cursor).
 func (h *TodoHandler) GetAll(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
-	todos, err := h.todoService.GetAll(userID)
+	var filter models.TodoFilter
+	// ?status=pending,in_progress filters by status
+	for _, value := range splitQuery(c, "status") {
+		status := models.Status(value)
+		if !status.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status: " + value})
+			return
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	for _, value := range splitQuery(c, "priority") {
+		priority := models.Priority(value)
+		if priority != models.PriorityLow && priority != models.PriorityMedium && priority != models.PriorityHigh {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid priority: " + value})
+			return
+		}
+		filter.Priorities = append(filter.Priorities, priority)
+	}
+	// ?group_id=none matches todos without a group
+	for _, value := range splitQuery(c, "group_id") {
+		if value == "none" {
+			value = ""
+		}
+		filter.GroupIDs = append(filter.GroupIDs, value)
+	}
+	filter.Tags = splitQuery(c, "tags")
+	filter.DueFrom = c.Query("due_from")
+	filter.DueTo = c.Query("due_to")
+	filter.Overdue = c.Query("overdue") == "true"
+	filter.Query = strings.TrimSpace(c.Query("q"))
+
+	sort := c.Query("sort")
+	if strings.HasPrefix(sort, "-") {
+		filter.Descending = true
+		sort = sort[1:]
+	}
+	filter.Sort = models.TodoSort(sort)
+
+	if param := c.Query("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	var timezone *string
+	if param := c.Query("timezone"); param != "" {
+		timezone = &param
+	}
+
+	page, err := h.todoService.List(userID, filter, c.Query("cursor"), timezone)
+	if errors.Is(err, services.ErrInvalidTodoFilter) || errors.Is(err, services.ErrInvalidDate) ||
+		errors.Is(err, services.ErrInvalidCursor) || errors.Is(err, services.ErrInvalidTimezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch todos"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"todos": todos,
-	})
+	c.JSON(http.StatusOK, page)
+}
+
+// splitQuery returns the comma-separated values of a query parameter
+func splitQuery(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 func (h *TodoHandler) Create(c *gin.Context) {
@@ -43,6 +115,10 @@ func (h *TodoHandler) Create(c *gin.Context) {
 	}
 
 	todo, err := h.todoService.Create(userID, &req)
+	if errors.Is(err, services.ErrInvalidRecurrence) || errors.Is(err, services.ErrInvalidParent) || errors.Is(err, services.ErrInvalidTimezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create todo"})
 		return
@@ -72,6 +148,26 @@ func (h *TodoHandler) GetByID(c *gin.Context) {
 	})
 }
 
+// GetSubtasks lists a todo's direct subtasks
+func (h *TodoHandler) GetSubtasks(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	todoID := c.Param("id")
+
+	subtasks, err := h.todoService.GetSubtasks(userID, todoID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch subtasks"})
+		return
+	}
+	if subtasks == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"todos": subtasks,
+	})
+}
+
 func (h *TodoHandler) Update(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	todoID := c.Param("id")
@@ -83,6 +179,14 @@ func (h *TodoHandler) Update(c *gin.Context) {
 	}
 
 	todo, err := h.todoService.Update(userID, todoID, &req)
+	if errors.Is(err, services.ErrInvalidRecurrence) || errors.Is(err, services.ErrInvalidParent) || errors.Is(err, services.ErrInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -97,7 +201,18 @@ func (h *TodoHandler) Delete(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	todoID := c.Param("id")
 
-	if err := h.todoService.Delete(userID, todoID); err != nil {
+	scope := models.TodoScope(c.DefaultQuery("scope", string(models.ScopeInstance)))
+	if scope != models.ScopeInstance && scope != models.ScopeSeries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be instance or series"})
+		return
+	}
+
+	err := h.todoService.Delete(userID, todoID, scope)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -107,6 +222,440 @@ func (h *TodoHandler) Delete(c *gin.Context) {
 	})
 }
 
+// AddBlocker makes a todo depend on another one
+func (h *TodoHandler) AddBlocker(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	todoID := c.Param("id")
+
+	var req models.TodoDependencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todo, err := h.todoService.AddBlocker(userID, todoID, req.BlockerID)
+	h.respondDependency(c, todo, err)
+}
+
+// RemoveBlocker removes a todo's dependency on another one
+func (h *TodoHandler) RemoveBlocker(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	todo, err := h.todoService.RemoveBlocker(userID, c.Param("id"), c.Param("blocker_id"))
+	h.respondDependency(c, todo, err)
+}
+
+func (h *TodoHandler) respondDependency(c *gin.Context, todo *models.Todo, err error) {
+	switch {
+	case errors.Is(err, services.ErrTodoNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidDependency):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update dependencies"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"todo": todo})
+	}
+}
+
+// GetReminders lists a todo's reminders
+func (h *TodoHandler) GetReminders(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	reminders, err := h.todoService.GetReminders(userID, c.Param("id"))
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch reminders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reminders": reminders,
+	})
+}
+
+// CreateReminder adds a reminder at a fixed time or relative to the due date
+func (h *TodoHandler) CreateReminder(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.ReminderCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reminder, err := h.todoService.CreateReminder(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidReminder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reminder"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"reminder": reminder,
+	})
+}
+
+// DeleteReminder deletes one of a todo's reminders
+func (h *TodoHandler) DeleteReminder(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	err := h.todoService.DeleteReminder(userID, c.Param("id"), c.Param("reminder_id"))
+	if errors.Is(err, services.ErrTodoNotFound) || errors.Is(err, services.ErrReminderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete reminder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "reminder deleted successfully",
+	})
+}
+
+// StartTimer starts tracking time on a todo. The note in the body is optional.
+func (h *TodoHandler) StartTimer(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.TimerStartRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	entry, err := h.todoService.StartTimer(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTimerRunning) {
+		// Say which timer, so it can be stopped first
+		running, _ := h.todoService.GetRunningTimer(userID)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "time_entry": running})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start timer"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"time_entry": entry,
+	})
+}
+
+// StopTimer stops the timer running on a todo
+func (h *TodoHandler) StopTimer(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	entry, err := h.todoService.StopTimer(userID, c.Param("id"))
+	if errors.Is(err, services.ErrTodoNotFound) || errors.Is(err, services.ErrTimerNotRunning) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stop timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"time_entry": entry,
+	})
+}
+
+// GetRunningTimer returns the user's running timer, null if none is running
+func (h *TodoHandler) GetRunningTimer(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	entry, err := h.todoService.GetRunningTimer(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"time_entry": entry,
+	})
+}
+
+// GetTime lists a todo's time entries with their total and its estimate
+func (h *TodoHandler) GetTime(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	total, err := h.todoService.GetTime(userID, c.Param("id"))
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch time entries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, total)
+}
+
+// CreateTimeEntry records time spent on a todo by hand
+func (h *TodoHandler) CreateTimeEntry(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.TimeEntryCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.todoService.CreateTimeEntry(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidTimeEntry) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create time entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"time_entry": entry,
+	})
+}
+
+// DeleteTimeEntry deletes one of a todo's time entries
+func (h *TodoHandler) DeleteTimeEntry(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	err := h.todoService.DeleteTimeEntry(userID, c.Param("id"), c.Param("entry_id"))
+	if errors.Is(err, services.ErrTodoNotFound) || errors.Is(err, services.ErrTimeEntryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete time entry"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "time entry deleted successfully",
+	})
+}
+
+// GetTimeReport totals tracked time by group or tag over a range of days
+// (?from=&to=, YYYY-MM-DD, and ?group_by=group|tag)
+func (h *TodoHandler) GetTimeReport(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var timezone *string
+	if param := c.Query("timezone"); param != "" {
+		timezone = &param
+	}
+
+	report, err := h.todoService.GetTimeReport(userID, c.Query("from"), c.Query("to"), models.TimeReportGrouping(c.Query("group_by")), timezone)
+	if errors.Is(err, services.ErrInvalidTimeReport) || errors.Is(err, services.ErrInvalidDate) || errors.Is(err, services.ErrInvalidTimezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build time report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Skip skips an occurrence of a recurring todo and returns the next one
+func (h *TodoHandler) Skip(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	todoID := c.Param("id")
+
+	next, err := h.todoService.Skip(userID, todoID)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNotRecurring) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to skip todo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"todo": next,
+	})
+}
+
+// GetUpcoming lists pending and projected occurrences of recurring todos
+func (h *TodoHandler) GetUpcoming(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	days, _ := strconv.Atoi(c.Query("days"))
+
+	upcoming, err := h.todoService.GetUpcoming(userID, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch upcoming todos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, upcoming)
+}
+
+// GetBoard returns the user's board for a group, with its todos in columns
+func (h *TodoHandler) GetBoard(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	board, err := h.todoService.GetBoard(userID, c.Param("id"))
+	if errors.Is(err, services.ErrBoardGroupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch board"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"board": board,
+	})
+}
+
+// CreateColumn adds a column to a group's board
+func (h *TodoHandler) CreateColumn(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.BoardColumnCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	column, err := h.todoService.CreateColumn(userID, c.Param("id"), &req)
+	h.respondColumn(c, column, err, http.StatusCreated)
+}
+
+// UpdateColumn renames, remaps or moves a column of a group's board
+func (h *TodoHandler) UpdateColumn(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.BoardColumnUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	column, err := h.todoService.UpdateColumn(userID, c.Param("id"), c.Param("column_id"), &req)
+	h.respondColumn(c, column, err, http.StatusOK)
+}
+
+func (h *TodoHandler) respondColumn(c *gin.Context, column *models.BoardColumn, err error, status int) {
+	switch {
+	case errors.Is(err, services.ErrBoardGroupNotFound), errors.Is(err, services.ErrColumnNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidColumn):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save board column"})
+	default:
+		c.JSON(status, gin.H{"column": column})
+	}
+}
+
+// DeleteColumn deletes a column of a group's board
+func (h *TodoHandler) DeleteColumn(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	err := h.todoService.DeleteColumn(userID, c.Param("id"), c.Param("column_id"))
+	if errors.Is(err, services.ErrColumnNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete board column"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "board column deleted successfully",
+	})
+}
+
+// Move moves a todo to a place in a board column, setting its status to the
+// column's
+func (h *TodoHandler) Move(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.TodoMoveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todo, err := h.todoService.MoveTodo(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrTodoNotFound) || errors.Is(err, services.ErrColumnNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidColumn) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to move todo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"todo": todo,
+	})
+}
+
+// MoveAfter puts a todo right after another in the list, or first
+func (h *TodoHandler) MoveAfter(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	var req models.TodoMoveAfterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	todo, err := h.todoService.MoveAfter(userID, c.Param("id"), &req)
+	if errors.Is(err, services.ErrTodoNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to move todo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"todo": todo,
+	})
+}
+
 func (h *TodoHandler) Reorder(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
@@ -0,0 +1,398 @@
+// Package ical reads and writes iCalendar (RFC 5545) data: components such as
+// VCALENDAR, VTODO and VEVENT, their properties, and the date and text values
+// todos need.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalid is returned for data that isn't well-formed iCalendar
+var ErrInvalid = errors.New("invalid iCalendar data")
+
+const (
+	// maxLineLength is the longest a content line may be before it is folded,
+	// in octets, not counting the line break
+	maxLineLength = 75
+	// maxDepth bounds how deeply components may nest when decoding
+	maxDepth = 8
+
+	dateLayout        = "20060102"
+	dateTimeLayout    = "20060102T150405"
+	utcDateTimeLayout = "20060102T150405Z"
+)
+
+// Property is a content line: a name, parameters such as VALUE or TZID, and
+// the raw value, still escaped for TEXT properties
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Param returns a parameter's value, or "" if it isn't set
+func (p *Property) Param(name string) string {
+	return p.Params[strings.ToUpper(name)]
+}
+
+// Text returns the value unescaped, for TEXT properties such as SUMMARY
+func (p *Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+// Component is a BEGIN/END block with its properties and nested components
+type Component struct {
+	Name       string
+	Properties []Property
+	Children   []*Component
+}
+
+// NewComponent returns an empty component, e.g. NewComponent("VTODO")
+func NewComponent(name string) *Component {
+	return &Component{Name: strings.ToUpper(name)}
+}
+
+// Add appends a property with a raw value. params are name, value pairs.
+func (c *Component) Add(name, value string, params ...string) {
+	prop := Property{Name: strings.ToUpper(name), Value: value}
+	if len(params) > 0 {
+		prop.Params = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			prop.Params[strings.ToUpper(params[i])] = params[i+1]
+		}
+	}
+	c.Properties = append(c.Properties, prop)
+}
+
+// AddText appends a TEXT property, escaping its value
+func (c *Component) AddText(name, text string) {
+	c.Add(name, EscapeText(text))
+}
+
+// AddDate appends a DATE property, e.g. DUE;VALUE=DATE:20240307
+func (c *Component) AddDate(name string, t time.Time) {
+	c.Add(name, t.Format(dateLayout), "VALUE", "DATE")
+}
+
+// AddDateTime appends a DATE-TIME property in UTC
+func (c *Component) AddDateTime(name string, t time.Time) {
+	c.Add(name, t.UTC().Format(utcDateTimeLayout))
+}
+
+// Prop returns the first property with the given name, or nil
+func (c *Component) Prop(name string) *Property {
+	name = strings.ToUpper(name)
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// PropsNamed returns every property with the given name
+func (c *Component) PropsNamed(name string) []Property {
+	name = strings.ToUpper(name)
+	var props []Property
+	for _, prop := range c.Properties {
+		if prop.Name == name {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+// Text returns the unescaped value of the first property with the given
+// name, or "" if there is none
+func (c *Component) Text(name string) string {
+	if prop := c.Prop(name); prop != nil {
+		return prop.Text()
+	}
+	return ""
+}
+
+// ChildrenNamed returns the nested components with the given name
+func (c *Component) ChildrenNamed(name string) []*Component {
+	name = strings.ToUpper(name)
+	var children []*Component
+	for _, child := range c.Children {
+		if child.Name == name {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Encode writes c with CRLF line breaks, folding long lines
+func Encode(w io.Writer, c *Component) error {
+	bw := bufio.NewWriter(w)
+	encode(bw, c)
+	return bw.Flush()
+}
+
+func encode(w *bufio.Writer, c *Component) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, prop := range c.Properties {
+		writeLine(w, formatProperty(prop))
+	}
+	for _, child := range c.Children {
+		encode(w, child)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+func formatProperty(prop Property) string {
+	var b strings.Builder
+	b.WriteString(prop.Name)
+	// Parameters in a fixed order so output is stable
+	names := make([]string, 0, len(prop.Params))
+	for name := range prop.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := prop.Params[name]
+		b.WriteString(";" + name + "=")
+		if strings.ContainsAny(value, ";:,") {
+			b.WriteString(`"` + strings.ReplaceAll(value, `"`, "'") + `"`)
+		} else {
+			b.WriteString(value)
+		}
+	}
+	b.WriteString(":" + prop.Value)
+	return b.String()
+}
+
+// writeLine writes a content line folded at maxLineLength octets, never
+// splitting a UTF-8 sequence
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// The leading space of continuation lines counts toward the limit
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// Decode reads the first component from r, usually a VCALENDAR. Lines may end
+// in CRLF or LF.
+func Decode(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stack []*Component
+	var root *Component
+	for _, line := range lines {
+		prop, err := parseLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			if len(stack) >= maxDepth {
+				return nil, fmt.Errorf("%w: components nested too deeply", ErrInvalid)
+			}
+			c := NewComponent(prop.Value)
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, c)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("%w: unexpected END:%s", ErrInvalid, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				// Anything after the first component is ignored
+				return root, nil
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: property %s outside a component", ErrInvalid, prop.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, prop)
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("%w: no component", ErrInvalid)
+	}
+	return nil, fmt.Errorf("%w: missing END:%s", ErrInvalid, stack[len(stack)-1].Name)
+}
+
+// unfold joins folded lines and drops blank ones
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return lines, nil
+}
+
+// parseLine splits a content line into name, parameters and value. Colons and
+// semicolons inside quoted parameter values don't count.
+func parseLine(line string) (Property, error) {
+	prop := Property{}
+	inQuotes := false
+	start := 0
+	var paramName string
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case ch == '=' && prop.Name != "" && paramName == "":
+			paramName = strings.ToUpper(line[start:i])
+			start = i + 1
+		case ch == ';' || ch == ':':
+			part := line[start:i]
+			if prop.Name == "" {
+				prop.Name = strings.ToUpper(part)
+			} else if paramName != "" {
+				if prop.Params == nil {
+					prop.Params = make(map[string]string)
+				}
+				prop.Params[paramName] = strings.Trim(part, `"`)
+				paramName = ""
+			}
+			if ch == ':' && prop.Name != "" {
+				prop.Value = line[i+1:]
+				return prop, nil
+			}
+			start = i + 1
+		}
+	}
+	return prop, fmt.Errorf("%w: malformed line %q", ErrInvalid, truncate(line, 40))
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// EscapeText escapes a TEXT value
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// UnescapeText reverses EscapeText
+func UnescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// SplitList splits a comma-separated TEXT list such as CATEGORIES, leaving
+// escaped commas alone
+func SplitList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, UnescapeText(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, UnescapeText(value[start:]))
+}
+
+// JoinList formats a TEXT list, escaping each item
+func JoinList(items []string) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		escaped[i] = EscapeText(item)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// Time parses a DATE or DATE-TIME value. allDay reports a DATE. DATE-TIMEs in
+// UTC or with a TZID the system knows are exact; floating times and unknown
+// zones are read as UTC, and floating reports that.
+func (p *Property) Time() (t time.Time, allDay, floating bool, err error) {
+	value := strings.TrimSpace(p.Value)
+	if strings.EqualFold(p.Param("VALUE"), "DATE") || len(value) == len(dateLayout) {
+		t, err = time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, false, false, fmt.Errorf("%w: bad date %q", ErrInvalid, value)
+		}
+		return t, true, false, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(utcDateTimeLayout, value)
+		if err != nil {
+			return time.Time{}, false, false, fmt.Errorf("%w: bad date-time %q", ErrInvalid, value)
+		}
+		return t, false, false, nil
+	}
+
+	loc, floating := time.UTC, true
+	if tzid := strings.TrimPrefix(p.Param("TZID"), "/"); tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc, floating = zone, false
+		}
+	}
+	t, err = time.ParseInLocation(dateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false, false, fmt.Errorf("%w: bad date-time %q", ErrInvalid, value)
+	}
+	return t, false, floating, nil
+}
@@ -0,0 +1,99 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	cal := NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	todo := NewComponent("VTODO")
+	todo.Add("UID", "abc@example.com")
+	summary := "Buy milk, eggs; and bread\nfor the weekend " + strings.Repeat("é", 60)
+	todo.AddText("SUMMARY", summary)
+	todo.Add("CATEGORIES", JoinList([]string{"Errands", "food, dairy"}))
+	todo.AddDate("DUE", time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC))
+	todo.Add("X-LABEL", "x", "ALTREP", "http://example.com/a:b")
+	cal.Children = append(cal.Children, todo)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 || !utf8.ValidString(line) {
+			t.Errorf("line not folded on a character boundary within 75 octets: %q", line)
+		}
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	todos := decoded.ChildrenNamed("VTODO")
+	if len(todos) != 1 {
+		t.Fatalf("expected one VTODO, got %d", len(todos))
+	}
+	got := todos[0]
+	if got.Text("SUMMARY") != summary {
+		t.Errorf("summary didn't round-trip: %q", got.Text("SUMMARY"))
+	}
+	if list := SplitList(got.Prop("CATEGORIES").Value); len(list) != 2 || list[1] != "food, dairy" {
+		t.Errorf("unexpected categories %q", list)
+	}
+	if got.Prop("X-LABEL").Param("altrep") != "http://example.com/a:b" {
+		t.Errorf("quoted parameter didn't round-trip: %+v", got.Prop("X-LABEL"))
+	}
+	due, allDay, _, err := got.Prop("DUE").Time()
+	if err != nil || !allDay || !due.Equal(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected due date %v (all day %v, %v)", due, allDay, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"SUMMARY:outside\n",
+		"BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nno colon here\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\nBEGIN:VTODO\n",
+	} {
+		if _, err := Decode(strings.NewReader(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	tests := []struct {
+		line             string
+		want             time.Time
+		allDay, floating bool
+	}{
+		{"DUE;VALUE=DATE:20240307", time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC), true, false},
+		{"DUE:20240307T170000Z", time.Date(2024, 3, 7, 17, 0, 0, 0, time.UTC), false, false},
+		{"DUE;TZID=Europe/Berlin:20240307T170000", time.Date(2024, 3, 7, 17, 0, 0, 0, berlin), false, false},
+		{"DUE:20240307T170000", time.Date(2024, 3, 7, 17, 0, 0, 0, time.UTC), false, true},
+		// Zones the system doesn't know, such as Windows names, are floating
+		{"DUE;TZID=W. Europe Standard Time:20240307T170000", time.Date(2024, 3, 7, 17, 0, 0, 0, time.UTC), false, true},
+	}
+	for _, tt := range tests {
+		prop, err := parseLine(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, allDay, floating, err := prop.Time()
+		if err != nil || !got.Equal(tt.want) || allDay != tt.allDay || floating != tt.floating {
+			t.Errorf("%s: got %v (all day %v, floating %v, %v)", tt.line, got, allDay, floating, err)
+		}
+	}
+}
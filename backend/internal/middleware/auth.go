@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/models"
 	"github.com/todomyday/backend/internal/services"
 )
 
@@ -18,7 +19,14 @@ func min(a, b int) int {
 
 const UserIDKey = "userID"
 
-func AuthMiddleware(supabaseAuthService *services.SupabaseAuthService) gin.HandlerFunc {
+// TokenVerifier verifies bearer tokens and maps them to local users.
+// SupabaseAuthService implements it; tests can swap in a fake.
+type TokenVerifier interface {
+	VerifyToken(tokenString string) (*services.SupabaseClaims, error)
+	SyncUserFromToken(claims *services.SupabaseClaims) (*models.User, error)
+}
+
+func AuthMiddleware(supabaseAuthService TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -64,6 +72,40 @@ func AuthMiddleware(supabaseAuthService *services.SupabaseAuthService) gin.Handl
 	}
 }
 
+// PasswordVerifier checks app passwords for clients that can only send HTTP
+// Basic auth, returning the user ID or "" if they don't match.
+// CalDAVService implements it.
+type PasswordVerifier interface {
+	Authenticate(username, password string) (string, error)
+}
+
+// BasicAuthMiddleware signs in CalDAV clients with an email and app password
+func BasicAuthMiddleware(verifier PasswordVerifier, realm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := verifier.Authenticate(username, password)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to check app password: %v\n", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if userID == "" {
+			c.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Set(UserIDKey, userID)
+		c.Next()
+	}
+}
+
 func GetUserID(c *gin.Context) string {
 	userID, exists := c.Get(UserIDKey)
 	if !exists {
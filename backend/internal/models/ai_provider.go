@@ -9,8 +9,17 @@ const (
 	ProviderTypeAnthropic ProviderType = "anthropic"
 	ProviderTypeGoogle    ProviderType = "google"
 	ProviderTypeCustom    ProviderType = "custom"
+	ProviderTypeOllama    ProviderType = "ollama"
+	// ProviderTypeMock answers from a scripted MockScript, for offline testing
+	ProviderTypeMock ProviderType = "mock"
 )
 
+// RequiresAPIKey reports whether the provider type needs an API key.
+// Local providers like Ollama run without authentication.
+func (p ProviderType) RequiresAPIKey() bool {
+	return p != ProviderTypeOllama && p != ProviderTypeMock
+}
+
 type AIProvider struct {
 	ID              string       `json:"id"`
 	UserID          string       `json:"user_id"`
@@ -20,6 +29,7 @@ type AIProvider struct {
 	APIKeyEncrypted string       `json:"-"` // Never expose encrypted key
 	APIKeyMasked    string       `json:"api_key_masked,omitempty"`
 	SelectedModel   *string      `json:"selected_model"`
+	VisionModel     *string      `json:"vision_model"` // Model used for image uploads; at most one provider per user has one
 	IsDefault       bool         `json:"is_default"`
 	IsEnabled       bool         `json:"is_enabled"`
 	CreatedAt       time.Time    `json:"created_at"`
@@ -27,18 +37,56 @@ type AIProvider struct {
 }
 
 type AIProviderModel struct {
-	ID         string    `json:"id"`
-	ProviderID string    `json:"provider_id"`
-	ModelID    string    `json:"model_id"`
-	ModelName  string    `json:"model_name"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID           string            `json:"id"`
+	ProviderID   string            `json:"provider_id"`
+	ModelID      string            `json:"model_id"`
+	ModelName    string            `json:"model_name"`
+	Capabilities ModelCapabilities `json:"capabilities"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// ModelCapabilities describes what a model accepts and produces.
+// A zero ContextWindow means the window is unknown.
+type ModelCapabilities struct {
+	ContextWindow int  `json:"context_window"` // Input tokens
+	Vision        bool `json:"vision"`
+	Tools         bool `json:"tools"`
+	JSONMode      bool `json:"json_mode"`
+	Streaming     bool `json:"streaming"`
+	Embedding     bool `json:"embedding"` // Embedding-only models can't answer prompts
+}
+
+// ModelRequirements is what a feature needs from a model
+type ModelRequirements struct {
+	Vision     bool
+	Tools      bool
+	JSONMode   bool
+	MinContext int // Minimum input tokens; 0 means any
+}
+
+// Satisfies reports whether a chat model with these capabilities meets the requirements.
+// An unknown context window satisfies no minimum.
+func (c ModelCapabilities) Satisfies(req ModelRequirements) bool {
+	if c.Embedding {
+		return false
+	}
+	if req.Vision && !c.Vision {
+		return false
+	}
+	if req.Tools && !c.Tools {
+		return false
+	}
+	if req.JSONMode && !c.JSONMode {
+		return false
+	}
+	return req.MinContext == 0 || c.ContextWindow >= req.MinContext
 }
 
 type AIProviderCreate struct {
 	Name         string       `json:"name" binding:"required"`
 	ProviderType ProviderType `json:"provider_type" binding:"required"`
 	BaseURL      string       `json:"base_url" binding:"required"`
-	APIKey       string       `json:"api_key" binding:"required"`
+	APIKey       string       `json:"api_key"` // Optional for local providers (ollama)
 	IsDefault    bool         `json:"is_default"`
 }
 
@@ -47,6 +95,7 @@ type AIProviderUpdate struct {
 	BaseURL       *string `json:"base_url"`
 	APIKey        *string `json:"api_key"`
 	SelectedModel *string `json:"selected_model"`
+	VisionModel   *string `json:"vision_model"` // Empty string clears the selection
 	IsDefault     *bool   `json:"is_default"`
 	IsEnabled     *bool   `json:"is_enabled"`
 }
@@ -54,13 +103,21 @@ type AIProviderUpdate struct {
 type TestConnectionRequest struct {
 	ProviderType ProviderType `json:"provider_type" binding:"required"`
 	BaseURL      string       `json:"base_url" binding:"required"`
-	APIKey       string       `json:"api_key" binding:"required"`
+	APIKey       string       `json:"api_key"` // Optional for local providers (ollama)
+}
+
+// PullModelRequest asks a local provider (ollama) to download a model
+type PullModelRequest struct {
+	Model string `json:"model" binding:"required"`
 }
 
 type TestConnectionResponse struct {
 	Success bool     `json:"success"`
 	Message string   `json:"message"`
 	Models  []string `json:"models,omitempty"`
+	// Capabilities reported by the provider's model listing, keyed by model ID.
+	// Only some providers report them; the rest come from the built-in table.
+	Capabilities map[string]ModelCapabilities `json:"capabilities,omitempty"`
 }
 
 // GetDefaultBaseURL returns the default base URL for a provider type
@@ -72,6 +129,9 @@ func GetDefaultBaseURL(providerType ProviderType) string {
 		return "https://api.anthropic.com/v1"
 	case ProviderTypeGoogle:
 		return "https://generativelanguage.googleapis.com/v1beta"
+	case ProviderTypeOllama:
+		// Ollama's OpenAI-compatible endpoint; native APIs live under the server root
+		return "http://localhost:11434/v1"
 	default:
 		return ""
 	}
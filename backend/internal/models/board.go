@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// BoardColumn is a column of a user's board for a group. A column with a
+// Status holds the todos with that status, and moving a todo there sets it;
+// a column without one is a custom lane that leaves the status alone.
+type BoardColumn struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	GroupID   string    `json:"group_id"`
+	Name      string    `json:"name"`
+	Status    *Status   `json:"status"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BoardLane is a column with its todos in order
+type BoardLane struct {
+	BoardColumn
+	Todos []Todo `json:"todos"`
+}
+
+// Board is a group's todos laid out in columns. Todos are in the column they
+// were last moved to while it still matches their status, else in the first
+// column for their status. Open todos no column takes go in the first column,
+// and done ones are left off.
+type Board struct {
+	GroupID string      `json:"group_id"`
+	Columns []BoardLane `json:"columns"`
+}
+
+type BoardColumnCreateRequest struct {
+	Name   string  `json:"name" binding:"required"`
+	Status *Status `json:"status" binding:"omitempty,oneof=pending in_progress blocked completed cancelled"`
+}
+
+// BoardColumnUpdateRequest changes a column. An empty Status makes it a custom
+// lane, and Position moves it among the board's columns (0 is first).
+type BoardColumnUpdateRequest struct {
+	Name     *string `json:"name"`
+	Status   *Status `json:"status"`
+	Position *int    `json:"position" binding:"omitempty,min=0"`
+}
+
+// TodoMoveRequest moves a todo to Index (0 is the top) in a column of its
+// group's board
+type TodoMoveRequest struct {
+	ColumnID string `json:"column_id" binding:"required"`
+	Index    int    `json:"index" binding:"min=0"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DAVCredentials sign a user's CalDAV clients in with HTTP Basic auth: their
+// email and an app password. Password is only set when one is created.
+type DAVCredentials struct {
+	UserID       string    `json:"-"`
+	PasswordHash string    `json:"-"`
+	URL          string    `json:"url"`
+	Username     string    `json:"username"`
+	Password     string    `json:"password,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TodoChange is the latest change to a todo in a collection since a sync-token
+type TodoChange struct {
+	Seq     int64
+	TodoID  string
+	UID     string
+	Deleted bool
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// CalendarFeed is a user's secret iCalendar subscription. Anyone with the URL
+// can read the user's todos, so rotating it replaces the token.
+type CalendarFeed struct {
+	UserID string `json:"-"`
+	Token  string `json:"token"`
+	// URL serves todos as events, for calendar apps; TodosURL serves them as
+	// VTODOs, for task apps
+	URL       string    `json:"url"`
+	TodosURL  string    `json:"todos_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CalendarImportResult reports what an iCalendar upload created
+type CalendarImportResult struct {
+	Todos   []Todo               `json:"todos"`
+	Skipped []CalendarImportSkip `json:"skipped"`
+}
+
+// CalendarImportSkip is an entry that wasn't imported and why
+type CalendarImportSkip struct {
+	UID     string `json:"uid"`
+	Summary string `json:"summary"`
+	Reason  string `json:"reason"`
+}
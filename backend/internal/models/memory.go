@@ -27,13 +27,141 @@ type MemoryCategory struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// DigestPeriod is the span of time a digest covers
+type DigestPeriod string
+
+const (
+	DigestDaily   DigestPeriod = "daily"
+	DigestWeekly  DigestPeriod = "weekly"
+	DigestMonthly DigestPeriod = "monthly"
+)
+
+// MemoryDigest summarises a period's memories. WeekStart and WeekEnd are the first
+// and last day of the period, whatever its length.
 type MemoryDigest struct {
-	ID            string    `json:"id"`
-	UserID        string    `json:"user_id"`
-	WeekStart     string    `json:"week_start"`
-	WeekEnd       string    `json:"week_end"`
-	DigestContent string    `json:"digest_content"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            string       `json:"id"`
+	UserID        string       `json:"user_id"`
+	Period        DigestPeriod `json:"period"`
+	WeekStart     string       `json:"week_start"`
+	WeekEnd       string       `json:"week_end"`
+	DigestContent string       `json:"digest_content"`
+	// Sections holds the period's todo activity and AI insights; nil on digests
+	// written before todos were covered
+	Sections  *DigestSections `json:"sections"`
+	CreatedAt time.Time       `json:"created_at"`
+	// Context reports memories cut to fit the model; only set on a freshly generated digest
+	Context *ContextReport `json:"context,omitempty"`
+}
+
+// DigestSections is the structured part of a digest, rendered alongside its text
+type DigestSections struct {
+	Todos    []DigestTodoGroup `json:"todos"`
+	Insights []DigestInsight   `json:"insights"`
+}
+
+// DigestTodoGroup is one group's todo activity during a digest period. Todos
+// without a group have a nil GroupID.
+type DigestTodoGroup struct {
+	GroupID   *string      `json:"group_id"`
+	Name      string       `json:"name"`
+	ColorCode string       `json:"color_code"`
+	Completed []DigestTodo `json:"completed"`
+	Created   []DigestTodo `json:"created"`
+	Overdue   []DigestTodo `json:"overdue"`
+}
+
+// DigestTodo is a todo as it appears in a digest
+type DigestTodo struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	DueDate  *string  `json:"due_date"`
+	Priority Priority `json:"priority"`
+}
+
+// DigestInsight is an AI observation connecting memories and todos from the period
+type DigestInsight struct {
+	Text      string   `json:"text"`
+	MemoryIDs []string `json:"memory_ids"`
+	TodoIDs   []string `json:"todo_ids"`
+}
+
+// DigestSettings controls when a user's digests are generated
+type DigestSettings struct {
+	UserID    string       `json:"-"`
+	Enabled   bool         `json:"enabled"`
+	Cadence   DigestPeriod `json:"cadence"`
+	Timezone  string       `json:"timezone"`   // IANA name, e.g. "Europe/Berlin"
+	WeekStart int          `json:"week_start"` // 0 = Sunday ... 6 = Saturday
+	// EmailEnabled opts in to receiving each scheduled digest by email
+	EmailEnabled     bool      `json:"email_enabled"`
+	UnsubscribeToken string    `json:"-"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type DigestSettingsUpdate struct {
+	Enabled      *bool         `json:"enabled"`
+	Cadence      *DigestPeriod `json:"cadence" binding:"omitempty,oneof=daily weekly monthly"`
+	Timezone     *string       `json:"timezone"`
+	WeekStart    *int          `json:"week_start" binding:"omitempty,min=0,max=6"`
+	EmailEnabled *bool         `json:"email_enabled"`
+}
+
+// ReviewOutcome is how well a memory was recalled when reviewed
+type ReviewOutcome string
+
+const (
+	ReviewAgain ReviewOutcome = "again"
+	ReviewHard  ReviewOutcome = "hard"
+	ReviewGood  ReviewOutcome = "good"
+	ReviewEasy  ReviewOutcome = "easy"
+)
+
+// MemoryReview is the spaced repetition schedule of a memory marked to learn.
+// Unmarking keeps the row, with Learn false, so re-marking resumes the schedule.
+type MemoryReview struct {
+	MemoryID       string         `json:"memory_id"`
+	UserID         string         `json:"-"`
+	Learn          bool           `json:"learn"`
+	Ease           float64        `json:"ease"`
+	IntervalDays   int            `json:"interval_days"`
+	Repetitions    int            `json:"repetitions"` // successful reviews in a row
+	Lapses         int            `json:"lapses"`
+	ReviewCount    int            `json:"review_count"`
+	DueDate        string         `json:"due_date"`
+	LastOutcome    *ReviewOutcome `json:"last_outcome"`
+	LastReviewedAt *time.Time     `json:"last_reviewed_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// MemoryReviewLog records one review of a memory
+type MemoryReviewLog struct {
+	ID           string        `json:"id"`
+	MemoryID     string        `json:"memory_id"`
+	Outcome      ReviewOutcome `json:"outcome"`
+	IntervalDays int           `json:"interval_days"`
+	DueDate      string        `json:"due_date"`
+	ReviewedAt   time.Time     `json:"reviewed_at"`
+}
+
+type MemoryReviewRequest struct {
+	Outcome ReviewOutcome `json:"outcome" binding:"required,oneof=again hard good easy"`
+	// Date is the reviewer's local date (YYYY-MM-DD); defaults to the server's
+	Date *string `json:"date"`
+}
+
+// ResurfacedMemory is a memory brought back by the resurfacing feed
+type ResurfacedMemory struct {
+	Memory   Memory        `json:"memory"`
+	YearsAgo int           `json:"years_ago,omitempty"`
+	Review   *MemoryReview `json:"review,omitempty"`
+}
+
+// ResurfaceFeed holds the memories to look back at on a given day
+type ResurfaceFeed struct {
+	Date      string             `json:"date"`
+	OnThisDay []ResurfacedMemory `json:"on_this_day"`
+	Due       []ResurfacedMemory `json:"due"`
 }
 
 type MemoryCreateRequest struct {
@@ -71,6 +199,12 @@ type MemoryPosition struct {
 	Position string `json:"position" binding:"required"`
 }
 
+// MemoryMoveAfterRequest moves a memory right after AfterID in the list, or
+// first when AfterID is empty
+type MemoryMoveAfterRequest struct {
+	AfterID *string `json:"after_id"`
+}
+
 type WebSearchRequest struct {
 	Query string `json:"query" binding:"required"`
 }
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// PromptTemplate is one saved version of a user's prompt override.
+// Every save adds a new version; the highest version is active.
+type PromptTemplate struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Template  string    `json:"template"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PromptTemplateInfo describes the template currently used for a task
+type PromptTemplateInfo struct {
+	Name            string     `json:"name"`
+	Description     string     `json:"description"`
+	Variables       []string   `json:"variables"`
+	Template        string     `json:"template"`
+	Version         string     `json:"version"`
+	IsCustom        bool       `json:"is_custom"`
+	DefaultTemplate string     `json:"default_template"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+}
+
+type PromptTemplateUpdateRequest struct {
+	Template string `json:"template" binding:"required"`
+}
+
+// PromptPreviewRequest renders a template without saving it.
+// Template defaults to the active template; MemoryID defaults to a built-in sample memory.
+type PromptPreviewRequest struct {
+	Template *string `json:"template"`
+	MemoryID *string `json:"memory_id"`
+}
+
+type PromptPreviewResponse struct {
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+}
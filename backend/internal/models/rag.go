@@ -99,6 +99,26 @@ type AskResponse struct {
 	Sources   []SearchResult `json:"sources"`
 	Question  string         `json:"question"`
 	TimeTaken float64        `json:"time_taken_ms"`
+	Context   *ContextReport `json:"context,omitempty"` // How retrieved context was fitted to the model
+}
+
+// ContextReport describes how retrieved text was fitted into a model's context window.
+// Items are named by their labels (titles or URLs).
+type ContextReport struct {
+	Budget     int      `json:"budget"` // Tokens available for context
+	Used       int      `json:"used"`
+	Summarized []string `json:"summarized,omitempty"` // Replaced by their summary
+	Truncated  []string `json:"truncated,omitempty"`
+	Dropped    []string `json:"dropped,omitempty"`
+}
+
+// Add combines the report of another part of the same prompt into r
+func (r *ContextReport) Add(other ContextReport) {
+	r.Budget += other.Budget
+	r.Used += other.Used
+	r.Summarized = append(r.Summarized, other.Summarized...)
+	r.Truncated = append(r.Truncated, other.Truncated...)
+	r.Dropped = append(r.Dropped, other.Dropped...)
 }
 
 // IndexStats provides statistics about the vector index
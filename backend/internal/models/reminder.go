@@ -0,0 +1,99 @@
+package models
+
+import "time"
+
+// ReminderStatus tracks a reminder's delivery
+type ReminderStatus string
+
+const (
+	ReminderPending ReminderStatus = "pending"
+	ReminderSending ReminderStatus = "sending"
+	ReminderSent    ReminderStatus = "sent"
+	ReminderFailed  ReminderStatus = "failed"
+	ReminderSkipped ReminderStatus = "skipped"
+)
+
+// Reminder notifies a user about a todo, either at a fixed time (RemindAt) or a
+// number of minutes before the todo is due (OffsetMinutes)
+type Reminder struct {
+	ID            string     `json:"id"`
+	TodoID        string     `json:"todo_id"`
+	UserID        string     `json:"-"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"`
+	OffsetMinutes *int       `json:"offset_minutes,omitempty"`
+	// FireAt is when the reminder goes out, nil while a relative reminder's
+	// todo has no due date
+	FireAt    *time.Time     `json:"fire_at"`
+	Status    ReminderStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	LastError *string        `json:"last_error,omitempty"`
+	SentAt    *time.Time     `json:"sent_at,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	// RetryAt and ClaimedAt are scheduler bookkeeping
+	RetryAt   *time.Time `json:"-"`
+	ClaimedAt *time.Time `json:"-"`
+}
+
+// ReminderCreateRequest sets exactly one of RemindAt and OffsetMinutes
+type ReminderCreateRequest struct {
+	RemindAt      *time.Time `json:"remind_at"`
+	OffsetMinutes *int       `json:"offset_minutes" binding:"omitempty,min=0,max=525600"`
+}
+
+// NotificationChannel is a way reminders reach a user
+type NotificationChannel string
+
+const (
+	ChannelEmail   NotificationChannel = "email"
+	ChannelWebhook NotificationChannel = "webhook"
+	ChannelPush    NotificationChannel = "push"
+)
+
+// NotificationSettings controls which channels a user's reminders are sent through
+type NotificationSettings struct {
+	UserID       string  `json:"-"`
+	EmailEnabled bool    `json:"email_enabled"`
+	WebhookURL   *string `json:"webhook_url"`
+	// WebhookSecret signs webhook requests; it is generated with the first URL
+	WebhookSecret *string `json:"webhook_secret,omitempty"`
+	// PushPublicKey is the server's VAPID key for subscribing browsers, empty
+	// when Web Push isn't configured
+	PushPublicKey string    `json:"push_public_key"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NotificationSettingsUpdate changes notification settings; an empty webhook
+// URL removes the webhook
+type NotificationSettingsUpdate struct {
+	EmailEnabled *bool   `json:"email_enabled"`
+	WebhookURL   *string `json:"webhook_url" binding:"omitempty,url"`
+}
+
+// PushSubscription is a browser's Web Push endpoint and keys
+type PushSubscription struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"-"`
+	Auth      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushSubscriptionRequest matches the browser's PushSubscription.toJSON()
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" binding:"required,url"`
+	Keys     struct {
+		P256dh string `json:"p256dh" binding:"required"`
+		Auth   string `json:"auth" binding:"required"`
+	} `json:"keys"`
+}
+
+// ReminderNotification is what a reminder sends through each channel
+type ReminderNotification struct {
+	ReminderID  string    `json:"reminder_id"`
+	TodoID      string    `json:"todo_id"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description,omitempty"`
+	DueDate     *string   `json:"due_date,omitempty"`
+	FireAt      time.Time `json:"fire_at"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// TimeEntry is an interval of time spent on a todo, tracked with a timer or
+// entered by hand. EndedAt is nil while its timer is running, and Seconds
+// counts up to now until it stops.
+type TimeEntry struct {
+	ID        string     `json:"id"`
+	TodoID    string     `json:"todo_id"`
+	UserID    string     `json:"-"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Note      *string    `json:"note"`
+	Seconds   int64      `json:"seconds"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TimeEntryCreateRequest records time spent on a todo after the fact
+type TimeEntryCreateRequest struct {
+	StartedAt time.Time `json:"started_at" binding:"required"`
+	EndedAt   time.Time `json:"ended_at" binding:"required"`
+	Note      *string   `json:"note"`
+}
+
+// TimerStartRequest starts a timer on a todo
+type TimerStartRequest struct {
+	Note *string `json:"note"`
+}
+
+// TodoTime is the time tracked on a todo against its estimate
+type TodoTime struct {
+	Entries         []TimeEntry `json:"entries"`
+	TrackedSeconds  int64       `json:"tracked_seconds"`
+	EstimateMinutes *int        `json:"estimate_minutes"`
+}
+
+// TimeReportGrouping is what a time report totals by
+type TimeReportGrouping string
+
+const (
+	ReportByGroup TimeReportGrouping = "group"
+	// ReportByTag counts a todo's time under each of its tags
+	ReportByTag TimeReportGrouping = "tag"
+)
+
+// TimeReport totals the time tracked between two days (YYYY-MM-DD, inclusive)
+// in a timezone. Entries crossing the range only count the part inside it.
+type TimeReport struct {
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	Timezone     string             `json:"timezone"`
+	GroupBy      TimeReportGrouping `json:"group_by"`
+	TotalSeconds int64              `json:"total_seconds"`
+	Rows         []TimeReportRow    `json:"rows"`
+	// Todos compares the time tracked on each todo with its estimate
+	Todos []TodoTimeTotal `json:"todos"`
+}
+
+// TimeReportRow is the time tracked in a group or under a tag. ID is the
+// group ID or tag, nil for todos without one.
+type TimeReportRow struct {
+	ID      *string `json:"id"`
+	Name    string  `json:"name"`
+	Seconds int64   `json:"seconds"`
+	Todos   int     `json:"todos"`
+	// EstimateMinutes sums the estimates of the row's todos
+	EstimateMinutes int `json:"estimate_minutes"`
+}
+
+// TodoTimeTotal is the time tracked on one todo in a report
+type TodoTimeTotal struct {
+	TodoID          string `json:"todo_id"`
+	Title           string `json:"title"`
+	Seconds         int64  `json:"seconds"`
+	EstimateMinutes *int   `json:"estimate_minutes"`
+}
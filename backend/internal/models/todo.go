@@ -12,10 +12,28 @@ const (
 )
 
 const (
-	StatusPending   Status = "pending"
-	StatusCompleted Status = "completed"
+	StatusPending    Status = "pending"
+	StatusInProgress Status = "in_progress"
+	StatusBlocked    Status = "blocked"
+	StatusCompleted  Status = "completed"
+	StatusCancelled  Status = "cancelled"
 )
 
+// IsValid reports whether s is a known status
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusPending, StatusInProgress, StatusBlocked, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsDone reports whether a todo with this status no longer needs doing, so it
+// doesn't block the todos that depend on it
+func (s Status) IsDone() bool {
+	return s == StatusCompleted || s == StatusCancelled
+}
+
 type Todo struct {
 	ID          string    `json:"id"`
 	UserID      string    `json:"user_id"`
@@ -29,6 +47,89 @@ type Todo struct {
 	Tags        []string  `json:"tags"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// CompletedAt is when the todo was last marked completed; nil while pending
+	CompletedAt *time.Time `json:"completed_at"`
+	// Recurring todos are instances of a series. Occurrence is the instance's date
+	// in the series (YYYY-MM-DD), which stays put if only this instance is moved.
+	SeriesID   *string `json:"series_id"`
+	Occurrence *string `json:"occurrence"`
+	Recurrence *string `json:"recurrence"` // the series' RRULE
+	// Subtasks have a parent. Progress counts a todo's direct subtasks and is nil
+	// if it has none; AutoComplete completes it once they're all done.
+	ParentID     *string       `json:"parent_id"`
+	AutoComplete bool          `json:"auto_complete"`
+	Progress     *TodoProgress `json:"progress"`
+	// BlockedBy lists the todos this one depends on. While any of them is open,
+	// a pending or in-progress todo is blocked.
+	BlockedBy []string `json:"blocked_by"`
+	// EstimateMinutes is how long the todo is expected to take, compared with
+	// the time tracked on it
+	EstimateMinutes *int `json:"estimate_minutes"`
+	// ColumnID is the board column the todo was last moved to, and
+	// ColumnPosition its place there
+	ColumnID       *string `json:"column_id"`
+	ColumnPosition *int    `json:"-"`
+	// ICalUID is the UID of the calendar entry the todo was imported from
+	ICalUID *string `json:"-"`
+	// Parsed is set on a todo just created with parse, saying what was inferred
+	// from its title
+	Parsed *TodoParse `json:"parsed,omitempty"`
+}
+
+// TodoParse is what was read from a todo's title: Source is "rules" for the
+// built-in parser or "ai" for the model, and fields it didn't fill in are nil.
+// Fields the request set explicitly are never inferred.
+type TodoParse struct {
+	Source     string    `json:"source"`
+	Timezone   string    `json:"timezone"`
+	DueDate    *string   `json:"due_date,omitempty"`
+	Priority   *Priority `json:"priority,omitempty"`
+	GroupID    *string   `json:"group_id,omitempty"`
+	Recurrence *string   `json:"recurrence,omitempty"`
+}
+
+type TodoProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// TodoScope picks which todos of a series an edit applies to
+type TodoScope string
+
+const (
+	ScopeInstance TodoScope = "instance"
+	ScopeSeries   TodoScope = "series"
+)
+
+// TodoSeries is a recurring todo: the RFC 5545 rule its instances follow and the
+// template they're generated from
+type TodoSeries struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	RRule       string    `json:"rrule"`
+	DTStart     string    `json:"dtstart"`  // first occurrence, YYYY-MM-DD
+	DueTime     string    `json:"due_time"` // due date suffix after the day, e.g. "T09:30"
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	Priority    Priority  `json:"priority"`
+	GroupID     *string   `json:"group_id"`
+	Tags        []string  `json:"tags"`
+	ExDates     []string  `json:"exdates"` // skipped occurrences
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UpcomingTodo is a pending instance of a recurring todo, or a projected
+// occurrence that will be generated once the ones before it are done
+type UpcomingTodo struct {
+	Todo
+	Projected bool `json:"projected"`
+}
+
+type UpcomingTodos struct {
+	From  string         `json:"from"`
+	To    string         `json:"to"`
+	Todos []UpcomingTodo `json:"todos"`
 }
 
 type TodoCreateRequest struct {
@@ -37,6 +138,19 @@ type TodoCreateRequest struct {
 	DueDate     *string  `json:"due_date"`
 	Priority    Priority `json:"priority"`
 	GroupID     *string  `json:"group_id"`
+	// Recurrence is an RRULE such as "FREQ=WEEKLY;BYDAY=MO"; RecurrenceEnd
+	// (YYYY-MM-DD) is the last day it may recur on
+	Recurrence    *string `json:"recurrence"`
+	RecurrenceEnd *string `json:"recurrence_end"`
+	// ParentID makes the todo a subtask, in its parent's group unless GroupID is set
+	ParentID        *string `json:"parent_id"`
+	AutoComplete    bool    `json:"auto_complete"`
+	EstimateMinutes *int    `json:"estimate_minutes" binding:"omitempty,min=1"`
+	// Parse reads the due date, time, priority, group (#name) and recurrence
+	// from the title, as in "call mom tomorrow 5pm high priority". Dates are in
+	// Timezone (an IANA name), defaulting to the user's digest timezone.
+	Parse    bool    `json:"parse"`
+	Timezone *string `json:"timezone"`
 }
 
 type TodoUpdateRequest struct {
@@ -44,10 +158,24 @@ type TodoUpdateRequest struct {
 	Description *string   `json:"description"`
 	DueDate     *string   `json:"due_date"`
 	Priority    *Priority `json:"priority"`
-	Status      *Status   `json:"status"`
+	Status      *Status   `json:"status" binding:"omitempty,oneof=pending in_progress blocked completed cancelled"`
 	GroupID     *string   `json:"group_id"`
 	Position    *string   `json:"position"`
 	Tags        []string  `json:"tags"`
+	// Recurrence changes or, when empty, ends the series. Scope "series" also
+	// applies the other changes to the series and its later instances.
+	Recurrence    *string   `json:"recurrence"`
+	RecurrenceEnd *string   `json:"recurrence_end"`
+	Scope         TodoScope `json:"scope" binding:"omitempty,oneof=instance series"`
+	// ParentID moves the todo under another one, or to the top level when empty
+	ParentID     *string `json:"parent_id"`
+	AutoComplete *bool   `json:"auto_complete"`
+	// EstimateMinutes changes the estimate, or removes it when 0
+	EstimateMinutes *int `json:"estimate_minutes" binding:"omitempty,min=0"`
+}
+
+type TodoDependencyRequest struct {
+	BlockerID string `json:"blocker_id" binding:"required"`
 }
 
 type TodoReorderRequest struct {
@@ -58,3 +186,72 @@ type TodoPosition struct {
 	ID       string `json:"id" binding:"required"`
 	Position string `json:"position" binding:"required"`
 }
+
+// TodoMoveAfterRequest moves a todo right after AfterID in the list, or first
+// when AfterID is empty
+type TodoMoveAfterRequest struct {
+	AfterID *string `json:"after_id"`
+}
+
+// TodoSort is the order todos are listed in
+type TodoSort string
+
+const (
+	SortPosition  TodoSort = "position"
+	SortDueDate   TodoSort = "due_date" // todos without one come last
+	SortPriority  TodoSort = "priority" // high first
+	SortCreatedAt TodoSort = "created_at"
+	SortUpdatedAt TodoSort = "updated_at"
+	SortTitle     TodoSort = "title"
+)
+
+// IsValid reports whether s is a known sort order
+func (s TodoSort) IsValid() bool {
+	switch s {
+	case SortPosition, SortDueDate, SortPriority, SortCreatedAt, SortUpdatedAt, SortTitle:
+		return true
+	}
+	return false
+}
+
+// TodoFilter selects and orders the todos listed. Empty fields match all todos.
+type TodoFilter struct {
+	Statuses   []Status
+	Priorities []Priority
+	// GroupIDs matches todos in any of the groups; "" matches todos without one
+	GroupIDs []string
+	// Tags matches todos with all of the tags
+	Tags []string
+	// DueFrom and DueTo match todos due on or between the days (YYYY-MM-DD)
+	DueFrom string
+	DueTo   string
+	// Overdue matches open todos due before Now, or before Today for todos
+	// due on a day without a time
+	Overdue bool
+	Now     time.Time
+	Today   string
+	// Query matches text in the title or description
+	Query      string
+	Sort       TodoSort
+	Descending bool
+	// Limit is the most todos listed, 0 for all of them. After continues
+	// from the end of the page before.
+	Limit int
+	After *TodoCursor
+}
+
+// TodoCursor is where a page of todos ended: the order it was in, and the
+// sort key and ID of its last todo
+type TodoCursor struct {
+	Sort       TodoSort    `json:"s"`
+	Descending bool        `json:"d,omitempty"`
+	Key        interface{} `json:"k"`
+	ID         string      `json:"id"`
+}
+
+// TodoPage is a page of todos. NextCursor fetches the next page, and is nil
+// on the last one.
+type TodoPage struct {
+	Todos      []Todo  `json:"todos"`
+	NextCursor *string `json:"next_cursor"`
+}
@@ -17,8 +17,8 @@ func NewAIProviderRepository(db *sql.DB) *AIProviderRepository {
 
 func (r *AIProviderRepository) Create(provider *models.AIProvider) error {
 	query := `
-		INSERT INTO ai_providers (id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, is_default, is_enabled, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO ai_providers (id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	_, err := r.db.Exec(query,
 		provider.ID,
@@ -28,6 +28,7 @@ func (r *AIProviderRepository) Create(provider *models.AIProvider) error {
 		provider.BaseURL,
 		provider.APIKeyEncrypted,
 		provider.SelectedModel,
+		provider.VisionModel,
 		provider.IsDefault,
 		provider.IsEnabled,
 		provider.CreatedAt,
@@ -36,13 +37,14 @@ func (r *AIProviderRepository) Create(provider *models.AIProvider) error {
 	return err
 }
 
+// GetByID returns a provider, or nil if there is none with the id
 func (r *AIProviderRepository) GetByID(id string) (*models.AIProvider, error) {
 	query := `
-		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, is_default, is_enabled, created_at, updated_at
+		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at
 		FROM ai_providers WHERE id = ?
 	`
 	var provider models.AIProvider
-	var selectedModel sql.NullString
+	var selectedModel, visionModel sql.NullString
 	err := r.db.QueryRow(query, id).Scan(
 		&provider.ID,
 		&provider.UserID,
@@ -51,23 +53,30 @@ func (r *AIProviderRepository) GetByID(id string) (*models.AIProvider, error) {
 		&provider.BaseURL,
 		&provider.APIKeyEncrypted,
 		&selectedModel,
+		&visionModel,
 		&provider.IsDefault,
 		&provider.IsEnabled,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	if selectedModel.Valid {
 		provider.SelectedModel = &selectedModel.String
 	}
+	if visionModel.Valid {
+		provider.VisionModel = &visionModel.String
+	}
 	return &provider, nil
 }
 
 func (r *AIProviderRepository) GetByUserID(userID string) ([]models.AIProvider, error) {
 	query := `
-		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, is_default, is_enabled, created_at, updated_at
+		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at
 		FROM ai_providers WHERE user_id = ? ORDER BY created_at DESC
 	`
 	rows, err := r.db.Query(query, userID)
@@ -79,7 +88,7 @@ func (r *AIProviderRepository) GetByUserID(userID string) ([]models.AIProvider,
 	var providers []models.AIProvider
 	for rows.Next() {
 		var provider models.AIProvider
-		var selectedModel sql.NullString
+		var selectedModel, visionModel sql.NullString
 		if err := rows.Scan(
 			&provider.ID,
 			&provider.UserID,
@@ -88,6 +97,7 @@ func (r *AIProviderRepository) GetByUserID(userID string) ([]models.AIProvider,
 			&provider.BaseURL,
 			&provider.APIKeyEncrypted,
 			&selectedModel,
+			&visionModel,
 			&provider.IsDefault,
 			&provider.IsEnabled,
 			&provider.CreatedAt,
@@ -98,6 +108,9 @@ func (r *AIProviderRepository) GetByUserID(userID string) ([]models.AIProvider,
 		if selectedModel.Valid {
 			provider.SelectedModel = &selectedModel.String
 		}
+		if visionModel.Valid {
+			provider.VisionModel = &visionModel.String
+		}
 		providers = append(providers, provider)
 	}
 	return providers, nil
@@ -105,11 +118,46 @@ func (r *AIProviderRepository) GetByUserID(userID string) ([]models.AIProvider,
 
 func (r *AIProviderRepository) GetDefaultByUserID(userID string) (*models.AIProvider, error) {
 	query := `
-		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, is_default, is_enabled, created_at, updated_at
+		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at
 		FROM ai_providers WHERE user_id = ? AND is_default = 1 AND is_enabled = 1 LIMIT 1
 	`
 	var provider models.AIProvider
-	var selectedModel sql.NullString
+	var selectedModel, visionModel sql.NullString
+	err := r.db.QueryRow(query, userID).Scan(
+		&provider.ID,
+		&provider.UserID,
+		&provider.Name,
+		&provider.ProviderType,
+		&provider.BaseURL,
+		&provider.APIKeyEncrypted,
+		&selectedModel,
+		&visionModel,
+		&provider.IsDefault,
+		&provider.IsEnabled,
+		&provider.CreatedAt,
+		&provider.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if selectedModel.Valid {
+		provider.SelectedModel = &selectedModel.String
+	}
+	if visionModel.Valid {
+		provider.VisionModel = &visionModel.String
+	}
+	return &provider, nil
+}
+
+// GetVisionByUserID returns the enabled provider holding the user's vision model selection
+func (r *AIProviderRepository) GetVisionByUserID(userID string) (*models.AIProvider, error) {
+	query := `
+		SELECT id, user_id, name, provider_type, base_url, api_key_encrypted, selected_model, vision_model, is_default, is_enabled, created_at, updated_at
+		FROM ai_providers WHERE user_id = ? AND vision_model IS NOT NULL AND vision_model != '' AND is_enabled = 1
+		ORDER BY is_default DESC, updated_at DESC LIMIT 1
+	`
+	var provider models.AIProvider
+	var selectedModel, visionModel sql.NullString
 	err := r.db.QueryRow(query, userID).Scan(
 		&provider.ID,
 		&provider.UserID,
@@ -118,6 +166,7 @@ func (r *AIProviderRepository) GetDefaultByUserID(userID string) (*models.AIProv
 		&provider.BaseURL,
 		&provider.APIKeyEncrypted,
 		&selectedModel,
+		&visionModel,
 		&provider.IsDefault,
 		&provider.IsEnabled,
 		&provider.CreatedAt,
@@ -129,13 +178,16 @@ func (r *AIProviderRepository) GetDefaultByUserID(userID string) (*models.AIProv
 	if selectedModel.Valid {
 		provider.SelectedModel = &selectedModel.String
 	}
+	if visionModel.Valid {
+		provider.VisionModel = &visionModel.String
+	}
 	return &provider, nil
 }
 
 func (r *AIProviderRepository) Update(provider *models.AIProvider) error {
 	query := `
 		UPDATE ai_providers
-		SET name = ?, base_url = ?, api_key_encrypted = ?, selected_model = ?, is_default = ?, is_enabled = ?, updated_at = ?
+		SET name = ?, base_url = ?, api_key_encrypted = ?, selected_model = ?, vision_model = ?, is_default = ?, is_enabled = ?, updated_at = ?
 		WHERE id = ?
 	`
 	_, err := r.db.Exec(query,
@@ -143,6 +195,7 @@ func (r *AIProviderRepository) Update(provider *models.AIProvider) error {
 		provider.BaseURL,
 		provider.APIKeyEncrypted,
 		provider.SelectedModel,
+		provider.VisionModel,
 		provider.IsDefault,
 		provider.IsEnabled,
 		time.Now(),
@@ -161,6 +214,12 @@ func (r *AIProviderRepository) ClearDefaultForUser(userID string) error {
 	return err
 }
 
+// ClearVisionModelForUser unsets the vision model on all of a user's providers
+func (r *AIProviderRepository) ClearVisionModelForUser(userID string) error {
+	_, err := r.db.Exec("UPDATE ai_providers SET vision_model = NULL WHERE user_id = ?", userID)
+	return err
+}
+
 // Model methods
 func (r *AIProviderRepository) SaveModels(providerID string, models []models.AIProviderModel) error {
 	// Delete existing models
@@ -170,8 +229,13 @@ func (r *AIProviderRepository) SaveModels(providerID string, models []models.AIP
 
 	// Insert new models
 	for _, model := range models {
-		query := `INSERT INTO ai_provider_models (id, provider_id, model_id, model_name, created_at) VALUES (?, ?, ?, ?, ?)`
-		if _, err := r.db.Exec(query, model.ID, model.ProviderID, model.ModelID, model.ModelName, model.CreatedAt); err != nil {
+		query := `
+			INSERT INTO ai_provider_models (id, provider_id, model_id, model_name, context_window, supports_vision, supports_tools, supports_json, supports_streaming, supports_embedding, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		caps := model.Capabilities
+		if _, err := r.db.Exec(query, model.ID, model.ProviderID, model.ModelID, model.ModelName,
+			caps.ContextWindow, caps.Vision, caps.Tools, caps.JSONMode, caps.Streaming, caps.Embedding, model.CreatedAt); err != nil {
 			return err
 		}
 	}
@@ -179,7 +243,10 @@ func (r *AIProviderRepository) SaveModels(providerID string, models []models.AIP
 }
 
 func (r *AIProviderRepository) GetModelsByProviderID(providerID string) ([]models.AIProviderModel, error) {
-	query := `SELECT id, provider_id, model_id, model_name, created_at FROM ai_provider_models WHERE provider_id = ? ORDER BY model_name`
+	query := `
+		SELECT id, provider_id, model_id, model_name, context_window, supports_vision, supports_tools, supports_json, supports_streaming, supports_embedding, created_at
+		FROM ai_provider_models WHERE provider_id = ? ORDER BY model_name
+	`
 	rows, err := r.db.Query(query, providerID)
 	if err != nil {
 		return nil, err
@@ -189,10 +256,28 @@ func (r *AIProviderRepository) GetModelsByProviderID(providerID string) ([]model
 	var providerModels []models.AIProviderModel
 	for rows.Next() {
 		var model models.AIProviderModel
-		if err := rows.Scan(&model.ID, &model.ProviderID, &model.ModelID, &model.ModelName, &model.CreatedAt); err != nil {
+		caps := &model.Capabilities
+		if err := rows.Scan(&model.ID, &model.ProviderID, &model.ModelID, &model.ModelName,
+			&caps.ContextWindow, &caps.Vision, &caps.Tools, &caps.JSONMode, &caps.Streaming, &caps.Embedding, &model.CreatedAt); err != nil {
 			return nil, err
 		}
 		providerModels = append(providerModels, model)
 	}
 	return providerModels, nil
 }
+
+// GetModel returns one cached model of a provider
+func (r *AIProviderRepository) GetModel(providerID, modelID string) (*models.AIProviderModel, error) {
+	query := `
+		SELECT id, provider_id, model_id, model_name, context_window, supports_vision, supports_tools, supports_json, supports_streaming, supports_embedding, created_at
+		FROM ai_provider_models WHERE provider_id = ? AND model_id = ?
+	`
+	var model models.AIProviderModel
+	caps := &model.Capabilities
+	err := r.db.QueryRow(query, providerID, modelID).Scan(&model.ID, &model.ProviderID, &model.ModelID, &model.ModelName,
+		&caps.ContextWindow, &caps.Vision, &caps.Tools, &caps.JSONMode, &caps.Streaming, &caps.Embedding, &model.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &model, nil
+}
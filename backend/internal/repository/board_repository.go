@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todomyday/backend/internal/models"
+)
+
+// BoardRepository stores the columns of users' group boards
+type BoardRepository struct {
+	db *sql.DB
+}
+
+func NewBoardRepository(db *sql.DB) *BoardRepository {
+	return &BoardRepository{db: db}
+}
+
+const boardColumnColumns = "id, user_id, group_id, name, status, position, created_at"
+
+func scanBoardColumn(row interface{ Scan(...interface{}) error }) (*models.BoardColumn, error) {
+	column := &models.BoardColumn{}
+	var status sql.NullString
+
+	err := row.Scan(&column.ID, &column.UserID, &column.GroupID, &column.Name, &status, &column.Position, &column.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if status.Valid {
+		s := models.Status(status.String)
+		column.Status = &s
+	}
+	return column, nil
+}
+
+// GetColumns returns the columns of the user's board for a group, in order
+func (r *BoardRepository) GetColumns(userID, groupID string) ([]models.BoardColumn, error) {
+	rows, err := r.db.Query(`
+		SELECT `+boardColumnColumns+` FROM board_columns
+		WHERE user_id = ? AND group_id = ?
+		ORDER BY position, created_at
+	`, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []models.BoardColumn{}
+	for rows.Next() {
+		column, err := scanBoardColumn(rows)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, *column)
+	}
+	return columns, rows.Err()
+}
+
+func (r *BoardRepository) GetColumn(id string) (*models.BoardColumn, error) {
+	column, err := scanBoardColumn(r.db.QueryRow(`
+		SELECT `+boardColumnColumns+` FROM board_columns WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return column, err
+}
+
+// CreateColumns adds columns to a board together
+func (r *BoardRepository) CreateColumns(columns []*models.BoardColumn) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, column := range columns {
+		column.ID = uuid.New().String()
+		column.CreatedAt = time.Now()
+		if _, err := tx.Exec(`
+			INSERT INTO board_columns (id, user_id, group_id, name, status, position, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, column.ID, column.UserID, column.GroupID, column.Name, column.Status, column.Position, column.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateColumn sets a column's name and status
+func (r *BoardRepository) UpdateColumn(column *models.BoardColumn) error {
+	_, err := r.db.Exec(`
+		UPDATE board_columns SET name = ?, status = ? WHERE id = ?
+	`, column.Name, column.Status, column.ID)
+	return err
+}
+
+// SetOrder numbers columns in the order given
+func (r *BoardRepository) SetOrder(columnIDs []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range columnIDs {
+		if _, err := tx.Exec("UPDATE board_columns SET position = ? WHERE id = ?", i, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteColumn deletes a column. Its todos fall back to the column for their status.
+func (r *BoardRepository) DeleteColumn(id string) error {
+	_, err := r.db.Exec("DELETE FROM board_columns WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+type CalendarRepository struct {
+	db *sql.DB
+}
+
+func NewCalendarRepository(db *sql.DB) *CalendarRepository {
+	return &CalendarRepository{db: db}
+}
+
+// GetFeed returns the user's iCalendar feed, or nil if they have none
+func (r *CalendarRepository) GetFeed(userID string) (*models.CalendarFeed, error) {
+	feed := &models.CalendarFeed{UserID: userID}
+	err := r.db.QueryRow(`
+		SELECT token, created_at FROM calendar_feeds WHERE user_id = ?
+	`, userID).Scan(&feed.Token, &feed.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// GetFeedByToken returns the feed with the given secret token, or nil
+func (r *CalendarRepository) GetFeedByToken(token string) (*models.CalendarFeed, error) {
+	feed := &models.CalendarFeed{Token: token}
+	err := r.db.QueryRow(`
+		SELECT user_id, created_at FROM calendar_feeds WHERE token = ?
+	`, token).Scan(&feed.UserID, &feed.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// SaveFeed creates the user's feed or replaces its token
+func (r *CalendarRepository) SaveFeed(feed *models.CalendarFeed) error {
+	feed.CreatedAt = time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO calendar_feeds (user_id, token, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET token = excluded.token, created_at = excluded.created_at
+	`, feed.UserID, feed.Token, feed.CreatedAt)
+	return err
+}
+
+// DeleteFeed removes the user's feed and reports whether they had one
+func (r *CalendarRepository) DeleteFeed(userID string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM calendar_feeds WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+type DAVRepository struct {
+	db *sql.DB
+}
+
+func NewDAVRepository(db *sql.DB) *DAVRepository {
+	return &DAVRepository{db: db}
+}
+
+// GetCredentials returns the user's CalDAV credentials, or nil if they have none
+func (r *DAVRepository) GetCredentials(userID string) (*models.DAVCredentials, error) {
+	credentials := &models.DAVCredentials{UserID: userID}
+	err := r.db.QueryRow(`
+		SELECT password_hash, created_at FROM dav_credentials WHERE user_id = ?
+	`, userID).Scan(&credentials.PasswordHash, &credentials.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// SaveCredentials creates the user's credentials or replaces their password
+func (r *DAVRepository) SaveCredentials(credentials *models.DAVCredentials) error {
+	credentials.CreatedAt = time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO dav_credentials (user_id, password_hash, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET password_hash = excluded.password_hash, created_at = excluded.created_at
+	`, credentials.UserID, credentials.PasswordHash, credentials.CreatedAt)
+	return err
+}
+
+// DeleteCredentials removes the user's credentials and reports whether they had any
+func (r *DAVRepository) DeleteCredentials(userID string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM dav_credentials WHERE user_id = ?", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetLatestChange returns the sequence number of the last change to the
+// todos in a group, or the user's ungrouped todos if groupID is nil
+func (r *DAVRepository) GetLatestChange(userID string, groupID *string) (int64, error) {
+	var seq int64
+	err := r.db.QueryRow(`
+		SELECT COALESCE(MAX(seq), 0) FROM todo_changes WHERE user_id = ? AND group_id IS ?
+	`, userID, groupID).Scan(&seq)
+	return seq, err
+}
+
+// GetChanges returns the latest change to each todo in a group, or the user's
+// ungrouped todos if groupID is nil, after the change numbered since
+func (r *DAVRepository) GetChanges(userID string, groupID *string, since int64) ([]models.TodoChange, error) {
+	rows, err := r.db.Query(`
+		SELECT c.seq, c.todo_id, c.uid, c.deleted FROM todo_changes c
+		WHERE c.user_id = ? AND c.group_id IS ? AND c.seq > ?
+		AND c.seq = (
+			SELECT MAX(seq) FROM todo_changes
+			WHERE user_id = c.user_id AND group_id IS c.group_id AND todo_id = c.todo_id
+		)
+		ORDER BY c.seq
+	`, userID, groupID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.TodoChange{}
+	for rows.Next() {
+		var change models.TodoChange
+		if err := rows.Scan(&change.Seq, &change.TodoID, &change.UID, &change.Deleted); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
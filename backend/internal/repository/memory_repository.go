@@ -2,6 +2,8 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -26,9 +28,15 @@ func (r *MemoryRepository) Create(memory *models.Memory) error {
 		memory.Category = "Uncategorized"
 	}
 
+	// New memories go at the end of the user's list
 	if memory.Position == "" {
-		memory.Position = "1000"
+		position, err := memoryPositions.next(r.db, memory.UserID)
+		if err != nil {
+			return err
+		}
+		memory.Position = position
 	}
+
 	_, err := r.db.Exec(`
 		INSERT INTO memories (id, user_id, content, summary, category, url, url_title, url_content, is_archived, position, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -80,7 +88,7 @@ func (r *MemoryRepository) GetAllByUserID(userID string, limit, offset int) ([]m
 		SELECT id, user_id, content, summary, category, url, url_title, url_content, is_archived, position, created_at, updated_at
 		FROM memories
 		WHERE user_id = ? AND is_archived = 0
-		ORDER BY CAST(position AS INTEGER) ASC, created_at DESC
+		ORDER BY position ASC, created_at DESC
 		LIMIT ? OFFSET ?
 	`, userID, limit, offset)
 	if err != nil {
@@ -100,7 +108,7 @@ func (r *MemoryRepository) GetByCategory(userID, category string, limit, offset
 		SELECT id, user_id, content, summary, category, url, url_title, url_content, is_archived, position, created_at, updated_at
 		FROM memories
 		WHERE user_id = ? AND category = ? AND is_archived = 0
-		ORDER BY CAST(position AS INTEGER) ASC, created_at DESC
+		ORDER BY position ASC, created_at DESC
 		LIMIT ? OFFSET ?
 	`, userID, category, limit, offset)
 	if err != nil {
@@ -140,7 +148,7 @@ func (r *MemoryRepository) Search(userID string, req *models.MemorySearchRequest
 		args = append(args, *req.DateTo)
 	}
 
-	query += " ORDER BY CAST(position AS INTEGER) ASC, created_at DESC"
+	query += " ORDER BY position ASC, created_at DESC"
 
 	limit := req.Limit
 	if limit <= 0 {
@@ -163,7 +171,7 @@ func (r *MemoryRepository) GetByDateRange(userID string, from, to time.Time) ([]
 		SELECT id, user_id, content, summary, category, url, url_title, url_content, is_archived, position, created_at, updated_at
 		FROM memories
 		WHERE user_id = ? AND is_archived = 0 AND created_at >= ? AND created_at <= ?
-		ORDER BY CAST(position AS INTEGER) ASC, created_at DESC
+		ORDER BY position ASC, created_at DESC
 	`, userID, from, to)
 	if err != nil {
 		return nil, err
@@ -296,15 +304,54 @@ func (r *MemoryRepository) GetCategoryStats(userID string) (map[string]int, erro
 
 // Digests
 
-func (r *MemoryRepository) GetDigest(userID string, weekStart time.Time) (*models.MemoryDigest, error) {
+const digestColumns = "id, user_id, period, week_start, week_end, digest_content, sections, created_at"
+
+func scanDigest(row interface{ Scan(...interface{}) error }) (*models.MemoryDigest, error) {
 	digest := &models.MemoryDigest{}
-	weekStartStr := weekStart.Format("2006-01-02")
+	var sections sql.NullString
+	err := row.Scan(&digest.ID, &digest.UserID, &digest.Period, &digest.WeekStart, &digest.WeekEnd, &digest.DigestContent, &sections, &digest.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if sections.Valid && sections.String != "" {
+		digest.Sections = &models.DigestSections{}
+		if err := json.Unmarshal([]byte(sections.String), digest.Sections); err != nil {
+			return nil, fmt.Errorf("failed to decode digest sections: %w", err)
+		}
+	}
+	// DATE columns come back as full timestamps from some drivers
+	if len(digest.WeekStart) > 10 {
+		digest.WeekStart = digest.WeekStart[:10]
+	}
+	if len(digest.WeekEnd) > 10 {
+		digest.WeekEnd = digest.WeekEnd[:10]
+	}
+	return digest, nil
+}
 
-	err := r.db.QueryRow(`
-		SELECT id, user_id, week_start, week_end, digest_content, created_at
+func (r *MemoryRepository) GetDigest(userID string, period models.DigestPeriod, periodStart time.Time) (*models.MemoryDigest, error) {
+	digest, err := scanDigest(r.db.QueryRow(`
+		SELECT `+digestColumns+`
+		FROM memory_digests
+		WHERE user_id = ? AND period = ? AND week_start = ?
+	`, userID, period, periodStart.Format("2006-01-02")))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return digest, nil
+}
+
+func (r *MemoryRepository) GetDigestByID(id string) (*models.MemoryDigest, error) {
+	digest, err := scanDigest(r.db.QueryRow(`
+		SELECT `+digestColumns+`
 		FROM memory_digests
-		WHERE user_id = ? AND week_start = ?
-	`, userID, weekStartStr).Scan(&digest.ID, &digest.UserID, &digest.WeekStart, &digest.WeekEnd, &digest.DigestContent, &digest.CreatedAt)
+		WHERE id = ?
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -316,20 +363,355 @@ func (r *MemoryRepository) GetDigest(userID string, weekStart time.Time) (*model
 	return digest, nil
 }
 
+// ListDigests returns a user's digests, newest period first. An empty period lists all.
+func (r *MemoryRepository) ListDigests(userID string, period models.DigestPeriod, limit, offset int) ([]models.MemoryDigest, error) {
+	query := `SELECT ` + digestColumns + ` FROM memory_digests WHERE user_id = ?`
+	args := []interface{}{userID}
+	if period != "" {
+		query += " AND period = ?"
+		args = append(args, period)
+	}
+	query += " ORDER BY week_start DESC, period ASC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	digests := []models.MemoryDigest{}
+	for rows.Next() {
+		digest, err := scanDigest(rows)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, *digest)
+	}
+
+	return digests, rows.Err()
+}
+
 func (r *MemoryRepository) SaveDigest(digest *models.MemoryDigest) error {
 	digest.ID = uuid.New().String()
 	digest.CreatedAt = time.Now()
+	if digest.Period == "" {
+		digest.Period = models.DigestWeekly
+	}
+
+	var sections interface{}
+	if digest.Sections != nil {
+		data, err := json.Marshal(digest.Sections)
+		if err != nil {
+			return err
+		}
+		sections = string(data)
+	}
 
 	_, err := r.db.Exec(`
-		INSERT OR REPLACE INTO memory_digests (id, user_id, week_start, week_end, digest_content, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, digest.ID, digest.UserID, digest.WeekStart, digest.WeekEnd, digest.DigestContent, digest.CreatedAt)
+		INSERT OR REPLACE INTO memory_digests (id, user_id, period, week_start, week_end, digest_content, sections, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, digest.ID, digest.UserID, digest.Period, digest.WeekStart, digest.WeekEnd, digest.DigestContent, sections, digest.CreatedAt)
+
+	return err
+}
+
+// Digest settings
+
+// defaultDigestSettings applies to users who never changed their digest schedule
+func defaultDigestSettings(userID string) *models.DigestSettings {
+	return &models.DigestSettings{
+		UserID:    userID,
+		Enabled:   true,
+		Cadence:   models.DigestWeekly,
+		Timezone:  "UTC",
+		WeekStart: int(time.Sunday),
+	}
+}
+
+// GetDigestSettings returns a user's digest schedule, or the defaults if they have none
+func (r *MemoryRepository) GetDigestSettings(userID string) (*models.DigestSettings, error) {
+	settings := &models.DigestSettings{UserID: userID}
+	var token sql.NullString
+	err := r.db.QueryRow(`
+		SELECT enabled, cadence, timezone, week_start, email_enabled, unsubscribe_token, updated_at
+		FROM digest_settings
+		WHERE user_id = ?
+	`, userID).Scan(&settings.Enabled, &settings.Cadence, &settings.Timezone, &settings.WeekStart, &settings.EmailEnabled, &token, &settings.UpdatedAt)
+	settings.UnsubscribeToken = token.String
+
+	if err == sql.ErrNoRows {
+		return defaultDigestSettings(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// ListDigestSettings returns the digest schedule of every user, with defaults filled in
+func (r *MemoryRepository) ListDigestSettings() ([]models.DigestSettings, error) {
+	rows, err := r.db.Query(`
+		SELECT u.id, ds.enabled, ds.cadence, ds.timezone, ds.week_start, ds.email_enabled, ds.unsubscribe_token, ds.updated_at
+		FROM users u
+		LEFT JOIN digest_settings ds ON ds.user_id = u.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []models.DigestSettings
+	for rows.Next() {
+		var userID string
+		var enabled, emailEnabled sql.NullBool
+		var cadence, timezone, token sql.NullString
+		var weekStart sql.NullInt64
+		var updatedAt sql.NullTime
+		if err := rows.Scan(&userID, &enabled, &cadence, &timezone, &weekStart, &emailEnabled, &token, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		settings := defaultDigestSettings(userID)
+		if cadence.Valid {
+			settings.Enabled = enabled.Bool
+			settings.Cadence = models.DigestPeriod(cadence.String)
+			settings.Timezone = timezone.String
+			settings.WeekStart = int(weekStart.Int64)
+			settings.EmailEnabled = emailEnabled.Bool
+			settings.UnsubscribeToken = token.String
+			settings.UpdatedAt = updatedAt.Time
+		}
+		all = append(all, *settings)
+	}
+
+	return all, rows.Err()
+}
+
+func (r *MemoryRepository) SaveDigestSettings(settings *models.DigestSettings) error {
+	settings.UpdatedAt = time.Now()
+
+	var token interface{}
+	if settings.UnsubscribeToken != "" {
+		token = settings.UnsubscribeToken
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO digest_settings (user_id, enabled, cadence, timezone, week_start, email_enabled, unsubscribe_token, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			enabled = excluded.enabled,
+			cadence = excluded.cadence,
+			timezone = excluded.timezone,
+			week_start = excluded.week_start,
+			email_enabled = excluded.email_enabled,
+			unsubscribe_token = excluded.unsubscribe_token,
+			updated_at = excluded.updated_at
+	`, settings.UserID, settings.Enabled, settings.Cadence, settings.Timezone, settings.WeekStart, settings.EmailEnabled, token, settings.UpdatedAt)
 
 	return err
 }
 
+// DisableDigestEmail turns off digest emails for the holder of an unsubscribe
+// token. It reports whether the token matched anyone.
+// HasUnsubscribeToken reports whether a digest unsubscribe token belongs to a user
+func (r *MemoryRepository) HasUnsubscribeToken(token string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM digest_settings WHERE unsubscribe_token = ?)
+	`, token).Scan(&exists)
+	return exists, err
+}
+
+func (r *MemoryRepository) DisableDigestEmail(token string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE digest_settings SET email_enabled = 0, updated_at = ?
+		WHERE unsubscribe_token = ?
+	`, time.Now(), token)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
 // Stats
 
+// Reviews
+
+const reviewColumns = "memory_id, user_id, learn, ease, interval_days, repetitions, lapses, review_count, due_date, last_outcome, last_reviewed_at, created_at, updated_at"
+
+func scanReview(row interface{ Scan(...interface{}) error }) (*models.MemoryReview, error) {
+	review := &models.MemoryReview{}
+	var learn int
+	var lastOutcome sql.NullString
+	var lastReviewedAt sql.NullTime
+	err := row.Scan(&review.MemoryID, &review.UserID, &learn, &review.Ease, &review.IntervalDays, &review.Repetitions, &review.Lapses, &review.ReviewCount, &review.DueDate, &lastOutcome, &lastReviewedAt, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	review.Learn = learn == 1
+	// DATE columns come back as full timestamps from some drivers
+	if len(review.DueDate) > 10 {
+		review.DueDate = review.DueDate[:10]
+	}
+	if lastOutcome.Valid {
+		outcome := models.ReviewOutcome(lastOutcome.String)
+		review.LastOutcome = &outcome
+	}
+	if lastReviewedAt.Valid {
+		review.LastReviewedAt = &lastReviewedAt.Time
+	}
+	return review, nil
+}
+
+// GetReview returns a memory's review schedule, or nil if it was never marked to learn
+func (r *MemoryRepository) GetReview(memoryID string) (*models.MemoryReview, error) {
+	review, err := scanReview(r.db.QueryRow(`
+		SELECT `+reviewColumns+`
+		FROM memory_reviews
+		WHERE memory_id = ?
+	`, memoryID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return review, err
+}
+
+// SetLearn marks or unmarks a memory to learn. A memory marked for the first time
+// is due on dueDate; one marked again picks up its old schedule.
+func (r *MemoryRepository) SetLearn(memoryID, userID string, learn bool, dueDate string) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO memory_reviews (memory_id, user_id, learn, due_date, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(memory_id) DO UPDATE SET
+			learn = excluded.learn,
+			updated_at = excluded.updated_at
+	`, memoryID, userID, learn, dueDate, now, now)
+	return err
+}
+
+// SaveReview stores a memory's new schedule together with the review that set it
+func (r *MemoryRepository) SaveReview(review *models.MemoryReview, entry *models.MemoryReviewLog) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	review.UpdatedAt = time.Now()
+	_, err = tx.Exec(`
+		UPDATE memory_reviews SET
+			ease = ?, interval_days = ?, repetitions = ?, lapses = ?, review_count = ?,
+			due_date = ?, last_outcome = ?, last_reviewed_at = ?, updated_at = ?
+		WHERE memory_id = ?
+	`, review.Ease, review.IntervalDays, review.Repetitions, review.Lapses, review.ReviewCount,
+		review.DueDate, review.LastOutcome, review.LastReviewedAt, review.UpdatedAt, review.MemoryID)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO memory_review_log (id, memory_id, user_id, outcome, interval_days, due_date, reviewed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.MemoryID, review.UserID, entry.Outcome, entry.IntervalDays, entry.DueDate, entry.ReviewedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListDueReviews returns the schedules of the user's unarchived memories marked to
+// learn that are due on or before day (YYYY-MM-DD), longest overdue first
+func (r *MemoryRepository) ListDueReviews(userID, day string, limit int) ([]models.MemoryReview, error) {
+	rows, err := r.db.Query(`
+		SELECT `+reviewColumns+`
+		FROM memory_reviews
+		WHERE user_id = ? AND learn = 1 AND due_date <= ?
+			AND memory_id IN (SELECT id FROM memories WHERE user_id = ? AND is_archived = 0)
+		ORDER BY due_date ASC, created_at ASC
+		LIMIT ?
+	`, userID, day, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []models.MemoryReview{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, *review)
+	}
+	return reviews, rows.Err()
+}
+
+// ListReviewLog returns a memory's reviews, newest first
+func (r *MemoryRepository) ListReviewLog(memoryID string, limit int) ([]models.MemoryReviewLog, error) {
+	rows, err := r.db.Query(`
+		SELECT id, memory_id, outcome, interval_days, due_date, reviewed_at
+		FROM memory_review_log
+		WHERE memory_id = ?
+		ORDER BY reviewed_at DESC
+		LIMIT ?
+	`, memoryID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.MemoryReviewLog{}
+	for rows.Next() {
+		var entry models.MemoryReviewLog
+		if err := rows.Scan(&entry.ID, &entry.MemoryID, &entry.Outcome, &entry.IntervalDays, &entry.DueDate, &entry.ReviewedAt); err != nil {
+			return nil, err
+		}
+		if len(entry.DueDate) > 10 {
+			entry.DueDate = entry.DueDate[:10]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// GetOnThisDay returns the user's unarchived memories created before year on one
+// of monthDays ("MM-DD"), newest first. Timestamps are stored as text starting
+// with the date, in the server's zone.
+func (r *MemoryRepository) GetOnThisDay(userID string, monthDays []string, year int) ([]models.Memory, error) {
+	if len(monthDays) == 0 {
+		return []models.Memory{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(monthDays)), ", ")
+	args := []interface{}{userID}
+	for _, day := range monthDays {
+		args = append(args, day)
+	}
+	args = append(args, fmt.Sprintf("%04d", year))
+
+	rows, err := r.db.Query(`
+		SELECT id, user_id, content, summary, category, url, url_title, url_content, is_archived, position, created_at, updated_at
+		FROM memories
+		WHERE user_id = ? AND is_archived = 0
+			AND substr(created_at, 6, 5) IN (`+placeholders+`)
+			AND substr(created_at, 1, 4) < ?
+		ORDER BY created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return r.scanMemories(rows)
+}
+
 func (r *MemoryRepository) GetStats(userID string) (*models.MemoryStats, error) {
 	stats := &models.MemoryStats{
 		ByCategory: make(map[string]int),
@@ -372,45 +754,22 @@ func (r *MemoryRepository) GetStats(userID string) (*models.MemoryStats, error)
 	return stats, nil
 }
 
-// GetMaxPosition returns the maximum position for a user's memories
-func (r *MemoryRepository) GetMaxPosition(userID string) (int, error) {
-	var maxPos sql.NullInt64
-	err := r.db.QueryRow(`
-		SELECT MAX(CAST(position AS INTEGER)) FROM memories WHERE user_id = ?
-	`, userID).Scan(&maxPos)
-
-	if err != nil {
-		return 0, err
-	}
-
-	if maxPos.Valid {
-		return int(maxPos.Int64), nil
+// UpdatePositions sets the positions of the user's memories, rebalancing
+// the list if they have grown too long
+func (r *MemoryRepository) UpdatePositions(userID string, memories []models.MemoryPosition) error {
+	ids := make([]string, len(memories))
+	positions := make([]string, len(memories))
+	for i, m := range memories {
+		ids[i], positions[i] = m.ID, m.Position
 	}
-	return 0, nil
+	return memoryPositions.set(r.db, userID, ids, positions)
 }
 
-// UpdatePositions updates positions for multiple memories
-func (r *MemoryRepository) UpdatePositions(memories []models.MemoryPosition) error {
-	tx, err := r.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare("UPDATE memories SET position = ?, updated_at = ? WHERE id = ?")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	for _, m := range memories {
-		_, err := stmt.Exec(m.Position, time.Now(), m.ID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit()
+// MoveAfter puts a memory right after another in the user's list, or first
+// when afterID is empty, changing only the moved memory's position. It
+// returns false if either memory isn't the user's.
+func (r *MemoryRepository) MoveAfter(userID, memoryID, afterID string) (bool, error) {
+	return memoryPositions.moveAfter(r.db, userID, memoryID, afterID)
 }
 
 // Helper function to scan memory rows
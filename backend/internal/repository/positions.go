@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/todomyday/backend/internal/fracindex"
+)
+
+// maxPositionLength is how long position keys may grow before a list is
+// rebalanced. Keys grow when items keep being put in the same spot.
+const maxPositionLength = 24
+
+// positionList is a user's list of todos or memories, ordered by their
+// fractional index keys (see package fracindex)
+type positionList struct {
+	table string
+	// order is how the list is shown, breaking ties between equal keys
+	order string
+}
+
+var (
+	todoPositions   = positionList{table: "todos", order: "position ASC, id ASC"}
+	memoryPositions = positionList{table: "memories", order: "position ASC, created_at DESC"}
+)
+
+// next returns a key after the last item of the user's list
+func (l positionList) next(db *sql.DB, userID string) (string, error) {
+	var last sql.NullString
+	if err := db.QueryRow("SELECT MAX(position) FROM "+l.table+" WHERE user_id = ?", userID).Scan(&last); err != nil {
+		return "", err
+	}
+	return fracindex.Between(last.String, "")
+}
+
+// set gives items of the user's list the keys given, then rebalances the
+// list if any of them is too long
+func (l positionList) set(db *sql.DB, userID string, ids, positions []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE " + l.table + " SET position = ?, updated_at = ? WHERE id = ? AND user_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	longest := 0
+	for i, id := range ids {
+		if _, err := stmt.Exec(positions[i], now, id, userID); err != nil {
+			return err
+		}
+		if len(positions[i]) > longest {
+			longest = len(positions[i])
+		}
+	}
+
+	if longest > maxPositionLength {
+		if err := l.rebalance(tx, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// moveAfter gives an item of the user's list a key between afterID's and
+// the next item's, or before the first item when afterID is empty. Only the
+// moved item's key changes unless it grows too long, when the list is
+// rebalanced. It returns false when either item isn't in the list.
+func (l positionList) moveAfter(db *sql.DB, userID, id, afterID string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow("SELECT position FROM "+l.table+" WHERE id = ? AND user_id = ?", id, userID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var lower string
+	var upper sql.NullString
+	if afterID == "" {
+		err = tx.QueryRow("SELECT MIN(position) FROM "+l.table+" WHERE user_id = ? AND id != ?", userID, id).Scan(&upper)
+	} else {
+		err = tx.QueryRow("SELECT position FROM "+l.table+" WHERE id = ? AND user_id = ?", afterID, userID).Scan(&lower)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		err = tx.QueryRow("SELECT MIN(position) FROM "+l.table+" WHERE user_id = ? AND id != ? AND position > ?", userID, id, lower).Scan(&upper)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Already in place
+	if current > lower && (!upper.Valid || current < upper.String) {
+		return true, tx.Commit()
+	}
+
+	position, err := fracindex.Between(lower, upper.String)
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("UPDATE "+l.table+" SET position = ?, updated_at = ? WHERE id = ?", position, time.Now(), id); err != nil {
+		return false, err
+	}
+
+	if len(position) > maxPositionLength {
+		if err := l.rebalance(tx, userID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// rebalance gives the user's list short, evenly spaced keys in its current
+// order. It isn't a change to the items, so updated_at is left alone.
+func (l positionList) rebalance(tx *sql.Tx, userID string) error {
+	rows, err := tx.Query("SELECT id FROM "+l.table+" WHERE user_id = ? ORDER BY "+l.order, userID)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, position := range fracindex.Spread(len(ids)) {
+		if _, err := tx.Exec("UPDATE "+l.table+" SET position = ? WHERE id = ?", position, ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+type PromptTemplateRepository struct {
+	db *sql.DB
+}
+
+func NewPromptTemplateRepository(db *sql.DB) *PromptTemplateRepository {
+	return &PromptTemplateRepository{db: db}
+}
+
+// Create stores a new template version, numbering it after the user's latest version for the name
+func (r *PromptTemplateRepository) Create(tmpl *models.PromptTemplate) error {
+	query := `
+		INSERT INTO prompt_templates (id, user_id, name, version, template, created_at)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(version), 0) + 1 FROM prompt_templates WHERE user_id = ? AND name = ?), ?, ?)
+		RETURNING version
+	`
+	return r.db.QueryRow(query,
+		tmpl.ID,
+		tmpl.UserID,
+		tmpl.Name,
+		tmpl.UserID,
+		tmpl.Name,
+		tmpl.Template,
+		tmpl.CreatedAt,
+	).Scan(&tmpl.Version)
+}
+
+// GetActiveByUserID returns the latest version of each template the user has overridden
+func (r *PromptTemplateRepository) GetActiveByUserID(userID string) ([]models.PromptTemplate, error) {
+	query := `
+		SELECT id, user_id, name, version, template, created_at
+		FROM prompt_templates p
+		WHERE user_id = ? AND version = (
+			SELECT MAX(version) FROM prompt_templates WHERE user_id = p.user_id AND name = p.name
+		)
+		ORDER BY name
+	`
+	return r.queryTemplates(query, userID)
+}
+
+// GetVersions returns every saved version of a template, newest first
+func (r *PromptTemplateRepository) GetVersions(userID, name string) ([]models.PromptTemplate, error) {
+	query := `
+		SELECT id, user_id, name, version, template, created_at
+		FROM prompt_templates WHERE user_id = ? AND name = ?
+		ORDER BY version DESC
+	`
+	return r.queryTemplates(query, userID, name)
+}
+
+// DeleteByName removes all versions of a template, reverting the user to the default
+func (r *PromptTemplateRepository) DeleteByName(userID, name string) error {
+	_, err := r.db.Exec("DELETE FROM prompt_templates WHERE user_id = ? AND name = ?", userID, name)
+	return err
+}
+
+func (r *PromptTemplateRepository) queryTemplates(query string, args ...interface{}) ([]models.PromptTemplate, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []models.PromptTemplate
+	for rows.Next() {
+		var tmpl models.PromptTemplate
+		if err := rows.Scan(
+			&tmpl.ID,
+			&tmpl.UserID,
+			&tmpl.Name,
+			&tmpl.Version,
+			&tmpl.Template,
+			&tmpl.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, rows.Err()
+}
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todomyday/backend/internal/models"
+)
+
+// ReminderRepository stores todo reminders, their delivery state, and where
+// users want reminders sent
+type ReminderRepository struct {
+	db *sql.DB
+}
+
+func NewReminderRepository(db *sql.DB) *ReminderRepository {
+	return &ReminderRepository{db: db}
+}
+
+const reminderColumns = "id, todo_id, user_id, remind_at, offset_minutes, fire_at, status, attempts, retry_at, claimed_at, last_error, sent_at, created_at"
+
+func scanReminder(row interface{ Scan(...interface{}) error }) (*models.Reminder, error) {
+	reminder := &models.Reminder{}
+	var remindAt, fireAt, retryAt, claimedAt, sentAt sql.NullTime
+	var offset sql.NullInt64
+	var lastError sql.NullString
+
+	err := row.Scan(&reminder.ID, &reminder.TodoID, &reminder.UserID, &remindAt, &offset, &fireAt, &reminder.Status, &reminder.Attempts, &retryAt, &claimedAt, &lastError, &sentAt, &reminder.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if remindAt.Valid {
+		reminder.RemindAt = &remindAt.Time
+	}
+	if offset.Valid {
+		minutes := int(offset.Int64)
+		reminder.OffsetMinutes = &minutes
+	}
+	if fireAt.Valid {
+		reminder.FireAt = &fireAt.Time
+	}
+	if retryAt.Valid {
+		reminder.RetryAt = &retryAt.Time
+	}
+	if claimedAt.Valid {
+		reminder.ClaimedAt = &claimedAt.Time
+	}
+	if lastError.Valid {
+		reminder.LastError = &lastError.String
+	}
+	if sentAt.Valid {
+		reminder.SentAt = &sentAt.Time
+	}
+	return reminder, nil
+}
+
+func (r *ReminderRepository) queryReminders(query string, args ...interface{}) ([]models.Reminder, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []models.Reminder{}
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, *reminder)
+	}
+	return reminders, rows.Err()
+}
+
+func (r *ReminderRepository) Create(reminder *models.Reminder) error {
+	reminder.ID = uuid.New().String()
+	reminder.CreatedAt = time.Now()
+	if reminder.Status == "" {
+		reminder.Status = models.ReminderPending
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO todo_reminders (id, todo_id, user_id, remind_at, offset_minutes, fire_at, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, reminder.ID, reminder.TodoID, reminder.UserID, utcTime(reminder.RemindAt), reminder.OffsetMinutes, utcTime(reminder.FireAt), reminder.Status, reminder.CreatedAt)
+	return err
+}
+
+func (r *ReminderRepository) GetByID(id string) (*models.Reminder, error) {
+	reminder, err := scanReminder(r.db.QueryRow(`
+		SELECT `+reminderColumns+` FROM todo_reminders WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return reminder, err
+}
+
+// GetByTodoID returns a todo's reminders, earliest first
+func (r *ReminderRepository) GetByTodoID(todoID string) ([]models.Reminder, error) {
+	return r.queryReminders(`
+		SELECT `+reminderColumns+` FROM todo_reminders
+		WHERE todo_id = ?
+		ORDER BY fire_at IS NULL, fire_at, created_at
+	`, todoID)
+}
+
+func (r *ReminderRepository) Delete(id string) error {
+	_, err := r.db.Exec("DELETE FROM todo_reminders WHERE id = ?", id)
+	return err
+}
+
+// Reschedule moves a reminder to a new fire time and re-arms it, forgetting
+// earlier deliveries so it goes out again
+func (r *ReminderRepository) Reschedule(id string, fireAt *time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE todo_reminders
+		SET fire_at = ?, status = 'pending', attempts = 0, retry_at = NULL, claimed_at = NULL, last_error = NULL, sent_at = NULL
+		WHERE id = ?
+	`, utcTime(fireAt), id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM reminder_deliveries WHERE reminder_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDue returns up to limit reminders ready to go out at now: pending ones
+// whose time (or retry time) has come, and ones left sending by a run that
+// claimed them before staleBefore and never finished
+func (r *ReminderRepository) GetDue(now, staleBefore time.Time, limit int) ([]models.Reminder, error) {
+	return r.queryReminders(`
+		SELECT `+reminderColumns+` FROM todo_reminders
+		WHERE (status = 'pending' AND fire_at <= ? AND (retry_at IS NULL OR retry_at <= ?))
+			OR (status = 'sending' AND claimed_at < ?)
+		ORDER BY fire_at
+		LIMIT ?
+	`, now.UTC(), now.UTC(), staleBefore.UTC(), limit)
+}
+
+// Claim marks a due reminder as sending. It reports false if another run
+// claimed it first.
+func (r *ReminderRepository) Claim(id string, now, staleBefore time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE todo_reminders SET status = 'sending', claimed_at = ?
+		WHERE id = ? AND (status = 'pending' OR (status = 'sending' AND claimed_at < ?))
+	`, now.UTC(), id, staleBefore.UTC())
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Finish records the outcome of sending a claimed reminder. Reminders put back
+// to pending are retried at retryAt.
+func (r *ReminderRepository) Finish(id string, status models.ReminderStatus, attempts int, lastError *string, retryAt, sentAt *time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE todo_reminders
+		SET status = ?, attempts = ?, last_error = ?, retry_at = ?, sent_at = ?, claimed_at = NULL
+		WHERE id = ? AND status = 'sending'
+	`, status, attempts, lastError, utcTime(retryAt), utcTime(sentAt), id)
+	return err
+}
+
+// GetDeliveries returns the channel and target of every delivery a reminder
+// has made, as "channel:target" keys
+func (r *ReminderRepository) GetDeliveries(reminderID string) (map[string]bool, error) {
+	rows, err := r.db.Query("SELECT channel, target FROM reminder_deliveries WHERE reminder_id = ?", reminderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	delivered := make(map[string]bool)
+	for rows.Next() {
+		var channel, target string
+		if err := rows.Scan(&channel, &target); err != nil {
+			return nil, err
+		}
+		delivered[channel+":"+target] = true
+	}
+	return delivered, rows.Err()
+}
+
+// AddDelivery records that a reminder reached a target
+func (r *ReminderRepository) AddDelivery(reminderID string, channel models.NotificationChannel, target string) error {
+	_, err := r.db.Exec(`
+		INSERT OR IGNORE INTO reminder_deliveries (reminder_id, channel, target, delivered_at)
+		VALUES (?, ?, ?, ?)
+	`, reminderID, channel, target, time.Now())
+	return err
+}
+
+// Notification settings
+
+// GetSettings returns a user's notification settings, or the defaults if they have none
+func (r *ReminderRepository) GetSettings(userID string) (*models.NotificationSettings, error) {
+	settings := &models.NotificationSettings{UserID: userID}
+	var webhookURL, webhookSecret sql.NullString
+	err := r.db.QueryRow(`
+		SELECT email_enabled, webhook_url, webhook_secret, updated_at
+		FROM notification_settings
+		WHERE user_id = ?
+	`, userID).Scan(&settings.EmailEnabled, &webhookURL, &webhookSecret, &settings.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return &models.NotificationSettings{UserID: userID, EmailEnabled: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if webhookURL.Valid {
+		settings.WebhookURL = &webhookURL.String
+	}
+	if webhookSecret.Valid {
+		settings.WebhookSecret = &webhookSecret.String
+	}
+	return settings, nil
+}
+
+func (r *ReminderRepository) SaveSettings(settings *models.NotificationSettings) error {
+	settings.UpdatedAt = time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO notification_settings (user_id, email_enabled, webhook_url, webhook_secret, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			email_enabled = excluded.email_enabled,
+			webhook_url = excluded.webhook_url,
+			webhook_secret = excluded.webhook_secret,
+			updated_at = excluded.updated_at
+	`, settings.UserID, settings.EmailEnabled, settings.WebhookURL, settings.WebhookSecret, settings.UpdatedAt)
+	return err
+}
+
+// Push subscriptions
+
+// SavePushSubscription stores a browser's subscription. A browser subscribing
+// again replaces its keys, and takes the endpoint over from any other user.
+func (r *ReminderRepository) SavePushSubscription(sub *models.PushSubscription) error {
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = time.Now()
+
+	return r.db.QueryRow(`
+		INSERT INTO push_subscriptions (id, user_id, endpoint, p256dh, auth, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(endpoint) DO UPDATE SET
+			user_id = excluded.user_id,
+			p256dh = excluded.p256dh,
+			auth = excluded.auth
+		RETURNING id, created_at
+	`, sub.ID, sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.CreatedAt).Scan(&sub.ID, &sub.CreatedAt)
+}
+
+func (r *ReminderRepository) GetPushSubscriptions(userID string) ([]models.PushSubscription, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, endpoint, p256dh, auth, created_at
+		FROM push_subscriptions
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.PushSubscription{}
+	for rows.Next() {
+		var sub models.PushSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeletePushSubscription deletes one of the user's subscriptions and reports
+// whether it existed
+func (r *ReminderRepository) DeletePushSubscription(userID, id string) (bool, error) {
+	result, err := r.db.Exec("DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// utcTime normalizes stored times to UTC so they compare correctly as text
+func utcTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
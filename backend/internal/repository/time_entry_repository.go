@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todomyday/backend/internal/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// TimeEntryRepository stores the time tracked on todos
+type TimeEntryRepository struct {
+	db *sql.DB
+}
+
+func NewTimeEntryRepository(db *sql.DB) *TimeEntryRepository {
+	return &TimeEntryRepository{db: db}
+}
+
+const timeEntryColumns = "id, todo_id, user_id, started_at, ended_at, note, created_at"
+
+func scanTimeEntry(row interface{ Scan(...interface{}) error }) (*models.TimeEntry, error) {
+	entry := &models.TimeEntry{}
+	var endedAt sql.NullTime
+	var note sql.NullString
+
+	err := row.Scan(&entry.ID, &entry.TodoID, &entry.UserID, &entry.StartedAt, &endedAt, &note, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	if endedAt.Valid {
+		entry.EndedAt = &endedAt.Time
+		end = endedAt.Time
+	}
+	if note.Valid {
+		entry.Note = &note.String
+	}
+	entry.Seconds = int64(end.Sub(entry.StartedAt) / time.Second)
+	return entry, nil
+}
+
+func (r *TimeEntryRepository) queryTimeEntries(query string, args ...interface{}) ([]models.TimeEntry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.TimeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// Times are stored in UTC to the second, so they compare as text
+func entryTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+// Create records a finished entry
+func (r *TimeEntryRepository) Create(entry *models.TimeEntry) error {
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO time_entries (id, todo_id, user_id, started_at, ended_at, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.ID, entry.TodoID, entry.UserID, entryTime(&entry.StartedAt), entryTime(entry.EndedAt), entry.Note, entry.CreatedAt)
+	return err
+}
+
+// Start records a running entry, unless the user already has one running. It
+// reports whether the entry was started. A start racing another one of the
+// user's past the NOT EXISTS check is stopped by idx_time_entries_running and
+// reported the same way.
+func (r *TimeEntryRepository) Start(entry *models.TimeEntry) (bool, error) {
+	entry.ID = uuid.New().String()
+	entry.CreatedAt = time.Now()
+	entry.EndedAt = nil
+
+	result, err := r.db.Exec(`
+		INSERT INTO time_entries (id, todo_id, user_id, started_at, note, created_at)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM time_entries WHERE user_id = ? AND ended_at IS NULL)
+	`, entry.ID, entry.TodoID, entry.UserID, entryTime(&entry.StartedAt), entry.Note, entry.CreatedAt, entry.UserID)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Stop ends the user's running entry on a todo at endedAt. It reports false
+// if there was none.
+func (r *TimeEntryRepository) Stop(userID, todoID string, endedAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE time_entries SET ended_at = ?
+		WHERE user_id = ? AND todo_id = ? AND ended_at IS NULL
+	`, entryTime(&endedAt), userID, todoID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *TimeEntryRepository) GetByID(id string) (*models.TimeEntry, error) {
+	entry, err := scanTimeEntry(r.db.QueryRow(`
+		SELECT `+timeEntryColumns+` FROM time_entries WHERE id = ?
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// GetRunning returns the user's running entry, or nil if no timer is running
+func (r *TimeEntryRepository) GetRunning(userID string) (*models.TimeEntry, error) {
+	entry, err := scanTimeEntry(r.db.QueryRow(`
+		SELECT `+timeEntryColumns+` FROM time_entries WHERE user_id = ? AND ended_at IS NULL
+	`, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entry, err
+}
+
+// GetByTodoID returns a todo's entries, earliest first
+func (r *TimeEntryRepository) GetByTodoID(todoID string) ([]models.TimeEntry, error) {
+	return r.queryTimeEntries(`
+		SELECT `+timeEntryColumns+` FROM time_entries
+		WHERE todo_id = ?
+		ORDER BY started_at
+	`, todoID)
+}
+
+// GetInRange returns the user's entries overlapping from to to, including
+// running ones, earliest first
+func (r *TimeEntryRepository) GetInRange(userID string, from, to time.Time) ([]models.TimeEntry, error) {
+	return r.queryTimeEntries(`
+		SELECT `+timeEntryColumns+` FROM time_entries
+		WHERE user_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?)
+		ORDER BY started_at
+	`, userID, entryTime(&to), entryTime(&from))
+}
+
+func (r *TimeEntryRepository) Delete(id string) error {
+	_, err := r.db.Exec("DELETE FROM time_entries WHERE id = ?", id)
+	return err
+}
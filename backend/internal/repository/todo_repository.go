@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,8 +30,13 @@ func (r *TodoRepository) Create(todo *models.Todo) error {
 	if todo.Status == "" {
 		todo.Status = models.StatusPending
 	}
+	// New todos go at the end of the user's list
 	if todo.Position == "" {
-		todo.Position = "1000"
+		position, err := todoPositions.next(r.db, todo.UserID)
+		if err != nil {
+			return err
+		}
+		todo.Position = position
 	}
 	if todo.Tags == nil {
 		todo.Tags = []string{}
@@ -39,28 +45,36 @@ func (r *TodoRepository) Create(todo *models.Todo) error {
 	tagsJSON, _ := json.Marshal(todo.Tags)
 
 	_, err := r.db.Exec(`
-		INSERT INTO todos (id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, todo.ID, todo.UserID, todo.GroupID, todo.Title, todo.Description, todo.DueDate, todo.Priority, todo.Status, todo.Position, string(tagsJSON), todo.CreatedAt, todo.UpdatedAt)
+		INSERT INTO todos (id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at, series_id, occurrence, parent_id, auto_complete, ical_uid, estimate_minutes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, todo.ID, todo.UserID, todo.GroupID, todo.Title, todo.Description, todo.DueDate, todo.Priority, todo.Status, todo.Position, string(tagsJSON), todo.CreatedAt, todo.UpdatedAt, todo.SeriesID, todo.Occurrence, todo.ParentID, todo.AutoComplete, todo.ICalUID, todo.EstimateMinutes)
 
 	return err
 }
 
-func (r *TodoRepository) GetByID(id string) (*models.Todo, error) {
+const todoColumns = "id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at, completed_at, " +
+	"series_id, occurrence, (SELECT rrule FROM todo_series WHERE todo_series.id = todos.series_id), " +
+	"parent_id, auto_complete, " +
+	"(SELECT COUNT(*) FROM todos AS subtasks WHERE subtasks.parent_id = todos.id AND subtasks.status != 'cancelled'), " +
+	"(SELECT COUNT(*) FROM todos AS subtasks WHERE subtasks.parent_id = todos.id AND subtasks.status = 'completed'), " +
+	"(SELECT json_group_array(blocker_id) FROM todo_dependencies WHERE todo_dependencies.todo_id = todos.id), " +
+	"ical_uid, estimate_minutes, column_id, column_position"
+
+func scanTodo(row interface{ Scan(...interface{}) error }) (*models.Todo, error) {
 	todo := &models.Todo{}
 	var tagsJSON string
 	var groupID sql.NullString
 	var description sql.NullString
 	var dueDate sql.NullString
-
-	err := r.db.QueryRow(`
-		SELECT id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at
-		FROM todos WHERE id = ?
-	`, id).Scan(&todo.ID, &todo.UserID, &groupID, &todo.Title, &description, &dueDate, &todo.Priority, &todo.Status, &todo.Position, &tagsJSON, &todo.CreatedAt, &todo.UpdatedAt)
-
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
+	var completedAt sql.NullTime
+	var seriesID, occurrence, recurrence, parentID, icalUID sql.NullString
+	var subtasks, completedSubtasks int
+	var blockedByJSON string
+	var estimate, columnPosition sql.NullInt64
+	var columnID sql.NullString
+
+	err := row.Scan(&todo.ID, &todo.UserID, &groupID, &todo.Title, &description, &dueDate, &todo.Priority, &todo.Status, &todo.Position, &tagsJSON, &todo.CreatedAt, &todo.UpdatedAt, &completedAt,
+		&seriesID, &occurrence, &recurrence, &parentID, &todo.AutoComplete, &subtasks, &completedSubtasks, &blockedByJSON, &icalUID, &estimate, &columnID, &columnPosition)
 	if err != nil {
 		return nil, err
 	}
@@ -74,57 +88,312 @@ func (r *TodoRepository) GetByID(id string) (*models.Todo, error) {
 	if dueDate.Valid {
 		todo.DueDate = &dueDate.String
 	}
+	if completedAt.Valid {
+		todo.CompletedAt = &completedAt.Time
+	}
+	if seriesID.Valid {
+		todo.SeriesID = &seriesID.String
+	}
+	if occurrence.Valid {
+		todo.Occurrence = &occurrence.String
+	}
+	if recurrence.Valid {
+		todo.Recurrence = &recurrence.String
+	}
+	if parentID.Valid {
+		todo.ParentID = &parentID.String
+	}
+	if icalUID.Valid {
+		todo.ICalUID = &icalUID.String
+	}
+	if estimate.Valid {
+		minutes := int(estimate.Int64)
+		todo.EstimateMinutes = &minutes
+	}
+	if columnID.Valid {
+		todo.ColumnID = &columnID.String
+	}
+	if columnPosition.Valid {
+		position := int(columnPosition.Int64)
+		todo.ColumnPosition = &position
+	}
+	if subtasks > 0 {
+		todo.Progress = &models.TodoProgress{Completed: completedSubtasks, Total: subtasks}
+	}
 
 	json.Unmarshal([]byte(tagsJSON), &todo.Tags)
 	if todo.Tags == nil {
 		todo.Tags = []string{}
 	}
+	json.Unmarshal([]byte(blockedByJSON), &todo.BlockedBy)
+	if todo.BlockedBy == nil {
+		todo.BlockedBy = []string{}
+	}
 
 	return todo, nil
 }
 
-func (r *TodoRepository) GetAllByUserID(userID string) ([]models.Todo, error) {
-	rows, err := r.db.Query(`
-		SELECT id, user_id, group_id, title, description, due_date, priority, status, position, tags, created_at, updated_at
-		FROM todos WHERE user_id = ? ORDER BY position ASC
-	`, userID)
+func (r *TodoRepository) GetByID(id string) (*models.Todo, error) {
+	todo, err := scanTodo(r.db.QueryRow(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE id = ?
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	todos := []models.Todo{}
-	for rows.Next() {
-		todo := models.Todo{}
-		var tagsJSON string
-		var groupID sql.NullString
-		var description sql.NullString
-		var dueDate sql.NullString
+	return todo, nil
+}
 
-		err := rows.Scan(&todo.ID, &todo.UserID, &groupID, &todo.Title, &description, &dueDate, &todo.Priority, &todo.Status, &todo.Position, &tagsJSON, &todo.CreatedAt, &todo.UpdatedAt)
-		if err != nil {
-			return nil, err
+// GetByICalUID returns the user's todo imported with the given iCalendar UID
+func (r *TodoRepository) GetByICalUID(userID, uid string) (*models.Todo, error) {
+	todo, err := scanTodo(r.db.QueryRow(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE user_id = ? AND ical_uid = ?
+	`, userID, uid))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+// GetAllByUserID returns the user's todos, only those with the given statuses
+// if any are given
+func (r *TodoRepository) GetAllByUserID(userID string, statuses ...models.Status) ([]models.Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todos WHERE user_id = ?`
+	args := []interface{}{userID}
+	if len(statuses) > 0 {
+		query += " AND status IN (?" + strings.Repeat(", ?", len(statuses)-1) + ")"
+		for _, status := range statuses {
+			args = append(args, status)
 		}
+	}
+	return r.queryTodos(query+" ORDER BY position ASC", args...)
+}
 
-		if groupID.Valid {
-			todo.GroupID = &groupID.String
+// todoSortKey returns the SQL expression todos are ordered by. Todos without
+// a due date come last either way.
+func todoSortKey(sort models.TodoSort, descending bool) string {
+	switch sort {
+	case models.SortDueDate:
+		if descending {
+			return "COALESCE(julianday(NULLIF(due_date, '')), -1e9)"
 		}
-		if description.Valid {
-			todo.Description = &description.String
+		return "COALESCE(julianday(NULLIF(due_date, '')), 1e9)"
+	case models.SortPriority:
+		return "CASE priority WHEN 'high' THEN 0 WHEN 'medium' THEN 1 ELSE 2 END"
+	case models.SortCreatedAt:
+		return "julianday(" + sqlTime("created_at") + ")"
+	case models.SortUpdatedAt:
+		return "julianday(" + sqlTime("updated_at") + ")"
+	case models.SortTitle:
+		return "lower(title)"
+	default:
+		return "position"
+	}
+}
+
+// sqlTime returns a time column as a date SQLite can read, keeping its UTC
+// offset so times written in different zones compare as instants. Times are
+// stored as Go formats them ("2006-01-02 15:04:05.999999999 -0700 MST"), which
+// becomes "2006-01-02 15:04:05.999999999-07:00". Values without a zone, such
+// as CURRENT_TIMESTAMP defaults, are UTC and read as they are.
+func sqlTime(column string) string {
+	// The zone starts after the first space past the seconds
+	space := fmt.Sprintf("instr(substr(%s, 20), ' ')", column)
+	zone := fmt.Sprintf("substr(%s, 20 + %s)", column, space)
+	return fmt.Sprintf("CASE WHEN %s = 0 THEN %s ELSE substr(%s, 1, 18 + %s) || substr(%s, 1, 3) || ':' || substr(%s, 4, 2) END",
+		space, column, column, space, zone, zone)
+}
+
+// keyedRow scans a todo followed by its sort key
+type keyedRow struct {
+	rows *sql.Rows
+	key  *interface{}
+}
+
+func (k keyedRow) Scan(dest ...interface{}) error {
+	return k.rows.Scan(append(dest, k.key)...)
+}
+
+// List returns the user's todos matching filter in its order, along with the
+// sort key of each for paging
+func (r *TodoRepository) List(userID string, filter *models.TodoFilter) ([]models.Todo, []interface{}, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if len(filter.Statuses) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(filter.Statuses)-1)+")")
+		for _, status := range filter.Statuses {
+			args = append(args, status)
 		}
-		if dueDate.Valid {
-			todo.DueDate = &dueDate.String
+	}
+	if len(filter.Priorities) > 0 {
+		where = append(where, "priority IN (?"+strings.Repeat(", ?", len(filter.Priorities)-1)+")")
+		for _, priority := range filter.Priorities {
+			args = append(args, priority)
 		}
+	}
+	if len(filter.GroupIDs) > 0 {
+		groups := []string{}
+		for _, groupID := range filter.GroupIDs {
+			if groupID == "" {
+				groups = append(groups, "group_id IS NULL OR group_id = ''")
+			} else {
+				groups = append(groups, "group_id = ?")
+				args = append(args, groupID)
+			}
+		}
+		where = append(where, "("+strings.Join(groups, " OR ")+")")
+	}
+	for _, tag := range filter.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each(todos.tags) WHERE lower(json_each.value) = lower(?))")
+		args = append(args, tag)
+	}
+	// Due dates are compared by the day they're written with
+	if filter.DueFrom != "" || filter.DueTo != "" {
+		where = append(where, "due_date IS NOT NULL AND due_date != ''")
+	}
+	if filter.DueFrom != "" {
+		where = append(where, "substr(due_date, 1, 10) >= ?")
+		args = append(args, filter.DueFrom)
+	}
+	if filter.DueTo != "" {
+		where = append(where, "substr(due_date, 1, 10) <= ?")
+		args = append(args, filter.DueTo)
+	}
+	if filter.Overdue {
+		where = append(where, `status NOT IN ('completed', 'cancelled') AND due_date IS NOT NULL AND due_date != ''
+			AND CASE WHEN length(due_date) = 10 THEN due_date < ? ELSE julianday(due_date) < julianday(?) END`)
+		args = append(args, filter.Today, filter.Now.UTC().Format(time.RFC3339))
+	}
+	if filter.Query != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Query) + "%"
+		where = append(where, `(title LIKE ? ESCAPE '\' OR COALESCE(description, '') LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	key := todoSortKey(filter.Sort, filter.Descending)
+	op, direction := ">", "ASC"
+	if filter.Descending {
+		op, direction = "<", "DESC"
+	}
+	if filter.After != nil {
+		where = append(where, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", key, op, key, op))
+		args = append(args, filter.After.Key, filter.After.Key, filter.After.ID)
+	}
+
+	query := `SELECT ` + todoColumns + `, ` + key + `
+		FROM todos WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + key + ` ` + direction + `, id ` + direction
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
 
-		json.Unmarshal([]byte(tagsJSON), &todo.Tags)
-		if todo.Tags == nil {
-			todo.Tags = []string{}
+	todos := []models.Todo{}
+	keys := []interface{}{}
+	for rows.Next() {
+		var key interface{}
+		todo, err := scanTodo(keyedRow{rows: rows, key: &key})
+		if err != nil {
+			return nil, nil, err
 		}
+		todos = append(todos, *todo)
+		keys = append(keys, key)
+	}
+	return todos, keys, rows.Err()
+}
+
+// GetActivityByDateRange returns the user's todos created before to that were
+// created or completed between from and to, or were still open at to with a due
+// date. Callers decide which of those count as overdue.
+func (r *TodoRepository) GetActivityByDateRange(userID string, from, to time.Time) ([]models.Todo, error) {
+	return r.queryTodos(`
+		SELECT `+todoColumns+`
+		FROM todos
+		WHERE user_id = ? AND created_at <= ? AND (
+			created_at >= ?
+			OR (completed_at >= ? AND completed_at <= ?)
+			OR (due_date IS NOT NULL AND (completed_at IS NULL OR completed_at > ?))
+		)
+		ORDER BY position ASC
+	`, userID, to, from, from, to, to)
+}
+
+// GetSubtasks returns a todo's direct subtasks in position order
+func (r *TodoRepository) GetSubtasks(parentID string) ([]models.Todo, error) {
+	return r.queryTodos(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE parent_id = ? ORDER BY position ASC
+	`, parentID)
+}
+
+// GetAncestors returns the todos above a subtask, starting from the top level
+func (r *TodoRepository) GetAncestors(id string) ([]models.Todo, error) {
+	return r.queryTodos(`
+		WITH RECURSIVE ancestors(ancestor_id, depth) AS (
+			SELECT parent_id, 1 FROM todos WHERE id = ? AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT todos.parent_id, ancestors.depth + 1 FROM todos
+			JOIN ancestors ON todos.id = ancestors.ancestor_id
+			WHERE todos.parent_id IS NOT NULL
+		)
+		SELECT `+todoColumns+`
+		FROM todos JOIN ancestors ON todos.id = ancestors.ancestor_id
+		ORDER BY ancestors.depth DESC
+	`, id)
+}
+
+// GetDescendants returns all subtasks below a todo, parents before their subtasks
+func (r *TodoRepository) GetDescendants(id string) ([]models.Todo, error) {
+	return r.queryTodos(`
+		WITH RECURSIVE descendants(descendant_id, depth) AS (
+			SELECT id, 1 FROM todos WHERE parent_id = ?
+			UNION ALL
+			SELECT todos.id, descendants.depth + 1 FROM todos
+			JOIN descendants ON todos.parent_id = descendants.descendant_id
+		)
+		SELECT `+todoColumns+`
+		FROM todos JOIN descendants ON todos.id = descendants.descendant_id
+		ORDER BY descendants.depth ASC, todos.position ASC
+	`, id)
+}
 
-		todos = append(todos, todo)
+func (r *TodoRepository) queryTodos(query string, args ...interface{}) ([]models.Todo, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	return todos, nil
+	todos := []models.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, *todo)
+	}
+
+	return todos, rows.Err()
 }
 
 func (r *TodoRepository) Update(id string, updates map[string]interface{}) error {
@@ -161,12 +430,15 @@ func (r *TodoRepository) Delete(id string) error {
 	return err
 }
 
-// DeleteAllByUserID deletes all todos for a user
+// DeleteAllByUserID deletes all todos and recurring series for a user
 func (r *TodoRepository) DeleteAllByUserID(userID string) (int64, error) {
 	result, err := r.db.Exec("DELETE FROM todos WHERE user_id = ?", userID)
 	if err != nil {
 		return 0, err
 	}
+	if _, err := r.db.Exec("DELETE FROM todo_series WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
 	return result.RowsAffected()
 }
 
@@ -177,42 +449,334 @@ func (r *TodoRepository) CountByUserID(userID string) (int, error) {
 	return count, err
 }
 
-func (r *TodoRepository) GetMaxPosition(userID string) (int, error) {
-	var maxPos sql.NullInt64
-	err := r.db.QueryRow(`
-		SELECT MAX(CAST(position AS INTEGER)) FROM todos WHERE user_id = ?
-	`, userID).Scan(&maxPos)
-
-	if err != nil {
-		return 0, err
+// UpdatePositions sets the positions of the user's todos, rebalancing the
+// list if they have grown too long
+func (r *TodoRepository) UpdatePositions(userID string, todos []models.TodoPosition) error {
+	ids := make([]string, len(todos))
+	positions := make([]string, len(todos))
+	for i, t := range todos {
+		ids[i], positions[i] = t.ID, t.Position
 	}
+	return todoPositions.set(r.db, userID, ids, positions)
+}
 
-	if maxPos.Valid {
-		return int(maxPos.Int64), nil
-	}
-	return 0, nil
+// MoveAfter puts a todo right after another in the user's list, or first
+// when afterID is empty, changing only the moved todo's position. It returns
+// false if either todo isn't the user's.
+func (r *TodoRepository) MoveAfter(userID, todoID, afterID string) (bool, error) {
+	return todoPositions.moveAfter(r.db, userID, todoID, afterID)
 }
 
-func (r *TodoRepository) UpdatePositions(todos []models.TodoPosition) error {
+// MoveToColumn moves a todo to a board column in one transaction: it applies
+// updates (such as a new status) to the todo, then numbers the column's todos
+// in the order returned by place, which includes the moved one. place gets the
+// todos of the moved todo's group in list order, read after the update and
+// inside the transaction, so a concurrent move can't change the column between
+// reading its order and writing it.
+func (r *TodoRepository) MoveToColumn(todoID, columnID string, updates map[string]interface{}, place func(todos []models.Todo) []string) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("UPDATE todos SET position = ?, updated_at = ? WHERE id = ?")
-	if err != nil {
+	updates["column_id"] = columnID
+	updates["updated_at"] = time.Now()
+	sets := make([]string, 0, len(updates))
+	args := make([]interface{}, 0, len(updates)+1)
+	for key, value := range updates {
+		sets = append(sets, key+" = ?")
+		args = append(args, value)
+	}
+	if _, err := tx.Exec("UPDATE todos SET "+strings.Join(sets, ", ")+" WHERE id = ?", append(args, todoID)...); err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	now := time.Now()
-	for _, t := range todos {
-		_, err := stmt.Exec(t.Position, now, t.ID)
+	rows, err := tx.Query(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE (user_id, group_id) = (SELECT user_id, group_id FROM todos WHERE id = ?)
+		ORDER BY position ASC, id ASC
+	`, todoID)
+	if err != nil {
+		return err
+	}
+	todos := []models.Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
 		if err != nil {
-			return fmt.Errorf("failed to update position for todo %s: %w", t.ID, err)
+			rows.Close()
+			return err
 		}
+		todos = append(todos, *todo)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
+	for i, id := range place(todos) {
+		if _, err := tx.Exec("UPDATE todos SET column_id = ?, column_position = ? WHERE id = ?", columnID, i, id); err != nil {
+			return fmt.Errorf("failed to update column position for todo %s: %w", id, err)
+		}
+	}
 	return tx.Commit()
 }
+
+// GetSeriesInstances returns the todos generated from a series, in occurrence order
+func (r *TodoRepository) GetSeriesInstances(seriesID string) ([]models.Todo, error) {
+	return r.queryTodos(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE series_id = ? ORDER BY occurrence ASC
+	`, seriesID)
+}
+
+// GetSeriesInstance returns the todo generated for an occurrence of a series, or
+// nil if there isn't one
+func (r *TodoRepository) GetSeriesInstance(seriesID, occurrence string) (*models.Todo, error) {
+	todo, err := scanTodo(r.db.QueryRow(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE series_id = ? AND occurrence = ?
+	`, seriesID, occurrence))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return todo, err
+}
+
+// UpdatePendingInstances applies updates to a series' open todos after the
+// given occurrence
+func (r *TodoRepository) UpdatePendingInstances(seriesID, after string, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	updates["updated_at"] = time.Now()
+	if tags, ok := updates["tags"]; ok {
+		tagsJSON, _ := json.Marshal(tags)
+		updates["tags"] = string(tagsJSON)
+	}
+
+	query := "UPDATE todos SET "
+	args := []interface{}{}
+	first := true
+	for key, value := range updates {
+		if !first {
+			query += ", "
+		}
+		query += key + " = ?"
+		args = append(args, value)
+		first = false
+	}
+	query += " WHERE series_id = ? AND status NOT IN ('completed', 'cancelled') AND occurrence > ?"
+	args = append(args, seriesID, after)
+
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+// DeletePendingInstances deletes a series' open todos other than keepID and
+// returns the IDs it deleted
+func (r *TodoRepository) DeletePendingInstances(seriesID, keepID string) ([]string, error) {
+	rows, err := r.db.Query(`
+		DELETE FROM todos WHERE series_id = ? AND status NOT IN ('completed', 'cancelled') AND id != ? RETURNING id
+	`, seriesID, keepID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+const seriesColumns = "id, user_id, rrule, dtstart, due_time, title, description, priority, group_id, tags, exdates, created_at, updated_at"
+
+func scanSeries(row interface{ Scan(...interface{}) error }) (*models.TodoSeries, error) {
+	series := &models.TodoSeries{}
+	var description, groupID sql.NullString
+	var tagsJSON, exdatesJSON string
+
+	err := row.Scan(&series.ID, &series.UserID, &series.RRule, &series.DTStart, &series.DueTime, &series.Title, &description,
+		&series.Priority, &groupID, &tagsJSON, &exdatesJSON, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if description.Valid {
+		series.Description = &description.String
+	}
+	if groupID.Valid {
+		series.GroupID = &groupID.String
+	}
+	json.Unmarshal([]byte(tagsJSON), &series.Tags)
+	if series.Tags == nil {
+		series.Tags = []string{}
+	}
+	json.Unmarshal([]byte(exdatesJSON), &series.ExDates)
+	if series.ExDates == nil {
+		series.ExDates = []string{}
+	}
+
+	return series, nil
+}
+
+func (r *TodoRepository) CreateSeries(series *models.TodoSeries) error {
+	series.ID = uuid.New().String()
+	series.CreatedAt = time.Now()
+	series.UpdatedAt = series.CreatedAt
+	if series.Tags == nil {
+		series.Tags = []string{}
+	}
+	if series.ExDates == nil {
+		series.ExDates = []string{}
+	}
+
+	tagsJSON, _ := json.Marshal(series.Tags)
+	exdatesJSON, _ := json.Marshal(series.ExDates)
+
+	_, err := r.db.Exec(`
+		INSERT INTO todo_series (`+seriesColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, series.ID, series.UserID, series.RRule, series.DTStart, series.DueTime, series.Title, series.Description,
+		series.Priority, series.GroupID, string(tagsJSON), string(exdatesJSON), series.CreatedAt, series.UpdatedAt)
+	return err
+}
+
+func (r *TodoRepository) GetSeries(id string) (*models.TodoSeries, error) {
+	series, err := scanSeries(r.db.QueryRow(`
+		SELECT `+seriesColumns+`
+		FROM todo_series WHERE id = ?
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return series, err
+}
+
+func (r *TodoRepository) GetSeriesByUserID(userID string) ([]models.TodoSeries, error) {
+	rows, err := r.db.Query(`
+		SELECT `+seriesColumns+`
+		FROM todo_series WHERE user_id = ? ORDER BY created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seriesList := []models.TodoSeries{}
+	for rows.Next() {
+		series, err := scanSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		seriesList = append(seriesList, *series)
+	}
+	return seriesList, rows.Err()
+}
+
+// UpdateSeries saves a series' rule and template
+func (r *TodoRepository) UpdateSeries(series *models.TodoSeries) error {
+	series.UpdatedAt = time.Now()
+	tagsJSON, _ := json.Marshal(series.Tags)
+	exdatesJSON, _ := json.Marshal(series.ExDates)
+
+	_, err := r.db.Exec(`
+		UPDATE todo_series SET rrule = ?, dtstart = ?, due_time = ?, title = ?, description = ?, priority = ?,
+			group_id = ?, tags = ?, exdates = ?, updated_at = ?
+		WHERE id = ?
+	`, series.RRule, series.DTStart, series.DueTime, series.Title, series.Description, series.Priority,
+		series.GroupID, string(tagsJSON), string(exdatesJSON), series.UpdatedAt, series.ID)
+	return err
+}
+
+// DeleteSeries deletes a series; its remaining todos become one-off todos
+func (r *TodoRepository) DeleteSeries(id string) error {
+	_, err := r.db.Exec("DELETE FROM todo_series WHERE id = ?", id)
+	return err
+}
+
+// AddDependency records that todoID is blocked by blockerID
+func (r *TodoRepository) AddDependency(todoID, blockerID string) error {
+	_, err := r.db.Exec(`
+		INSERT OR IGNORE INTO todo_dependencies (todo_id, blocker_id, created_at) VALUES (?, ?, ?)
+	`, todoID, blockerID, time.Now())
+	return err
+}
+
+// RemoveDependency removes a dependency and reports whether it existed
+func (r *TodoRepository) RemoveDependency(todoID, blockerID string) (bool, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM todo_dependencies WHERE todo_id = ? AND blocker_id = ?
+	`, todoID, blockerID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// DependsOn reports whether todoID is blocked by otherID, directly or through
+// the todos blocking it
+func (r *TodoRepository) DependsOn(todoID, otherID string) (bool, error) {
+	var count int
+	err := r.db.QueryRow(`
+		WITH RECURSIVE blockers(blocker_id) AS (
+			SELECT blocker_id FROM todo_dependencies WHERE todo_id = ?
+			UNION
+			SELECT todo_dependencies.blocker_id FROM todo_dependencies
+			JOIN blockers ON todo_dependencies.todo_id = blockers.blocker_id
+		)
+		SELECT COUNT(*) FROM blockers WHERE blocker_id = ?
+	`, todoID, otherID).Scan(&count)
+	return count > 0, err
+}
+
+// GetDependents returns the todos blocked by blockerID
+func (r *TodoRepository) GetDependents(blockerID string) ([]models.Todo, error) {
+	return r.queryTodos(`
+		SELECT `+todoColumns+`
+		FROM todos WHERE id IN (SELECT todo_id FROM todo_dependencies WHERE blocker_id = ?)
+		ORDER BY position ASC
+	`, blockerID)
+}
+
+// CountOpenBlockers counts the todos blocking todoID that aren't done yet
+func (r *TodoRepository) CountOpenBlockers(todoID string) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM todo_dependencies
+		JOIN todos ON todos.id = todo_dependencies.blocker_id
+		WHERE todo_dependencies.todo_id = ? AND todos.status NOT IN ('completed', 'cancelled')
+	`, todoID).Scan(&count)
+	return count, err
+}
+
+// SetBlocked blocks a pending or in-progress todo, remembering its status, or
+// unblocks a todo it blocked before by restoring that status. It reports
+// whether the todo changed.
+func (r *TodoRepository) SetBlocked(id string, blocked bool) (bool, error) {
+	query := `
+		UPDATE todos SET status = resume_status, resume_status = NULL, updated_at = ?
+		WHERE id = ? AND status = 'blocked' AND resume_status IS NOT NULL
+	`
+	if blocked {
+		query = `
+			UPDATE todos SET resume_status = status, status = 'blocked', updated_at = ?
+			WHERE id = ? AND status IN ('pending', 'in_progress')
+		`
+	}
+	result, err := r.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
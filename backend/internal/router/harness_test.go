@@ -0,0 +1,269 @@
+package router_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/todomyday/backend/internal/crypto"
+	"github.com/todomyday/backend/internal/database"
+	"github.com/todomyday/backend/internal/fakes"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+	"github.com/todomyday/backend/internal/router"
+	"github.com/todomyday/backend/internal/services"
+)
+
+const (
+	testToken        = "test-token"
+	testEmbeddingDim = 64
+)
+
+// testEnv is a fully wired router backed by a temporary database and
+// in-process fakes for every external API
+type testEnv struct {
+	t      *testing.T
+	router *gin.Engine
+	db     *sql.DB // for arranging state the API can't, such as past timestamps
+
+	digests   *services.DigestScheduler
+	reminders *services.ReminderScheduler
+
+	openai    *fakes.OpenAIServer
+	anthropic *fakes.AnthropicServer
+	google    *fakes.GoogleServer
+	nim       *fakes.NIMServer
+	searxng   *fakes.SearXNGServer
+	smtp      *fakes.SMTPServer
+	webhook   *fakes.WebhookServer
+	push      *fakes.PushServer
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	env := &testEnv{
+		t:         t,
+		openai:    fakes.NewOpenAIServer(),
+		anthropic: fakes.NewAnthropicServer(),
+		google:    fakes.NewGoogleServer(),
+		nim:       fakes.NewNIMServer(testEmbeddingDim),
+		searxng:   fakes.NewSearXNGServer(),
+		smtp:      fakes.NewSMTPServer(),
+		webhook:   fakes.NewWebhookServer(),
+		push:      fakes.NewPushServer(),
+	}
+	t.Cleanup(func() {
+		env.openai.Close()
+		env.anthropic.Close()
+		env.google.Close()
+		env.nim.Close()
+		env.searxng.Close()
+		env.smtp.Close()
+		env.webhook.Close()
+		env.push.Close()
+	})
+
+	dir := t.TempDir()
+	db, err := database.Connect(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("connect database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	env.db = db
+
+	userRepo := repository.NewUserRepository(db)
+	todoRepo := repository.NewTodoRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	aiProviderRepo := repository.NewAIProviderRepository(db)
+	memoryRepo := repository.NewMemoryRepository(db)
+	chatRepo := repository.NewChatRepository(db)
+	promptTemplateRepo := repository.NewPromptTemplateRepository(db)
+	reminderRepo := repository.NewReminderRepository(db)
+	timeEntryRepo := repository.NewTimeEntryRepository(db)
+	boardRepo := repository.NewBoardRepository(db)
+	calendarRepo := repository.NewCalendarRepository(db)
+	davRepo := repository.NewDAVRepository(db)
+
+	supabaseAuthService := services.NewSupabaseAuthService(userRepo, "test-secret", "http://supabase.invalid", "anon", "service")
+	verifier := fakes.NewAuthVerifier(supabaseAuthService)
+	verifier.AddUser(testToken, "supabase-user-1", "tester@example.com")
+
+	aiService := services.NewAIService("", "", "")
+	aiProviderService := services.NewAIProviderService(aiProviderRepo, crypto.NewEncryptor("test-encryption-key"))
+	groupService := services.NewGroupService(groupRepo)
+	promptTemplateService := services.NewPromptTemplateService(promptTemplateRepo, memoryRepo)
+	scraperService := services.NewScraperService([]string{env.searxng.URL})
+
+	embeddingService := services.NewEmbeddingService(env.nim.URL, "nim-key", "", 60000, testEmbeddingDim)
+	ftsRepo := repository.NewFTSRepository(db)
+	if err := ftsRepo.InitFTSTables(); err != nil {
+		t.Fatalf("init fts: %v", err)
+	}
+	vectorRepo, err := repository.NewVectorRepository(
+		repository.VectorConfig{Dimension: testEmbeddingDim}, // in-memory
+		embeddingService,
+	)
+	if err != nil {
+		t.Fatalf("create vector repository: %v", err)
+	}
+
+	ragService := services.NewRAGService(vectorRepo, ftsRepo, todoRepo, memoryRepo, embeddingService, aiService, aiProviderService, scraperService, promptTemplateService)
+	todoService := services.NewTodoService(todoRepo, reminderRepo, timeEntryRepo, boardRepo, groupRepo, memoryRepo, aiService, aiProviderService, ragService, promptTemplateService)
+	memoryService := services.NewMemoryService(memoryRepo, todoRepo, groupRepo, aiService, aiProviderService, scraperService, ragService, promptTemplateService)
+	userDataService := services.NewUserDataService(memoryRepo, todoRepo, groupRepo, vectorRepo, ragService)
+	emailService := services.NewEmailService(env.smtp.Host, env.smtp.Port, "", "", "Memlane <digest@memlane.test>")
+	digestMailer := services.NewDigestMailer(emailService, userRepo, todoRepo, "http://memlane.test")
+	env.digests = services.NewDigestScheduler(memoryService, digestMailer, 3)
+
+	vapidKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate VAPID key: %v", err)
+	}
+	webPush, err := services.NewWebPush(base64.RawURLEncoding.EncodeToString(vapidKey.Bytes()), "mailto:admin@memlane.test")
+	if err != nil {
+		t.Fatalf("configure web push: %v", err)
+	}
+	env.reminders = services.NewReminderScheduler(reminderRepo, todoRepo,
+		services.NewEmailReminderChannel(emailService, userRepo, reminderRepo),
+		services.NewWebhookReminderChannel(reminderRepo),
+		services.NewPushReminderChannel(webPush, reminderRepo),
+	)
+
+	env.router = router.Setup(
+		verifier,
+		userRepo,
+		todoService,
+		groupService,
+		aiProviderService,
+		memoryService,
+		ragService,
+		userDataService,
+		services.NewFileParserService(),
+		services.NewUploadJobService(),
+		services.NewVisionService("", "", "", aiProviderService, promptTemplateService),
+		services.NewChatService(chatRepo),
+		promptTemplateService,
+		services.NewNotificationService(reminderRepo, webPush),
+		services.NewCalendarService(calendarRepo, todoRepo, groupRepo, todoService, "http://memlane.test"),
+		services.NewCalDAVService(davRepo, userRepo, todoRepo, groupRepo, todoService, "http://memlane.test"),
+		[]string{"http://localhost:3000"},
+	)
+	return env
+}
+
+// do sends an authenticated JSON request and returns the recorded response
+func (e *testEnv) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			e.t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return e.serve(req)
+}
+
+// upload posts a file as multipart form data under the given field name
+func (e *testEnv) upload(path, field, filename, content string) *httptest.ResponseRecorder {
+	e.t.Helper()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile(field, filename)
+	if err != nil {
+		e.t.Fatalf("create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return e.serve(req)
+}
+
+func (e *testEnv) serve(req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// expect checks the status code and decodes the JSON body into out (if non-nil)
+func (e *testEnv) expect(w *httptest.ResponseRecorder, status int, out interface{}) {
+	e.t.Helper()
+
+	if w.Code != status {
+		e.t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			e.t.Fatalf("decode response: %v: %s", err, w.Body.String())
+		}
+	}
+}
+
+// useProvider creates a default AI provider with a selected model through the API
+func (e *testEnv) useProvider(providerType models.ProviderType, baseURL, apiKey, model string) *models.AIProvider {
+	e.t.Helper()
+
+	var provider models.AIProvider
+	e.expect(e.do(http.MethodPost, "/api/ai-providers", models.AIProviderCreate{
+		Name:         string(providerType) + " test",
+		ProviderType: providerType,
+		BaseURL:      baseURL,
+		APIKey:       apiKey,
+		IsDefault:    true,
+	}), http.StatusCreated, &provider)
+
+	e.expect(e.do(http.MethodPut, "/api/ai-providers/"+provider.ID, models.AIProviderUpdate{
+		SelectedModel: &model,
+	}), http.StatusOK, &provider)
+	return &provider
+}
+
+// createMemory posts a memory and returns it
+func (e *testEnv) createMemory(content string) models.Memory {
+	e.t.Helper()
+
+	var resp struct {
+		Memory models.Memory `json:"memory"`
+	}
+	e.expect(e.do(http.MethodPost, "/api/memories", models.MemoryCreateRequest{Content: content}), http.StatusCreated, &resp)
+	return resp.Memory
+}
+
+// waitFor polls check until it returns true or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, check func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if check() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("condition not met within %s", timeout)
+}
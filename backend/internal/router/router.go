@@ -1,6 +1,8 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/todomyday/backend/internal/handlers"
@@ -10,7 +12,7 @@ import (
 )
 
 func Setup(
-	supabaseAuthService *services.SupabaseAuthService,
+	supabaseAuthService middleware.TokenVerifier,
 	userRepo *repository.UserRepository,
 	todoService *services.TodoService,
 	groupService *services.GroupService,
@@ -22,6 +24,10 @@ func Setup(
 	uploadJobService *services.UploadJobService,
 	visionService *services.VisionService,
 	chatService *services.ChatService,
+	promptTemplateService *services.PromptTemplateService,
+	notificationService *services.NotificationService,
+	calendarService *services.CalendarService,
+	caldavService *services.CalDAVService,
 	allowedOrigins []string,
 ) *gin.Engine {
 	r := gin.Default()
@@ -48,6 +54,33 @@ func Setup(
 	ragHandler := handlers.NewRAGHandler(ragService)
 	userDataHandler := handlers.NewUserDataHandler(userDataService)
 	chatHandler := handlers.NewChatHandler(chatService)
+	promptTemplateHandler := handlers.NewPromptTemplateHandler(promptTemplateService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+	caldavHandler := handlers.NewCalDAVHandler(caldavService)
+
+	// CalDAV for native task apps, signed in with an app password
+	for _, method := range []string{http.MethodGet, "PROPFIND"} {
+		r.Handle(method, "/.well-known/caldav", caldavHandler.WellKnown)
+	}
+	dav := r.Group("/caldav")
+	{
+		dav.OPTIONS("/*path", caldavHandler.Options)
+
+		davAuth := dav.Group("")
+		davAuth.Use(middleware.BasicAuthMiddleware(caldavService, "Memlane"))
+		{
+			davAuth.Handle("PROPFIND", "/*path", caldavHandler.Propfind)
+			davAuth.Handle("PROPPATCH", "/*path", caldavHandler.Proppatch)
+			davAuth.Handle("REPORT", "/*path", caldavHandler.Report)
+			davAuth.Handle("MKCALENDAR", "/*path", caldavHandler.MakeCollection)
+			davAuth.Handle("MKCOL", "/*path", caldavHandler.MakeCollection)
+			davAuth.GET("/*path", caldavHandler.Get)
+			davAuth.HEAD("/*path", caldavHandler.Get)
+			davAuth.PUT("/*path", caldavHandler.Put)
+			davAuth.DELETE("/*path", caldavHandler.Delete)
+		}
+	}
 
 	// API routes
 	api := r.Group("/api")
@@ -59,6 +92,13 @@ func Setup(
 			auth.POST("/logout", authHandler.Logout)
 		}
 
+		// Digest email unsubscribe links (public, authorized by token)
+		api.GET("/digest/unsubscribe", memoryHandler.ConfirmUnsubscribeDigest)
+		api.POST("/digest/unsubscribe", memoryHandler.UnsubscribeDigest)
+
+		// iCalendar subscription feed (public, authorized by token)
+		api.GET("/calendar/ics/:token", calendarHandler.ServeFeed)
+
 		// Protected routes
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware(supabaseAuthService))
@@ -69,10 +109,47 @@ func Setup(
 			// Todos
 			protected.GET("/todos", todoHandler.GetAll)
 			protected.POST("/todos", todoHandler.Create)
+			protected.GET("/todos/upcoming", todoHandler.GetUpcoming)
 			protected.GET("/todos/:id", todoHandler.GetByID)
+			protected.GET("/todos/:id/subtasks", todoHandler.GetSubtasks)
 			protected.PUT("/todos/:id", todoHandler.Update)
 			protected.DELETE("/todos/:id", todoHandler.Delete)
+			protected.POST("/todos/:id/skip", todoHandler.Skip)
+			protected.POST("/todos/:id/blockers", todoHandler.AddBlocker)
+			protected.DELETE("/todos/:id/blockers/:blocker_id", todoHandler.RemoveBlocker)
+			protected.GET("/todos/:id/reminders", todoHandler.GetReminders)
+			protected.POST("/todos/:id/reminders", todoHandler.CreateReminder)
+			protected.DELETE("/todos/:id/reminders/:reminder_id", todoHandler.DeleteReminder)
+			protected.POST("/todos/:id/timer/start", todoHandler.StartTimer)
+			protected.POST("/todos/:id/timer/stop", todoHandler.StopTimer)
+			protected.GET("/todos/:id/time", todoHandler.GetTime)
+			protected.POST("/todos/:id/time-entries", todoHandler.CreateTimeEntry)
+			protected.DELETE("/todos/:id/time-entries/:entry_id", todoHandler.DeleteTimeEntry)
+			protected.POST("/todos/:id/move", todoHandler.Move)
+			protected.PUT("/todos/:id/position", todoHandler.MoveAfter)
 			protected.PUT("/todos/reorder", todoHandler.Reorder)
+			protected.POST("/todos/import", calendarHandler.ImportTodos)
+
+			// Time tracking
+			protected.GET("/time/timer", todoHandler.GetRunningTimer)
+			protected.GET("/time/report", todoHandler.GetTimeReport)
+
+			// Notifications (where reminders are sent)
+			protected.GET("/notifications/settings", notificationHandler.GetSettings)
+			protected.PUT("/notifications/settings", notificationHandler.UpdateSettings)
+			protected.GET("/notifications/push-subscriptions", notificationHandler.GetPushSubscriptions)
+			protected.POST("/notifications/push-subscriptions", notificationHandler.Subscribe)
+			protected.DELETE("/notifications/push-subscriptions/:id", notificationHandler.Unsubscribe)
+
+			// CalDAV app password
+			protected.GET("/caldav/credentials", caldavHandler.GetCredentials)
+			protected.POST("/caldav/credentials", caldavHandler.CreatePassword)
+			protected.DELETE("/caldav/credentials", caldavHandler.DeleteCredentials)
+
+			// Calendar feed
+			protected.GET("/calendar/feed", calendarHandler.GetFeed)
+			protected.POST("/calendar/feed", calendarHandler.CreateFeed)
+			protected.DELETE("/calendar/feed", calendarHandler.DeleteFeed)
 
 			// Groups
 			protected.GET("/groups", groupHandler.GetAll)
@@ -80,6 +157,10 @@ func Setup(
 			protected.GET("/groups/:id", groupHandler.GetByID)
 			protected.PUT("/groups/:id", groupHandler.Update)
 			protected.DELETE("/groups/:id", groupHandler.Delete)
+			protected.GET("/groups/:id/board", todoHandler.GetBoard)
+			protected.POST("/groups/:id/board/columns", todoHandler.CreateColumn)
+			protected.PUT("/groups/:id/board/columns/:column_id", todoHandler.UpdateColumn)
+			protected.DELETE("/groups/:id/board/columns/:column_id", todoHandler.DeleteColumn)
 
 			// AI Providers
 			protected.GET("/ai-providers", aiProviderHandler.GetAll)
@@ -88,8 +169,10 @@ func Setup(
 			protected.PUT("/ai-providers/:id", aiProviderHandler.Update)
 			protected.DELETE("/ai-providers/:id", aiProviderHandler.Delete)
 			protected.POST("/ai-providers/test", aiProviderHandler.TestConnection)
+			protected.GET("/ai-providers/stats", aiProviderHandler.GetStats)
 			protected.POST("/ai-providers/:id/fetch-models", aiProviderHandler.FetchModels)
 			protected.GET("/ai-providers/:id/models", aiProviderHandler.GetModels)
+			protected.POST("/ai-providers/:id/pull-model", aiProviderHandler.PullModel)
 
 			// Memories
 			protected.GET("/memories", memoryHandler.GetAll)
@@ -101,14 +184,24 @@ func Setup(
 			protected.GET("/memories/category/:category", memoryHandler.GetByCategory)
 			protected.GET("/memories/stats", memoryHandler.GetStats)
 			protected.POST("/memories/search", memoryHandler.Search)
+			protected.PUT("/memories/:id/position", memoryHandler.MoveAfter)
 			protected.PUT("/memories/reorder", memoryHandler.Reorder)
 			protected.GET("/memories/digest", memoryHandler.GetDigest)
 			protected.POST("/memories/digest/generate", memoryHandler.GenerateDigest)
+			protected.GET("/memories/digest/settings", memoryHandler.GetDigestSettings)
+			protected.PUT("/memories/digest/settings", memoryHandler.UpdateDigestSettings)
+			protected.GET("/memories/digests", memoryHandler.ListDigests)
+			protected.GET("/memories/digests/:id", memoryHandler.GetDigestByID)
 			protected.POST("/memories/web-search", memoryHandler.WebSearch)
+			protected.GET("/memories/resurface", memoryHandler.GetResurfaceFeed)
 			protected.GET("/memories/:id", memoryHandler.GetByID)
 			protected.PUT("/memories/:id", memoryHandler.Update)
 			protected.DELETE("/memories/:id", memoryHandler.Delete)
 			protected.POST("/memories/:id/to-todo", memoryHandler.ConvertToTodo)
+			protected.GET("/memories/:id/learn", memoryHandler.GetLearnState)
+			protected.PUT("/memories/:id/learn", memoryHandler.MarkLearn)
+			protected.DELETE("/memories/:id/learn", memoryHandler.UnmarkLearn)
+			protected.POST("/memories/:id/review", memoryHandler.ReviewMemory)
 
 			// RAG - Search & Q&A
 			protected.POST("/rag/search", ragHandler.Search)
@@ -128,6 +221,14 @@ func Setup(
 			protected.POST("/chat/threads", chatHandler.CreateThread)
 			protected.POST("/chat/threads/:id/messages", chatHandler.AddMessage)
 			protected.DELETE("/chat/threads/:id", chatHandler.DeleteThread)
+
+			// Prompt Templates
+			protected.GET("/prompt-templates", promptTemplateHandler.GetAll)
+			protected.GET("/prompt-templates/:name", promptTemplateHandler.GetByName)
+			protected.PUT("/prompt-templates/:name", promptTemplateHandler.Update)
+			protected.DELETE("/prompt-templates/:name", promptTemplateHandler.Reset)
+			protected.GET("/prompt-templates/:name/versions", promptTemplateHandler.GetVersions)
+			protected.POST("/prompt-templates/:name/preview", promptTemplateHandler.Preview)
 		}
 	}
 
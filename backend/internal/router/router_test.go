@@ -0,0 +1,2272 @@
+package router_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/todomyday/backend/internal/fakes"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/services"
+)
+
+func TestAuthRequired(t *testing.T) {
+	env := newTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	env.expect(env.serve(req), http.StatusUnauthorized, nil)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer unknown-token")
+	env.expect(env.serve(req), http.StatusUnauthorized, nil)
+
+	var resp struct {
+		User models.User `json:"user"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/auth/me", nil), http.StatusOK, &resp)
+	if resp.User.Email != "tester@example.com" {
+		t.Fatalf("expected synced user, got %+v", resp.User)
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	env := newTestEnv(t)
+	env.openai.SetModels("gpt-fake", "gpt-fake-mini")
+	env.google.SetModels("gemini-fake")
+	services.RegisterMockScript("connection", &services.MockScript{Models: []string{"scripted-model"}})
+
+	tests := []struct {
+		providerType models.ProviderType
+		baseURL      string
+		want         string
+	}{
+		{models.ProviderTypeOpenAI, env.openai.URL, "gpt-fake-mini"},
+		{models.ProviderTypeGoogle, env.google.URL, "gemini-fake"},
+		{models.ProviderTypeMock, "mock://connection", "scripted-model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.providerType), func(t *testing.T) {
+			var result models.TestConnectionResponse
+			env.expect(env.do(http.MethodPost, "/api/ai-providers/test", models.TestConnectionRequest{
+				ProviderType: tt.providerType,
+				BaseURL:      tt.baseURL,
+				APIKey:       "test-key",
+			}), http.StatusOK, &result)
+
+			if !result.Success {
+				t.Fatalf("expected success, got %+v", result)
+			}
+			found := false
+			for _, model := range result.Models {
+				found = found || model == tt.want
+			}
+			if !found {
+				t.Fatalf("expected model %q in %v", tt.want, result.Models)
+			}
+		})
+	}
+}
+
+func TestCreateMemoryWithMockProvider(t *testing.T) {
+	env := newTestEnv(t)
+
+	script := &services.MockScript{
+		Rules: []services.MockRule{
+			{
+				Match: "cacio e pepe",
+				ToolCalls: []services.MockToolCall{{
+					Name:      "categorize_memory",
+					Arguments: map[string]interface{}{"summary": "A pasta dish to try in Rome", "category": "Food"},
+				}},
+			},
+			{
+				Match:    "Stoicism",
+				Response: `{"summary": "", "category": "Learnings"}`,
+			},
+		},
+	}
+	services.RegisterMockScript("create-memory", script)
+	env.useProvider(models.ProviderTypeMock, "mock://create-memory", "", "mock-model")
+
+	memory := env.createMemory("Try the cacio e pepe at Felice a Testaccio next time I'm in Rome")
+	if memory.Category != "Food" {
+		t.Errorf("expected category Food, got %q", memory.Category)
+	}
+	if memory.Summary == nil || *memory.Summary != "A pasta dish to try in Rome" {
+		t.Errorf("unexpected summary %v", memory.Summary)
+	}
+
+	// No scripted tool call: falls back to structured categorization
+	memory = env.createMemory("Stoicism is about focusing on what you control")
+	if memory.Category != "Learnings" {
+		t.Errorf("expected fallback category Learnings, got %q", memory.Category)
+	}
+
+	kinds := []string{}
+	for _, call := range script.Calls() {
+		kinds = append(kinds, call.Kind)
+	}
+	if strings.Join(kinds, ",") != "tools,tools,json" {
+		t.Errorf("unexpected mock call sequence %v", kinds)
+	}
+}
+
+func TestCreateMemoryScrapesURLAcrossProviders(t *testing.T) {
+	env := newTestEnv(t)
+
+	pageURL := env.searxng.AddPage(fakes.Page{
+		Path:    "/felice",
+		Title:   "Felice a Testaccio",
+		Snippet: "Roman trattoria",
+		Body:    "Felice a Testaccio is a Roman trattoria famous for cacio e pepe tossed at the table.",
+	})
+
+	categorize := fakes.Reply{
+		Match: "take the appropriate action",
+		ToolCalls: []fakes.ToolCall{{
+			Name: "categorize_memory",
+			Arguments: map[string]interface{}{
+				"summary":  "Restaurant to visit",
+				"category": "Places",
+				"has_url":  true,
+				"url":      pageURL,
+			},
+		}},
+	}
+	summarize := fakes.Reply{
+		Match: "Summarize this webpage",
+		Text:  `{"title": "Felice a Testaccio", "summary": "Trattoria in Rome known for cacio e pepe."}`,
+	}
+
+	tests := []struct {
+		providerType models.ProviderType
+		server       interface {
+			Reply(...fakes.Reply)
+			Prompts() []string
+		}
+		baseURL string
+		model   string
+	}{
+		{models.ProviderTypeOpenAI, env.openai, env.openai.URL, "gpt-fake"},
+		{models.ProviderTypeAnthropic, env.anthropic, env.anthropic.URL, "claude-fake"},
+		{models.ProviderTypeGoogle, env.google, env.google.URL, "gemini-fake"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.providerType), func(t *testing.T) {
+			tt.server.Reply(categorize, summarize)
+			env.useProvider(tt.providerType, tt.baseURL, "test-key", tt.model)
+
+			memory := env.createMemory("Dinner idea: " + pageURL)
+			if memory.Category != "Places" {
+				t.Errorf("expected category Places, got %q", memory.Category)
+			}
+			if memory.URL == nil || *memory.URL != pageURL {
+				t.Errorf("expected URL %s, got %v", pageURL, memory.URL)
+			}
+			if memory.URLContent == nil || !strings.Contains(*memory.URLContent, "cacio e pepe") {
+				t.Errorf("expected URL summary, got %v", memory.URLContent)
+			}
+
+			prompts := tt.server.Prompts()
+			if len(prompts) != 2 {
+				t.Fatalf("expected 2 provider calls, got %d", len(prompts))
+			}
+			if !strings.Contains(prompts[1], "tossed at the table") {
+				t.Errorf("expected scraped page content in summary prompt, got %q", prompts[1])
+			}
+		})
+	}
+}
+
+func TestPullModelErrors(t *testing.T) {
+	env := newTestEnv(t)
+	provider := env.useProvider(models.ProviderTypeMock, "mock://pull-model", "", "mock-model")
+	req := models.PullModelRequest{Model: "llama3"}
+
+	env.expect(env.do(http.MethodPost, "/api/ai-providers/missing/pull-model", req), http.StatusNotFound, nil)
+	// Only Ollama can pull models
+	env.expect(env.do(http.MethodPost, "/api/ai-providers/"+provider.ID+"/pull-model", req), http.StatusBadRequest, nil)
+}
+
+func TestUploadJob(t *testing.T) {
+	env := newTestEnv(t)
+	services.RegisterMockScript("upload", &services.MockScript{
+		Rules: []services.MockRule{{
+			ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Ideas"},
+			}},
+		}},
+	})
+	env.useProvider(models.ProviderTypeMock, "mock://upload", "", "mock-model")
+
+	var job models.UploadJobCreateResponse
+	env.expect(env.upload("/api/memories/upload", "file", "notes.md", "# Garden\nPlant tomatoes in spring\n\n## Reading\nFinish the Dune series\n"), http.StatusAccepted, &job)
+	if job.JobID == "" {
+		t.Fatal("expected job ID")
+	}
+
+	var status models.UploadJobStatusResponse
+	waitFor(t, 5*time.Second, func() bool {
+		env.expect(env.do(http.MethodGet, "/api/memories/upload/jobs/"+job.JobID, nil), http.StatusOK, &status)
+		return status.Status == models.JobStatusCompleted
+	})
+
+	if status.TotalItems != 2 || len(status.Memories) != 2 {
+		t.Fatalf("expected 2 memories, got total=%d memories=%d", status.TotalItems, len(status.Memories))
+	}
+	for _, memory := range status.Memories {
+		if memory.Category != "Ideas" {
+			t.Errorf("expected category Ideas, got %q for %q", memory.Category, memory.Content)
+		}
+	}
+
+	env.expect(env.do(http.MethodGet, "/api/memories/upload/jobs/missing", nil), http.StatusNotFound, nil)
+}
+
+func TestUploadImageUsesVisionModel(t *testing.T) {
+	env := newTestEnv(t)
+
+	image := "\x89PNG\r\n\x1a\nfake image bytes"
+	encoded := base64.StdEncoding.EncodeToString([]byte(image))
+	extraction := fakes.Reply{
+		Text: `{"content": "Buy milk, eggs and bread", "summary": "Shopping list", "category": "Ideas", "tags": ["Groceries"]}`,
+	}
+
+	// Without a vision model (and no server fallback) image upload is unavailable
+	env.useProvider(models.ProviderTypeOpenAI, env.openai.URL, "test-key", "gpt-fake")
+	env.expect(env.upload("/api/memories/upload-image", "image", "list.png", image), http.StatusServiceUnavailable, nil)
+
+	tests := []struct {
+		providerType models.ProviderType
+		server       interface {
+			Reply(...fakes.Reply)
+			Requests() []fakes.Request
+		}
+		baseURL   string
+		imageKey  string // where the provider's request format carries the image
+		wantModel func(req fakes.Request) bool
+	}{
+		{models.ProviderTypeOpenAI, env.openai, env.openai.URL, "image_url", func(req fakes.Request) bool {
+			return req.Body["model"] == "vision-fake"
+		}},
+		{models.ProviderTypeAnthropic, env.anthropic, env.anthropic.URL, "media_type", func(req fakes.Request) bool {
+			return req.Body["model"] == "vision-fake"
+		}},
+		{models.ProviderTypeGoogle, env.google, env.google.URL, "inlineData", func(req fakes.Request) bool {
+			return strings.Contains(req.Path, "vision-fake")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.providerType), func(t *testing.T) {
+			tt.server.Reply(extraction)
+			provider := env.useProvider(tt.providerType, tt.baseURL, "test-key", "chat-fake")
+			visionModel := "vision-fake"
+			env.expect(env.do(http.MethodPut, "/api/ai-providers/"+provider.ID, models.AIProviderUpdate{
+				VisionModel: &visionModel,
+			}), http.StatusOK, nil)
+
+			var resp struct {
+				Memory models.Memory `json:"memory"`
+			}
+			env.expect(env.upload("/api/memories/upload-image", "image", "list.png", image), http.StatusCreated, &resp)
+			if resp.Memory.Content != "Buy milk, eggs and bread" || resp.Memory.Category != "Ideas" {
+				t.Errorf("unexpected memory %+v", resp.Memory)
+			}
+
+			requests := tt.server.Requests()
+			if len(requests) == 0 {
+				t.Fatal("expected a vision request")
+			}
+			req := requests[len(requests)-1]
+			body, _ := json.Marshal(req.Body)
+			if !strings.Contains(string(body), encoded) || !strings.Contains(string(body), tt.imageKey) {
+				t.Errorf("expected image as %s in request, got %.300s", tt.imageKey, body)
+			}
+			if !tt.wantModel(req) {
+				t.Errorf("expected vision model in request to %s", req.Path)
+			}
+		})
+	}
+}
+
+func TestModelCapabilityRouting(t *testing.T) {
+	env := newTestEnv(t)
+
+	// Listed capabilities are cached with the model
+	env.google.SetModels("gemini-fake")
+	google := env.useProvider(models.ProviderTypeGoogle, env.google.URL, "test-key", "gemini-fake")
+	var listed []models.AIProviderModel
+	env.expect(env.do(http.MethodPost, "/api/ai-providers/"+google.ID+"/fetch-models", nil), http.StatusOK, &listed)
+	if len(listed) != 1 || listed[0].Capabilities.ContextWindow != fakes.FakeInputTokenLimit {
+		t.Fatalf("expected listed context window %d, got %+v", fakes.FakeInputTokenLimit, listed)
+	}
+
+	script := &services.MockScript{
+		Models: []string{"mock-chat", "mock-vision", "mock-long"},
+		Capabilities: map[string]models.ModelCapabilities{
+			"mock-chat":   {ContextWindow: 50, Tools: true, JSONMode: true},
+			"mock-vision": {ContextWindow: 60, Vision: true},
+			"mock-long":   {ContextWindow: 200000, Tools: true, JSONMode: true},
+		},
+		Rules: []services.MockRule{
+			{Match: "Analyze this image", Response: `{"content": "Whiteboard: ship the beta", "category": "Ideas"}`},
+			{Match: "memories/notes from the past week", Response: "A productive week."},
+			{ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Ideas"},
+			}}},
+		},
+	}
+	services.RegisterMockScript("capabilities", script)
+	provider := env.useProvider(models.ProviderTypeMock, "mock://capabilities", "", "mock-chat")
+	env.expect(env.do(http.MethodPost, "/api/ai-providers/"+provider.ID+"/fetch-models", nil), http.StatusOK, nil)
+
+	// A model known to lack vision can't be the vision model
+	chatModel := "mock-chat"
+	env.expect(env.do(http.MethodPut, "/api/ai-providers/"+provider.ID, models.AIProviderUpdate{
+		VisionModel: &chatModel,
+	}), http.StatusBadRequest, nil)
+
+	// Without a selection, images go to a vision-capable model
+	env.expect(env.upload("/api/memories/upload-image", "image", "board.png", "fake image bytes"), http.StatusCreated, nil)
+
+	// The digest prompt doesn't fit mock-chat's window, so it moves to the long-context model
+	var resp struct {
+		Digest models.MemoryDigest `json:"digest"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/memories/digest/generate", nil), http.StatusCreated, &resp)
+	if resp.Digest.DigestContent != "A productive week." {
+		t.Errorf("unexpected digest %q", resp.Digest.DigestContent)
+	}
+
+	modelFor := map[string]string{}
+	for _, call := range script.Calls() {
+		switch {
+		case strings.Contains(call.Prompt, "Analyze this image"):
+			modelFor["vision"] = call.Model
+		case strings.Contains(call.Prompt, "memories/notes from the past week"):
+			modelFor["digest"] = call.Model
+		}
+	}
+	if modelFor["vision"] != "mock-vision" || modelFor["digest"] != "mock-long" {
+		t.Errorf("expected vision on mock-vision and digest on mock-long, got %v", modelFor)
+	}
+}
+
+func TestAskFitsContextWindow(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.searxng.AddPage(fakes.Page{
+		Path:    "/marathon",
+		Title:   "Marathon training plan",
+		Snippet: "Build mileage gradually over 16 weeks",
+		Body:    strings.Repeat("Long runs should increase by no more than ten percent each week. ", 300),
+	})
+
+	// Room for the snippet but not the whole page once the answer and instructions are reserved
+	script := &services.MockScript{
+		Models: []string{"mock-small"},
+		Capabilities: map[string]models.ModelCapabilities{
+			"mock-small": {ContextWindow: 1600, Tools: true, JSONMode: true},
+		},
+		Rules: []services.MockRule{{Match: "web search results", Response: "Increase mileage slowly."}},
+	}
+	services.RegisterMockScript("small-window", script)
+	provider := env.useProvider(models.ProviderTypeMock, "mock://small-window", "", "mock-small")
+	env.expect(env.do(http.MethodPost, "/api/ai-providers/"+provider.ID+"/fetch-models", nil), http.StatusOK, nil)
+
+	var resp models.AskResponse
+	env.expect(env.do(http.MethodPost, "/api/rag/ask", models.AskRequest{
+		Question: "How should I train for a marathon?",
+		Mode:     models.AskModeInternet,
+	}), http.StatusOK, &resp)
+
+	if resp.Context == nil || len(resp.Context.Summarized) != 1 || resp.Context.Summarized[0] != "Marathon training plan" {
+		t.Fatalf("expected the page to be summarized, got %+v", resp.Context)
+	}
+	if resp.Context.Used > resp.Context.Budget {
+		t.Errorf("used %d tokens of a %d token budget", resp.Context.Used, resp.Context.Budget)
+	}
+
+	calls := script.Calls()
+	prompt := calls[len(calls)-1].Prompt
+	if !strings.Contains(prompt, "Build mileage gradually") || strings.Contains(prompt, "Long runs should increase") {
+		t.Errorf("expected the search snippet in place of the page, got %.300s", prompt)
+	}
+}
+
+func TestAskModes(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.searxng.AddPage(fakes.Page{
+		Path:    "/sourdough",
+		Title:   "Sourdough basics",
+		Snippet: "How to feed a starter",
+		Body:    "Feed a sourdough starter with equal weights of flour and water every day.",
+	})
+
+	services.RegisterMockScript("ask", &services.MockScript{
+		Rules: []services.MockRule{
+			{Match: "YOUR PERSONAL DATA", Response: "Combined answer."},
+			{Match: "personal data", Response: "From your notes: feed it daily."},
+			{Match: "web search results", Response: "The web says: equal flour and water."},
+			{Match: "search queries", Response: `{"queries": ["sourdough starter feeding"]}`},
+			{Match: "answer the following question directly", Response: "Direct answer."},
+			{ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Food"},
+			}}},
+		},
+	})
+	env.useProvider(models.ProviderTypeMock, "mock://ask", "", "mock-model")
+
+	env.createMemory("My sourdough starter needs feeding every day with flour and water")
+
+	// Memories are indexed asynchronously after creation
+	waitFor(t, 5*time.Second, func() bool {
+		var search models.SearchResponse
+		env.expect(env.do(http.MethodPost, "/api/rag/search", models.SearchRequest{Query: "sourdough starter"}), http.StatusOK, &search)
+		return len(search.Results) > 0
+	})
+
+	tests := []struct {
+		mode        models.AskMode
+		wantAnswer  string
+		wantSources []models.ContentType
+	}{
+		{models.AskModeMemories, "From your notes: feed it daily.", []models.ContentType{models.ContentTypeMemory}},
+		{models.AskModeInternet, "The web says: equal flour and water.", []models.ContentType{models.ContentTypeWeb}},
+		{models.AskModeHybrid, "Combined answer.", []models.ContentType{models.ContentTypeMemory, models.ContentTypeWeb}},
+		{models.AskModeLLM, "Direct answer.", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			var resp models.AskResponse
+			env.expect(env.do(http.MethodPost, "/api/rag/ask", models.AskRequest{
+				Question: "How often should I feed my sourdough starter?",
+				Mode:     tt.mode,
+			}), http.StatusOK, &resp)
+
+			if resp.Answer != tt.wantAnswer {
+				t.Errorf("expected answer %q, got %q", tt.wantAnswer, resp.Answer)
+			}
+			for _, want := range tt.wantSources {
+				found := false
+				for _, source := range resp.Sources {
+					found = found || source.Document.ContentType == want
+				}
+				if !found {
+					t.Errorf("expected a %s source in %d sources", want, len(resp.Sources))
+				}
+			}
+			if tt.wantSources == nil && len(resp.Sources) != 0 {
+				t.Errorf("expected no sources, got %d", len(resp.Sources))
+			}
+		})
+	}
+
+	if queries := env.searxng.Queries(); len(queries) == 0 {
+		t.Error("expected web searches")
+	}
+}
+
+func TestDigestScheduler(t *testing.T) {
+	env := newTestEnv(t)
+
+	script := &services.MockScript{
+		Rules: []services.MockRule{
+			{Match: "memories/notes from the past day", Response: "A quiet day."},
+			{ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Ideas"},
+			}}},
+		},
+	}
+	services.RegisterMockScript("scheduler", script)
+	env.useProvider(models.ProviderTypeMock, "mock://scheduler", "", "mock-model")
+
+	badZone := "Mars/Olympus"
+	env.expect(env.do(http.MethodPut, "/api/memories/digest/settings", models.DigestSettingsUpdate{
+		Timezone: &badZone,
+	}), http.StatusBadRequest, nil)
+
+	cadence, zone := models.DigestDaily, "Europe/Berlin"
+	var settings struct {
+		Settings models.DigestSettings `json:"settings"`
+	}
+	env.expect(env.do(http.MethodPut, "/api/memories/digest/settings", models.DigestSettingsUpdate{
+		Cadence:  &cadence,
+		Timezone: &zone,
+	}), http.StatusOK, &settings)
+	if settings.Settings.Cadence != models.DigestDaily || settings.Settings.Timezone != zone || !settings.Settings.Enabled {
+		t.Fatalf("unexpected settings %+v", settings.Settings)
+	}
+
+	env.expect(env.do(http.MethodPost, "/api/memories", models.MemoryCreateRequest{
+		Content: "Try a standing desk",
+	}), http.StatusCreated, nil)
+
+	// Two days on, today's period is over; the other backfilled days had no memories
+	later := time.Now().Add(48 * time.Hour)
+	if generated := env.digests.RunOnce(later); generated != 1 {
+		t.Fatalf("expected 1 digest, got %d", generated)
+	}
+	if generated := env.digests.RunOnce(later); generated != 0 {
+		t.Fatalf("expected existing digests to be kept, got %d new", generated)
+	}
+
+	var history struct {
+		Digests []models.MemoryDigest `json:"digests"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/memories/digests?period=daily", nil), http.StatusOK, &history)
+	if len(history.Digests) != 1 {
+		t.Fatalf("expected 1 digest in history, got %d", len(history.Digests))
+	}
+
+	digest := history.Digests[0]
+	loc, _ := time.LoadLocation(zone)
+	today := time.Now().In(loc).Format("2006-01-02")
+	if digest.Period != models.DigestDaily || digest.WeekStart != today || digest.WeekEnd != today || digest.DigestContent != "A quiet day." {
+		t.Errorf("unexpected digest %+v", digest)
+	}
+
+	env.expect(env.do(http.MethodGet, "/api/memories/digests/"+digest.ID, nil), http.StatusOK, nil)
+	env.expect(env.do(http.MethodGet, "/api/memories/digests/unknown", nil), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodGet, "/api/memories/digests?period=yearly", nil), http.StatusBadRequest, nil)
+}
+
+func TestDigestTodos(t *testing.T) {
+	env := newTestEnv(t)
+
+	script := &services.MockScript{
+		Rules: []services.MockRule{
+			{Match: "memories/notes from the past day", Response: "A busy day."},
+			{Match: "connections between someone's notes and their todos", Response: `{"insights": [
+				{"text": "Your photo notes will help with the passport renewal.", "memories": ["M1", "M9"], "todos": ["t1", "T9"]},
+				{"text": " ", "memories": [], "todos": []}
+			]}`},
+			{ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Ideas"},
+			}}},
+		},
+	}
+	services.RegisterMockScript("digest-todos", script)
+	env.useProvider(models.ProviderTypeMock, "mock://digest-todos", "", "mock-model")
+
+	cadence := models.DigestDaily
+	env.expect(env.do(http.MethodPut, "/api/memories/digest/settings", models.DigestSettingsUpdate{
+		Cadence: &cadence,
+	}), http.StatusOK, nil)
+
+	memory := env.createMemory("Passport photos need a white background")
+
+	now := time.Now().UTC()
+	personal := "default-personal"
+	yesterday, nextWeek := now.AddDate(0, 0, -1).Format("2006-01-02"), now.AddDate(0, 0, 7).Format("2006-01-02")
+	todos := make(map[string]models.Todo)
+	for _, req := range []models.TodoCreateRequest{
+		{Title: "Renew passport", DueDate: &yesterday, GroupID: &personal},
+		{Title: "Buy groceries", GroupID: &personal},
+		{Title: "Call mom", DueDate: &nextWeek},
+	} {
+		var resp struct {
+			Todo models.Todo `json:"todo"`
+		}
+		env.expect(env.do(http.MethodPost, "/api/todos", req), http.StatusCreated, &resp)
+		todos[req.Title] = resp.Todo
+	}
+
+	completed := models.StatusCompleted
+	var updated struct {
+		Todo models.Todo `json:"todo"`
+	}
+	env.expect(env.do(http.MethodPut, "/api/todos/"+todos["Buy groceries"].ID, models.TodoUpdateRequest{
+		Status: &completed,
+	}), http.StatusOK, &updated)
+	if updated.Todo.CompletedAt == nil {
+		t.Fatal("expected completed todo to record when it was completed")
+	}
+
+	if generated := env.digests.RunOnce(now.Add(24 * time.Hour)); generated != 1 {
+		t.Fatalf("expected 1 digest, got %d", generated)
+	}
+
+	// The digest prompt lists each todo once with everything that happened to it
+	var prompt string
+	for _, call := range script.Calls() {
+		if strings.Contains(call.Prompt, "memories/notes from the past day") {
+			prompt = call.Prompt
+		}
+	}
+	for _, want := range []string{
+		"Personal:\n- Renew passport (added, overdue, due " + yesterday + ")\n- Buy groceries (added, completed)",
+		"No group:\n- Call mom (added)",
+		"Passport photos need a white background",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected digest prompt to contain %q, got:\n%s", want, prompt)
+		}
+	}
+
+	var history struct {
+		Digests []models.MemoryDigest `json:"digests"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/memories/digests", nil), http.StatusOK, &history)
+	if len(history.Digests) != 1 || history.Digests[0].Sections == nil {
+		t.Fatalf("expected 1 digest with sections, got %+v", history.Digests)
+	}
+
+	sections := history.Digests[0].Sections
+	if len(sections.Todos) != 2 || sections.Todos[0].Name != "Personal" || sections.Todos[1].GroupID != nil {
+		t.Fatalf("expected Personal then ungrouped todos, got %+v", sections.Todos)
+	}
+	titles := func(list []models.DigestTodo) []string {
+		out := []string{}
+		for _, todo := range list {
+			out = append(out, todo.Title)
+		}
+		return out
+	}
+	group := sections.Todos[0]
+	if got := titles(group.Created); !reflect.DeepEqual(got, []string{"Renew passport", "Buy groceries"}) {
+		t.Errorf("unexpected created todos %v", got)
+	}
+	if got := titles(group.Completed); !reflect.DeepEqual(got, []string{"Buy groceries"}) {
+		t.Errorf("unexpected completed todos %v", got)
+	}
+	if got := titles(group.Overdue); !reflect.DeepEqual(got, []string{"Renew passport"}) {
+		t.Errorf("unexpected overdue todos %v", got)
+	}
+
+	// Refs are mapped back to IDs; made-up refs and empty insights are dropped
+	want := []models.DigestInsight{{
+		Text:      "Your photo notes will help with the passport renewal.",
+		MemoryIDs: []string{memory.ID},
+		TodoIDs:   []string{todos["Renew passport"].ID},
+	}}
+	if !reflect.DeepEqual(sections.Insights, want) {
+		t.Errorf("expected insights %+v, got %+v", want, sections.Insights)
+	}
+}
+
+func TestResurfacing(t *testing.T) {
+	env := newTestEnv(t)
+
+	categorize := func(category string) []services.MockToolCall {
+		return []services.MockToolCall{{
+			Name:      "categorize_memory",
+			Arguments: map[string]interface{}{"category": category},
+		}}
+	}
+	services.RegisterMockScript("resurfacing", &services.MockScript{
+		Rules: []services.MockRule{
+			{Match: "TIL", ToolCalls: categorize("Learnings")},
+			{ToolCalls: categorize("Ideas")},
+		},
+	})
+	env.useProvider(models.ProviderTypeMock, "mock://resurfacing", "", "mock-model")
+
+	type feedResponse struct {
+		Date      string                    `json:"date"`
+		OnThisDay []models.ResurfacedMemory `json:"on_this_day"`
+		Due       []models.ResurfacedMemory `json:"due"`
+	}
+	type reviewResponse struct {
+		Review *models.MemoryReview `json:"review"`
+	}
+	feed := func(date time.Time) feedResponse {
+		t.Helper()
+		var resp feedResponse
+		env.expect(env.do(http.MethodGet, "/api/memories/resurface?date="+date.Format("2006-01-02"), nil), http.StatusOK, &resp)
+		return resp
+	}
+	review := func(id string, outcome models.ReviewOutcome, date time.Time) *models.MemoryReview {
+		t.Helper()
+		day := date.Format("2006-01-02")
+		var resp reviewResponse
+		env.expect(env.do(http.MethodPost, "/api/memories/"+id+"/review", models.MemoryReviewRequest{
+			Outcome: outcome,
+			Date:    &day,
+		}), http.StatusOK, &resp)
+		return resp.Review
+	}
+
+	learning := env.createMemory("TIL spaced repetition beats cramming")
+	anniversary := env.createMemory("Anniversary dinner at Luigi's")
+	other := env.createMemory("Bought a bike")
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for id, createdAt := range map[string]time.Time{
+		anniversary.ID: now.AddDate(-2, 0, 0),
+		other.ID:       now.AddDate(-1, 0, -1),
+	} {
+		if _, err := env.db.Exec("UPDATE memories SET created_at = ? WHERE id = ?", createdAt, id); err != nil {
+			t.Fatalf("backdate memory: %v", err)
+		}
+	}
+
+	// Learnings are scheduled for the next day
+	resp := feed(today)
+	if len(resp.OnThisDay) != 1 || resp.OnThisDay[0].Memory.ID != anniversary.ID || resp.OnThisDay[0].YearsAgo != 2 {
+		t.Fatalf("expected the anniversary from 2 years ago, got %+v", resp.OnThisDay)
+	}
+	if len(resp.Due) != 0 {
+		t.Fatalf("expected nothing due today, got %+v", resp.Due)
+	}
+
+	day := today.AddDate(0, 0, 1)
+	resp = feed(day)
+	if len(resp.Due) != 1 || resp.Due[0].Memory.ID != learning.ID || resp.Due[0].Review == nil {
+		t.Fatalf("expected the learning to be due, got %+v", resp.Due)
+	}
+
+	// Intervals grow 1, 6, then by the ease factor; forgetting starts over
+	state := review(learning.ID, models.ReviewGood, day)
+	if state.IntervalDays != 1 || state.DueDate != day.AddDate(0, 0, 1).Format("2006-01-02") {
+		t.Fatalf("unexpected schedule after first review %+v", state)
+	}
+	day = day.AddDate(0, 0, 1)
+	if state = review(learning.ID, models.ReviewGood, day); state.IntervalDays != 6 {
+		t.Fatalf("expected 6 day interval, got %+v", state)
+	}
+	day = day.AddDate(0, 0, 6)
+	if state = review(learning.ID, models.ReviewEasy, day); state.IntervalDays != 20 || state.Ease <= 2.5 {
+		t.Fatalf("expected 6*2.5*1.3 day interval and a higher ease, got %+v", state)
+	}
+	if len(feed(day).Due) != 0 {
+		t.Fatal("expected reviewed memory to leave the feed")
+	}
+	day = day.AddDate(0, 0, 20)
+	state = review(learning.ID, models.ReviewAgain, day)
+	if state.IntervalDays != 1 || state.Repetitions != 0 || state.Lapses != 1 || state.ReviewCount != 4 {
+		t.Fatalf("expected a lapse to start over, got %+v", state)
+	}
+
+	var learnState struct {
+		Review  *models.MemoryReview     `json:"review"`
+		History []models.MemoryReviewLog `json:"history"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/memories/"+learning.ID+"/learn", nil), http.StatusOK, &learnState)
+	if len(learnState.History) != 4 || learnState.History[0].Outcome != models.ReviewAgain {
+		t.Fatalf("expected 4 reviews, newest first, got %+v", learnState.History)
+	}
+
+	// Unmarked memories leave the schedule and stay unmarked when recategorized
+	var marked reviewResponse
+	env.expect(env.do(http.MethodDelete, "/api/memories/"+learning.ID+"/learn", nil), http.StatusOK, &marked)
+	if marked.Review.Learn {
+		t.Fatal("expected memory to be unmarked")
+	}
+	if len(feed(day.AddDate(1, 0, 0)).Due) != 0 {
+		t.Fatal("expected unmarked memory to leave the feed")
+	}
+	category := "Learnings"
+	env.expect(env.do(http.MethodPut, "/api/memories/"+learning.ID, models.MemoryUpdateRequest{Category: &category}), http.StatusOK, nil)
+	env.expect(env.do(http.MethodGet, "/api/memories/"+learning.ID+"/learn", nil), http.StatusOK, &learnState)
+	if learnState.Review.Learn {
+		t.Fatal("expected recategorizing to keep the memory unmarked")
+	}
+	good := models.ReviewGood
+	env.expect(env.do(http.MethodPost, "/api/memories/"+learning.ID+"/review", models.MemoryReviewRequest{Outcome: good}), http.StatusBadRequest, nil)
+
+	// Any memory can be marked
+	env.expect(env.do(http.MethodPut, "/api/memories/"+anniversary.ID+"/learn", nil), http.StatusOK, &marked)
+	if !marked.Review.Learn || marked.Review.ReviewCount != 0 {
+		t.Fatalf("expected a fresh schedule, got %+v", marked.Review)
+	}
+
+	env.expect(env.do(http.MethodGet, "/api/memories/resurface?date=tomorrow", nil), http.StatusBadRequest, nil)
+	env.expect(env.do(http.MethodPut, "/api/memories/unknown/learn", nil), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodPost, "/api/memories/"+other.ID+"/review", map[string]string{"outcome": "meh"}), http.StatusBadRequest, nil)
+}
+
+func TestDigestEmail(t *testing.T) {
+	env := newTestEnv(t)
+
+	script := &services.MockScript{
+		Rules: []services.MockRule{
+			{Match: "memories/notes from the past day", Response: "You planned a <b>standing desk</b>.\n\nKeep it up."},
+			{ToolCalls: []services.MockToolCall{{
+				Name:      "categorize_memory",
+				Arguments: map[string]interface{}{"category": "Ideas"},
+			}}},
+		},
+	}
+	services.RegisterMockScript("digest-email", script)
+	env.useProvider(models.ProviderTypeMock, "mock://digest-email", "", "mock-model")
+
+	cadence, emailEnabled := models.DigestDaily, true
+	env.expect(env.do(http.MethodPut, "/api/memories/digest/settings", models.DigestSettingsUpdate{
+		Cadence:      &cadence,
+		EmailEnabled: &emailEnabled,
+	}), http.StatusOK, nil)
+
+	env.expect(env.do(http.MethodPost, "/api/memories", models.MemoryCreateRequest{
+		Content: "Try a standing desk",
+	}), http.StatusCreated, nil)
+
+	// The scheduler runs tomorrow, when today's digest is the latest one; due dates are relative to then
+	later := time.Now().UTC().Add(24 * time.Hour)
+	todos := map[string]string{
+		"Renew passport": later.AddDate(0, 0, -1).Format("2006-01-02"),
+		"Dentist":        later.AddDate(0, 0, 3).Format("2006-01-02"),
+		"Plan vacation":  later.AddDate(0, 1, 0).Format("2006-01-02"),
+	}
+	for title, due := range todos {
+		env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{
+			Title:   title,
+			DueDate: &due,
+		}), http.StatusCreated, nil)
+	}
+
+	if generated := env.digests.RunOnce(later); generated != 1 {
+		t.Fatalf("expected 1 digest, got %d", generated)
+	}
+
+	messages := env.smtp.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 email, got %d", len(messages))
+	}
+	msg := messages[0]
+	if len(msg.To) != 1 || msg.To[0] != "tester@example.com" {
+		t.Errorf("expected email to tester@example.com, got %v", msg.To)
+	}
+
+	text, html := msg.Body("text/plain"), msg.Body("text/html")
+	for _, want := range []string{"standing desk", "Overdue", "Renew passport", "Coming up", "Dentist"} {
+		if !strings.Contains(text, want) || !strings.Contains(html, want) {
+			t.Errorf("expected %q in both email bodies", want)
+		}
+	}
+	if strings.Contains(text, "Plan vacation") {
+		t.Error("expected todos due next month to be left out")
+	}
+	if !strings.Contains(html, "&lt;b&gt;standing desk&lt;/b&gt;") {
+		t.Error("expected digest text to be escaped in HTML")
+	}
+
+	unsubscribe := strings.Trim(msg.Header("List-Unsubscribe"), "<>")
+	if !strings.HasPrefix(unsubscribe, "http://memlane.test/api/digest/unsubscribe?token=") {
+		t.Fatalf("unexpected unsubscribe link %q", unsubscribe)
+	}
+
+	var settings struct {
+		Settings models.DigestSettings `json:"settings"`
+	}
+	emailsOn := func() bool {
+		t.Helper()
+		env.expect(env.do(http.MethodGet, "/api/memories/digest/settings", nil), http.StatusOK, &settings)
+		return settings.Settings.EmailEnabled
+	}
+
+	// The link works without authentication. Opening it only asks to confirm,
+	// as mail scanners follow links too.
+	path := strings.TrimPrefix(unsubscribe, "http://memlane.test")
+	w := env.serve(httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post"`) {
+		t.Fatalf("expected a confirmation form, got %d %s", w.Code, w.Body.String())
+	}
+	if !emailsOn() {
+		t.Fatal("expected opening the link to leave digest emails on")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/digest/unsubscribe?token=bogus", nil)
+	env.expect(env.serve(req), http.StatusNotFound, nil)
+	req = httptest.NewRequest(http.MethodPost, "/api/digest/unsubscribe?token=bogus", nil)
+	env.expect(env.serve(req), http.StatusNotFound, nil)
+
+	// One-click unsubscribe posts to the link
+	req = httptest.NewRequest(http.MethodPost, path, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	env.expect(env.serve(req), http.StatusOK, nil)
+	if emailsOn() {
+		t.Error("expected digest emails to be turned off")
+	}
+
+	// Later periods are no longer emailed
+	env.expect(env.do(http.MethodPost, "/api/memories", models.MemoryCreateRequest{
+		Content: "Order a monitor arm",
+	}), http.StatusCreated, nil)
+	env.digests.RunOnce(later.Add(24 * time.Hour))
+	if len(env.smtp.Messages()) != 1 {
+		t.Errorf("expected no email after unsubscribing, got %d", len(env.smtp.Messages()))
+	}
+}
+
+func TestRecurringTodos(t *testing.T) {
+	env := newTestEnv(t)
+
+	now := time.Now()
+	day := func(offset int) string { return now.AddDate(0, 0, offset).Format("2006-01-02") }
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	pending := func() []models.Todo {
+		var resp struct {
+			Todos []models.Todo `json:"todos"`
+		}
+		env.expect(env.do(http.MethodGet, "/api/todos", nil), http.StatusOK, &resp)
+		var open []models.Todo
+		for _, todo := range resp.Todos {
+			if todo.Status == models.StatusPending {
+				open = append(open, todo)
+			}
+		}
+		return open
+	}
+	complete := func(id string) {
+		status := models.StatusCompleted
+		env.expect(env.do(http.MethodPut, "/api/todos/"+id, models.TodoUpdateRequest{Status: &status}), http.StatusOK, nil)
+	}
+
+	bad := "FREQ=HOURLY"
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Stretch", Recurrence: &bad}), http.StatusBadRequest, nil)
+
+	due, rule, end := day(0)+"T09:30", "FREQ=DAILY", day(3)
+	var created todoResp
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{
+		Title:         "Water plants",
+		DueDate:       &due,
+		Recurrence:    &rule,
+		RecurrenceEnd: &end,
+	}), http.StatusCreated, &created)
+	first := created.Todo
+	if first.SeriesID == nil || *first.Occurrence != day(0) || *first.Recurrence != "FREQ=DAILY;UNTIL="+strings.ReplaceAll(end, "-", "") {
+		t.Fatalf("expected the todo to start a series today, got %+v", first)
+	}
+
+	// Completing an instance brings up the next one, at the same time of day
+	complete(first.ID)
+	open := pending()
+	if len(open) != 1 || *open[0].Occurrence != day(1) || !strings.HasPrefix(*open[0].DueDate, day(1)+"T09:30") {
+		t.Fatalf("expected tomorrow's instance, got %+v", open)
+	}
+	if *open[0].SeriesID != *first.SeriesID {
+		t.Fatal("expected the next instance to stay in the series")
+	}
+
+	var skipped todoResp
+	env.expect(env.do(http.MethodPost, "/api/todos/"+open[0].ID+"/skip", nil), http.StatusOK, &skipped)
+	if skipped.Todo == nil || *skipped.Todo.Occurrence != day(2) {
+		t.Fatalf("expected skipping to bring up the day after tomorrow, got %+v", skipped.Todo)
+	}
+
+	var upcoming models.UpcomingTodos
+	env.expect(env.do(http.MethodGet, "/api/todos/upcoming?days=7", nil), http.StatusOK, &upcoming)
+	var got []string
+	for _, todo := range upcoming.Todos {
+		got = append(got, fmt.Sprintf("%s projected=%v", *todo.Occurrence, todo.Projected))
+	}
+	if want := []string{day(2) + " projected=false", day(3) + " projected=true"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected upcoming %v, got %v", want, got)
+	}
+
+	// Series edits carry over to later instances; instance edits don't
+	title, instanceTitle := "Water the plants", "Water plants twice"
+	env.expect(env.do(http.MethodPut, "/api/todos/"+skipped.Todo.ID, models.TodoUpdateRequest{
+		Title: &title,
+		Scope: models.ScopeSeries,
+	}), http.StatusOK, nil)
+	env.expect(env.do(http.MethodPut, "/api/todos/"+skipped.Todo.ID, models.TodoUpdateRequest{
+		Title: &instanceTitle,
+	}), http.StatusOK, nil)
+	complete(skipped.Todo.ID)
+	open = pending()
+	if len(open) != 1 || open[0].Title != title || *open[0].Occurrence != day(3) {
+		t.Fatalf("expected the last instance with the series title, got %+v", open)
+	}
+
+	// The series ends on its end date
+	complete(open[0].ID)
+	if open = pending(); len(open) != 0 {
+		t.Fatalf("expected the series to have ended, got %+v", open)
+	}
+
+	// Deleting a whole series keeps completed instances as one-offs
+	weekly := "FREQ=WEEKLY"
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Take out bins", Recurrence: &weekly}), http.StatusCreated, &created)
+	complete(created.Todo.ID)
+	open = pending()
+	if len(open) != 1 || *open[0].Occurrence != day(7) {
+		t.Fatalf("expected next week's bins, got %+v", open)
+	}
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+open[0].ID+"?scope=series", nil), http.StatusOK, nil)
+	if open = pending(); len(open) != 0 {
+		t.Fatalf("expected no pending todos, got %+v", open)
+	}
+	var kept todoResp
+	env.expect(env.do(http.MethodGet, "/api/todos/"+created.Todo.ID, nil), http.StatusOK, &kept)
+	if kept.Todo.SeriesID != nil || kept.Todo.Recurrence != nil {
+		t.Errorf("expected the completed instance to be unlinked, got %+v", kept.Todo)
+	}
+	env.expect(env.do(http.MethodGet, "/api/todos/upcoming", nil), http.StatusOK, &upcoming)
+	if len(upcoming.Todos) != 0 {
+		t.Errorf("expected nothing upcoming, got %+v", upcoming.Todos)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	env := newTestEnv(t)
+
+	type todoResp struct {
+		Todo models.Todo `json:"todo"`
+	}
+	create := func(req models.TodoCreateRequest) models.Todo {
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", req), http.StatusCreated, &resp)
+		return resp.Todo
+	}
+	get := func(id string) models.Todo {
+		var resp todoResp
+		env.expect(env.do(http.MethodGet, "/api/todos/"+id, nil), http.StatusOK, &resp)
+		return resp.Todo
+	}
+	setStatus := func(id string, status models.Status) {
+		env.expect(env.do(http.MethodPut, "/api/todos/"+id, models.TodoUpdateRequest{Status: &status}), http.StatusOK, nil)
+	}
+
+	travel := "default-travel"
+	trip := create(models.TodoCreateRequest{Title: "Plan trip", GroupID: &travel, AutoComplete: true})
+	flights := create(models.TodoCreateRequest{Title: "Book flights", ParentID: &trip.ID})
+	hotel := create(models.TodoCreateRequest{Title: "Book hotel", ParentID: &trip.ID})
+	pack := create(models.TodoCreateRequest{Title: "Pack", ParentID: &hotel.ID})
+
+	if flights.GroupID == nil || *flights.GroupID != travel {
+		t.Errorf("expected subtasks to join their parent's group, got %v", flights.GroupID)
+	}
+	if got := get(trip.ID).Progress; got == nil || *got != (models.TodoProgress{Completed: 0, Total: 2}) {
+		t.Fatalf("expected 0/2 progress, got %+v", got)
+	}
+
+	var subtasks struct {
+		Todos []models.Todo `json:"todos"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/todos/"+trip.ID+"/subtasks", nil), http.StatusOK, &subtasks)
+	if len(subtasks.Todos) != 2 || subtasks.Todos[0].ID != flights.ID || subtasks.Todos[1].ID != hotel.ID {
+		t.Fatalf("expected flights and hotel, got %+v", subtasks.Todos)
+	}
+
+	// Subtask documents carry their parents' titles
+	waitFor(t, 5*time.Second, func() bool {
+		for _, input := range env.nim.Inputs() {
+			if strings.Contains(input, "Pack") && strings.Contains(input, "Subtask of: Plan trip > Book hotel") {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Todos can't be moved under themselves, their own subtasks or missing todos
+	for _, parentID := range []string{pack.ID, trip.ID, "missing"} {
+		id := parentID
+		env.expect(env.do(http.MethodPut, "/api/todos/"+trip.ID, models.TodoUpdateRequest{ParentID: &id}), http.StatusBadRequest, nil)
+	}
+
+	setStatus(flights.ID, models.StatusCompleted)
+	if got := get(trip.ID); got.Status != models.StatusPending || got.Progress.Completed != 1 {
+		t.Fatalf("expected the trip to stay open at 1/2, got %s %+v", got.Status, got.Progress)
+	}
+	setStatus(hotel.ID, models.StatusCompleted)
+	if got := get(trip.ID); got.Status != models.StatusCompleted || got.CompletedAt == nil {
+		t.Fatalf("expected the trip to auto-complete, got %s", got.Status)
+	}
+
+	// New or reopened subtasks reopen it
+	visa := create(models.TodoCreateRequest{Title: "Apply for visa", ParentID: &trip.ID})
+	if got := get(trip.ID).Status; got != models.StatusPending {
+		t.Fatalf("expected a new subtask to reopen the trip, got %s", got)
+	}
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+visa.ID, nil), http.StatusOK, nil)
+	if got := get(trip.ID).Status; got != models.StatusCompleted {
+		t.Fatalf("expected the trip to complete once the open subtask was deleted, got %s", got)
+	}
+	setStatus(flights.ID, models.StatusPending)
+	if got := get(trip.ID).Status; got != models.StatusPending {
+		t.Fatalf("expected a reopened subtask to reopen the trip, got %s", got)
+	}
+
+	// Open and cancelled statuses other than completed are left alone
+	setStatus(trip.ID, models.StatusInProgress)
+	rename := "Book flights to Rome"
+	env.expect(env.do(http.MethodPut, "/api/todos/"+flights.ID, models.TodoUpdateRequest{Title: &rename}), http.StatusOK, nil)
+	setStatus(hotel.ID, models.StatusPending)
+	if got := get(trip.ID).Status; got != models.StatusInProgress {
+		t.Fatalf("expected the trip to stay in progress as subtasks change, got %s", got)
+	}
+	setStatus(trip.ID, models.StatusCancelled)
+	insurance := create(models.TodoCreateRequest{Title: "Buy insurance", ParentID: &trip.ID})
+	if got := get(trip.ID).Status; got != models.StatusCancelled {
+		t.Fatalf("expected a new subtask to leave the cancelled trip alone, got %s", got)
+	}
+	for _, id := range []string{flights.ID, hotel.ID, insurance.ID} {
+		setStatus(id, models.StatusCompleted)
+	}
+	if got := get(trip.ID).Status; got != models.StatusCancelled {
+		t.Fatalf("expected finished subtasks to leave the cancelled trip alone, got %s", got)
+	}
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+insurance.ID, nil), http.StatusOK, nil)
+	setStatus(trip.ID, models.StatusInProgress)
+	setStatus(flights.ID, models.StatusPending)
+
+	// Moving a subtask to the top level
+	top := ""
+	env.expect(env.do(http.MethodPut, "/api/todos/"+flights.ID, models.TodoUpdateRequest{ParentID: &top}), http.StatusOK, nil)
+	if got := get(flights.ID).ParentID; got != nil {
+		t.Fatalf("expected flights at the top level, got parent %s", *got)
+	}
+	if got := get(trip.ID); got.Status != models.StatusCompleted || got.Progress.Total != 1 {
+		t.Fatalf("expected the trip to complete with only the hotel left, got %s %+v", got.Status, got.Progress)
+	}
+
+	// Deleting a todo deletes its subtasks
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+trip.ID, nil), http.StatusOK, nil)
+	env.expect(env.do(http.MethodGet, "/api/todos/"+pack.ID, nil), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodGet, "/api/todos/"+flights.ID, nil), http.StatusOK, nil)
+}
+
+func TestTodoDependencies(t *testing.T) {
+	env := newTestEnv(t)
+
+	type todoResp struct {
+		Todo models.Todo `json:"todo"`
+	}
+	create := func(title string) models.Todo {
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: title}), http.StatusCreated, &resp)
+		return resp.Todo
+	}
+	status := func(id string) models.Status {
+		var resp todoResp
+		env.expect(env.do(http.MethodGet, "/api/todos/"+id, nil), http.StatusOK, &resp)
+		return resp.Todo.Status
+	}
+	setStatus := func(id string, status models.Status) {
+		env.expect(env.do(http.MethodPut, "/api/todos/"+id, models.TodoUpdateRequest{Status: &status}), http.StatusOK, nil)
+	}
+	block := func(id, blockerID string, code int) models.Todo {
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos/"+id+"/blockers", models.TodoDependencyRequest{BlockerID: blockerID}), code, &resp)
+		return resp.Todo
+	}
+
+	design, build, ship := create("Design"), create("Build"), create("Ship")
+	setStatus(build.ID, models.StatusInProgress)
+
+	if got := block(build.ID, design.ID, http.StatusOK); got.Status != models.StatusBlocked || !reflect.DeepEqual(got.BlockedBy, []string{design.ID}) {
+		t.Fatalf("expected build to be blocked by design, got %s %v", got.Status, got.BlockedBy)
+	}
+	block(ship.ID, build.ID, http.StatusOK)
+
+	// Cycles, self-dependencies and missing todos are rejected
+	block(design.ID, ship.ID, http.StatusBadRequest)
+	block(design.ID, design.ID, http.StatusBadRequest)
+	block(design.ID, "missing", http.StatusBadRequest)
+
+	var list struct {
+		Todos []models.Todo `json:"todos"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/todos?status=blocked,cancelled", nil), http.StatusOK, &list)
+	if len(list.Todos) != 2 || list.Todos[0].ID != build.ID || list.Todos[1].ID != ship.ID {
+		t.Fatalf("expected build and ship to be blocked, got %+v", list.Todos)
+	}
+	env.expect(env.do(http.MethodGet, "/api/todos?status=someday", nil), http.StatusBadRequest, nil)
+
+	// Finishing a blocker puts its dependents back to where they were
+	setStatus(design.ID, models.StatusCompleted)
+	if got := status(build.ID); got != models.StatusInProgress {
+		t.Fatalf("expected build back in progress, got %s", got)
+	}
+	if got := status(ship.ID); got != models.StatusBlocked {
+		t.Fatalf("expected ship to wait on build, got %s", got)
+	}
+
+	// Todos can't be reopened while blocked
+	setStatus(ship.ID, models.StatusPending)
+	if got := status(ship.ID); got != models.StatusBlocked {
+		t.Fatalf("expected ship to stay blocked, got %s", got)
+	}
+
+	setStatus(build.ID, models.StatusCancelled)
+	if got := status(ship.ID); got != models.StatusPending {
+		t.Fatalf("expected cancelling build to unblock ship, got %s", got)
+	}
+	setStatus(build.ID, models.StatusPending)
+	if got := status(ship.ID); got != models.StatusBlocked {
+		t.Fatalf("expected reopening build to block ship again, got %s", got)
+	}
+
+	var removed todoResp
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+ship.ID+"/blockers/"+build.ID, nil), http.StatusOK, &removed)
+	if removed.Todo.Status != models.StatusPending || len(removed.Todo.BlockedBy) != 0 {
+		t.Fatalf("expected ship to be unblocked, got %s %v", removed.Todo.Status, removed.Todo.BlockedBy)
+	}
+
+	// Deleting a blocker unblocks its dependents
+	review := create("Review")
+	block(ship.ID, review.ID, http.StatusOK)
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+review.ID, nil), http.StatusOK, nil)
+	if got := status(ship.ID); got != models.StatusPending {
+		t.Fatalf("expected ship to be unblocked after deleting review, got %s", got)
+	}
+
+	// Blocked by hand stays blocked
+	setStatus(build.ID, models.StatusBlocked)
+	block(build.ID, ship.ID, http.StatusOK)
+	setStatus(ship.ID, models.StatusCompleted)
+	if got := status(build.ID); got != models.StatusBlocked {
+		t.Fatalf("expected build to stay blocked by hand, got %s", got)
+	}
+}
+
+func TestReminders(t *testing.T) {
+	env := newTestEnv(t)
+
+	var settings struct {
+		Settings models.NotificationSettings `json:"settings"`
+	}
+	webhookURL := env.webhook.URL + "/hooks/reminders"
+	env.expect(env.do(http.MethodPut, "/api/notifications/settings", models.NotificationSettingsUpdate{
+		WebhookURL: &webhookURL,
+	}), http.StatusOK, &settings)
+	if settings.Settings.WebhookSecret == nil || settings.Settings.PushPublicKey == "" || !settings.Settings.EmailEnabled {
+		t.Fatalf("expected webhook secret, push key and email on, got %+v", settings.Settings)
+	}
+	secret := *settings.Settings.WebhookSecret
+
+	browser := env.push.Subscribe()
+	var subscription models.PushSubscriptionRequest
+	subscription.Endpoint, subscription.Keys.P256dh, subscription.Keys.Auth = browser.Endpoint, browser.P256dh, browser.Auth
+	env.expect(env.do(http.MethodPost, "/api/notifications/push-subscriptions", subscription), http.StatusCreated, nil)
+	subscription.Keys.P256dh = "bm90IGEga2V5"
+	env.expect(env.do(http.MethodPost, "/api/notifications/push-subscriptions", subscription), http.StatusBadRequest, nil)
+
+	due := time.Now().UTC().Truncate(time.Minute).Add(2 * time.Hour)
+	dueDate := due.Format("2006-01-02T15:04")
+	var created struct {
+		Todo models.Todo `json:"todo"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Call the plumber", DueDate: &dueDate}), http.StatusCreated, &created)
+	todo := created.Todo
+
+	type reminderResp struct {
+		Reminder models.Reminder `json:"reminder"`
+	}
+	remind := func(todoID string, req models.ReminderCreateRequest, code int) models.Reminder {
+		var resp reminderResp
+		env.expect(env.do(http.MethodPost, "/api/todos/"+todoID+"/reminders", req), code, &resp)
+		return resp.Reminder
+	}
+	reminders := func(todoID string) []models.Reminder {
+		var resp struct {
+			Reminders []models.Reminder `json:"reminders"`
+		}
+		env.expect(env.do(http.MethodGet, "/api/todos/"+todoID+"/reminders", nil), http.StatusOK, &resp)
+		return resp.Reminders
+	}
+
+	offset := 30
+	relative := remind(todo.ID, models.ReminderCreateRequest{OffsetMinutes: &offset}, http.StatusCreated)
+	if relative.FireAt == nil || !relative.FireAt.Equal(due.Add(-30*time.Minute)) {
+		t.Fatalf("expected the reminder 30 minutes before %s, got %v", due, relative.FireAt)
+	}
+	at := due.Add(time.Hour)
+	absolute := remind(todo.ID, models.ReminderCreateRequest{RemindAt: &at}, http.StatusCreated)
+
+	past := time.Now().Add(-time.Hour)
+	remind(todo.ID, models.ReminderCreateRequest{RemindAt: &past}, http.StatusBadRequest)
+	remind(todo.ID, models.ReminderCreateRequest{RemindAt: &at, OffsetMinutes: &offset}, http.StatusBadRequest)
+	remind(todo.ID, models.ReminderCreateRequest{}, http.StatusBadRequest)
+
+	if sent := env.reminders.RunOnce(due.Add(-time.Hour)); sent != 0 {
+		t.Fatalf("expected nothing due yet, sent %d", sent)
+	}
+
+	// A failing webhook is retried without repeating the deliveries that worked
+	env.webhook.FailNext(1)
+	fired := due.Add(-29 * time.Minute)
+	if sent := env.reminders.RunOnce(fired); sent != 0 {
+		t.Fatalf("expected the reminder to wait for a retry, sent %d", sent)
+	}
+	if got := reminders(todo.ID)[0]; got.Status != models.ReminderPending || got.Attempts != 1 || got.LastError == nil {
+		t.Fatalf("expected a pending retry, got %+v", got)
+	}
+	if sent := env.reminders.RunOnce(fired.Add(10 * time.Second)); sent != 0 {
+		t.Fatalf("expected the retry to back off, sent %d", sent)
+	}
+	if sent := env.reminders.RunOnce(fired.Add(time.Minute)); sent != 1 {
+		t.Fatalf("expected the retry to send the reminder, sent %d", sent)
+	}
+	if got := reminders(todo.ID)[0]; got.ID != relative.ID || got.Status != models.ReminderSent || got.SentAt == nil {
+		t.Fatalf("expected the relative reminder to be sent, got %+v", got)
+	}
+
+	if messages := env.smtp.Messages(); len(messages) != 1 || messages[0].Header("Subject") != "Reminder: Call the plumber" {
+		t.Fatalf("expected one reminder email, got %d", len(messages))
+	}
+	pushes := env.push.Messages()
+	if len(pushes) != 1 || !strings.HasSuffix(pushes[0].Authorization, "k="+settings.Settings.PushPublicKey) {
+		t.Fatalf("expected one signed push, got %+v", pushes)
+	}
+	var pushed models.ReminderNotification
+	if err := json.Unmarshal(pushes[0].Payload, &pushed); err != nil || pushed.TodoID != todo.ID || pushed.Title != "Call the plumber" {
+		t.Fatalf("unexpected push payload %s", pushes[0].Payload)
+	}
+
+	hooks := env.webhook.Requests()
+	if len(hooks) != 1 {
+		t.Fatalf("expected one webhook request, got %d", len(hooks))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(hooks[0].Body)
+	if got, want := hooks[0].Header.Get("X-Memlane-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("expected signature %s, got %s", want, got)
+	}
+
+	// Moving the due date re-arms relative reminders; absolute ones stay put
+	dueDate = due.Add(24 * time.Hour).Format("2006-01-02T15:04")
+	env.expect(env.do(http.MethodPut, "/api/todos/"+todo.ID, models.TodoUpdateRequest{DueDate: &dueDate}), http.StatusOK, nil)
+	list := reminders(todo.ID)
+	if len(list) != 2 || list[0].ID != absolute.ID || !list[0].FireAt.Equal(at) {
+		t.Fatalf("expected the absolute reminder first and unchanged, got %+v", list)
+	}
+	if list[1].Status != models.ReminderPending || !list[1].FireAt.Equal(due.Add(24*time.Hour-30*time.Minute)) {
+		t.Fatalf("expected the relative reminder to move with the due date, got %+v", list[1])
+	}
+
+	// Subscriptions the push service dropped are deleted
+	env.push.Expire(browser.Endpoint)
+	if sent := env.reminders.RunOnce(at); sent != 1 {
+		t.Fatalf("expected the absolute reminder to be sent, sent %d", sent)
+	}
+	var subs struct {
+		Subscriptions []models.PushSubscription `json:"subscriptions"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/notifications/push-subscriptions", nil), http.StatusOK, &subs)
+	if len(subs.Subscriptions) != 0 {
+		t.Fatalf("expected the expired subscription to be deleted, got %+v", subs.Subscriptions)
+	}
+
+	// A reminder claimed by a run that died is taken over, without resending
+	// what that run delivered
+	if _, err := env.db.Exec(`UPDATE todo_reminders SET status = 'sending', claimed_at = ? WHERE id = ?`, at.Add(time.Hour).UTC(), relative.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.db.Exec(`INSERT INTO reminder_deliveries (reminder_id, channel, target) VALUES (?, 'email', 'tester@example.com')`, relative.ID); err != nil {
+		t.Fatal(err)
+	}
+	emails, hookCount := len(env.smtp.Messages()), len(env.webhook.Requests())
+	if sent := env.reminders.RunOnce(at.Add(time.Hour + time.Minute)); sent != 0 {
+		t.Fatalf("expected a fresh claim to be left alone, sent %d", sent)
+	}
+	if sent := env.reminders.RunOnce(at.Add(2 * time.Hour)); sent != 1 {
+		t.Fatalf("expected the stale claim to be taken over, sent %d", sent)
+	}
+	if len(env.smtp.Messages()) != emails || len(env.webhook.Requests()) != hookCount+1 {
+		t.Fatalf("expected only the webhook to be resent")
+	}
+
+	// Reminders for finished todos are skipped
+	later := due.Add(3 * time.Hour)
+	skipped := remind(todo.ID, models.ReminderCreateRequest{RemindAt: &later}, http.StatusCreated)
+	completed := models.StatusCompleted
+	env.expect(env.do(http.MethodPut, "/api/todos/"+todo.ID, models.TodoUpdateRequest{Status: &completed}), http.StatusOK, nil)
+	if sent := env.reminders.RunOnce(later); sent != 0 {
+		t.Fatalf("expected no reminder for a completed todo, sent %d", sent)
+	}
+	for _, reminder := range reminders(todo.ID) {
+		if reminder.ID == skipped.ID && reminder.Status != models.ReminderSkipped {
+			t.Fatalf("expected the reminder to be skipped, got %s", reminder.Status)
+		}
+	}
+
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+todo.ID+"/reminders/"+skipped.ID, nil), http.StatusOK, nil)
+	env.expect(env.do(http.MethodDelete, "/api/todos/"+todo.ID+"/reminders/"+skipped.ID, nil), http.StatusNotFound, nil)
+
+	// The next instance of a recurring todo keeps the relative reminders
+	daily := "FREQ=DAILY"
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Water plants", DueDate: &dueDate, Recurrence: &daily}), http.StatusCreated, &created)
+	remind(created.Todo.ID, models.ReminderCreateRequest{OffsetMinutes: &offset}, http.StatusCreated)
+	remind(created.Todo.ID, models.ReminderCreateRequest{RemindAt: &later}, http.StatusCreated)
+	var next struct {
+		Todo models.Todo `json:"todo"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/todos/"+created.Todo.ID+"/skip", nil), http.StatusOK, &next)
+	carried := reminders(next.Todo.ID)
+	if len(carried) != 1 || carried[0].OffsetMinutes == nil || *carried[0].OffsetMinutes != offset ||
+		!carried[0].FireAt.Equal(due.Add(48*time.Hour-30*time.Minute)) {
+		t.Fatalf("expected the relative reminder on the next day's instance, got %+v", carried)
+	}
+}
+
+func TestTodoParsing(t *testing.T) {
+	env := newTestEnv(t)
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	tomorrow := time.Now().In(tokyo).AddDate(0, 0, 1)
+	at := func(hour int) string {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), hour, 0, 0, 0, tokyo).Format(time.RFC3339)
+	}
+
+	var group struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Errands"}), http.StatusCreated, &group)
+
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	create := func(req models.TodoCreateRequest) *models.Todo {
+		t.Helper()
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", req), http.StatusCreated, &resp)
+		return resp.Todo
+	}
+	zone := "Asia/Tokyo"
+
+	todo := create(models.TodoCreateRequest{Title: "Call mom tomorrow 5pm high priority #errands", Parse: true, Timezone: &zone})
+	parsed := todo.Parsed
+	if todo.Title != "Call mom" || todo.DueDate == nil || *todo.DueDate != at(17) || todo.Priority != models.PriorityHigh ||
+		todo.GroupID == nil || *todo.GroupID != group.Group.ID {
+		t.Fatalf("expected the title to be parsed, got %+v", todo)
+	}
+	if parsed == nil || parsed.Source != "rules" || parsed.Timezone != zone || parsed.DueDate == nil || parsed.Priority == nil ||
+		parsed.GroupID == nil || parsed.Recurrence != nil {
+		t.Fatalf("expected what was inferred, got %+v", parsed)
+	}
+
+	// Fields set explicitly win over the title
+	todo = create(models.TodoCreateRequest{Title: "File taxes urgent every year", Priority: models.PriorityLow, Parse: true})
+	if todo.Priority != models.PriorityLow || todo.Parsed.Priority != nil || todo.Recurrence == nil || *todo.Recurrence != "FREQ=YEARLY" ||
+		todo.SeriesID == nil || todo.Parsed.Timezone != "UTC" {
+		t.Fatalf("expected the explicit priority and a yearly series, got %+v", todo)
+	}
+
+	// Without parse the title is kept as written
+	todo = create(models.TodoCreateRequest{Title: "Call mom tomorrow 5pm"})
+	if todo.Title != "Call mom tomorrow 5pm" || todo.DueDate != nil || todo.Parsed != nil {
+		t.Fatalf("expected no parsing, got %+v", todo)
+	}
+
+	bad := "Mars/Olympus_Mons"
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Launch", Parse: true, Timezone: &bad}), http.StatusBadRequest, nil)
+
+	// Text the rules can't read goes to the model, whose answer is checked
+	script := &services.MockScript{Rules: []services.MockRule{{
+		Match: "dentist sometime after lunch",
+		Response: fmt.Sprintf(`{"title": "Dentist appointment", "tags": ["health"], "due_date": %q, "due_time": "14:00",
+			"priority": "", "group": "errands", "recurrence": "FREQ=HOURLY"}`, tomorrow.Format("2006-01-02")),
+	}}}
+	services.RegisterMockScript("todo-parsing", script)
+	env.useProvider(models.ProviderTypeMock, "mock://todo-parsing", "", "mock-model")
+
+	todo = create(models.TodoCreateRequest{Title: "dentist sometime after lunch", Parse: true, Timezone: &zone})
+	parsed = todo.Parsed
+	if todo.Title != "Dentist appointment" || todo.DueDate == nil || *todo.DueDate != at(14) || todo.Priority != models.PriorityMedium ||
+		todo.GroupID == nil || *todo.GroupID != group.Group.ID || todo.SeriesID != nil || !reflect.DeepEqual(todo.Tags, []string{"health"}) {
+		t.Fatalf("expected the model's parse, got %+v", todo)
+	}
+	if parsed == nil || parsed.Source != "ai" || parsed.Priority != nil || parsed.Recurrence != nil {
+		t.Fatalf("expected the invalid rule to be dropped, got %+v", parsed)
+	}
+	// The model's parse doubles as the title cleanup
+	if calls := script.Calls(); len(calls) != 1 {
+		t.Fatalf("expected one call to the model, got %d", len(calls))
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	env := newTestEnv(t)
+
+	type feedResp struct {
+		Feed *models.CalendarFeed `json:"feed"`
+	}
+	var feed feedResp
+	env.expect(env.do(http.MethodGet, "/api/calendar/feed", nil), http.StatusOK, &feed)
+	if feed.Feed != nil {
+		t.Fatalf("expected no feed yet, got %+v", feed.Feed)
+	}
+	env.expect(env.do(http.MethodPost, "/api/calendar/feed", nil), http.StatusCreated, &feed)
+	if feed.Feed == nil || !strings.HasPrefix(feed.Feed.URL, "http://memlane.test/api/calendar/ics/") {
+		t.Fatalf("expected a feed URL, got %+v", feed.Feed)
+	}
+	fetch := func(url string) *httptest.ResponseRecorder {
+		return env.serve(httptest.NewRequest(http.MethodGet, strings.TrimPrefix(url, "http://memlane.test"), nil))
+	}
+
+	var group struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Garden", ColorCode: "#22c55e"}), http.StatusCreated, &group)
+	due, timed, rule := "2026-10-20", "2026-10-21T09:30:00Z", "FREQ=WEEKLY"
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{
+		Title:      "Mow the lawn",
+		DueDate:    &due,
+		Recurrence: &rule,
+		GroupID:    &group.Group.ID,
+	}), http.StatusCreated, nil)
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Dentist; bring forms", DueDate: &timed, Priority: models.PriorityHigh}), http.StatusCreated, nil)
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Someday"}), http.StatusCreated, nil)
+
+	w := fetch(feed.Feed.URL)
+	env.expect(w, http.StatusOK, nil)
+	body := w.Body.String()
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	for _, want := range []string{
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261020",
+		"RRULE:FREQ=WEEKLY",
+		`SUMMARY:Dentist\; bring forms`,
+		"DTSTART:20261021T093000Z",
+		"PRIORITY:1",
+	} {
+		if !strings.Contains(body, want+"\r\n") {
+			t.Errorf("expected the feed to contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Someday") || strings.Contains(body, "VTODO") {
+		t.Errorf("expected only dated todos as events:\n%s", body)
+	}
+
+	w = fetch(feed.Feed.TodosURL + "&group_id=" + group.Group.ID)
+	env.expect(w, http.StatusOK, nil)
+	body = w.Body.String()
+	if !strings.Contains(body, "BEGIN:VTODO") || !strings.Contains(body, "X-WR-CALNAME:Memlane – Garden") || strings.Contains(body, "Dentist") {
+		t.Errorf("expected the garden todos as VTODOs:\n%s", body)
+	}
+	env.expect(fetch(feed.Feed.URL+"?group_id=nope"), http.StatusNotFound, nil)
+
+	// Rotating the token retires the old URL
+	old := feed.Feed.URL
+	env.expect(env.do(http.MethodPost, "/api/calendar/feed", nil), http.StatusCreated, &feed)
+	env.expect(fetch(old), http.StatusNotFound, nil)
+	env.expect(fetch(feed.Feed.URL), http.StatusOK, nil)
+	env.expect(env.do(http.MethodDelete, "/api/calendar/feed", nil), http.StatusOK, nil)
+	env.expect(fetch(feed.Feed.URL), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodDelete, "/api/calendar/feed", nil), http.StatusNotFound, nil)
+
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Example//Tasks//EN",
+		"BEGIN:VTODO",
+		"UID:weed@example.com",
+		"SUMMARY:Weed the beds",
+		"DUE;VALUE=DATE:20261025",
+		"PRIORITY:7",
+		"CATEGORIES:garden,Outdoors",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:seeds@example.com",
+		"SUMMARY:Order seeds",
+		"STATUS:COMPLETED",
+		"RRULE:FREQ=YEARLY",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:empty@example.com",
+		"END:VTODO",
+		"END:VCALENDAR",
+	}, "\r\n") + "\r\n"
+
+	var imported models.CalendarImportResult
+	env.expect(env.upload("/api/todos/import", "file", "tasks.ics", ics), http.StatusCreated, &imported)
+	if len(imported.Todos) != 2 || len(imported.Skipped) != 1 || imported.Skipped[0].UID != "empty@example.com" {
+		t.Fatalf("expected two todos and one skipped entry, got %+v", imported)
+	}
+	weed, seeds := imported.Todos[0], imported.Todos[1]
+	if weed.GroupID == nil || *weed.GroupID != group.Group.ID || weed.Priority != models.PriorityLow ||
+		*weed.DueDate != "2026-10-25" || !reflect.DeepEqual(weed.Tags, []string{"outdoors"}) {
+		t.Errorf("unexpected imported todo %+v", weed)
+	}
+	if seeds.Status != models.StatusCompleted || seeds.Recurrence != nil {
+		t.Errorf("expected a completed one-off, got %+v", seeds)
+	}
+
+	// Importing the same file again creates nothing
+	req := httptest.NewRequest(http.MethodPost, "/api/todos/import", strings.NewReader(ics))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Content-Type", "text/calendar")
+	env.expect(env.serve(req), http.StatusCreated, &imported)
+	if len(imported.Todos) != 0 || len(imported.Skipped) != 3 || imported.Skipped[0].Reason != "already imported" {
+		t.Errorf("expected every entry to be skipped, got %+v", imported)
+	}
+
+	env.expect(env.upload("/api/todos/import", "file", "notes.txt", "not a calendar"), http.StatusBadRequest, nil)
+}
+
+func TestCalDAV(t *testing.T) {
+	env := newTestEnv(t)
+
+	var creds struct {
+		Credentials *models.DAVCredentials `json:"credentials"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/caldav/credentials", nil), http.StatusCreated, &creds)
+	if creds.Credentials.Username != "tester@example.com" || creds.Credentials.Password == "" || creds.Credentials.URL != "http://memlane.test/caldav/" {
+		t.Fatalf("unexpected credentials %+v", creds.Credentials)
+	}
+	password := creds.Credentials.Password
+	dav := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("tester@example.com", password)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		return env.serve(req)
+	}
+	expectDAV := func(w *httptest.ResponseRecorder, status int, contains ...string) string {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("expected status %d, got %d: %s", status, w.Code, w.Body.String())
+		}
+		for _, want := range contains {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Fatalf("expected the response to contain %q: %s", want, w.Body.String())
+			}
+		}
+		return w.Body.String()
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/caldav/", nil)
+	if w := env.serve(req); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected a Basic auth challenge, got %d", w.Code)
+	}
+	if w := dav(http.MethodOptions, "/caldav/", ""); !strings.Contains(w.Header().Get("DAV"), "calendar-access") {
+		t.Fatalf("expected CalDAV support to be advertised, got %q", w.Header().Get("DAV"))
+	}
+
+	// Discovery: principal, calendar home, then a collection per group
+	body := expectDAV(dav("PROPFIND", "/caldav/", `<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`, "Depth", "0"),
+		http.StatusMultiStatus, "/caldav/principals/")
+	principal := body[strings.Index(body, "/caldav/principals/"):]
+	principal = principal[:strings.Index(principal, "<")]
+	expectDAV(dav("PROPFIND", principal, `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/></d:prop></d:propfind>`, "Depth", "0"),
+		http.StatusMultiStatus, "<c:calendar-home-set><d:href>/caldav/calendars/")
+	home := strings.Replace(principal, "/principals/", "/calendars/", 1)
+
+	var group struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Garden", ColorCode: "#22c55e"}), http.StatusCreated, &group)
+	garden := home + group.Group.ID + "/"
+	expectDAV(dav("PROPFIND", home, "", "Depth", "1"), http.StatusMultiStatus,
+		"<d:displayname>Garden</d:displayname>", "<d:displayname>Inbox</d:displayname>", `<c:comp name="VTODO"/>`, "<a:calendar-color>#22c55e</a:calendar-color>")
+
+	due := "2026-10-20"
+	var created struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Mow the lawn", DueDate: &due, GroupID: &group.Group.ID}), http.StatusCreated, &created)
+	mow := created.Todo.ID + "@memlane.ics"
+
+	syncReport := func(token string) string {
+		return `<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:sync-token>` + token +
+			`</d:sync-token><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+	}
+	tokenOf := func(body string) string {
+		token := body[strings.LastIndex(body, "<d:sync-token>")+len("<d:sync-token>"):]
+		return token[:strings.Index(token, "<")]
+	}
+	body = expectDAV(dav("REPORT", garden, syncReport("")), http.StatusMultiStatus, garden+mow, "<d:getetag>")
+	token := tokenOf(body)
+
+	// Todos created in a client land in the collection's group
+	weed := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Example//Tasks//EN
+BEGIN:VTODO
+UID:weed-1
+SUMMARY:Weed the beds
+DUE;VALUE=DATE:20261025
+PRIORITY:1
+CATEGORIES:Garden,Outdoors
+END:VTODO
+END:VCALENDAR
+`
+	w := dav(http.MethodPut, garden+"weed-1.ics", weed, "If-None-Match", "*")
+	expectDAV(w, http.StatusCreated)
+	etag := w.Header().Get("ETag")
+	expectDAV(dav(http.MethodPut, garden+"weed-1.ics", weed, "If-None-Match", "*"), http.StatusPreconditionFailed)
+	expectDAV(dav(http.MethodPut, garden+"other.ics", weed), http.StatusForbidden, "valid-calendar-object-resource")
+	expectDAV(dav(http.MethodPut, home+"inbox/weed-1.ics", weed), http.StatusForbidden, "no-uid-conflict")
+
+	var list struct {
+		Todos []models.Todo `json:"todos"`
+	}
+	find := func(title string) *models.Todo {
+		env.expect(env.do(http.MethodGet, "/api/todos", nil), http.StatusOK, &list)
+		for i := range list.Todos {
+			if list.Todos[i].Title == title {
+				return &list.Todos[i]
+			}
+		}
+		return nil
+	}
+	got := find("Weed the beds")
+	if got == nil || got.GroupID == nil || *got.GroupID != group.Group.ID || got.Priority != models.PriorityHigh || !reflect.DeepEqual(got.Tags, []string{"outdoors"}) {
+		t.Fatalf("unexpected todo from the client %+v", got)
+	}
+
+	w = dav(http.MethodGet, garden+"weed-1.ics", "")
+	expectDAV(w, http.StatusOK, "UID:weed-1", "DUE;VALUE=DATE:20261025")
+	if w.Header().Get("ETag") != etag {
+		t.Errorf("expected GET to return the ETag from PUT, got %q and %q", w.Header().Get("ETag"), etag)
+	}
+
+	// Edits need the current ETag, and are reindexed
+	edited := strings.Replace(strings.Replace(weed, "SUMMARY:Weed the beds", "SUMMARY:Weed the vegetable beds", 1), "END:VTODO", "STATUS:COMPLETED\nEND:VTODO", 1)
+	expectDAV(dav(http.MethodPut, garden+"weed-1.ics", edited, "If-Match", `"stale"`), http.StatusPreconditionFailed)
+	w = dav(http.MethodPut, garden+"weed-1.ics", edited, "If-Match", etag)
+	expectDAV(w, http.StatusNoContent)
+	if w.Header().Get("ETag") == etag {
+		t.Error("expected the ETag to change")
+	}
+	if got = find("Weed the vegetable beds"); got == nil || got.Status != models.StatusCompleted {
+		t.Fatalf("expected the edit to be saved, got %+v", got)
+	}
+	waitFor(t, 5*time.Second, func() bool {
+		for _, input := range env.nim.Inputs() {
+			if strings.Contains(input, "Weed the vegetable beds") {
+				return true
+			}
+		}
+		return false
+	})
+
+	// Syncing reports what changed since the token, including todos moved away
+	var errands struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Errands"}), http.StatusCreated, &errands)
+	env.expect(env.do(http.MethodPut, "/api/todos/"+created.Todo.ID, models.TodoUpdateRequest{GroupID: &errands.Group.ID}), http.StatusOK, nil)
+	body = expectDAV(dav("REPORT", garden, syncReport(token)), http.StatusMultiStatus,
+		garden+"weed-1.ics</d:href><d:propstat>", "<d:href>"+garden+mow+"</d:href><d:status>HTTP/1.1 404 Not Found</d:status>")
+	expectDAV(dav(http.MethodGet, home+errands.Group.ID+"/"+mow, ""), http.StatusOK, "SUMMARY:Mow the lawn")
+	token = tokenOf(body)
+	body = expectDAV(dav("REPORT", garden, syncReport(token)), http.StatusMultiStatus)
+	if strings.Contains(body, "<d:response>") {
+		t.Errorf("expected no changes, got %s", body)
+	}
+
+	expectDAV(dav(http.MethodDelete, garden+"weed-1.ics", "", "If-Match", etag), http.StatusPreconditionFailed)
+	expectDAV(dav(http.MethodDelete, garden+"weed-1.ics", ""), http.StatusNoContent)
+	if find("Weed the vegetable beds") != nil {
+		t.Fatal("expected the todo to be deleted")
+	}
+	expectDAV(dav("REPORT", garden, syncReport(token)), http.StatusMultiStatus,
+		"<d:href>"+garden+"weed-1.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>")
+	expectDAV(dav("REPORT", garden, syncReport("urn:memlane:sync:999999")), http.StatusForbidden, "valid-sync-token")
+
+	errandsURL := home + errands.Group.ID + "/"
+	expectDAV(dav("REPORT", errandsURL, `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-data/></d:prop><d:href>`+errandsURL+mow+`</d:href><d:href>`+errandsURL+`gone.ics</d:href></c:calendar-multiget>`),
+		http.StatusMultiStatus, "SUMMARY:Mow the lawn", "HTTP/1.1 404 Not Found")
+
+	// Other users' calendars and old passwords are out of reach
+	expectDAV(dav("PROPFIND", "/caldav/calendars/someone-else/", "", "Depth", "1"), http.StatusNotFound)
+	env.expect(env.do(http.MethodDelete, "/api/caldav/credentials", nil), http.StatusOK, nil)
+	expectDAV(dav("PROPFIND", "/caldav/", ""), http.StatusUnauthorized)
+}
+
+func TestTodoListing(t *testing.T) {
+	env := newTestEnv(t)
+
+	var group struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Work"}), http.StatusCreated, &group)
+
+	now := time.Now().UTC()
+	day := func(days int) *string {
+		date := now.AddDate(0, 0, days).Format("2006-01-02")
+		return &date
+	}
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	create := func(req models.TodoCreateRequest, update models.TodoUpdateRequest) {
+		t.Helper()
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", req), http.StatusCreated, &resp)
+		env.expect(env.do(http.MethodPut, "/api/todos/"+resp.Todo.ID, update), http.StatusOK, nil)
+	}
+	description := "quarterly numbers, 100% done"
+	completed := models.StatusCompleted
+	later := now.AddDate(0, 0, 2).Format(time.RFC3339)
+	create(models.TodoCreateRequest{Title: "Write report", Description: &description, DueDate: day(-1), Priority: models.PriorityHigh, GroupID: &group.Group.ID},
+		models.TodoUpdateRequest{Tags: []string{"work", "urgent"}})
+	create(models.TodoCreateRequest{Title: "Buy milk", DueDate: day(1), Priority: models.PriorityLow},
+		models.TodoUpdateRequest{Tags: []string{"home"}})
+	create(models.TodoCreateRequest{Title: "Plan trip", Priority: models.PriorityMedium}, models.TodoUpdateRequest{})
+	create(models.TodoCreateRequest{Title: "Pay rent", DueDate: day(-2), Priority: models.PriorityMedium},
+		models.TodoUpdateRequest{Status: &completed})
+	create(models.TodoCreateRequest{Title: "fix bug_123", DueDate: &later, Priority: models.PriorityHigh, GroupID: &group.Group.ID},
+		models.TodoUpdateRequest{})
+	// Created first, but written in a zone whose wall clock reads later than
+	// the others'
+	earlier := now.Add(-time.Hour).In(time.FixedZone("IST", 5*3600+1800))
+	if _, err := env.db.Exec("UPDATE todos SET created_at = ? WHERE title = ?", earlier, "Plan trip"); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) ([]string, *string) {
+		t.Helper()
+		var page models.TodoPage
+		env.expect(env.do(http.MethodGet, "/api/todos?"+query, nil), http.StatusOK, &page)
+		titles := []string{}
+		for _, todo := range page.Todos {
+			titles = append(titles, todo.Title)
+		}
+		return titles, page.NextCursor
+	}
+	for query, want := range map[string][]string{
+		"":                             {"Write report", "Buy milk", "Plan trip", "Pay rent", "fix bug_123"},
+		"status=completed":             {"Pay rent"},
+		"priority=high,low&sort=title": {"Buy milk", "fix bug_123", "Write report"},
+		"group_id=none&sort=title":     {"Buy milk", "Pay rent", "Plan trip"},
+		"group_id=none,xyz&status=pending&sort=title": {"Buy milk", "Plan trip"},
+		"tags=WORK,urgent": {"Write report"},
+		"tags=work,home":   {},
+		"due_from=" + *day(0) + "&due_to=" + *day(7) + "&sort=due_date": {"Buy milk", "fix bug_123"},
+		"overdue=true&timezone=UTC":                                     {"Write report"},
+		"q=100%25":                                                      {"Write report"},
+		"q=g_1":                                                         {"fix bug_123"},
+		"q=g%251":                                                       {},
+		"sort=due_date":                                                 {"Pay rent", "Write report", "Buy milk", "fix bug_123", "Plan trip"},
+		"sort=-due_date":                                                {"fix bug_123", "Buy milk", "Write report", "Pay rent", "Plan trip"},
+		"sort=-created_at":                                              {"fix bug_123", "Pay rent", "Buy milk", "Write report", "Plan trip"},
+		"sort=-title":                                                   {"Write report", "Plan trip", "Pay rent", "fix bug_123", "Buy milk"},
+	} {
+		if got, next := list(query); !reflect.DeepEqual(got, want) || next != nil {
+			t.Errorf("GET /api/todos?%s: expected %v, got %v (next %v)", query, want, got, next)
+		}
+	}
+
+	// Pages continue from their cursor, in the same order
+	var titles []string
+	query := "sort=priority&limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("expected paging to end")
+		}
+		page, next := list(query)
+		titles = append(titles, page...)
+		if next == nil {
+			break
+		}
+		query = "sort=priority&limit=2&cursor=" + *next
+	}
+	if len(titles) != 5 || titles[4] != "Buy milk" || titles[2] == "Buy milk" || titles[0] == "Buy milk" {
+		t.Fatalf("expected every todo once by priority, got %v", titles)
+	}
+	_, next := list("sort=title&limit=2")
+	if next == nil {
+		t.Fatal("expected a next page")
+	}
+	if page, _ := list("sort=title&limit=2&cursor=" + *next); !reflect.DeepEqual(page, []string{"Pay rent", "Plan trip"}) {
+		t.Fatalf("expected the second page by title, got %v", page)
+	}
+
+	for _, query := range []string{
+		"sort=color", "limit=0", "status=done", "priority=urgent", "due_from=tomorrow",
+		"cursor=nonsense", "sort=-title&cursor=" + *next, "overdue=true&timezone=Mars/Olympus_Mons",
+	} {
+		env.expect(env.do(http.MethodGet, "/api/todos?"+query, nil), http.StatusBadRequest, nil)
+	}
+}
+
+func TestTimeTracking(t *testing.T) {
+	env := newTestEnv(t)
+
+	var group struct {
+		Group *models.Group `json:"group"`
+	}
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Work"}), http.StatusCreated, &group)
+
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	estimate := 120
+	var report, errand todoResp
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Write report", GroupID: &group.Group.ID, EstimateMinutes: &estimate}), http.StatusCreated, &report)
+	env.expect(env.do(http.MethodPut, "/api/todos/"+report.Todo.ID, models.TodoUpdateRequest{Tags: []string{"writing", "work"}}), http.StatusOK, nil)
+	env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: "Buy milk"}), http.StatusCreated, &errand)
+	if report.Todo.EstimateMinutes == nil || *report.Todo.EstimateMinutes != 120 || errand.Todo.EstimateMinutes != nil {
+		t.Fatalf("expected the estimate to be kept, got %v and %v", report.Todo.EstimateMinutes, errand.Todo.EstimateMinutes)
+	}
+
+	type entryResp struct {
+		TimeEntry *models.TimeEntry `json:"time_entry"`
+	}
+	reportURL := "/api/todos/" + report.Todo.ID
+	errandURL := "/api/todos/" + errand.Todo.ID
+
+	// One timer runs at a time
+	var started, conflict, running entryResp
+	env.expect(env.do(http.MethodPost, reportURL+"/timer/start", nil), http.StatusCreated, &started)
+	env.expect(env.do(http.MethodPost, errandURL+"/timer/start", models.TimerStartRequest{}), http.StatusConflict, &conflict)
+	if conflict.TimeEntry == nil || conflict.TimeEntry.ID != started.TimeEntry.ID {
+		t.Fatalf("expected the running timer in the conflict, got %+v", conflict.TimeEntry)
+	}
+	env.expect(env.do(http.MethodGet, "/api/time/timer", nil), http.StatusOK, &running)
+	if running.TimeEntry == nil || running.TimeEntry.TodoID != report.Todo.ID || running.TimeEntry.EndedAt != nil {
+		t.Fatalf("expected the report's timer to be running, got %+v", running.TimeEntry)
+	}
+	env.expect(env.do(http.MethodPost, errandURL+"/timer/stop", nil), http.StatusNotFound, nil)
+
+	var stopped entryResp
+	env.expect(env.do(http.MethodPost, reportURL+"/timer/stop", nil), http.StatusOK, &stopped)
+	if stopped.TimeEntry == nil || stopped.TimeEntry.ID != started.TimeEntry.ID || stopped.TimeEntry.EndedAt == nil {
+		t.Fatalf("expected the timer to be stopped, got %+v", stopped.TimeEntry)
+	}
+	env.expect(env.do(http.MethodGet, "/api/time/timer", nil), http.StatusOK, &running)
+	if running.TimeEntry != nil {
+		t.Fatalf("expected no timer running, got %+v", running.TimeEntry)
+	}
+	env.expect(env.do(http.MethodPost, errandURL+"/timer/start", nil), http.StatusCreated, nil)
+	env.expect(env.do(http.MethodPost, errandURL+"/timer/stop", nil), http.StatusOK, nil)
+
+	// Time entered by hand, one of them crossing into the day reported on
+	day := time.Now().UTC().AddDate(0, 0, -2).Truncate(24 * time.Hour)
+	var manual entryResp
+	env.expect(env.do(http.MethodPost, reportURL+"/time-entries", models.TimeEntryCreateRequest{
+		StartedAt: day.Add(9 * time.Hour), EndedAt: day.Add(10 * time.Hour),
+	}), http.StatusCreated, &manual)
+	if manual.TimeEntry.Seconds != 3600 {
+		t.Fatalf("expected an hour, got %+v", manual.TimeEntry)
+	}
+	env.expect(env.do(http.MethodPost, errandURL+"/time-entries", models.TimeEntryCreateRequest{
+		StartedAt: day.Add(-30 * time.Minute), EndedAt: day.Add(30 * time.Minute),
+	}), http.StatusCreated, nil)
+	for _, req := range []models.TimeEntryCreateRequest{
+		{StartedAt: day.Add(time.Hour), EndedAt: day},
+		{StartedAt: time.Now(), EndedAt: time.Now().Add(time.Hour)},
+	} {
+		env.expect(env.do(http.MethodPost, reportURL+"/time-entries", req), http.StatusBadRequest, nil)
+	}
+
+	var total models.TodoTime
+	env.expect(env.do(http.MethodGet, reportURL+"/time", nil), http.StatusOK, &total)
+	if len(total.Entries) != 2 || total.TrackedSeconds < 3600 || total.TrackedSeconds > 3700 ||
+		total.EstimateMinutes == nil || *total.EstimateMinutes != 120 {
+		t.Fatalf("expected the tracked time against the estimate, got %+v", total)
+	}
+
+	date := day.Format("2006-01-02")
+	var byGroup models.TimeReport
+	env.expect(env.do(http.MethodGet, "/api/time/report?timezone=UTC&from="+date+"&to="+date, nil), http.StatusOK, &byGroup)
+	if byGroup.TotalSeconds != 5400 || len(byGroup.Rows) != 2 || len(byGroup.Todos) != 2 {
+		t.Fatalf("expected an hour and a half on two todos, got %+v", byGroup)
+	}
+	if row := byGroup.Rows[0]; row.ID == nil || *row.ID != group.Group.ID || row.Name != "Work" || row.Seconds != 3600 || row.EstimateMinutes != 120 {
+		t.Fatalf("expected the hour in Work first, got %+v", row)
+	}
+	if row := byGroup.Rows[1]; row.ID != nil || row.Seconds != 1800 {
+		t.Fatalf("expected the half hour inside the range without a group, got %+v", row)
+	}
+
+	var byTag models.TimeReport
+	env.expect(env.do(http.MethodGet, "/api/time/report?timezone=UTC&group_by=tag&from="+date+"&to="+date, nil), http.StatusOK, &byTag)
+	var tags []string
+	for _, row := range byTag.Rows {
+		tags = append(tags, fmt.Sprintf("%s=%d", row.Name, row.Seconds))
+	}
+	if !reflect.DeepEqual(tags, []string{"writing=3600", "work=3600", "=1800"}) || byTag.TotalSeconds != 5400 {
+		t.Fatalf("expected the time under each tag, got %v", tags)
+	}
+
+	for _, query := range []string{"group_by=color", "from=yesterday", "from=2026-02-01&to=2026-01-01", "from=2020-01-01&to=2026-01-01", "timezone=Mars/Olympus_Mons"} {
+		env.expect(env.do(http.MethodGet, "/api/time/report?"+query, nil), http.StatusBadRequest, nil)
+	}
+
+	env.expect(env.do(http.MethodDelete, errandURL+"/time-entries/"+manual.TimeEntry.ID, nil), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodDelete, reportURL+"/time-entries/"+manual.TimeEntry.ID, nil), http.StatusOK, nil)
+	env.expect(env.do(http.MethodGet, reportURL+"/time", nil), http.StatusOK, &total)
+	if len(total.Entries) != 1 {
+		t.Fatalf("expected the entry to be deleted, got %+v", total.Entries)
+	}
+
+	// An estimate of 0 removes it
+	var updated todoResp
+	zero := 0
+	env.expect(env.do(http.MethodPut, reportURL, models.TodoUpdateRequest{EstimateMinutes: &zero}), http.StatusOK, &updated)
+	if updated.Todo.EstimateMinutes != nil {
+		t.Fatalf("expected the estimate to be removed, got %v", *updated.Todo.EstimateMinutes)
+	}
+}
+
+func TestBoard(t *testing.T) {
+	env := newTestEnv(t)
+
+	type groupResp struct {
+		Group *models.Group `json:"group"`
+	}
+	var work, home groupResp
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Work"}), http.StatusCreated, &work)
+	env.expect(env.do(http.MethodPost, "/api/groups", models.GroupCreateRequest{Name: "Home"}), http.StatusCreated, &home)
+	boardURL := "/api/groups/" + work.Group.ID + "/board"
+
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	ids := make(map[string]string)
+	titles := make(map[string]string)
+	create := func(title string, groupID *string) {
+		t.Helper()
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: title, GroupID: groupID}), http.StatusCreated, &resp)
+		ids[title] = resp.Todo.ID
+		titles[resp.Todo.ID] = title
+	}
+	for _, title := range []string{"Draft", "Review", "Ship", "Archive"} {
+		create(title, &work.Group.ID)
+	}
+	create("Laundry", nil)
+	completed := models.StatusCompleted
+	env.expect(env.do(http.MethodPut, "/api/todos/"+ids["Archive"], models.TodoUpdateRequest{Status: &completed}), http.StatusOK, nil)
+
+	var board struct {
+		Board *models.Board `json:"board"`
+	}
+	layout := func() map[string][]string {
+		t.Helper()
+		env.expect(env.do(http.MethodGet, boardURL, nil), http.StatusOK, &board)
+		lanes := make(map[string][]string)
+		for _, column := range board.Board.Columns {
+			lanes[column.Name] = []string{}
+			for _, todo := range column.Todos {
+				lanes[column.Name] = append(lanes[column.Name], titles[todo.ID])
+			}
+		}
+		return lanes
+	}
+	column := func(name string) string {
+		for _, column := range board.Board.Columns {
+			if column.Name == name {
+				return column.ID
+			}
+		}
+		t.Fatalf("no column %q", name)
+		return ""
+	}
+	move := func(title, column string, index int, status int) *models.Todo {
+		t.Helper()
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos/"+ids[title]+"/move", models.TodoMoveRequest{ColumnID: column, Index: index}), status, &resp)
+		return resp.Todo
+	}
+
+	// Boards start with a column per status
+	want := map[string][]string{"To Do": {"Draft", "Review", "Ship"}, "In Progress": {}, "Blocked": {}, "Done": {"Archive"}}
+	if got := layout(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the default columns, got %v", got)
+	}
+
+	// Moving to a column sets its status and the order within it
+	if todo := move("Ship", column("In Progress"), 0, http.StatusOK); todo.Status != models.StatusInProgress {
+		t.Fatalf("expected the todo to be in progress, got %s", todo.Status)
+	}
+	move("Review", column("To Do"), 0, http.StatusOK)
+	want = map[string][]string{"To Do": {"Review", "Draft"}, "In Progress": {"Ship"}, "Blocked": {}, "Done": {"Archive"}}
+	if got := layout(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the moves, got %v", got)
+	}
+
+	// Custom lanes leave the status alone
+	var lane struct {
+		Column *models.BoardColumn `json:"column"`
+	}
+	env.expect(env.do(http.MethodPost, boardURL+"/columns", models.BoardColumnCreateRequest{Name: "Waiting"}), http.StatusCreated, &lane)
+	position := 1
+	env.expect(env.do(http.MethodPut, boardURL+"/columns/"+lane.Column.ID, models.BoardColumnUpdateRequest{Position: &position}), http.StatusOK, nil)
+	if todo := move("Draft", lane.Column.ID, 5, http.StatusOK); todo.Status != models.StatusPending || todo.ColumnID == nil || *todo.ColumnID != lane.Column.ID {
+		t.Fatalf("expected the todo in the lane and still pending, got %+v", todo)
+	}
+	if todo := move("Ship", column("Done"), 0, http.StatusOK); todo.Status != models.StatusCompleted || todo.CompletedAt == nil {
+		t.Fatalf("expected the todo to be completed, got %+v", todo)
+	}
+	layout()
+	var names []string
+	for _, column := range board.Board.Columns {
+		names = append(names, column.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"To Do", "Waiting", "In Progress", "Blocked", "Done"}) {
+		t.Fatalf("expected the lane second, got %v", names)
+	}
+
+	// Todos follow status changes made elsewhere, and leave deleted columns
+	inProgress := models.StatusInProgress
+	env.expect(env.do(http.MethodPut, "/api/todos/"+ids["Review"], models.TodoUpdateRequest{Status: &inProgress}), http.StatusOK, nil)
+	env.expect(env.do(http.MethodDelete, boardURL+"/columns/"+lane.Column.ID, nil), http.StatusOK, nil)
+	want = map[string][]string{"To Do": {"Draft"}, "In Progress": {"Review"}, "Blocked": {}, "Done": {"Ship", "Archive"}}
+	if got := layout(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the status change and the deleted lane, got %v", got)
+	}
+
+	var homeBoard struct {
+		Board *models.Board `json:"board"`
+	}
+	env.expect(env.do(http.MethodGet, "/api/groups/"+home.Group.ID+"/board", nil), http.StatusOK, &homeBoard)
+	move("Draft", homeBoard.Board.Columns[0].ID, 0, http.StatusBadRequest)
+	move("Laundry", column("To Do"), 0, http.StatusBadRequest)
+	move("Draft", "missing", 0, http.StatusNotFound)
+	env.expect(env.do(http.MethodGet, "/api/groups/missing/board", nil), http.StatusNotFound, nil)
+
+	bogus := models.Status("someday")
+	empty := " "
+	env.expect(env.do(http.MethodPut, boardURL+"/columns/"+column("To Do"), models.BoardColumnUpdateRequest{Status: &bogus}), http.StatusBadRequest, nil)
+	env.expect(env.do(http.MethodPut, boardURL+"/columns/"+column("To Do"), models.BoardColumnUpdateRequest{Name: &empty}), http.StatusBadRequest, nil)
+	env.expect(env.do(http.MethodPut, "/api/groups/"+home.Group.ID+"/board/columns/"+column("To Do"), models.BoardColumnUpdateRequest{}), http.StatusNotFound, nil)
+}
+
+func TestPositions(t *testing.T) {
+	env := newTestEnv(t)
+
+	type todoResp struct {
+		Todo *models.Todo `json:"todo"`
+	}
+	ids := make(map[string]string)
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		var resp todoResp
+		env.expect(env.do(http.MethodPost, "/api/todos", models.TodoCreateRequest{Title: title}), http.StatusCreated, &resp)
+		ids[title] = resp.Todo.ID
+	}
+
+	positions := make(map[string]string)
+	list := func() []string {
+		t.Helper()
+		var page models.TodoPage
+		env.expect(env.do(http.MethodGet, "/api/todos", nil), http.StatusOK, &page)
+		titles := []string{}
+		for _, todo := range page.Todos {
+			titles = append(titles, todo.Title)
+			positions[todo.Title] = todo.Position
+		}
+		return titles
+	}
+	move := func(title string, after *string, status int) {
+		t.Helper()
+		env.expect(env.do(http.MethodPut, "/api/todos/"+ids[title]+"/position", models.TodoMoveAfterRequest{AfterID: after}), status, nil)
+	}
+	id := func(title string) *string {
+		id := ids[title]
+		return &id
+	}
+
+	if got := list(); !reflect.DeepEqual(got, []string{"A", "B", "C", "D", "E"}) {
+		t.Fatalf("expected todos in the order created, got %v", got)
+	}
+	before := map[string]string{"B": positions["B"], "C": positions["C"], "D": positions["D"]}
+
+	// Moving only rewrites the moved todo's position
+	move("E", id("A"), http.StatusOK)
+	move("C", nil, http.StatusOK)
+	if got := list(); !reflect.DeepEqual(got, []string{"C", "A", "E", "B", "D"}) {
+		t.Fatalf("expected the moves, got %v", got)
+	}
+	if positions["B"] != before["B"] || positions["D"] != before["D"] || positions["C"] == before["C"] {
+		t.Fatalf("expected only the moved todos to change, got %v from %v", positions, before)
+	}
+
+	// Integer positions from older clients still give the order, and the
+	// todos sent swap the places they hold
+	env.expect(env.do(http.MethodPut, "/api/todos/reorder", models.TodoReorderRequest{Todos: []models.TodoPosition{
+		{ID: ids["A"], Position: "10000"}, {ID: ids["D"], Position: "1000"}, {ID: ids["C"], Position: "2000"},
+	}}), http.StatusOK, nil)
+	if got := list(); !reflect.DeepEqual(got, []string{"D", "C", "E", "B", "A"}) {
+		t.Fatalf("expected the reorder, got %v", got)
+	}
+
+	// Moving into the same gap again and again rebalances once keys grow long
+	for i := 0; i < 300; i++ {
+		title := "B"
+		if i%2 == 1 {
+			title = "E"
+		}
+		move(title, id("C"), http.StatusOK)
+	}
+	if got := list(); !reflect.DeepEqual(got, []string{"D", "C", "E", "B", "A"}) {
+		t.Fatalf("expected the order kept through rebalancing, got %v", got)
+	}
+	for title, position := range positions {
+		if len(position) > 24 {
+			t.Fatalf("expected positions to be rebalanced, got %q for %s", position, title)
+		}
+	}
+
+	move("A", id("A"), http.StatusBadRequest)
+	missing := "missing"
+	move("A", &missing, http.StatusBadRequest)
+	env.expect(env.do(http.MethodPut, "/api/todos/missing/position", models.TodoMoveAfterRequest{}), http.StatusNotFound, nil)
+	legacy := "1000"
+	env.expect(env.do(http.MethodPut, "/api/todos/"+ids["A"], models.TodoUpdateRequest{Position: &legacy}), http.StatusBadRequest, nil)
+
+	// Memories order the same way
+	memories := make(map[string]string)
+	for _, content := range []string{"first", "second", "third"} {
+		memories[content] = env.createMemory(content).ID
+	}
+	listMemories := func() []string {
+		t.Helper()
+		var resp struct {
+			Memories []models.Memory `json:"memories"`
+		}
+		env.expect(env.do(http.MethodGet, "/api/memories", nil), http.StatusOK, &resp)
+		contents := []string{}
+		for _, memory := range resp.Memories {
+			contents = append(contents, memory.Content)
+		}
+		return contents
+	}
+	if got := listMemories(); !reflect.DeepEqual(got, []string{"first", "second", "third"}) {
+		t.Fatalf("expected memories in the order created, got %v", got)
+	}
+	env.expect(env.do(http.MethodPut, "/api/memories/"+memories["third"]+"/position", models.MemoryMoveAfterRequest{}), http.StatusOK, nil)
+	after := memories["third"]
+	env.expect(env.do(http.MethodPut, "/api/memories/"+memories["second"]+"/position", models.MemoryMoveAfterRequest{AfterID: &after}), http.StatusOK, nil)
+	if got := listMemories(); !reflect.DeepEqual(got, []string{"third", "second", "first"}) {
+		t.Fatalf("expected the memory moves, got %v", got)
+	}
+	env.expect(env.do(http.MethodPut, "/api/memories/missing/position", models.MemoryMoveAfterRequest{}), http.StatusNotFound, nil)
+	env.expect(env.do(http.MethodPut, "/api/memories/"+memories["first"]+"/position", models.MemoryMoveAfterRequest{AfterID: &missing}), http.StatusBadRequest, nil)
+}
+
+func TestPromptTemplatePreview(t *testing.T) {
+	env := newTestEnv(t)
+	memory := env.createMemory("Read Meditations by Marcus Aurelius")
+
+	preview := func(memoryID *string, status int) string {
+		t.Helper()
+		template := "Note: {{.Content}}"
+		var resp models.PromptPreviewResponse
+		env.expect(env.do(http.MethodPost, "/api/prompt-templates/memory_categorization/preview",
+			models.PromptPreviewRequest{Template: &template, MemoryID: memoryID}), status, &resp)
+		return resp.Prompt
+	}
+
+	if got := preview(nil, http.StatusOK); !strings.Contains(got, "cacio e pepe") {
+		t.Errorf("expected the sample memory without a memory_id, got %q", got)
+	}
+	if got := preview(&memory.ID, http.StatusOK); got != "Note: Read Meditations by Marcus Aurelius" {
+		t.Errorf("expected the chosen memory, got %q", got)
+	}
+	missing := "missing"
+	preview(&missing, http.StatusNotFound)
+}
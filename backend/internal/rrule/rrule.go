@@ -0,0 +1,505 @@
+// Package rrule parses RFC 5545 recurrence rules and expands them into dates.
+//
+// Todos recur by day, so only the date-level parts of a rule are supported:
+// FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL, COUNT, UNTIL, BYDAY,
+// BYMONTHDAY, BYMONTH and WKST. Rules using other parts are rejected rather
+// than silently misread.
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is how often a rule's period repeats
+type Frequency int
+
+const (
+	Daily Frequency = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencyNames = map[string]Frequency{
+	"DAILY":   Daily,
+	"WEEKLY":  Weekly,
+	"MONTHLY": Monthly,
+	"YEARLY":  Yearly,
+}
+
+func (f Frequency) String() string {
+	for name, freq := range frequencyNames {
+		if freq == f {
+			return name
+		}
+	}
+	return ""
+}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum is a BYDAY entry: a weekday, optionally the Nth (or, when
+// negative, Nth from last) of the month or year, e.g. "2MO" or "-1FR"
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+func (w WeekdayNum) String() string {
+	if w.N != 0 {
+		return strconv.Itoa(w.N) + weekdayNames[w.Weekday]
+	}
+	return weekdayNames[w.Weekday]
+}
+
+// Rule is a parsed recurrence rule
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	Count      int       // 0 means no limit
+	Until      time.Time // last possible date, inclusive; zero means no end
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+// maxEmptyPeriods bounds how many periods in a row may pass without an
+// occurrence, so rules that can never match (such as February 30) end instead of
+// looping
+const maxEmptyPeriods = 1000
+
+// Parse parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20251231".
+// A leading "RRULE:" is allowed.
+func Parse(text string) (*Rule, error) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), "RRULE:")
+	if text == "" {
+		return nil, fmt.Errorf("empty rule")
+	}
+
+	rule := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(text, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s given more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			freq, known := frequencyNames[value]
+			if !known {
+				return nil, fmt.Errorf("unsupported FREQ %q", value)
+			}
+			rule.Freq = freq
+		case "INTERVAL":
+			rule.Interval, err = positiveInt(name, value)
+		case "COUNT":
+			rule.Count, err = positiveInt(name, value)
+		case "UNTIL":
+			rule.Until, err = parseUntil(value)
+		case "BYDAY":
+			rule.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			rule.ByMonthDay, err = parseIntList(name, value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(name, value, 1, 12)
+			for _, m := range months {
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			rule.WeekStart, err = parseWeekday(value)
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !seen["FREQ"] {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if seen["COUNT"] && seen["UNTIL"] {
+		return nil, fmt.Errorf("COUNT and UNTIL can't both be given")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != Monthly && rule.Freq != Yearly {
+			return nil, fmt.Errorf("numbered BYDAY %s needs FREQ=MONTHLY or YEARLY", day)
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq == Weekly {
+		return nil, fmt.Errorf("BYMONTHDAY can't be used with FREQ=WEEKLY")
+	}
+	return rule, nil
+}
+
+func positiveInt(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", name, value)
+	}
+	return n, nil
+}
+
+func parseIntList(name, value string, min, max int) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("invalid %s value %q", name, item)
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseWeekday(value string) (time.Weekday, error) {
+	for i, name := range weekdayNames {
+		if value == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", value)
+}
+
+func parseByDay(value string) ([]WeekdayNum, error) {
+	var days []WeekdayNum
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid BYDAY value %q", item)
+		}
+		weekday, err := parseWeekday(item[len(item)-2:])
+		if err != nil {
+			return nil, err
+		}
+		day := WeekdayNum{Weekday: weekday}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			day.N, err = strconv.Atoi(prefix)
+			if err != nil || day.N == 0 || day.N < -53 || day.N > 53 {
+				return nil, fmt.Errorf("invalid BYDAY value %q", item)
+			}
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// parseUntil accepts a DATE ("20251231") or UTC DATE-TIME ("20251231T235959Z");
+// only the date is kept
+func parseUntil(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+	}
+	day, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+	}
+	return day, nil
+}
+
+// String formats the rule in canonical RFC 5545 form, without the "RRULE:" prefix
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq.String()}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, month := range r.ByMonth {
+			months[i] = strconv.Itoa(int(month))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Iterate calls yield with each occurrence of the rule starting at start, in
+// order, until yield returns false or the rule ends. start is always the first
+// occurrence, as DTSTART is in RFC 5545. Dates are days at midnight UTC. Rules
+// without COUNT or UNTIL never end, so yield must stop them.
+func (r *Rule) Iterate(start time.Time, yield func(time.Time) bool) {
+	start = day(start)
+	if !r.Until.IsZero() && start.After(r.Until) {
+		return
+	}
+	if !yield(start) {
+		return
+	}
+
+	count := 1
+	period := r.periodStart(start)
+	for empty := 0; empty < maxEmptyPeriods; empty++ {
+		for _, date := range r.candidates(period, start) {
+			if !date.After(start) {
+				continue
+			}
+			if r.Count > 0 && count >= r.Count {
+				return
+			}
+			if !r.Until.IsZero() && date.After(r.Until) {
+				return
+			}
+			count++
+			empty = -1
+			if !yield(date) {
+				return
+			}
+		}
+		period = r.nextPeriod(period)
+	}
+}
+
+// After returns the first occurrence strictly after t, if the rule has one
+func (r *Rule) After(start, t time.Time) (time.Time, bool) {
+	t = day(t)
+	var next time.Time
+	found := false
+	r.Iterate(start, func(date time.Time) bool {
+		if date.After(t) {
+			next, found = date, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// Between returns up to limit occurrences in [from, to], in order
+func (r *Rule) Between(start, from, to time.Time, limit int) []time.Time {
+	from, to = day(from), day(to)
+	var dates []time.Time
+	r.Iterate(start, func(date time.Time) bool {
+		if date.After(to) {
+			return false
+		}
+		if !date.Before(from) {
+			dates = append(dates, date)
+		}
+		return limit <= 0 || len(dates) < limit
+	})
+	return dates
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// periodStart returns the first day of the period containing t
+func (r *Rule) periodStart(t time.Time) time.Time {
+	switch r.Freq {
+	case Weekly:
+		offset := (int(t.Weekday()) - int(r.WeekStart) + 7) % 7
+		return t.AddDate(0, 0, -offset)
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case Yearly:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+func (r *Rule) nextPeriod(period time.Time) time.Time {
+	switch r.Freq {
+	case Weekly:
+		return period.AddDate(0, 0, 7*r.Interval)
+	case Monthly:
+		return period.AddDate(0, r.Interval, 0)
+	case Yearly:
+		return period.AddDate(r.Interval, 0, 0)
+	default:
+		return period.AddDate(0, 0, r.Interval)
+	}
+}
+
+// candidates returns the dates of a period that match the rule, in order. Parts
+// missing from the rule default to start's weekday, day of month and month.
+func (r *Rule) candidates(period, start time.Time) []time.Time {
+	var dates []time.Time
+	switch r.Freq {
+	case Daily:
+		if r.matchesMonth(period) && r.matchesMonthDay(period) && r.matchesWeekday(period) {
+			dates = append(dates, period)
+		}
+
+	case Weekly:
+		weekdays := r.ByDay
+		if len(weekdays) == 0 {
+			weekdays = []WeekdayNum{{Weekday: start.Weekday()}}
+		}
+		for i := 0; i < 7; i++ {
+			date := period.AddDate(0, 0, i)
+			for _, wd := range weekdays {
+				if date.Weekday() == wd.Weekday && r.matchesMonth(date) {
+					dates = append(dates, date)
+				}
+			}
+		}
+
+	case Monthly:
+		if r.matchesMonth(period) {
+			dates = r.monthDates(period, start)
+		}
+
+	case Yearly:
+		months := r.ByMonth
+		if len(months) == 0 && len(r.ByDay) > 0 && len(r.ByMonthDay) == 0 {
+			// BYDAY alone in a yearly rule counts weekdays across the whole year
+			return r.weekdaysIn(period, period.AddDate(1, 0, 0), nil)
+		}
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		for _, month := range months {
+			dates = append(dates, r.monthDates(time.Date(period.Year(), month, 1, 0, 0, 0, 0, time.UTC), start)...)
+		}
+	}
+
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dedupe(dates)
+}
+
+// monthDates returns the matching dates of the month starting at first
+func (r *Rule) monthDates(first, start time.Time) []time.Time {
+	next := first.AddDate(0, 1, 0)
+	if len(r.ByMonthDay) > 0 {
+		var dates []time.Time
+		for _, date := range r.monthDays(first) {
+			if r.matchesWeekday(date) {
+				dates = append(dates, date)
+			}
+		}
+		return dates
+	}
+	if len(r.ByDay) > 0 {
+		return r.weekdaysIn(first, next, nil)
+	}
+	// Months without start's day (e.g. the 31st) are skipped, per RFC 5545
+	date := time.Date(first.Year(), first.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	if date.Month() != first.Month() {
+		return nil
+	}
+	return []time.Time{date}
+}
+
+// monthDays resolves BYMONTHDAY in the month starting at first; negative days
+// count from the end of the month, and days the month lacks are skipped
+func (r *Rule) monthDays(first time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var dates []time.Time
+	for _, d := range r.ByMonthDay {
+		if d < 0 {
+			d = last + d + 1
+		}
+		if d >= 1 && d <= last {
+			dates = append(dates, time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, time.UTC))
+		}
+	}
+	return dates
+}
+
+// weekdaysIn returns the BYDAY dates in [from, to). Numbered entries pick the Nth
+// matching weekday of the range, or the Nth from last when negative.
+func (r *Rule) weekdaysIn(from, to time.Time, dates []time.Time) []time.Time {
+	for _, wd := range r.ByDay {
+		var matches []time.Time
+		for date := from; date.Before(to); date = date.AddDate(0, 0, 1) {
+			if date.Weekday() == wd.Weekday {
+				matches = append(matches, date)
+			}
+		}
+		switch {
+		case wd.N > 0 && wd.N <= len(matches):
+			dates = append(dates, matches[wd.N-1])
+		case wd.N < 0 && -wd.N <= len(matches):
+			dates = append(dates, matches[len(matches)+wd.N])
+		case wd.N == 0:
+			dates = append(dates, matches...)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates
+}
+
+func (r *Rule) matchesMonth(date time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, month := range r.ByMonth {
+		if date.Month() == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesMonthDay(date time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	for _, d := range r.monthDays(time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)) {
+		if d.Equal(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekday checks a date against BYDAY's weekdays, ignoring any numbers
+func (r *Rule) matchesWeekday(date time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wd := range r.ByDay {
+		if date.Weekday() == wd.Weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(dates []time.Time) []time.Time {
+	out := dates[:0]
+	for i, date := range dates {
+		if i == 0 || !date.Equal(dates[i-1]) {
+			out = append(out, date)
+		}
+	}
+	return out
+}
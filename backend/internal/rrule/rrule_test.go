@@ -0,0 +1,101 @@
+package rrule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dates(times []time.Time) string {
+	var out []string
+	for _, t := range times {
+		out = append(out, t.Format("2006-01-02"))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		rule, start, to, want string
+	}{
+		{"FREQ=DAILY;INTERVAL=2;COUNT=3", "2025-01-30", "2025-12-31", "2025-01-30 2025-02-01 2025-02-03"},
+		// Tuesday start, so DTSTART counts as an occurrence even off-pattern
+		{"FREQ=WEEKLY;BYDAY=MO,FR;UNTIL=20250113", "2025-01-07", "2025-12-31", "2025-01-07 2025-01-10 2025-01-13"},
+		{"FREQ=WEEKLY;INTERVAL=2", "2025-01-01", "2025-01-31", "2025-01-01 2025-01-15 2025-01-29"},
+		// Months without a 31st are skipped
+		{"FREQ=MONTHLY", "2025-01-31", "2025-06-30", "2025-01-31 2025-03-31 2025-05-31"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2025-01-31", "2025-04-30", "2025-01-31 2025-02-28 2025-03-31 2025-04-30"},
+		{"FREQ=MONTHLY;BYDAY=-1FR", "2025-01-31", "2025-04-30", "2025-01-31 2025-02-28 2025-03-28 2025-04-25"},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "2025-11-27", "2027-12-31", "2025-11-27 2026-11-26 2027-11-25"},
+		{"FREQ=YEARLY", "2024-02-29", "2032-12-31", "2024-02-29 2028-02-29 2032-02-29"},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.rule, err)
+		}
+		got := dates(rule.Between(date(tt.start), date(tt.start), date(tt.to), 0))
+		if got != tt.want {
+			t.Errorf("%s from %s: expected %s, got %s", tt.rule, tt.start, tt.want, got)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	rule, err := Parse("RRULE:FREQ=WEEKLY;BYDAY=MO;COUNT=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := date("2025-03-03")
+
+	if next, ok := rule.After(start, date("2025-03-05")); !ok || !next.Equal(date("2025-03-10")) {
+		t.Fatalf("expected 2025-03-10, got %s %v", next, ok)
+	}
+	if _, ok := rule.After(start, date("2025-03-17")); ok {
+		t.Fatal("expected the rule to end after three occurrences")
+	}
+
+	// Rules that never match end instead of looping
+	never, err := Parse("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := never.After(date("2025-01-01"), date("2025-01-01")); ok {
+		t.Fatal("expected no occurrence on February 30")
+	}
+}
+
+func TestParse(t *testing.T) {
+	rule, err := Parse("freq=monthly;interval=3;byday=2mo,-1fr;wkst=su;until=20261231T235959Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rule.String(), "FREQ=MONTHLY;INTERVAL=3;UNTIL=20261231;BYDAY=2MO,-1FR;WKST=SU"; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;BYHOUR=9",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20250101",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;FREQ=WEEKLY",
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,6 +18,13 @@ import (
 	"github.com/todomyday/backend/internal/repository"
 )
 
+var (
+	ErrProviderNotFound      = errors.New("provider not found")
+	ErrModelPullNotSupported = errors.New("model pulling is only supported for ollama providers")
+	ErrNoCapableModel        = errors.New("no model with the required capabilities")
+	ErrVisionNotSupported    = errors.New("model does not support image input")
+)
+
 type AIProviderService struct {
 	repo      *repository.AIProviderRepository
 	encryptor *crypto.Encryptor
@@ -28,7 +38,11 @@ func NewAIProviderService(repo *repository.AIProviderRepository, encryptor *cryp
 }
 
 func (s *AIProviderService) Create(userID string, input *models.AIProviderCreate) (*models.AIProvider, error) {
-	// Encrypt the API key
+	if input.APIKey == "" && input.ProviderType.RequiresAPIKey() {
+		return nil, fmt.Errorf("api_key is required for %s providers", input.ProviderType)
+	}
+
+	// Encrypt the API key (empty for local providers)
 	encryptedKey, err := s.encryptor.Encrypt(input.APIKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt API key: %w", err)
@@ -68,8 +82,8 @@ func (s *AIProviderService) GetByID(id, userID string) (*models.AIProvider, erro
 	if err != nil {
 		return nil, err
 	}
-	if provider.UserID != userID {
-		return nil, fmt.Errorf("provider not found")
+	if provider == nil || provider.UserID != userID {
+		return nil, ErrProviderNotFound
 	}
 
 	// Decrypt API key to create masked version
@@ -104,13 +118,18 @@ func (s *AIProviderService) GetDefaultByUserID(userID string) (*models.AIProvide
 	return provider, nil
 }
 
+// GetVisionByUserID returns the provider and model the user selected for image processing
+func (s *AIProviderService) GetVisionByUserID(userID string) (*models.AIProvider, error) {
+	return s.repo.GetVisionByUserID(userID)
+}
+
 func (s *AIProviderService) Update(id, userID string, input *models.AIProviderUpdate) (*models.AIProvider, error) {
 	provider, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if provider.UserID != userID {
-		return nil, fmt.Errorf("provider not found")
+	if provider == nil || provider.UserID != userID {
+		return nil, ErrProviderNotFound
 	}
 
 	if input.Name != nil {
@@ -129,6 +148,18 @@ func (s *AIProviderService) Update(id, userID string, input *models.AIProviderUp
 	if input.SelectedModel != nil {
 		provider.SelectedModel = input.SelectedModel
 	}
+	if input.VisionModel != nil && *input.VisionModel != "" {
+		if caps, known := s.GetModelCapabilities(provider.ID, *input.VisionModel); known && !caps.Vision {
+			return nil, fmt.Errorf("%w: %s", ErrVisionNotSupported, *input.VisionModel)
+		}
+		// A user has one vision model, so selecting it here clears it everywhere else
+		if err := s.repo.ClearVisionModelForUser(userID); err != nil {
+			return nil, err
+		}
+		provider.VisionModel = input.VisionModel
+	} else if input.VisionModel != nil {
+		provider.VisionModel = nil
+	}
 	if input.IsDefault != nil && *input.IsDefault {
 		if err := s.repo.ClearDefaultForUser(userID); err != nil {
 			return nil, err
@@ -158,8 +189,8 @@ func (s *AIProviderService) Delete(id, userID string) error {
 	if err != nil {
 		return err
 	}
-	if provider.UserID != userID {
-		return fmt.Errorf("provider not found")
+	if provider == nil || provider.UserID != userID {
+		return ErrProviderNotFound
 	}
 	return s.repo.Delete(id)
 }
@@ -172,6 +203,10 @@ func (s *AIProviderService) TestConnection(input *models.TestConnectionRequest)
 		return s.testAnthropic(input.BaseURL, input.APIKey)
 	case models.ProviderTypeGoogle:
 		return s.testGoogle(input.BaseURL, input.APIKey)
+	case models.ProviderTypeOllama:
+		return s.testOllama(input.BaseURL)
+	case models.ProviderTypeMock:
+		return testMock(input.BaseURL), nil
 	default:
 		return &models.TestConnectionResponse{
 			Success: false,
@@ -219,9 +254,16 @@ func (s *AIProviderService) testOpenAICompatible(baseURL, apiKey string) (*model
 		}, nil
 	}
 
+	// OpenAI only lists IDs; aggregators like OpenRouter add context length,
+	// input modalities and supported parameters
 	var modelsResp struct {
 		Data []struct {
-			ID string `json:"id"`
+			ID            string `json:"id"`
+			ContextLength int    `json:"context_length"`
+			Architecture  *struct {
+				InputModalities []string `json:"input_modalities"`
+			} `json:"architecture"`
+			SupportedParameters []string `json:"supported_parameters"`
 		} `json:"data"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
@@ -246,10 +288,29 @@ func (s *AIProviderService) testOpenAICompatible(baseURL, apiKey string) (*model
 		}
 	}
 
+	capabilities := make(map[string]models.ModelCapabilities)
+	for _, m := range modelsResp.Data {
+		if m.ContextLength == 0 && m.Architecture == nil && len(m.SupportedParameters) == 0 {
+			continue
+		}
+		caps := models.ModelCapabilities{ContextWindow: m.ContextLength}
+		if m.Architecture != nil {
+			for _, modality := range m.Architecture.InputModalities {
+				caps.Vision = caps.Vision || modality == "image"
+			}
+		}
+		for _, param := range m.SupportedParameters {
+			caps.Tools = caps.Tools || param == "tools"
+			caps.JSONMode = caps.JSONMode || param == "response_format" || param == "structured_outputs"
+		}
+		capabilities[m.ID] = caps
+	}
+
 	return &models.TestConnectionResponse{
-		Success: true,
-		Message: "Connection successful",
-		Models:  modelIDs,
+		Success:      true,
+		Message:      "Connection successful",
+		Models:       modelIDs,
+		Capabilities: capabilities,
 	}, nil
 }
 
@@ -349,7 +410,9 @@ func (s *AIProviderService) testGoogle(baseURL, apiKey string) (*models.TestConn
 
 	var modelsResp struct {
 		Models []struct {
-			Name string `json:"name"`
+			Name                       string   `json:"name"`
+			InputTokenLimit            int      `json:"inputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
 		} `json:"models"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&modelsResp); err != nil {
@@ -360,28 +423,82 @@ func (s *AIProviderService) testGoogle(baseURL, apiKey string) (*models.TestConn
 	}
 
 	modelIDs := make([]string, 0, len(modelsResp.Models))
+	capabilities := make(map[string]models.ModelCapabilities)
 	for _, m := range modelsResp.Models {
 		// Extract model ID from name (format: models/model-id)
 		parts := strings.Split(m.Name, "/")
 		if len(parts) > 1 && strings.Contains(parts[1], "gemini") {
 			modelIDs = append(modelIDs, parts[1])
+
+			// Models that can only embed list embedContent without generateContent
+			caps := models.ModelCapabilities{ContextWindow: m.InputTokenLimit}
+			canGenerate := false
+			for _, method := range m.SupportedGenerationMethods {
+				canGenerate = canGenerate || method == "generateContent"
+				caps.Embedding = caps.Embedding || method == "embedContent"
+			}
+			caps.Embedding = caps.Embedding && !canGenerate
+			capabilities[parts[1]] = caps
 		}
 	}
 
+	return &models.TestConnectionResponse{
+		Success:      true,
+		Message:      "Connection successful",
+		Models:       modelIDs,
+		Capabilities: capabilities,
+	}, nil
+}
+
+func (s *AIProviderService) testOllama(baseURL string) (*models.TestConnectionResponse, error) {
+	// Ollama needs no API key - list local models via the native tags API
+	modelIDs, err := listOllamaModels(baseURL)
+	if err != nil {
+		return &models.TestConnectionResponse{
+			Success: false,
+			Message: fmt.Sprintf("Connection failed: %v", err),
+		}, nil
+	}
+
+	message := "Connection successful"
+	if len(modelIDs) == 0 {
+		message = "Connection successful, but no models are installed. Pull a model first."
+	}
+
 	return &models.TestConnectionResponse{
 		Success: true,
-		Message: "Connection successful",
+		Message: message,
 		Models:  modelIDs,
 	}, nil
 }
 
+// PullModel downloads a model onto a user's Ollama server and refreshes the cached model list
+func (s *AIProviderService) PullModel(ctx context.Context, id, userID, model string) ([]models.AIProviderModel, error) {
+	provider, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil || provider.UserID != userID {
+		return nil, ErrProviderNotFound
+	}
+	if provider.ProviderType != models.ProviderTypeOllama {
+		return nil, ErrModelPullNotSupported
+	}
+
+	if err := pullOllamaModel(ctx, provider.BaseURL, model); err != nil {
+		return nil, err
+	}
+
+	return s.FetchAndSaveModels(id, userID)
+}
+
 func (s *AIProviderService) FetchAndSaveModels(id, userID string) ([]models.AIProviderModel, error) {
 	provider, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
 	}
-	if provider.UserID != userID {
-		return nil, fmt.Errorf("provider not found")
+	if provider == nil || provider.UserID != userID {
+		return nil, ErrProviderNotFound
 	}
 
 	// Decrypt API key
@@ -403,15 +520,20 @@ func (s *AIProviderService) FetchAndSaveModels(id, userID string) ([]models.AIPr
 		return nil, fmt.Errorf("failed to fetch models: %s", testResult.Message)
 	}
 
-	// Convert to AIProviderModel
+	// Convert to AIProviderModel, filling in capabilities the listing didn't report
 	providerModels := make([]models.AIProviderModel, len(testResult.Models))
 	for i, modelID := range testResult.Models {
+		var listed *models.ModelCapabilities
+		if caps, ok := testResult.Capabilities[modelID]; ok {
+			listed = &caps
+		}
 		providerModels[i] = models.AIProviderModel{
-			ID:         uuid.New().String(),
-			ProviderID: provider.ID,
-			ModelID:    modelID,
-			ModelName:  modelID,
-			CreatedAt:  time.Now(),
+			ID:           uuid.New().String(),
+			ProviderID:   provider.ID,
+			ModelID:      modelID,
+			ModelName:    modelID,
+			Capabilities: inferModelCapabilities(modelID, listed),
+			CreatedAt:    time.Now(),
 		}
 	}
 
@@ -428,13 +550,78 @@ func (s *AIProviderService) GetModels(id, userID string) ([]models.AIProviderMod
 	if err != nil {
 		return nil, err
 	}
-	if provider.UserID != userID {
-		return nil, fmt.Errorf("provider not found")
+	if provider == nil || provider.UserID != userID {
+		return nil, ErrProviderNotFound
 	}
 
 	return s.repo.GetModelsByProviderID(id)
 }
 
+// GetModelCapabilities returns what a model can do, from the provider's model cache or
+// the built-in table. known is false when neither has the model.
+func (s *AIProviderService) GetModelCapabilities(providerID, modelID string) (caps models.ModelCapabilities, known bool) {
+	cached, err := s.repo.GetModel(providerID, modelID)
+	if err == nil && cached.Capabilities != (models.ModelCapabilities{}) {
+		return cached.Capabilities, true
+	}
+	// Not cached, or cached before capabilities were recorded
+	return lookupModelCapabilities(modelID)
+}
+
+// FindCapableModel picks a model meeting the requirements. The default provider's
+// selected model wins when it qualifies; otherwise the cached models of the user's
+// enabled providers are searched, default provider first. For a minimum context
+// the smallest window that fits is chosen.
+func (s *AIProviderService) FindCapableModel(userID string, req models.ModelRequirements) (*models.AIProvider, string, error) {
+	providers, err := s.repo.GetByUserID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.SliceStable(providers, func(i, j int) bool {
+		return providers[i].IsDefault && !providers[j].IsDefault
+	})
+
+	for i := range providers {
+		provider := &providers[i]
+		if !provider.IsEnabled {
+			continue
+		}
+
+		if provider.IsDefault && provider.SelectedModel != nil {
+			if caps, _ := s.GetModelCapabilities(provider.ID, *provider.SelectedModel); caps.Satisfies(req) {
+				return provider, *provider.SelectedModel, nil
+			}
+		}
+
+		cachedModels, err := s.repo.GetModelsByProviderID(provider.ID)
+		if err != nil {
+			return nil, "", err
+		}
+
+		best := ""
+		bestWindow := 0
+		for _, model := range cachedModels {
+			caps := model.Capabilities
+			if caps == (models.ModelCapabilities{}) {
+				caps, _ = lookupModelCapabilities(model.ModelID)
+			}
+			if !caps.Satisfies(req) {
+				continue
+			}
+			if best == "" || (req.MinContext > 0 && caps.ContextWindow < bestWindow) {
+				best = model.ModelID
+				bestWindow = caps.ContextWindow
+			}
+		}
+		if best != "" {
+			return provider, best, nil
+		}
+	}
+
+	return nil, "", ErrNoCapableModel
+}
+
 // GetDecryptedAPIKey returns the decrypted API key for a provider
 func (s *AIProviderService) GetDecryptedAPIKey(provider *models.AIProvider) (string, error) {
 	return s.encryptor.Decrypt(provider.APIKeyEncrypted)
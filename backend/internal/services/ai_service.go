@@ -27,6 +27,22 @@ type AIProviderConfig struct {
 	BaseURL      string
 	APIKey       string
 	Model        string
+	Prompts      *PromptSet // user's prompt overrides; nil uses the defaults
+	// UserID is who the request is made for, so cached results aren't shared
+	// between users; empty for requests not made on a user's behalf
+	UserID string
+	// ContextWindow is the model's input token window from the provider's model
+	// cache; 0 falls back to the built-in capability table
+	ContextWindow int
+}
+
+// IsUsable reports whether the config has everything needed to make a request.
+// Local providers (ollama) are usable without an API key.
+func (c *AIProviderConfig) IsUsable() bool {
+	if c == nil || c.BaseURL == "" || c.Model == "" {
+		return false
+	}
+	return c.APIKey != "" || !c.ProviderType.RequiresAPIKey()
 }
 
 type chatRequest struct {
@@ -94,8 +110,10 @@ type googlePart struct {
 }
 
 type googleGenConfig struct {
-	MaxOutputTokens int     `json:"maxOutputTokens"`
-	Temperature     float64 `json:"temperature"`
+	MaxOutputTokens  int                    `json:"maxOutputTokens"`
+	Temperature      float64                `json:"temperature"`
+	ResponseMimeType string                 `json:"responseMimeType,omitempty"`
+	ResponseSchema   map[string]interface{} `json:"responseSchema,omitempty"`
 }
 
 type googleResponse struct {
@@ -161,6 +179,77 @@ type chatResponseWithTools struct {
 	} `json:"choices"`
 }
 
+// Anthropic tool use types (https://docs.anthropic.com/en/docs/build-with-claude/tool-use)
+type anthropicTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicRequestWithTools struct {
+	Model      string               `json:"model"`
+	MaxTokens  int                  `json:"max_tokens"`
+	Messages   []anthropicMessage   `json:"messages"`
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicResponseWithTools struct {
+	Content []struct {
+		Type  string          `json:"type"` // "text" or "tool_use"
+		Text  string          `json:"text,omitempty"`
+		ID    string          `json:"id,omitempty"`
+		Name  string          `json:"name,omitempty"`
+		Input json.RawMessage `json:"input,omitempty"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+}
+
+// Gemini function calling types (https://ai.google.dev/gemini-api/docs/function-calling)
+type googleFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type googleTool struct {
+	FunctionDeclarations []googleFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type googleFunctionCallingConfig struct {
+	Mode string `json:"mode"`
+}
+
+type googleToolConfig struct {
+	FunctionCallingConfig googleFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type googleRequestWithTools struct {
+	Contents         []googleContent   `json:"contents"`
+	Tools            []googleTool      `json:"tools,omitempty"`
+	ToolConfig       *googleToolConfig `json:"toolConfig,omitempty"`
+	GenerationConfig googleGenConfig   `json:"generationConfig"`
+}
+
+type googleResponseWithTools struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text         string `json:"text,omitempty"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall,omitempty"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
 // Memory processing tools for function calling
 var memoryProcessingTools = []Tool{
 	{
@@ -178,10 +267,7 @@ var memoryProcessingTools = []Tool{
 					"category": map[string]interface{}{
 						"type":        "string",
 						"description": "The best matching category for this memory",
-						"enum": []string{
-							"Websites", "Food", "Movies", "Books", "Ideas",
-							"Places", "Products", "People", "Learnings", "Quotes", "Uncategorized",
-						},
+						"enum":        memoryCategoryNames,
 					},
 					"has_url": map[string]interface{}{
 						"type":        "boolean",
@@ -211,10 +297,7 @@ var memoryProcessingTools = []Tool{
 					"category": map[string]interface{}{
 						"type":        "string",
 						"description": "The best matching category for this memory",
-						"enum": []string{
-							"Websites", "Food", "Movies", "Books", "Ideas",
-							"Places", "Products", "People", "Learnings", "Quotes", "Uncategorized",
-						},
+						"enum":        memoryCategoryNames,
 					},
 				},
 				"required": []string{"query", "category"},
@@ -224,12 +307,25 @@ var memoryProcessingTools = []Tool{
 }
 
 // AIProcessedTodo contains all AI-extracted information
-// Note: DueDate extraction has been moved to frontend for better consistency
+// Note: Dates come from the frontend, or from TodoService's parser when a todo
+// is created with parse (see ParseTodoWithProvider)
 type AIProcessedTodo struct {
 	Title string
 	Tags  []string
 }
 
+// AIParsedTodo is a todo the model read from plain text. Dates and times are in
+// the user's timezone, and fields the text doesn't mention are empty.
+type AIParsedTodo struct {
+	Title      string   `json:"title"`
+	Tags       []string `json:"tags"`
+	DueDate    string   `json:"due_date"` // YYYY-MM-DD
+	DueTime    string   `json:"due_time"` // HH:MM, 24-hour
+	Priority   string   `json:"priority"`
+	Group      string   `json:"group"`
+	Recurrence string   `json:"recurrence"`
+}
+
 func NewAIService(baseURL, apiKey, model string) *AIService {
 	return &AIService{
 		baseURL: strings.TrimSuffix(baseURL, "/"),
@@ -246,7 +342,7 @@ func (s *AIService) IsConfigured() bool {
 }
 
 // ProcessTodo processes a todo title using the default AI configuration (from env)
-func (s *AIService) ProcessTodo(title string) (*AIProcessedTodo, error) {
+func (s *AIService) ProcessTodo(title string, prompts *PromptSet) (*AIProcessedTodo, error) {
 	if !s.IsConfigured() {
 		return &AIProcessedTodo{Title: title, Tags: []string{}}, nil
 	}
@@ -256,6 +352,7 @@ func (s *AIService) ProcessTodo(title string) (*AIProcessedTodo, error) {
 		BaseURL:      s.baseURL,
 		APIKey:       s.apiKey,
 		Model:        s.model,
+		Prompts:      prompts,
 	}
 
 	return ProcessTodoWithProvider(title, config)
@@ -263,7 +360,7 @@ func (s *AIService) ProcessTodo(title string) (*AIProcessedTodo, error) {
 
 // ProcessTodoWithProvider processes a todo title using a specific provider configuration
 func ProcessTodoWithProvider(title string, config *AIProviderConfig) (*AIProcessedTodo, error) {
-	if config == nil || config.BaseURL == "" || config.APIKey == "" || config.Model == "" {
+	if !config.IsUsable() {
 		log.Printf("[AI] Skipping - no valid config (baseURL=%s, model=%s)", config.BaseURL, config.Model)
 		return &AIProcessedTodo{Title: title, Tags: []string{}}, nil
 	}
@@ -272,50 +369,55 @@ func ProcessTodoWithProvider(title string, config *AIProviderConfig) (*AIProcess
 	log.Printf("[AI] Using provider: %s, model: %s, baseURL: %s", config.ProviderType, config.Model, config.BaseURL)
 
 	// Simple prompt - frontend handles date parsing now
-	prompt := fmt.Sprintf(`You are a todo assistant. Clean the following todo input and extract tags.
-
-Input: "%s"
-
-INSTRUCTIONS:
-1. title: Clean the title - fix typos, capitalize first letter, keep it concise. The title has already been cleaned of date/time references by the frontend, so just focus on grammar and clarity.
-2. tags: Extract 1-5 relevant tags (lowercase, single words like "shopping", "work", "health", "meeting", "errand")
-
-Respond with ONLY valid JSON (no markdown, no code blocks, no explanation):
-{"title": "cleaned title", "tags": ["tag1", "tag2"]}`, title)
+	prompt := config.Prompts.Render(PromptTodoProcessing, PromptData{Title: title})
 
 	log.Printf("[AI] Prompt: %s", prompt)
 
-	var content string
-	var err error
-
-	switch config.ProviderType {
-	case models.ProviderTypeAnthropic:
-		content, err = callAnthropic(config, prompt)
-	case models.ProviderTypeGoogle:
-		content, err = callGoogle(config, prompt)
-	default:
-		// OpenAI-compatible (openai, custom)
-		content, err = callOpenAICompatible(config, prompt)
-	}
-
-	if err != nil {
+	var raw aiResult
+	if err := generateStructured(config, prompt, todoOutputSchema, &raw); err != nil {
 		log.Printf("[AI] Error from provider: %v", err)
 		return &AIProcessedTodo{Title: title, Tags: []string{}}, err
 	}
 
-	log.Printf("[AI] Raw response: %s", content)
-
-	result, err := parseAIResponse(title, content)
-	if err != nil {
-		log.Printf("[AI] Parse error: %v", err)
-		return &AIProcessedTodo{Title: title, Tags: []string{}}, err
-	}
+	result := parseAIResponse(title, raw)
 
 	log.Printf("[AI] Result - title: %q, tags: %v", result.Title, result.Tags)
 	return result, nil
 }
 
+// ParseTodoWithProvider asks the model for a todo's title, tags, due date,
+// priority, group and recurrence. now is in the user's timezone and groups are
+// the names of the user's groups. The answer is not validated.
+func ParseTodoWithProvider(text string, now time.Time, groups []string, config *AIProviderConfig) (*AIParsedTodo, error) {
+	if !config.IsUsable() {
+		return nil, fmt.Errorf("no usable AI provider")
+	}
+
+	log.Printf("[AI] Parsing todo: %q", text)
+	prompt := config.Prompts.Render(PromptTodoParsing, PromptData{
+		Title:    text,
+		Now:      now.Format("Monday, 2006-01-02 15:04"),
+		Timezone: now.Location().String(),
+		Groups:   groups,
+	})
+
+	var result AIParsedTodo
+	if err := generateStructured(config, prompt, todoParseOutputSchema, &result); err != nil {
+		log.Printf("[AI] Error from provider: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[AI] Parsed - title: %q, due: %q %q, priority: %q, group: %q, recurrence: %q",
+		result.Title, result.DueDate, result.DueTime, result.Priority, result.Group, result.Recurrence)
+	return &result, nil
+}
+
 func callOpenAICompatible(config *AIProviderConfig, prompt string) (string, error) {
+	return callOpenAICompatibleWithFormat(config, prompt, false)
+}
+
+// callOpenAICompatibleWithFormat sends a chat completion, optionally requesting JSON mode
+func callOpenAICompatibleWithFormat(config *AIProviderConfig, prompt string, jsonMode bool) (string, error) {
 	// Build request
 	reqBody := chatRequest{
 		Model: config.Model,
@@ -326,8 +428,7 @@ func callOpenAICompatible(config *AIProviderConfig, prompt string) (string, erro
 		Temperature: 0.3,
 	}
 
-	// Add response_format for OpenAI
-	if strings.Contains(config.BaseURL, "openai.com") {
+	if jsonMode {
 		reqBody.ResponseFormat = &responseFormat{Type: "json_object"}
 	}
 
@@ -349,7 +450,9 @@ func callOpenAICompatible(config *AIProviderConfig, prompt string) (string, erro
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
 
 	keyPreview := config.APIKey
 	if len(keyPreview) > 10 {
@@ -395,14 +498,9 @@ func callOpenAICompatible(config *AIProviderConfig, prompt string) (string, erro
 	// If content is empty but reasoning has JSON, try to extract it
 	if content == "" && reasoning != "" {
 		log.Printf("[AI-HTTP] <<< Content empty, searching for JSON in reasoning_content")
-		// Look for JSON object in reasoning
-		start := strings.Index(reasoning, `{"title"`)
-		if start != -1 {
-			end := strings.Index(reasoning[start:], "}")
-			if end != -1 {
-				content = reasoning[start : start+end+1]
-				log.Printf("[AI-HTTP] <<< Extracted JSON from reasoning: %s", content)
-			}
+		if extracted := extractJSON(reasoning); extracted != "" {
+			content = extracted
+			log.Printf("[AI-HTTP] <<< Extracted JSON from reasoning: %s", content)
 		}
 	}
 
@@ -463,6 +561,14 @@ func callAnthropic(config *AIProviderConfig, prompt string) (string, error) {
 }
 
 func callGoogle(config *AIProviderConfig, prompt string) (string, error) {
+	return callGoogleWithGenConfig(config, prompt, googleGenConfig{
+		MaxOutputTokens: 200,
+		Temperature:     0.3,
+	})
+}
+
+// callGoogleWithGenConfig sends a generateContent request with custom generation settings
+func callGoogleWithGenConfig(config *AIProviderConfig, prompt string, genConfig googleGenConfig) (string, error) {
 	reqBody := googleRequest{
 		Contents: []googleContent{
 			{
@@ -471,10 +577,7 @@ func callGoogle(config *AIProviderConfig, prompt string) (string, error) {
 				},
 			},
 		},
-		GenerationConfig: googleGenConfig{
-			MaxOutputTokens: 200,
-			Temperature:     0.3,
-		},
+		GenerationConfig: genConfig,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -531,7 +634,7 @@ type urlSummaryResult struct {
 
 // ProcessMemoryWithProvider analyzes memory content and returns categorization + summary
 func ProcessMemoryWithProvider(content string, config *AIProviderConfig) (*models.AIProcessedMemory, error) {
-	if config == nil || config.BaseURL == "" || config.APIKey == "" || config.Model == "" {
+	if !config.IsUsable() {
 		log.Printf("[AI-Memory] Skipping - no valid config")
 		return &models.AIProcessedMemory{
 			Summary:  "",
@@ -541,70 +644,18 @@ func ProcessMemoryWithProvider(content string, config *AIProviderConfig) (*model
 
 	log.Printf("[AI-Memory] Processing memory: %q", content)
 
-	prompt := fmt.Sprintf(`You are a personal memory organizer. Analyze this note/memory and categorize it.
-
-Input: "%s"
-
-INSTRUCTIONS:
-1. summary: If the content is longer than 50 characters, provide a concise 1-sentence summary. Otherwise leave empty string.
-2. category: Choose the BEST matching category from this list ONLY:
-   - Websites (for links, tools, apps, online resources)
-   - Food (for restaurants, recipes, dishes, drinks)
-   - Movies (for films, TV shows, videos, streaming content)
-   - Books (for books, articles, reading material)
-   - Ideas (for thoughts, concepts, project ideas)
-   - Places (for locations, travel destinations, venues)
-   - Products (for items to buy, gadgets, purchases)
-   - People (for contacts, people met, networking)
-   - Learnings (for lessons learned, TIL, insights)
-   - Quotes (for memorable phrases, sayings)
-   - Uncategorized (if nothing else fits)
-
-Respond with ONLY valid JSON (no markdown, no code blocks):
-{"summary": "", "category": "Category Name"}`, content)
-
-	var respContent string
-	var err error
-
-	switch config.ProviderType {
-	case models.ProviderTypeAnthropic:
-		respContent, err = callAnthropic(config, prompt)
-	case models.ProviderTypeGoogle:
-		respContent, err = callGoogle(config, prompt)
-	default:
-		respContent, err = callOpenAICompatible(config, prompt)
-	}
-
-	if err != nil {
-		log.Printf("[AI-Memory] Error: %v", err)
-		return &models.AIProcessedMemory{Category: "Uncategorized"}, err
-	}
-
-	log.Printf("[AI-Memory] Raw response: %s", respContent)
-
+	cacheKey := responseCacheKey(PromptMemoryCategorization, config, content)
 	var result memoryAIResult
-	if err := json.Unmarshal([]byte(respContent), &result); err != nil {
-		// Try to extract JSON
-		start := strings.Index(respContent, "{")
-		end := strings.LastIndex(respContent, "}")
-		if start != -1 && end != -1 && end > start {
-			if err := json.Unmarshal([]byte(respContent[start:end+1]), &result); err != nil {
-				return &models.AIProcessedMemory{Category: "Uncategorized"}, err
-			}
-		} else {
+	if !cacheLookup(cacheKey, &result) {
+		prompt := config.Prompts.Render(PromptMemoryCategorization, PromptData{Content: content})
+
+		// The schema restricts category to the list above, so a made-up category
+		// triggers a repair round-trip instead of silently becoming Uncategorized
+		if err := generateStructured(config, prompt, memoryOutputSchema, &result); err != nil {
+			log.Printf("[AI-Memory] Error: %v", err)
 			return &models.AIProcessedMemory{Category: "Uncategorized"}, err
 		}
-	}
-
-	// Validate category
-	validCategories := map[string]bool{
-		"Websites": true, "Food": true, "Movies": true, "Books": true,
-		"Ideas": true, "Places": true, "Products": true, "People": true,
-		"Learnings": true, "Quotes": true, "Uncategorized": true,
-	}
-
-	if !validCategories[result.Category] {
-		result.Category = "Uncategorized"
+		cacheStore(cacheKey, result)
 	}
 
 	log.Printf("[AI-Memory] Result - summary: %q, category: %s", result.Summary, result.Category)
@@ -617,7 +668,7 @@ Respond with ONLY valid JSON (no markdown, no code blocks):
 
 // SummarizeURLWithProvider summarizes scraped URL content
 func SummarizeURLWithProvider(url, htmlContent string, config *AIProviderConfig) (*models.URLSummary, error) {
-	if config == nil || config.BaseURL == "" || config.APIKey == "" || config.Model == "" {
+	if !config.IsUsable() {
 		return &models.URLSummary{Title: "", Summary: ""}, nil
 	}
 
@@ -627,41 +678,14 @@ func SummarizeURLWithProvider(url, htmlContent string, config *AIProviderConfig)
 		htmlContent = htmlContent[:maxLen] + "..."
 	}
 
-	prompt := fmt.Sprintf(`Summarize this webpage content concisely.
-
-URL: %s
-Content: %s
-
-Respond with ONLY valid JSON:
-{"title": "page title or descriptive title", "summary": "1-2 sentence summary of what this page is about"}`, url, htmlContent)
-
-	var respContent string
-	var err error
-
-	switch config.ProviderType {
-	case models.ProviderTypeAnthropic:
-		respContent, err = callAnthropic(config, prompt)
-	case models.ProviderTypeGoogle:
-		respContent, err = callGoogle(config, prompt)
-	default:
-		respContent, err = callOpenAICompatible(config, prompt)
-	}
-
-	if err != nil {
-		return &models.URLSummary{}, err
-	}
-
+	cacheKey := responseCacheKey(PromptURLSummary, config, url, htmlContent)
 	var result urlSummaryResult
-	if err := json.Unmarshal([]byte(respContent), &result); err != nil {
-		start := strings.Index(respContent, "{")
-		end := strings.LastIndex(respContent, "}")
-		if start != -1 && end != -1 && end > start {
-			if err := json.Unmarshal([]byte(respContent[start:end+1]), &result); err != nil {
-				return &models.URLSummary{}, err
-			}
-		} else {
+	if !cacheLookup(cacheKey, &result) {
+		prompt := config.Prompts.Render(PromptURLSummary, PromptData{URL: url, Content: htmlContent})
+		if err := generateStructured(config, prompt, urlSummaryOutputSchema, &result); err != nil {
 			return &models.URLSummary{}, err
 		}
+		cacheStore(cacheKey, result)
 	}
 
 	return &models.URLSummary{
@@ -670,75 +694,226 @@ Respond with ONLY valid JSON:
 	}, nil
 }
 
-// GenerateWeeklyDigestWithProvider creates a summary of the week's memories
-func GenerateWeeklyDigestWithProvider(memories []models.Memory, config *AIProviderConfig) (string, error) {
-	if config == nil || config.BaseURL == "" || config.APIKey == "" || config.Model == "" {
-		return "", fmt.Errorf("AI not configured")
+// GenerateDigestWithProvider creates a summary of a period's memories and todo
+// activity. Todos are always included; memories that don't fit the model's context
+// window are summarised, truncated or left out, oldest first; the report says which.
+func GenerateDigestWithProvider(memories []models.Memory, todos []models.DigestTodoGroup, period models.DigestPeriod, config *AIProviderConfig) (string, models.ContextReport, error) {
+	if !config.IsUsable() {
+		return "", models.ContextReport{}, fmt.Errorf("AI not configured")
+	}
+
+	if len(memories) == 0 && len(todos) == 0 {
+		return fmt.Sprintf("No memories or todo activity this %s.", digestPeriodNoun(period)), models.ContextReport{}, nil
 	}
 
-	if len(memories) == 0 {
-		return "No memories recorded this week.", nil
+	prompt, report := digestPrompt(memories, todos, period, config)
+	if len(report.Dropped) > 0 || len(report.Truncated) > 0 || len(report.Summarized) > 0 {
+		log.Printf("[AI] %s digest over budget (%d tokens): dropped=%d truncated=%d summarized=%d",
+			period, report.Budget, len(report.Dropped), len(report.Truncated), len(report.Summarized))
 	}
 
-	// Build memory list for the prompt
-	var memoryList strings.Builder
+	respContent, err := callProvider(config, prompt)
+	if err != nil {
+		return "", report, err
+	}
+
+	return strings.TrimSpace(respContent), report, nil
+}
+
+// digestPrompt renders the digest prompt with the period's todo activity and as
+// many of its memories as the model's context window allows, preferring the most recent
+func digestPrompt(memories []models.Memory, todos []models.DigestTodoGroup, period models.DigestPeriod, config *AIProviderConfig) (string, models.ContextReport) {
+	data := PromptData{Period: digestPeriodNoun(period), Todos: promptTodoGroups(todos)}
+	budget := NewPromptBudget(config)
+	budget.Reserve(config.Prompts.Render(PromptWeeklyDigest, data))
+
+	var report models.ContextReport
+	data.Memories, report = fitDigestMemories(budget, memories, func(_ string, m models.Memory) string {
+		return fmt.Sprintf("- [%s] ", m.Category)
+	})
+
+	return config.Prompts.Render(PromptWeeklyDigest, data), report
+}
+
+// fitDigestMemories spends the budget on as many memories as fit, most recent
+// first. prefix is the template's line prefix for a memory, so it's counted.
+// Memories keep their order and their refs (M1, M2, ...) from the full list.
+func fitDigestMemories(budget *PromptBudget, memories []models.Memory, prefix func(ref string, m models.Memory) string) ([]PromptMemory, models.ContextReport) {
+	byRef := make(map[string]models.Memory, len(memories))
+	prefixes := make(map[string]string, len(memories))
+	items := make([]ContextItem, len(memories))
 	for i, m := range memories {
-		if i >= 30 { // Limit to 30 memories to avoid token limits
-			break
+		ref := digestMemoryRef(i)
+		byRef[ref] = m
+		prefixes[ref] = prefix(ref, m)
+		items[i] = ContextItem{
+			ID:    ref,
+			Label: truncateText(m.Content, 60),
+			Text:  prefixes[ref] + m.Content,
+			Score: float64(m.CreatedAt.Unix()),
+		}
+		if m.Summary != nil && *m.Summary != "" {
+			items[i].Summary = prefixes[ref] + *m.Summary
 		}
-		memoryList.WriteString(fmt.Sprintf("- [%s] %s\n", m.Category, m.Content))
 	}
 
-	prompt := fmt.Sprintf(`You are a personal assistant reviewing someone's weekly memories/notes.
+	fitted, report := budget.Fit(items, 0)
 
-Here are the memories from this week:
-%s
+	memoryList := make([]PromptMemory, len(fitted))
+	for i, item := range fitted {
+		memoryList[i] = PromptMemory{
+			Ref:      item.ID,
+			Category: byRef[item.ID].Category,
+			Content:  strings.TrimPrefix(item.Text, prefixes[item.ID]),
+		}
+	}
+	return memoryList, report
+}
 
-Create a brief, friendly weekly digest that:
-1. Highlights interesting patterns or themes
-2. Mentions standout items worth revisiting
-3. Notes any categories that were particularly active
-4. Keeps a conversational, helpful tone
+// digestMemoryRef is how digest prompts refer to the i-th memory of a period
+func digestMemoryRef(i int) string {
+	return fmt.Sprintf("M%d", i+1)
+}
 
-Keep the digest to 3-4 short paragraphs. Be specific and reference actual items.`, memoryList.String())
+// digestTokens counts the tokens a digest of every memory needs, answer included
+func digestTokens(memories []models.Memory, todos []models.DigestTodoGroup, period models.DigestPeriod, config *AIProviderConfig) int {
+	memoryList := make([]PromptMemory, len(memories))
+	for i, m := range memories {
+		memoryList[i] = PromptMemory{Category: m.Category, Content: m.Content}
+	}
+	prompt := config.Prompts.Render(PromptWeeklyDigest, PromptData{
+		Period:   digestPeriodNoun(period),
+		Memories: memoryList,
+		Todos:    promptTodoGroups(todos),
+	})
+	return tokenizerForModel(config.Model).CountTokens(prompt) + responseReserveTokens
+}
 
-	var respContent string
-	var err error
+// promptTodoGroups flattens a digest's todo sections for prompt templates, one
+// line per todo with everything that happened to it. Refs (T1, T2, ...) follow
+// the order todos first appear in.
+func promptTodoGroups(groups []models.DigestTodoGroup) []PromptTodoGroup {
+	result := make([]PromptTodoGroup, 0, len(groups))
+	ref := 0
+	for _, group := range groups {
+		promptGroup := PromptTodoGroup{Name: group.Name}
+		byID := make(map[string]int)
+		add := func(todo models.DigestTodo, activity string) {
+			if i, ok := byID[todo.ID]; ok {
+				promptGroup.Todos[i].Activity += ", " + activity
+				return
+			}
+			ref++
+			byID[todo.ID] = len(promptGroup.Todos)
+			promptGroup.Todos = append(promptGroup.Todos, PromptTodo{
+				Ref:      fmt.Sprintf("T%d", ref),
+				ID:       todo.ID,
+				Title:    todo.Title,
+				Activity: activity,
+			})
+		}
+		for _, todo := range group.Created {
+			add(todo, "added")
+		}
+		for _, todo := range group.Completed {
+			add(todo, "completed")
+		}
+		for _, todo := range group.Overdue {
+			activity := "overdue"
+			if todo.DueDate != nil {
+				if day, ok := dueDay(*todo.DueDate); ok {
+					activity += ", due " + day
+				}
+			}
+			add(todo, activity)
+		}
+		result = append(result, promptGroup)
+	}
+	return result
+}
 
-	switch config.ProviderType {
-	case models.ProviderTypeAnthropic:
-		respContent, err = callAnthropic(config, prompt)
-	case models.ProviderTypeGoogle:
-		respContent, err = callGoogle(config, prompt)
-	default:
-		respContent, err = callOpenAICompatible(config, prompt)
+type digestInsightsResult struct {
+	Insights []struct {
+		Text     string   `json:"text"`
+		Memories []string `json:"memories"`
+		Todos    []string `json:"todos"`
+	} `json:"insights"`
+}
+
+// maxDigestInsights caps how many insights a digest keeps
+const maxDigestInsights = 3
+
+// GenerateDigestInsightsWithProvider asks the model for observations linking a
+// period's memories and todos. Insights refer to items by prompt ref, which are
+// mapped back to IDs; refs the model made up are dropped.
+func GenerateDigestInsightsWithProvider(memories []models.Memory, todos []models.DigestTodoGroup, period models.DigestPeriod, config *AIProviderConfig) ([]models.DigestInsight, error) {
+	if !config.IsUsable() {
+		return nil, fmt.Errorf("AI not configured")
+	}
+	// Insights connect the two, so both are needed
+	if len(memories) == 0 || len(todos) == 0 {
+		return []models.DigestInsight{}, nil
 	}
 
-	if err != nil {
-		return "", err
+	data := PromptData{Period: digestPeriodNoun(period), Todos: promptTodoGroups(todos)}
+	budget := NewPromptBudget(config)
+	budget.Reserve(config.Prompts.Render(PromptDigestInsights, data))
+	data.Memories, _ = fitDigestMemories(budget, memories, func(ref string, m models.Memory) string {
+		return fmt.Sprintf("- %s [%s] ", ref, m.Category)
+	})
+
+	var result digestInsightsResult
+	if err := generateStructured(config, config.Prompts.Render(PromptDigestInsights, data), digestInsightsOutputSchema, &result); err != nil {
+		return nil, err
 	}
 
-	return strings.TrimSpace(respContent), nil
+	memoryIDs := make(map[string]string, len(memories))
+	for i, m := range memories {
+		memoryIDs[digestMemoryRef(i)] = m.ID
+	}
+	todoIDs := make(map[string]string)
+	for _, group := range data.Todos {
+		for _, todo := range group.Todos {
+			todoIDs[todo.Ref] = todo.ID
+		}
+	}
+
+	insights := []models.DigestInsight{}
+	for _, raw := range result.Insights {
+		text := strings.TrimSpace(raw.Text)
+		if text == "" {
+			continue
+		}
+		insights = append(insights, models.DigestInsight{
+			Text:      text,
+			MemoryIDs: resolveDigestRefs(raw.Memories, memoryIDs),
+			TodoIDs:   resolveDigestRefs(raw.Todos, todoIDs),
+		})
+		if len(insights) == maxDigestInsights {
+			break
+		}
+	}
+	return insights, nil
 }
 
-func parseAIResponse(originalTitle, content string) (*AIProcessedTodo, error) {
-	// Try to parse the JSON response
-	var result aiResult
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		// If JSON parsing fails, try to extract JSON from the response
-		start := strings.Index(content, "{")
-		end := strings.LastIndex(content, "}")
-		if start != -1 && end != -1 && end > start {
-			jsonStr := content[start : end+1]
-			if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, fmt.Errorf("invalid AI response format")
+// resolveDigestRefs maps prompt refs such as "M2" to IDs, skipping unknown and repeated refs
+func resolveDigestRefs(refs []string, ids map[string]string) []string {
+	resolved := []string{}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		id, ok := ids[strings.ToUpper(strings.TrimSpace(ref))]
+		if !ok || seen[id] {
+			continue
 		}
+		seen[id] = true
+		resolved = append(resolved, id)
 	}
+	return resolved
+}
 
-	// Validate and clean the result
+// parseAIResponse normalizes a schema-validated todo result
+func parseAIResponse(originalTitle string, result aiResult) *AIProcessedTodo {
+	// Clean the result
 	if result.Title == "" {
 		result.Title = originalTitle
 	}
@@ -761,7 +936,7 @@ func parseAIResponse(originalTitle, content string) (*AIProcessedTodo, error) {
 	return &AIProcessedTodo{
 		Title: result.Title,
 		Tags:  cleanedTags,
-	}, nil
+	}
 }
 
 // ========================================
@@ -782,23 +957,41 @@ type WebSearchFunctionResult struct {
 	Category string `json:"category"`
 }
 
+// buildFunctionCallingPrompt builds the user prompt for memory function calling
+func buildFunctionCallingPrompt(config *AIProviderConfig, content string) string {
+	return config.Prompts.Render(PromptMemoryFunctionCalling, PromptData{Content: content})
+}
+
+// callWithTools makes a function calling request using the provider's native tool format
+// and returns the tool calls normalized to the OpenAI-compatible ToolCall shape
+func callWithTools(config *AIProviderConfig, content string, tools []Tool) ([]ToolCall, error) {
+	switch config.ProviderType {
+	case models.ProviderTypeMock:
+		return callMockWithTools(config, content)
+	case models.ProviderTypeAnthropic:
+		return callAnthropicWithTools(config, content, tools)
+	case models.ProviderTypeGoogle:
+		return callGoogleWithTools(config, content, tools)
+	default:
+		resp, err := callOpenAIWithTools(config, content, tools)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("no response from AI")
+		}
+		return resp.Choices[0].Message.ToolCalls, nil
+	}
+}
+
 // callOpenAIWithTools makes an API call with function calling enabled
 func callOpenAIWithTools(config *AIProviderConfig, content string, tools []Tool) (*chatResponseWithTools, error) {
 	reqBody := chatRequestWithTools{
 		Model: config.Model,
 		Messages: []chatMessage{
 			{
-				Role: "user",
-				Content: fmt.Sprintf(`Analyze this memory/note and take the appropriate action.
-
-Content: "%s"
-
-Instructions:
-1. If the content indicates the user wants to search/research something (e.g., "search about X", "find info on Y", "look up Z", "what is X", "research about W"), use the web_search function with the extracted search query.
-2. If the content contains a URL (http/https), use categorize_memory with has_url=true and include the URL.
-3. Otherwise, use categorize_memory to categorize the note with a summary and category.
-
-Choose the most appropriate function based on the content.`, content),
+				Role:    "user",
+				Content: buildFunctionCallingPrompt(config, content),
 			},
 		},
 		Tools:       tools,
@@ -822,7 +1015,9 @@ Choose the most appropriate function based on the content.`, content),
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -849,64 +1044,245 @@ Choose the most appropriate function based on the content.`, content),
 	return &chatResp, nil
 }
 
-// ProcessMemoryWithFunctionCalling uses OpenAI-compatible function calling for a 2-step AI process
+// toAnthropicTools translates OpenAI-style tools to Anthropic's tools format
+func toAnthropicTools(tools []Tool) []anthropicTool {
+	result := make([]anthropicTool, 0, len(tools))
+	for _, t := range tools {
+		result = append(result, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: t.Function.Parameters,
+		})
+	}
+	return result
+}
+
+// callAnthropicWithTools makes a Messages API call with native tool use enabled
+func callAnthropicWithTools(config *AIProviderConfig, content string, tools []Tool) ([]ToolCall, error) {
+	reqBody := anthropicRequestWithTools{
+		Model:     config.Model,
+		MaxTokens: 500,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: buildFunctionCallingPrompt(config, content)},
+		},
+		Tools:      toAnthropicTools(tools),
+		ToolChoice: &anthropicToolChoice{Type: "auto"},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(config.BaseURL, "/") + "/messages"
+	log.Printf("[AI-FunctionCall] >>> Anthropic request URL: %s", url)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", config.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("[AI-FunctionCall] !!! HTTP error: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("[AI-FunctionCall] <<< Anthropic response status: %d", resp.StatusCode)
+	log.Printf("[AI-FunctionCall] <<< Anthropic response body: %s", string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Anthropic API error: %s - %s", resp.Status, string(body))
+	}
+
+	var anthropicResp anthropicResponseWithTools
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return nil, err
+	}
+
+	var toolCalls []ToolCall
+	for _, block := range anthropicResp.Content {
+		if block.Type != "tool_use" {
+			continue
+		}
+		toolCall := ToolCall{ID: block.ID, Type: "function"}
+		toolCall.Function.Name = block.Name
+		toolCall.Function.Arguments = string(block.Input)
+		toolCalls = append(toolCalls, toolCall)
+	}
+
+	return toolCalls, nil
+}
+
+// toGoogleTools translates OpenAI-style tools to Gemini functionDeclarations
+func toGoogleTools(tools []Tool) []googleTool {
+	declarations := make([]googleFunctionDeclaration, 0, len(tools))
+	for _, t := range tools {
+		declarations = append(declarations, googleFunctionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  t.Function.Parameters,
+		})
+	}
+	return []googleTool{{FunctionDeclarations: declarations}}
+}
+
+// callGoogleWithTools makes a generateContent call with native function calling enabled
+func callGoogleWithTools(config *AIProviderConfig, content string, tools []Tool) ([]ToolCall, error) {
+	reqBody := googleRequestWithTools{
+		Contents: []googleContent{
+			{
+				Parts: []googlePart{
+					{Text: buildFunctionCallingPrompt(config, content)},
+				},
+			},
+		},
+		Tools: toGoogleTools(tools),
+		ToolConfig: &googleToolConfig{
+			FunctionCallingConfig: googleFunctionCallingConfig{Mode: "AUTO"},
+		},
+		GenerationConfig: googleGenConfig{
+			MaxOutputTokens: 500,
+			Temperature:     0.3,
+		},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s",
+		strings.TrimSuffix(config.BaseURL, "/"),
+		config.Model,
+		config.APIKey,
+	)
+	log.Printf("[AI-FunctionCall] >>> Google request model: %s", config.Model)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("[AI-FunctionCall] !!! HTTP error: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	log.Printf("[AI-FunctionCall] <<< Google response status: %d", resp.StatusCode)
+	log.Printf("[AI-FunctionCall] <<< Google response body: %s", string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Google API error: %s - %s", resp.Status, string(body))
+	}
+
+	var googleResp googleResponseWithTools
+	if err := json.Unmarshal(body, &googleResp); err != nil {
+		return nil, err
+	}
+
+	if len(googleResp.Candidates) == 0 {
+		return nil, fmt.Errorf("no response from Google")
+	}
+
+	var toolCalls []ToolCall
+	for i, part := range googleResp.Candidates[0].Content.Parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+		args := string(part.FunctionCall.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		// Gemini doesn't return call IDs, so synthesize one per part
+		toolCall := ToolCall{ID: fmt.Sprintf("call_%d", i), Type: "function"}
+		toolCall.Function.Name = part.FunctionCall.Name
+		toolCall.Function.Arguments = args
+		toolCalls = append(toolCalls, toolCall)
+	}
+
+	return toolCalls, nil
+}
+
+// callProvider sends a single prompt to the configured provider and returns the text response
+func callProvider(config *AIProviderConfig, prompt string) (string, error) {
+	switch config.ProviderType {
+	case models.ProviderTypeMock:
+		return callMock(config, prompt)
+	case models.ProviderTypeAnthropic:
+		return callAnthropic(config, prompt)
+	case models.ProviderTypeGoogle:
+		return callGoogle(config, prompt)
+	default:
+		return callOpenAICompatible(config, prompt)
+	}
+}
+
+// ProcessMemoryWithFunctionCalling uses native function calling (OpenAI, Anthropic or Gemini) for a 2-step AI process
 // Step 1: AI analyzes content, returns category/summary and detects URLs
 // Step 2: If URL detected, scrape and summarize with scraped content
 func ProcessMemoryWithFunctionCalling(content string, config *AIProviderConfig, scraper *ScraperService) (*models.AIProcessedMemory, *models.URLSummary, error) {
-	if config == nil || config.BaseURL == "" || config.APIKey == "" || config.Model == "" {
+	if !config.IsUsable() {
 		log.Printf("[AI-FunctionCall] Skipping - no valid config")
 		return &models.AIProcessedMemory{Category: "Uncategorized"}, nil, nil
 	}
 
 	log.Printf("[AI-FunctionCall] Processing memory with function calling: %q", content)
 
-	// Step 1: Call AI with function calling to get category and detect URL
-	resp, err := callOpenAIWithTools(config, content, memoryProcessingTools)
-	if err != nil {
-		log.Printf("[AI-FunctionCall] Error: %v", err)
-		// Fall back to regular processing
-		fallback, _ := ProcessMemoryWithProvider(content, config)
-		return fallback, nil, nil
-	}
-
-	if len(resp.Choices) == 0 {
-		log.Printf("[AI-FunctionCall] No choices in response")
-		return &models.AIProcessedMemory{Category: "Uncategorized"}, nil, nil
+	// Step 1: Call AI with function calling to get category and detect URL.
+	// The tool call used is cached once its arguments validate; scraping and
+	// web search below always run fresh.
+	cacheKey := responseCacheKey(PromptMemoryFunctionCalling, config, content)
+	var toolCalls []ToolCall
+	cached := cacheLookup(cacheKey, &toolCalls)
+	if cached {
+		log.Printf("[AI-FunctionCall] Using cached tool calls")
+	} else {
+		var err error
+		toolCalls, err = callWithTools(config, content, memoryProcessingTools)
+		if err != nil {
+			log.Printf("[AI-FunctionCall] Error: %v", err)
+			// Fall back to regular processing
+			fallback, _ := ProcessMemoryWithProvider(content, config)
+			return fallback, nil, nil
+		}
 	}
 
-	choice := resp.Choices[0]
-
 	// Check if we got tool calls
-	if len(choice.Message.ToolCalls) == 0 {
+	if len(toolCalls) == 0 {
 		log.Printf("[AI-FunctionCall] No tool calls, falling back to regular processing")
 		fallback, _ := ProcessMemoryWithProvider(content, config)
 		return fallback, nil, nil
 	}
 
-	// Validate category helper
-	validCategories := map[string]bool{
-		"Websites": true, "Food": true, "Movies": true, "Books": true,
-		"Ideas": true, "Places": true, "Products": true, "People": true,
-		"Learnings": true, "Quotes": true, "Uncategorized": true,
-	}
-
 	var memoryResult *models.AIProcessedMemory
 	var urlSummary *models.URLSummary
+	var validCall ToolCall
 
 	// Process tool calls
-	for _, toolCall := range choice.Message.ToolCalls {
+	for _, toolCall := range toolCalls {
 		switch toolCall.Function.Name {
 		case "categorize_memory":
 			log.Printf("[AI-FunctionCall] Got categorize_memory call: %s", toolCall.Function.Arguments)
 			var result FunctionCallResult
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &result); err != nil {
-				log.Printf("[AI-FunctionCall] Failed to parse function arguments: %v", err)
+			if err := decodeToolArguments(config, toolCall, memoryProcessingTools, &result); err != nil {
+				log.Printf("[AI-FunctionCall] Invalid function arguments: %v", err)
 				continue
 			}
-
-			if !validCategories[result.Category] {
-				result.Category = "Uncategorized"
-			}
+			validCall = toolCall
 
 			memoryResult = &models.AIProcessedMemory{
 				Summary:  result.Summary,
@@ -935,14 +1311,11 @@ func ProcessMemoryWithFunctionCalling(content string, config *AIProviderConfig,
 		case "web_search":
 			log.Printf("[AI-FunctionCall] Got web_search call: %s", toolCall.Function.Arguments)
 			var searchArgs WebSearchFunctionResult
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &searchArgs); err != nil {
-				log.Printf("[AI-FunctionCall] Failed to parse web_search arguments: %v", err)
+			if err := decodeToolArguments(config, toolCall, memoryProcessingTools, &searchArgs); err != nil {
+				log.Printf("[AI-FunctionCall] Invalid web_search arguments: %v", err)
 				continue
 			}
-
-			if !validCategories[searchArgs.Category] {
-				searchArgs.Category = "Learnings" // Default to Learnings for search results
-			}
+			validCall = toolCall
 
 			memoryResult = &models.AIProcessedMemory{
 				Category: searchArgs.Category,
@@ -970,7 +1343,7 @@ func ProcessMemoryWithFunctionCalling(content string, config *AIProviderConfig,
 					summaryPrompt := fmt.Sprintf(`Summarize these search results about "%s" in 2-3 sentences. Be concise and informative:
 
 %s`, searchArgs.Query, rawResults)
-					summary, err := callOpenAICompatible(config, summaryPrompt)
+					summary, err := callProvider(config, summaryPrompt)
 					if err != nil {
 						log.Printf("[AI-FunctionCall] Failed to summarize search results: %v", err)
 						summary = rawResults[:min(500, len(rawResults))]
@@ -1001,10 +1374,15 @@ func ProcessMemoryWithFunctionCalling(content string, config *AIProviderConfig,
 		}
 	}
 
-	// Fallback if no valid tool call was processed
+	// Fallback to schema-validated processing if no valid tool call was processed
 	if memoryResult == nil {
-		memoryResult = &models.AIProcessedMemory{Category: "Uncategorized"}
+		log.Printf("[AI-FunctionCall] No valid tool call, falling back to regular processing")
+		fallback, _ := ProcessMemoryWithProvider(content, config)
+		return fallback, nil, nil
 	}
 
+	if !cached {
+		cacheStore(cacheKey, []ToolCall{validCall})
+	}
 	return memoryResult, urlSummary, nil
 }
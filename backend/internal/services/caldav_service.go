@@ -0,0 +1,498 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/todomyday/backend/internal/ical"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+var (
+	// ErrPreconditionFailed is returned when a resource's ETag doesn't match
+	// the one a client expects
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrInvalidSyncToken is returned for sync-tokens this server didn't hand out
+	ErrInvalidSyncToken = errors.New("invalid sync token")
+	// ErrResourceName is returned for resources not named after their UID
+	ErrResourceName = errors.New("resource name must be the UID followed by .ics")
+	// ErrUIDConflict is returned when a UID is already used in another collection
+	ErrUIDConflict = errors.New("UID is already used by another todo")
+)
+
+// DAVInbox is the collection of todos without a group
+const DAVInbox = "inbox"
+
+// davSyncTokenPrefix makes change numbers into the URIs sync-tokens must be
+const davSyncTokenPrefix = "urn:memlane:sync:"
+
+// DAVCollection is a calendar of todos: one of the user's groups, or the inbox
+type DAVCollection struct {
+	ID        string
+	Name      string
+	Color     string
+	SyncToken string
+}
+
+// DAVResource is a todo as an iCalendar object holding one VTODO
+type DAVResource struct {
+	Name string
+	ETag string
+	Data []byte
+	todo *models.Todo
+}
+
+// CalDAVService serves todos to CalDAV clients. Changes go through the
+// TodoService, so they're validated and reindexed like any other.
+type CalDAVService struct {
+	davRepo     *repository.DAVRepository
+	userRepo    *repository.UserRepository
+	todoRepo    *repository.TodoRepository
+	groupRepo   *repository.GroupRepository
+	todoService *TodoService
+	publicURL   string
+}
+
+func NewCalDAVService(davRepo *repository.DAVRepository, userRepo *repository.UserRepository, todoRepo *repository.TodoRepository, groupRepo *repository.GroupRepository, todoService *TodoService, publicURL string) *CalDAVService {
+	return &CalDAVService{
+		davRepo:     davRepo,
+		userRepo:    userRepo,
+		todoRepo:    todoRepo,
+		groupRepo:   groupRepo,
+		todoService: todoService,
+		publicURL:   strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// GetCredentials returns the user's CalDAV sign-in without the password, or
+// nil if they haven't created one
+func (s *CalDAVService) GetCredentials(userID string) (*models.DAVCredentials, error) {
+	credentials, err := s.davRepo.GetCredentials(userID)
+	if err != nil || credentials == nil {
+		return nil, err
+	}
+	if err := s.setSignIn(credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// CreatePassword creates an app password for the user, replacing any they
+// had. It is only ever returned here.
+func (s *CalDAVService) CreatePassword(userID string) (*models.DAVCredentials, error) {
+	password := randomHex(16)
+	credentials := &models.DAVCredentials{UserID: userID, PasswordHash: hashDAVPassword(password)}
+	if err := s.davRepo.SaveCredentials(credentials); err != nil {
+		return nil, err
+	}
+	if err := s.setSignIn(credentials); err != nil {
+		return nil, err
+	}
+	credentials.Password = password
+	return credentials, nil
+}
+
+// DeleteCredentials signs out the user's CalDAV clients and reports whether
+// they had a password
+func (s *CalDAVService) DeleteCredentials(userID string) (bool, error) {
+	return s.davRepo.DeleteCredentials(userID)
+}
+
+func (s *CalDAVService) setSignIn(credentials *models.DAVCredentials) error {
+	user, err := s.userRepo.GetByID(credentials.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s not found", credentials.UserID)
+	}
+	credentials.Username = user.Email
+	credentials.URL = s.publicURL + "/caldav/"
+	return nil
+}
+
+// Authenticate returns the user an email and app password belong to, or ""
+// if they don't match
+func (s *CalDAVService) Authenticate(username, password string) (string, error) {
+	user, err := s.userRepo.GetByEmail(username)
+	if err != nil || user == nil {
+		return "", err
+	}
+	credentials, err := s.davRepo.GetCredentials(user.ID)
+	if err != nil || credentials == nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashDAVPassword(password)), []byte(credentials.PasswordHash)) != 1 {
+		return "", nil
+	}
+	return user.ID, nil
+}
+
+// App passwords are random, so a plain hash is enough to keep them secret
+func hashDAVPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetUser returns the user a principal stands for
+func (s *CalDAVService) GetUser(userID string) (*models.User, error) {
+	return s.userRepo.GetByID(userID)
+}
+
+// Collections returns the user's groups as collections, after the inbox
+func (s *CalDAVService) Collections(userID string) ([]DAVCollection, error) {
+	groups, err := s.groupRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	collections := []DAVCollection{{ID: DAVInbox, Name: "Inbox"}}
+	for _, group := range groups {
+		collections = append(collections, DAVCollection{ID: group.ID, Name: group.Name, Color: group.ColorCode})
+	}
+	for i := range collections {
+		seq, err := s.davRepo.GetLatestChange(userID, collectionGroupID(collections[i].ID))
+		if err != nil {
+			return nil, err
+		}
+		collections[i].SyncToken = davSyncTokenPrefix + strconv.FormatInt(seq, 10)
+	}
+	return collections, nil
+}
+
+// Collection returns one of the user's collections, or nil if there's none by that ID
+func (s *CalDAVService) Collection(userID, collectionID string) (*DAVCollection, error) {
+	collections, err := s.Collections(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		if collections[i].ID == collectionID {
+			return &collections[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func collectionGroupID(collectionID string) *string {
+	if collectionID == DAVInbox {
+		return nil
+	}
+	return &collectionID
+}
+
+func inCollection(todo *models.Todo, collectionID string) bool {
+	if todo.GroupID == nil || *todo.GroupID == "" {
+		return collectionID == DAVInbox
+	}
+	return *todo.GroupID == collectionID
+}
+
+// Resources returns the todos in a collection
+func (s *CalDAVService) Resources(userID, collectionID string) ([]DAVResource, error) {
+	todos, todoCal, err := loadTodoCalendar(s.todoRepo, s.groupRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	resources := []DAVResource{}
+	for i := range todos {
+		if inCollection(&todos[i], collectionID) {
+			resource, err := davResource(&todos[i], todoCal)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, *resource)
+		}
+	}
+	return resources, nil
+}
+
+// Resource returns the todo with the given resource name in a collection, or
+// nil if there isn't one
+func (s *CalDAVService) Resource(userID, collectionID, name string) (*DAVResource, error) {
+	todos, todoCal, err := loadTodoCalendar(s.todoRepo, s.groupRepo, userID)
+	if err != nil {
+		return nil, err
+	}
+	todo := findByUID(todos, todoCal, strings.TrimSuffix(name, ".ics"))
+	if todo == nil || !inCollection(todo, collectionID) {
+		return nil, nil
+	}
+	return davResource(todo, todoCal)
+}
+
+func findByUID(todos []models.Todo, todoCal *todoCalendar, uid string) *models.Todo {
+	for i := range todos {
+		if todoCal.uids[todos[i].ID] == uid {
+			return &todos[i]
+		}
+	}
+	return nil
+}
+
+// davResource renders a todo, naming it after its UID and tagging it with a
+// hash of its data
+func davResource(todo *models.Todo, todoCal *todoCalendar) (*DAVResource, error) {
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", calendarProductID)
+	cal.Children = append(cal.Children, todoCal.component(todo, FeedTodos))
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return &DAVResource{
+		Name: todoCal.uids[todo.ID] + ".ics",
+		ETag: `"` + hex.EncodeToString(sum[:16]) + `"`,
+		Data: buf.Bytes(),
+		todo: todo,
+	}, nil
+}
+
+// etagMatches checks an If-Match or If-None-Match header against a resource
+func etagMatches(header string, resource *DAVResource) bool {
+	if resource == nil {
+		return false
+	}
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+		if etag == "*" || etag == resource.ETag {
+			return true
+		}
+	}
+	return false
+}
+
+// Put creates or replaces the todo a client sent as an iCalendar object. The
+// collection decides the todo's group. ifMatch and ifNoneMatch are the
+// request's conditional headers. It reports whether the todo was created.
+func (s *CalDAVService) Put(userID, collectionID, name string, body io.Reader, ifMatch, ifNoneMatch string) (*DAVResource, bool, error) {
+	cal, err := ical.Decode(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+	}
+	entries := cal.ChildrenNamed("VTODO")
+	if cal.Name != "VCALENDAR" || len(entries) != 1 {
+		return nil, false, fmt.Errorf("%w: expected a VCALENDAR with one VTODO", ErrInvalidCalendar)
+	}
+	entry := entries[0]
+	uid := strings.TrimSpace(entry.Text("UID"))
+	if uid == "" || uid+".ics" != name {
+		return nil, false, ErrResourceName
+	}
+
+	todos, todoCal, err := loadTodoCalendar(s.todoRepo, s.groupRepo, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	var current *DAVResource
+	if todo := findByUID(todos, todoCal, uid); todo != nil {
+		if !inCollection(todo, collectionID) {
+			return nil, false, ErrUIDConflict
+		}
+		if current, err = davResource(todo, todoCal); err != nil {
+			return nil, false, err
+		}
+	}
+	if (ifMatch != "" && !etagMatches(ifMatch, current)) || (ifNoneMatch != "" && etagMatches(ifNoneMatch, current)) {
+		return nil, false, ErrPreconditionFailed
+	}
+
+	// Only the collection's group is matched, so its name isn't kept as a tag
+	var groups []models.Group
+	if group, ok := todoCal.groups[collectionID]; ok {
+		groups = append(groups, group)
+	}
+	req, tags, status, err := importedTodoRequest(entry, groups)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+	}
+	req.GroupID = collectionGroupID(collectionID)
+
+	var todo *models.Todo
+	if current == nil {
+		// Subtasks made in clients point to their parent
+		if related := entry.Prop("RELATED-TO"); related != nil {
+			if reltype := related.Param("RELTYPE"); reltype == "" || strings.EqualFold(reltype, "PARENT") {
+				if parent := findByUID(todos, todoCal, strings.TrimSpace(related.Text())); parent != nil {
+					req.ParentID = &parent.ID
+				}
+			}
+		}
+		if todo, err = s.todoService.CreateImported(userID, req, tags, uid); err != nil {
+			return nil, false, err
+		}
+		if status != models.StatusPending {
+			if todo, err = s.todoService.Update(userID, todo.ID, &models.TodoUpdateRequest{Status: &status}); err != nil {
+				return nil, false, err
+			}
+		}
+		log.Printf("[CalDAVService] Created todo %s from %s for user %s", todo.ID, name, userID)
+	} else {
+		update := davUpdateRequest(current, req, tags, status)
+		if todo, err = s.todoService.Update(userID, current.todo.ID, update); err != nil {
+			return nil, false, err
+		}
+	}
+
+	resource, err := s.Resource(userID, collectionID, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if resource == nil {
+		// The todo moved, such as a subtask created in another group's collection
+		return nil, false, fmt.Errorf("todo %s is no longer in collection %s", todo.ID, collectionID)
+	}
+	return resource, current == nil, nil
+}
+
+// davUpdateRequest changes what a client changed in a todo. Clients send the
+// whole todo back, so fields that didn't change are left alone; in
+// particular, a moved due date reschedules reminders and a new status sets
+// off series, blockers and parents.
+func davUpdateRequest(current *DAVResource, req *models.TodoCreateRequest, tags []string, status models.Status) *models.TodoUpdateRequest {
+	todo := current.todo
+	update := &models.TodoUpdateRequest{Tags: tags}
+
+	if req.Title != todo.Title {
+		update.Title = &req.Title
+	}
+	description := ""
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if todo.Description == nil && description != "" || todo.Description != nil && *todo.Description != description {
+		update.Description = &description
+	}
+	if !sameDueDate(todo.DueDate, req.DueDate) {
+		dueDate := ""
+		if req.DueDate != nil {
+			dueDate = *req.DueDate
+		}
+		update.DueDate = &dueDate
+	}
+	if req.Priority != "" && req.Priority != todo.Priority {
+		update.Priority = &req.Priority
+	}
+	// Clients only know NEEDS-ACTION for pending and blocked todos
+	if davStatus(status) != davStatus(todo.Status) {
+		update.Status = &status
+	}
+
+	// Recurrence starts when a client adds a rule and ends when it removes the
+	// one it was given; edits to a rule are left alone, since clients send
+	// back the rule as rewritten for the instance
+	hadRule := bytes.Contains(current.Data, []byte("\r\nRRULE:"))
+	if todo.SeriesID == nil && req.Recurrence != nil {
+		update.Recurrence = req.Recurrence
+	} else if hadRule && req.Recurrence == nil && !status.IsDone() {
+		ended := ""
+		update.Recurrence = &ended
+	}
+	return update
+}
+
+// sameDueDate reports whether a stored due date and one read from a client are
+// the same time, however they're written
+func sameDueDate(stored, sent *string) bool {
+	storedDue, hasStored := parseDueTime(stored)
+	sentDue, hasSent := parseDueTime(sent)
+	if !hasStored || !hasSent {
+		return hasStored == hasSent
+	}
+	return storedDue.Equal(sentDue) && isAllDay(*stored) == isAllDay(*sent)
+}
+
+// davStatus is how a status is written in a VTODO
+func davStatus(status models.Status) string {
+	switch status {
+	case models.StatusCompleted:
+		return "COMPLETED"
+	case models.StatusCancelled:
+		return "CANCELLED"
+	case models.StatusInProgress:
+		return "IN-PROCESS"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// Delete deletes the todo with the given resource name. Deleting the
+// instance of a recurring todo that carries its rule deletes the series.
+func (s *CalDAVService) Delete(userID, collectionID, name, ifMatch string) error {
+	current, err := s.Resource(userID, collectionID, name)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrTodoNotFound
+	}
+	if ifMatch != "" && !etagMatches(ifMatch, current) {
+		return ErrPreconditionFailed
+	}
+
+	scope := models.ScopeInstance
+	if bytes.Contains(current.Data, []byte("\r\nRRULE:")) {
+		scope = models.ScopeSeries
+	}
+	return s.todoService.Delete(userID, current.todo.ID, scope)
+}
+
+// Changes returns the todos changed in a collection since a sync-token, the
+// names of those deleted or moved out of it, and the collection's current
+// token. An empty token returns all the todos in it.
+func (s *CalDAVService) Changes(userID, collectionID, token string) ([]DAVResource, []string, string, error) {
+	groupID := collectionGroupID(collectionID)
+	latest, err := s.davRepo.GetLatestChange(userID, groupID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	newToken := davSyncTokenPrefix + strconv.FormatInt(latest, 10)
+
+	if token == "" {
+		resources, err := s.Resources(userID, collectionID)
+		return resources, []string{}, newToken, err
+	}
+	since, err := strconv.ParseInt(strings.TrimPrefix(token, davSyncTokenPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(token, davSyncTokenPrefix) || since < 0 || since > latest {
+		return nil, nil, "", ErrInvalidSyncToken
+	}
+
+	changes, err := s.davRepo.GetChanges(userID, groupID, since)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	todos, todoCal, err := loadTodoCalendar(s.todoRepo, s.groupRepo, userID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	byID := make(map[string]*models.Todo, len(todos))
+	for i := range todos {
+		byID[todos[i].ID] = &todos[i]
+	}
+
+	resources, deleted := []DAVResource{}, []string{}
+	for _, change := range changes {
+		todo := byID[change.TodoID]
+		if change.Deleted || todo == nil || !inCollection(todo, collectionID) {
+			deleted = append(deleted, change.UID+".ics")
+			continue
+		}
+		resource, err := davResource(todo, todoCal)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		resources = append(resources, *resource)
+	}
+	return resources, deleted, newToken, nil
+}
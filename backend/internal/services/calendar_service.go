@@ -0,0 +1,566 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/ical"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+	"github.com/todomyday/backend/internal/rrule"
+)
+
+var (
+	// ErrCalendarFeedNotFound is returned for feed tokens that don't exist
+	ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+	// ErrInvalidCalendar is returned for uploads that aren't iCalendar data
+	ErrInvalidCalendar = errors.New("invalid iCalendar file")
+)
+
+// FeedKind picks the component todos are published as
+type FeedKind string
+
+const (
+	// FeedEvents publishes VEVENTs, which calendar apps show
+	FeedEvents FeedKind = "events"
+	// FeedTodos publishes VTODOs, which task apps show
+	FeedTodos FeedKind = "todos"
+)
+
+const (
+	// maxImportEntries is how many VTODOs one upload may create
+	maxImportEntries = 1000
+	// calendarProductID identifies the app in iCalendar data
+	calendarProductID = "-//Memlane//Todos//EN"
+	// calendarUIDDomain makes todo IDs globally unique UIDs
+	calendarUIDDomain = "@memlane"
+)
+
+// CalendarService publishes todos as iCalendar feeds and imports them from
+// iCalendar files
+type CalendarService struct {
+	calendarRepo *repository.CalendarRepository
+	todoRepo     *repository.TodoRepository
+	groupRepo    *repository.GroupRepository
+	todoService  *TodoService
+	publicURL    string
+}
+
+func NewCalendarService(calendarRepo *repository.CalendarRepository, todoRepo *repository.TodoRepository, groupRepo *repository.GroupRepository, todoService *TodoService, publicURL string) *CalendarService {
+	return &CalendarService{
+		calendarRepo: calendarRepo,
+		todoRepo:     todoRepo,
+		groupRepo:    groupRepo,
+		todoService:  todoService,
+		publicURL:    strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// GetFeed returns the user's feed, or nil if they haven't created one
+func (s *CalendarService) GetFeed(userID string) (*models.CalendarFeed, error) {
+	feed, err := s.calendarRepo.GetFeed(userID)
+	if err != nil || feed == nil {
+		return nil, err
+	}
+	s.setFeedURLs(feed)
+	return feed, nil
+}
+
+// CreateFeed creates the user's feed, or gives it a new token so the old URL
+// stops working
+func (s *CalendarService) CreateFeed(userID string) (*models.CalendarFeed, error) {
+	feed := &models.CalendarFeed{UserID: userID, Token: randomHex(32)}
+	if err := s.calendarRepo.SaveFeed(feed); err != nil {
+		return nil, err
+	}
+	s.setFeedURLs(feed)
+	return feed, nil
+}
+
+// DeleteFeed turns off the user's feed and reports whether they had one
+func (s *CalendarService) DeleteFeed(userID string) (bool, error) {
+	return s.calendarRepo.DeleteFeed(userID)
+}
+
+func (s *CalendarService) setFeedURLs(feed *models.CalendarFeed) {
+	feed.URL = s.publicURL + "/api/calendar/ics/" + url.PathEscape(feed.Token) + ".ics"
+	feed.TodosURL = feed.URL + "?type=" + string(FeedTodos)
+}
+
+// Feed renders the todos with due dates of the feed's user as an iCalendar
+// file. groupID, if set, limits it to one of the user's groups and names the
+// calendar after it.
+func (s *CalendarService) Feed(token string, kind FeedKind, groupID string) ([]byte, error) {
+	feed, err := s.calendarRepo.GetFeedByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if feed == nil {
+		return nil, ErrCalendarFeedNotFound
+	}
+
+	todos, todoCal, err := loadTodoCalendar(s.todoRepo, s.groupRepo, feed.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", calendarProductID)
+	cal.Add("CALSCALE", "GREGORIAN")
+	cal.Add("METHOD", "PUBLISH")
+	name := "Memlane"
+	if groupID != "" {
+		group, ok := todoCal.groups[groupID]
+		if !ok {
+			return nil, ErrCalendarFeedNotFound
+		}
+		name += " – " + group.Name
+		cal.Add("X-APPLE-CALENDAR-COLOR", group.ColorCode)
+		cal.Add("COLOR", cssColorName(group.ColorCode))
+	}
+	cal.AddText("NAME", name)
+	cal.AddText("X-WR-CALNAME", name)
+	cal.Add("REFRESH-INTERVAL", "PT1H", "VALUE", "DURATION")
+	cal.Add("X-PUBLISHED-TTL", "PT1H")
+
+	for i := range todos {
+		todo := &todos[i]
+		if _, ok := parseDueTime(todo.DueDate); !ok || (groupID != "" && (todo.GroupID == nil || *todo.GroupID != groupID)) {
+			continue
+		}
+		cal.Children = append(cal.Children, todoCal.component(todo, kind))
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// todoCalendar is what rendering a user's todos takes besides the todos
+type todoCalendar struct {
+	groups map[string]models.Group
+	uids   map[string]string // by todo ID
+	series map[string]*models.TodoSeries
+	// carriers maps each series to the open instance that carries its rule,
+	// the one with the earliest occurrence
+	carriers map[string]string
+}
+
+// loadTodoCalendar loads all of a user's todos and what rendering them takes
+func loadTodoCalendar(todoRepo *repository.TodoRepository, groupRepo *repository.GroupRepository, userID string) ([]models.Todo, *todoCalendar, error) {
+	groups, err := groupRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	todos, err := todoRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	seriesList, err := todoRepo.GetSeriesByUserID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	todoCal := &todoCalendar{
+		groups:   make(map[string]models.Group, len(groups)),
+		uids:     make(map[string]string, len(todos)),
+		series:   make(map[string]*models.TodoSeries, len(seriesList)),
+		carriers: make(map[string]string),
+	}
+	for _, group := range groups {
+		todoCal.groups[group.ID] = group
+	}
+	for i := range seriesList {
+		todoCal.series[seriesList[i].ID] = &seriesList[i]
+	}
+	byID := make(map[string]*models.Todo, len(todos))
+	for i := range todos {
+		todo := &todos[i]
+		byID[todo.ID] = todo
+		todoCal.uids[todo.ID] = todoUID(todo)
+		if todo.SeriesID == nil || todo.Occurrence == nil || todo.Status.IsDone() {
+			continue
+		}
+		carrier := byID[todoCal.carriers[*todo.SeriesID]]
+		if carrier == nil || *todo.Occurrence < *carrier.Occurrence || (*todo.Occurrence == *carrier.Occurrence && todo.ID < carrier.ID) {
+			todoCal.carriers[*todo.SeriesID] = todo.ID
+		}
+	}
+	return todos, todoCal, nil
+}
+
+// component renders a todo with its parent and, if it carries its series'
+// rule, its recurrence
+func (c *todoCalendar) component(todo *models.Todo, kind FeedKind) *ical.Component {
+	parentUID := ""
+	if todo.ParentID != nil {
+		parentUID = c.uids[*todo.ParentID]
+	}
+	component := todoComponent(todo, kind, c.groups, parentUID)
+	if todo.SeriesID != nil && c.carriers[*todo.SeriesID] == todo.ID {
+		if todoSeries := c.series[*todo.SeriesID]; todoSeries != nil {
+			addRecurrence(component, todo, todoSeries, kind)
+		}
+	}
+	return component
+}
+
+// todoUID returns the UID a todo is published under: the one it was imported
+// with, or one made from its ID
+func todoUID(todo *models.Todo) string {
+	if todo.ICalUID != nil {
+		return *todo.ICalUID
+	}
+	return todo.ID + calendarUIDDomain
+}
+
+// isAllDay reports whether a due date has no time of day. Dates read back
+// from the DATETIME column come out as UTC midnight.
+func isAllDay(dueDate string) bool {
+	return len(dueDate) == len("2006-01-02") || strings.HasSuffix(dueDate, "T00:00:00Z")
+}
+
+// todoComponent renders a todo as a VTODO or VEVENT. Events need a due date.
+// parentUID links subtasks to their parent in VTODOs.
+func todoComponent(todo *models.Todo, kind FeedKind, groups map[string]models.Group, parentUID string) *ical.Component {
+
+	var c *ical.Component
+	if kind == FeedTodos {
+		c = ical.NewComponent("VTODO")
+	} else {
+		c = ical.NewComponent("VEVENT")
+	}
+	c.Add("UID", todoUID(todo))
+	c.AddDateTime("DTSTAMP", todo.UpdatedAt)
+	c.AddDateTime("CREATED", todo.CreatedAt)
+	c.AddDateTime("LAST-MODIFIED", todo.UpdatedAt)
+	c.AddText("SUMMARY", todo.Title)
+	if todo.Description != nil && *todo.Description != "" {
+		c.AddText("DESCRIPTION", *todo.Description)
+	}
+
+	if due, ok := parseDueTime(todo.DueDate); ok {
+		dueProp := "DTSTART"
+		if kind == FeedTodos {
+			dueProp = "DUE"
+		}
+		if isAllDay(*todo.DueDate) {
+			c.AddDate(dueProp, due)
+		} else {
+			c.AddDateTime(dueProp, due)
+		}
+	}
+
+	switch todo.Priority {
+	case models.PriorityHigh:
+		c.Add("PRIORITY", "1")
+	case models.PriorityMedium:
+		c.Add("PRIORITY", "5")
+	case models.PriorityLow:
+		c.Add("PRIORITY", "9")
+	}
+
+	categories := []string{}
+	if todo.GroupID != nil {
+		if group, ok := groups[*todo.GroupID]; ok {
+			categories = append(categories, group.Name)
+			c.Add("COLOR", cssColorName(group.ColorCode))
+		}
+	}
+	categories = append(categories, todo.Tags...)
+	if len(categories) > 0 {
+		c.Add("CATEGORIES", ical.JoinList(categories))
+	}
+
+	if kind == FeedTodos {
+		switch todo.Status {
+		case models.StatusCompleted:
+			c.Add("STATUS", "COMPLETED")
+			if todo.CompletedAt != nil {
+				c.AddDateTime("COMPLETED", *todo.CompletedAt)
+			}
+		case models.StatusCancelled:
+			c.Add("STATUS", "CANCELLED")
+		case models.StatusInProgress:
+			c.Add("STATUS", "IN-PROCESS")
+		default:
+			c.Add("STATUS", "NEEDS-ACTION")
+		}
+		if parentUID != "" {
+			c.Add("RELATED-TO", parentUID, "RELTYPE", "PARENT")
+		}
+	} else {
+		if todo.Status == models.StatusCancelled {
+			c.Add("STATUS", "CANCELLED")
+		} else {
+			c.Add("STATUS", "CONFIRMED")
+		}
+		// Todos don't make the user busy
+		c.Add("TRANSP", "TRANSPARENT")
+	}
+
+	return c
+}
+
+// addRecurrence adds the series' rule to its open instance, starting from the
+// instance: COUNT becomes the occurrences left, and skipped occurrences after
+// it become EXDATEs. It adds nothing if the series has nothing left to repeat.
+func addRecurrence(c *ical.Component, todo *models.Todo, series *models.TodoSeries, kind FeedKind) {
+	rule, err := rrule.Parse(series.RRule)
+	if err != nil || todo.Occurrence == nil {
+		return
+	}
+	occurrence, err := time.Parse("2006-01-02", *todo.Occurrence)
+	if err != nil {
+		return
+	}
+	dtstart, err := time.Parse("2006-01-02", series.DTStart)
+	if err != nil {
+		return
+	}
+	due, ok := parseDueTime(todo.DueDate)
+	if !ok {
+		return
+	}
+	if rule.Count > 0 {
+		rule.Count -= len(rule.Between(dtstart, dtstart, occurrence.AddDate(0, 0, -1), 0))
+		if rule.Count <= 1 {
+			return
+		}
+	}
+
+	allDay := isAllDay(*todo.DueDate)
+	// Timed occurrences repeat at the instance's time in UTC, which may fall on
+	// the day before or after the occurrence's own date
+	at := func(day time.Time) string {
+		if allDay {
+			return day.Format("20060102")
+		}
+		shift := int(time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, time.UTC).Sub(occurrence).Hours() / 24)
+		return time.Date(day.Year(), day.Month(), day.Day()+shift, due.Hour(), due.Minute(), due.Second(), 0, time.UTC).Format("20060102T150405Z")
+	}
+
+	until := rule.Until
+	rule.Until = time.Time{}
+	value := rule.String()
+	if !until.IsZero() {
+		value += ";UNTIL=" + at(until)
+	}
+
+	// RFC 5545 requires DTSTART on recurring VTODOs
+	if kind == FeedTodos {
+		if allDay {
+			c.AddDate("DTSTART", due)
+		} else {
+			c.AddDateTime("DTSTART", due)
+		}
+	}
+	c.Add("RRULE", value)
+
+	for _, exdate := range series.ExDates {
+		day, err := time.Parse("2006-01-02", exdate)
+		if err != nil || !day.After(occurrence) {
+			continue
+		}
+		if allDay {
+			c.Add("EXDATE", at(day), "VALUE", "DATE")
+		} else {
+			c.Add("EXDATE", at(day))
+		}
+	}
+}
+
+// cssColors are the CSS color names iCalendar's COLOR property may use that
+// are closest to the group colors people pick
+var cssColors = map[string][3]int{
+	"red": {255, 0, 0}, "crimson": {220, 20, 60}, "orange": {255, 165, 0}, "gold": {255, 215, 0},
+	"yellow": {255, 255, 0}, "limegreen": {50, 205, 50}, "green": {0, 128, 0}, "mediumseagreen": {60, 179, 113},
+	"teal": {0, 128, 128}, "turquoise": {64, 224, 208}, "dodgerblue": {30, 144, 255}, "royalblue": {65, 105, 225},
+	"blue": {0, 0, 255}, "slateblue": {106, 90, 205}, "blueviolet": {138, 43, 226}, "purple": {128, 0, 128},
+	"orchid": {218, 112, 214}, "hotpink": {255, 105, 180}, "deeppink": {255, 20, 147}, "sienna": {160, 82, 45},
+	"gray": {128, 128, 128}, "black": {0, 0, 0},
+}
+
+// cssColorName returns the CSS color name nearest a "#RRGGBB" color, since
+// iCalendar's COLOR takes names only
+func cssColorName(hex string) string {
+	value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	if err != nil || len(strings.TrimPrefix(hex, "#")) != 6 {
+		return "gray"
+	}
+	r, g, b := int(value>>16), int(value>>8&0xff), int(value&0xff)
+
+	best, bestDistance := "gray", -1
+	for name, rgb := range cssColors {
+		dr, dg, db := r-rgb[0], g-rgb[1], b-rgb[2]
+		distance := dr*dr + dg*dg + db*db
+		if bestDistance < 0 || distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// Import creates todos from the VTODOs in an iCalendar file. Entries already
+// imported, by UID, are skipped, as are ones that can't be read.
+func (s *CalendarService) Import(userID string, r io.Reader) (*models.CalendarImportResult, error) {
+	cal, err := ical.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCalendar, err)
+	}
+	if cal.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%w: expected a VCALENDAR, got %s", ErrInvalidCalendar, cal.Name)
+	}
+
+	groups, err := s.groupRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.CalendarImportResult{Todos: []models.Todo{}, Skipped: []models.CalendarImportSkip{}}
+	seen := make(map[string]bool)
+	for i, entry := range cal.ChildrenNamed("VTODO") {
+		uid := strings.TrimSpace(entry.Text("UID"))
+		skip := func(reason string) {
+			result.Skipped = append(result.Skipped, models.CalendarImportSkip{UID: uid, Summary: entry.Text("SUMMARY"), Reason: reason})
+		}
+
+		if i >= maxImportEntries {
+			skip(fmt.Sprintf("only %d entries are imported at a time", maxImportEntries))
+			continue
+		}
+		if uid != "" {
+			existing, err := s.todoRepo.GetByICalUID(userID, uid)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil || seen[uid] {
+				skip("already imported")
+				continue
+			}
+			seen[uid] = true
+		}
+
+		req, tags, status, err := importedTodoRequest(entry, groups)
+		if err != nil {
+			skip(err.Error())
+			continue
+		}
+
+		todo, err := s.todoService.CreateImported(userID, req, tags, uid)
+		if err != nil {
+			if errors.Is(err, ErrInvalidRecurrence) {
+				skip(err.Error())
+				continue
+			}
+			return nil, err
+		}
+		if status != models.StatusPending {
+			if todo, err = s.todoService.Update(userID, todo.ID, &models.TodoUpdateRequest{Status: &status}); err != nil {
+				return nil, err
+			}
+		}
+		result.Todos = append(result.Todos, *todo)
+	}
+
+	log.Printf("[CalendarService] Imported %d todos for user %s, skipped %d", len(result.Todos), userID, len(result.Skipped))
+	return result, nil
+}
+
+// importedTodoRequest reads a VTODO into a create request, its tags and its
+// status. CATEGORIES naming one of the user's groups put the todo in it; the
+// others become tags.
+func importedTodoRequest(entry *ical.Component, groups []models.Group) (*models.TodoCreateRequest, []string, models.Status, error) {
+	title := strings.TrimSpace(entry.Text("SUMMARY"))
+	if title == "" {
+		return nil, nil, "", errors.New("no summary")
+	}
+	req := &models.TodoCreateRequest{Title: title}
+
+	if description := strings.TrimSpace(entry.Text("DESCRIPTION")); description != "" {
+		req.Description = &description
+	}
+
+	dueProp := entry.Prop("DUE")
+	if dueProp == nil {
+		dueProp = entry.Prop("DTSTART")
+	}
+	if dueProp != nil {
+		t, allDay, floating, err := dueProp.Time()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		var dueDate string
+		switch {
+		case allDay:
+			dueDate = t.Format("2006-01-02")
+		case floating:
+			dueDate = t.Format("2006-01-02T15:04")
+		default:
+			dueDate = t.Format(time.RFC3339)
+		}
+		req.DueDate = &dueDate
+	}
+
+	if priority, err := strconv.Atoi(entry.Text("PRIORITY")); err == nil {
+		switch {
+		case priority >= 1 && priority <= 4:
+			req.Priority = models.PriorityHigh
+		case priority == 5:
+			req.Priority = models.PriorityMedium
+		case priority >= 6 && priority <= 9:
+			req.Priority = models.PriorityLow
+		}
+	}
+
+	tags := []string{}
+	for _, prop := range entry.PropsNamed("CATEGORIES") {
+		for _, category := range ical.SplitList(prop.Value) {
+			category = strings.TrimSpace(category)
+			if category == "" {
+				continue
+			}
+			matched := false
+			if req.GroupID == nil {
+				for _, group := range groups {
+					if strings.EqualFold(group.Name, category) {
+						req.GroupID = &group.ID
+						matched = true
+						break
+					}
+				}
+			}
+			if !matched {
+				tags = append(tags, strings.ToLower(category))
+			}
+		}
+	}
+
+	status := models.StatusPending
+	switch strings.ToUpper(entry.Text("STATUS")) {
+	case "COMPLETED":
+		status = models.StatusCompleted
+	case "CANCELLED":
+		status = models.StatusCancelled
+	case "IN-PROCESS":
+		status = models.StatusInProgress
+	}
+
+	// Finished todos come in as one-offs rather than starting a series
+	if rule := entry.Prop("RRULE"); rule != nil && !status.IsDone() {
+		recurrence := rule.Value
+		req.Recurrence = &recurrence
+	}
+
+	return req, tags, status, nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+// upcomingTodoDays is how far ahead digest emails list todos that are due
+const upcomingTodoDays = 7
+
+// DigestMailer emails scheduled digests, with the user's overdue and upcoming
+// todos, to users who opted in
+type DigestMailer struct {
+	email     *EmailService
+	userRepo  *repository.UserRepository
+	todoRepo  *repository.TodoRepository
+	publicURL string
+}
+
+// NewDigestMailer creates a mailer; publicURL is the backend's external address,
+// used for unsubscribe links
+func NewDigestMailer(email *EmailService, userRepo *repository.UserRepository, todoRepo *repository.TodoRepository, publicURL string) *DigestMailer {
+	return &DigestMailer{
+		email:     email,
+		userRepo:  userRepo,
+		todoRepo:  todoRepo,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// IsConfigured checks if digests can be emailed
+func (m *DigestMailer) IsConfigured() bool {
+	return m != nil && m.email.IsConfigured()
+}
+
+// digestEmailData is what the digest email templates render
+type digestEmailData struct {
+	Title          string
+	PeriodLabel    string
+	Paragraphs     []string
+	Overdue        []digestEmailTodo
+	Upcoming       []digestEmailTodo
+	UnsubscribeURL string
+}
+
+type digestEmailTodo struct {
+	Title    string
+	Due      string
+	Priority models.Priority
+}
+
+// Deliver emails a digest if its user opted in. now decides which todos are
+// overdue or upcoming, in the user's timezone.
+func (m *DigestMailer) Deliver(settings *models.DigestSettings, digest *models.MemoryDigest, now time.Time) error {
+	if !m.IsConfigured() || !settings.EmailEnabled || settings.UnsubscribeToken == "" {
+		return nil
+	}
+
+	user, err := m.userRepo.GetByID(settings.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Email == "" {
+		return fmt.Errorf("user %s has no email address", settings.UserID)
+	}
+
+	todos, err := m.todoRepo.GetAllByUserID(settings.UserID)
+	if err != nil {
+		return err
+	}
+
+	data := digestEmailData{
+		Title:          digestEmailTitle(digest),
+		PeriodLabel:    digestPeriodLabel(digest),
+		UnsubscribeURL: m.publicURL + "/api/digest/unsubscribe?token=" + url.QueryEscape(settings.UnsubscribeToken),
+	}
+	for _, paragraph := range strings.Split(digest.DigestContent, "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			data.Paragraphs = append(data.Paragraphs, paragraph)
+		}
+	}
+	data.Overdue, data.Upcoming = dueTodos(todos, now.In(digestLocation(settings)))
+
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, data); err != nil {
+		return fmt.Errorf("failed to render digest email: %w", err)
+	}
+	if err := digestHTMLTemplate.Execute(&html, data); err != nil {
+		return fmt.Errorf("failed to render digest email: %w", err)
+	}
+
+	return m.email.Send(&Email{
+		To:      user.Email,
+		Subject: data.Title + " – " + data.PeriodLabel,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// dueTodos splits open todos with a due date into overdue and due within
+// upcomingTodoDays of today, each soonest first
+func dueTodos(todos []models.Todo, now time.Time) (overdue, upcoming []digestEmailTodo) {
+	today := now.Format("2006-01-02")
+	horizon := now.AddDate(0, 0, upcomingTodoDays).Format("2006-01-02")
+
+	for _, todo := range todos {
+		if todo.Status.IsDone() || todo.DueDate == nil {
+			continue
+		}
+		due, ok := dueDay(*todo.DueDate)
+		if !ok {
+			continue
+		}
+
+		item := digestEmailTodo{Title: todo.Title, Due: due, Priority: todo.Priority}
+		switch {
+		case due < today:
+			overdue = append(overdue, item)
+		case due < horizon:
+			upcoming = append(upcoming, item)
+		}
+	}
+
+	for _, list := range [][]digestEmailTodo{overdue, upcoming} {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Due < list[j].Due })
+	}
+	return overdue, upcoming
+}
+
+// dueDay returns the calendar day (YYYY-MM-DD) of a todo due date, which may be
+// stored as a date or a full timestamp
+func dueDay(dueDate string) (string, bool) {
+	if len(dueDate) < 10 {
+		return "", false
+	}
+	day := dueDate[:10]
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return "", false
+	}
+	return day, true
+}
+
+func digestEmailTitle(digest *models.MemoryDigest) string {
+	switch digest.Period {
+	case models.DigestDaily:
+		return "Your daily digest"
+	case models.DigestMonthly:
+		return "Your monthly digest"
+	default:
+		return "Your weekly digest"
+	}
+}
+
+// digestPeriodLabel describes the dates a digest covers, e.g. "Oct 12 – Oct 18, 2026"
+func digestPeriodLabel(digest *models.MemoryDigest) string {
+	start, err := time.Parse("2006-01-02", digest.WeekStart)
+	if err != nil {
+		return digest.WeekStart
+	}
+	end, err := time.Parse("2006-01-02", digest.WeekEnd)
+	if err != nil || digest.WeekStart == digest.WeekEnd {
+		return start.Format("Jan 2, 2006")
+	}
+	if digest.Period == models.DigestMonthly {
+		return start.Format("January 2006")
+	}
+	return start.Format("Jan 2") + " – " + end.Format("Jan 2, 2006")
+}
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest.txt").Parse(`{{.Title}}
+{{.PeriodLabel}}
+
+{{range .Paragraphs}}{{.}}
+
+{{end}}{{if .Overdue}}Overdue
+{{range .Overdue}}- {{.Title}} (due {{.Due}})
+{{end}}
+{{end}}{{if .Upcoming}}Coming up
+{{range .Upcoming}}- {{.Title}} (due {{.Due}})
+{{end}}
+{{end}}--
+You receive this because digest emails are enabled in your settings.
+Unsubscribe: {{.UnsubscribeURL}}
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Parse(`<!DOCTYPE html>
+<html>
+<body style="margin:0;padding:24px;background:#f9fafb;font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;color:#111827;">
+<div style="max-width:600px;margin:0 auto;background:#ffffff;border-radius:8px;padding:24px;">
+<h1 style="margin:0 0 4px;font-size:20px;">{{.Title}}</h1>
+<p style="margin:0 0 20px;color:#6b7280;font-size:14px;">{{.PeriodLabel}}</p>
+{{range .Paragraphs}}<p style="line-height:1.5;">{{.}}</p>
+{{end}}{{if .Overdue}}<h2 style="font-size:16px;margin-top:24px;color:#ef4444;">Overdue</h2>
+<ul>{{range .Overdue}}<li>{{.Title}} <span style="color:#6b7280;">(due {{.Due}})</span></li>{{end}}</ul>
+{{end}}{{if .Upcoming}}<h2 style="font-size:16px;margin-top:24px;">Coming up</h2>
+<ul>{{range .Upcoming}}<li>{{.Title}} <span style="color:#6b7280;">(due {{.Due}})</span></li>{{end}}</ul>
+{{end}}<p style="margin-top:32px;font-size:12px;color:#9ca3af;">You receive this because digest emails are enabled in your settings. <a href="{{.UnsubscribeURL}}" style="color:#9ca3af;">Unsubscribe</a></p>
+</div>
+</body>
+</html>
+`))
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// DigestScheduler generates each user's digest once its period is over, in the
+// user's timezone, backfilling recent periods that were missed
+type DigestScheduler struct {
+	memoryService   *MemoryService
+	mailer          *DigestMailer
+	backfillPeriods int
+}
+
+// NewDigestScheduler creates a scheduler that looks back at most backfillPeriods
+// completed periods per user. mailer is optional; without it digests stay in-app.
+func NewDigestScheduler(memoryService *MemoryService, mailer *DigestMailer, backfillPeriods int) *DigestScheduler {
+	if backfillPeriods <= 0 {
+		backfillPeriods = 1
+	}
+	return &DigestScheduler{
+		memoryService:   memoryService,
+		mailer:          mailer,
+		backfillPeriods: backfillPeriods,
+	}
+}
+
+// Run checks for due digests immediately and then every interval until ctx is done
+func (d *DigestScheduler) Run(ctx context.Context, interval time.Duration) {
+	d.RunOnce(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.RunOnce(now)
+		}
+	}
+}
+
+// RunOnce generates every digest due at now and returns how many were written
+func (d *DigestScheduler) RunOnce(now time.Time) int {
+	schedules, err := d.memoryService.memoryRepo.ListDigestSettings()
+	if err != nil {
+		log.Printf("[DigestScheduler] Failed to list digest settings: %v", err)
+		return 0
+	}
+
+	total := 0
+	for i := range schedules {
+		settings := &schedules[i]
+		if !settings.Enabled {
+			continue
+		}
+
+		generated, err := d.runForUser(settings, now)
+		total += generated
+		if err != nil {
+			log.Printf("[DigestScheduler] Failed to generate %s digest for user %s: %v", settings.Cadence, settings.UserID, err)
+		}
+	}
+
+	if total > 0 {
+		log.Printf("[DigestScheduler] Generated %d digests", total)
+	}
+	return total
+}
+
+// runForUser fills in the user's missing digests for completed periods, oldest first
+func (d *DigestScheduler) runForUser(settings *models.DigestSettings, now time.Time) (int, error) {
+	// Users without any AI provider can't have digests written
+	if d.memoryService.getAIConfig(settings.UserID) == nil {
+		return 0, nil
+	}
+
+	current := digestPeriodStart(settings.Cadence, now.In(digestLocation(settings)), time.Weekday(settings.WeekStart))
+	start := current
+	for i := 0; i < d.backfillPeriods; i++ {
+		start = previousDigestPeriod(settings.Cadence, start)
+	}
+
+	generated := 0
+	for ; start.Before(current); start = nextDigestPeriod(settings.Cadence, start) {
+		existing, err := d.memoryService.memoryRepo.GetDigest(settings.UserID, settings.Cadence, start)
+		if err != nil {
+			return generated, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		memories, err := d.memoryService.periodMemories(settings.UserID, settings.Cadence, start)
+		if err != nil {
+			return generated, err
+		}
+		todos, err := d.memoryService.periodTodos(settings.UserID, settings.Cadence, start)
+		if err != nil {
+			return generated, err
+		}
+		// Quiet periods get no digest rather than a model call. Todos left
+		// overdue stay that way every period, so they alone don't count.
+		if len(memories) == 0 && !hasTodoActivity(todos) {
+			continue
+		}
+
+		digest, err := d.memoryService.generateDigest(settings.UserID, settings.Cadence, start, memories, todos)
+		if err != nil {
+			return generated, err
+		}
+		generated++
+
+		// Only the period that just ended is emailed; backfilled digests stay in the history
+		if d.mailer.IsConfigured() && nextDigestPeriod(settings.Cadence, start).Equal(current) {
+			if err := d.mailer.Deliver(settings, digest, now); err != nil {
+				log.Printf("[DigestScheduler] Failed to email digest to user %s: %v", settings.UserID, err)
+			}
+		}
+	}
+
+	return generated, nil
+}
+
+// hasTodoActivity reports whether any todo was created or completed in a period
+func hasTodoActivity(todos []models.DigestTodoGroup) bool {
+	for _, group := range todos {
+		if len(group.Created) > 0 || len(group.Completed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// digestLocation resolves a user's digest timezone, falling back to UTC
+func digestLocation(settings *models.DigestSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil || settings.Timezone == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// digestPeriodStart returns midnight at the start of the period containing t, in t's location
+func digestPeriodStart(period models.DigestPeriod, t time.Time, weekStart time.Weekday) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case models.DigestDaily:
+		return day
+	case models.DigestMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		offset := (int(day.Weekday()) - int(weekStart) + 7) % 7
+		return day.AddDate(0, 0, -offset)
+	}
+}
+
+// nextDigestPeriod returns the start of the period after the one starting at start
+func nextDigestPeriod(period models.DigestPeriod, start time.Time) time.Time {
+	switch period {
+	case models.DigestDaily:
+		return start.AddDate(0, 0, 1)
+	case models.DigestMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 7)
+	}
+}
+
+// previousDigestPeriod returns the start of the period before the one starting at start
+func previousDigestPeriod(period models.DigestPeriod, start time.Time) time.Time {
+	switch period {
+	case models.DigestDaily:
+		return start.AddDate(0, 0, -1)
+	case models.DigestMonthly:
+		return start.AddDate(0, -1, 0)
+	default:
+		return start.AddDate(0, 0, -7)
+	}
+}
+
+// digestPeriodNoun names a period in prompts and messages
+func digestPeriodNoun(period models.DigestPeriod) string {
+	switch period {
+	case models.DigestDaily:
+		return "day"
+	case models.DigestMonthly:
+		return "month"
+	default:
+		return "week"
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"unicode"
 
+	"github.com/todomyday/backend/internal/tokenizer"
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -14,7 +15,7 @@ type DocumentChunker struct {
 	maxTokens     int
 	overlapTokens int
 	minTokens     int
-	tokenCounter  *TokenCounter
+	tokenCounter  tokenizer.Tokenizer
 	separators    []string
 }
 
@@ -31,13 +32,9 @@ type ChunkerConfig struct {
 	MaxTokens     int
 	OverlapTokens int
 	MinTokens     int
+	Tokenizer     tokenizer.Tokenizer // Defaults to the embedding model's tokenizer
 }
 
-// MaxInputLength is the max character length for NIM embedding API
-// NIM has 512 token limit, ~4 chars per token = ~2000 chars
-// Using 1800 to leave buffer
-const MaxInputLength = 1800
-
 // NewDocumentChunker creates a new document chunker with the given config
 func NewDocumentChunker(cfg *ChunkerConfig) *DocumentChunker {
 	if cfg == nil {
@@ -59,11 +56,16 @@ func NewDocumentChunker(cfg *ChunkerConfig) *DocumentChunker {
 		minTokens = MinTokens
 	}
 
+	tok := cfg.Tokenizer
+	if tok == nil {
+		tok = embeddingTokenizer()
+	}
+
 	return &DocumentChunker{
 		maxTokens:     maxTokens,
 		overlapTokens: overlapTokens,
 		minTokens:     minTokens,
-		tokenCounter:  GetTokenCounter(),
+		tokenCounter:  tok,
 		separators:    []string{"\n\n", "\n", ". ", "! ", "? ", "; ", ", ", " "},
 	}
 }
@@ -206,18 +208,21 @@ func (dc *DocumentChunker) ChunkText(text string) []Chunk {
 	return chunks
 }
 
+var sentenceBoundary = regexp.MustCompile(`[.!?]\s+`)
+
 // splitIntoSentences splits text into sentences
 func (dc *DocumentChunker) splitIntoSentences(text string) []string {
-	// Split on sentence boundaries
-	sentencePattern := regexp.MustCompile(`(?<=[.!?])\s+`)
-	sentences := sentencePattern.Split(text, -1)
-
+	// Split on whitespace after sentence-ending punctuation, keeping the punctuation
 	var result []string
-	for _, s := range sentences {
-		s = strings.TrimSpace(s)
-		if s != "" {
+	start := 0
+	for _, loc := range sentenceBoundary.FindAllStringIndex(text, -1) {
+		if s := strings.TrimSpace(text[start : loc[0]+1]); s != "" {
 			result = append(result, s)
 		}
+		start = loc[1]
+	}
+	if s := strings.TrimSpace(text[start:]); s != "" {
+		result = append(result, s)
 	}
 	return result
 }
@@ -294,22 +299,9 @@ func (dc *DocumentChunker) finalizeChunk(parts []string, index int) Chunk {
 	}
 }
 
-// TruncateForEmbedding truncates text to fit within NIM's character limit
+// TruncateForEmbedding truncates text to fit within NIM's token limit, counted
+// in the E5 model's tokens, or estimated when its vocabulary wasn't embedded
 func TruncateForEmbedding(text string) string {
-	if len(text) <= MaxInputLength {
-		return text
-	}
-
-	text = text[:MaxInputLength]
-	// Try to cut at a sentence boundary
-	for _, endChar := range []string{". ", "! ", "? "} {
-		lastIdx := strings.LastIndex(text, endChar)
-		if lastIdx > MaxInputLength*8/10 { // 80% threshold
-			text = text[:lastIdx+1]
-			break
-		}
-	}
-
-	return strings.TrimSpace(text)
+	return embeddingTokenizer().TruncateToTokens(text, MaxTokens-tokenizer.SpecialTokens)
 }
 
@@ -25,8 +25,19 @@ const (
 	InputTypeQuery InputType = "query"
 )
 
-// EmbeddingService handles generating embeddings using NVIDIA NIM API
+// EmbeddingProvider identifies the backend used to generate embeddings
+type EmbeddingProvider string
+
+const (
+	// EmbeddingProviderNIM uses the hosted NVIDIA NIM API
+	EmbeddingProviderNIM EmbeddingProvider = "nim"
+	// EmbeddingProviderOllama uses a self-hosted Ollama server
+	EmbeddingProviderOllama EmbeddingProvider = "ollama"
+)
+
+// EmbeddingService handles generating embeddings using NVIDIA NIM API or a local Ollama server
 type EmbeddingService struct {
+	provider    EmbeddingProvider
 	baseURL     string
 	apiKey      string
 	model       string
@@ -78,6 +89,7 @@ func NewEmbeddingService(baseURL, apiKey, model string, rpmLimit, dimension int)
 	minInterval := time.Duration(float64(time.Minute) / float64(rpmLimit))
 
 	return &EmbeddingService{
+		provider:    EmbeddingProviderNIM,
 		baseURL:     strings.TrimSuffix(baseURL, "/"),
 		apiKey:      apiKey,
 		model:       model,
@@ -89,11 +101,50 @@ func NewEmbeddingService(baseURL, apiKey, model string, rpmLimit, dimension int)
 	}
 }
 
+// NewOllamaEmbeddingService creates an embedding service backed by a local Ollama server.
+// No API key or rate limit is needed, so a self-hosted install can run RAG without cloud keys.
+func NewOllamaEmbeddingService(baseURL, model string, dimension int) *EmbeddingService {
+	if model == "" {
+		model = "nomic-embed-text"
+	}
+
+	if dimension <= 0 {
+		dimension = 768 // nomic-embed-text
+	}
+
+	return &EmbeddingService{
+		provider:  EmbeddingProviderOllama,
+		baseURL:   ollamaRootURL(baseURL),
+		model:     model,
+		dimension: dimension,
+		client: &http.Client{
+			Timeout: 60 * time.Second, // Local models can be slow on CPU
+		},
+	}
+}
+
 // IsConfigured returns true if the service is properly configured
 func (s *EmbeddingService) IsConfigured() bool {
+	if s.provider == EmbeddingProviderOllama {
+		return s.baseURL != "" && s.model != ""
+	}
 	return s.baseURL != "" && s.apiKey != ""
 }
 
+// GetProvider returns the embedding backend in use
+func (s *EmbeddingService) GetProvider() EmbeddingProvider {
+	return s.provider
+}
+
+// EnsureModel makes sure the embedding model is available, pulling it onto
+// the Ollama server if needed. It is a no-op for hosted providers.
+func (s *EmbeddingService) EnsureModel(ctx context.Context) error {
+	if s.provider != EmbeddingProviderOllama {
+		return nil
+	}
+	return ensureOllamaModel(ctx, s.baseURL, s.model)
+}
+
 // GetDimension returns the embedding dimension for the configured model
 func (s *EmbeddingService) GetDimension() int {
 	return s.dimension
@@ -151,6 +202,16 @@ func (s *EmbeddingService) EmbedWithType(ctx context.Context, text string, input
 	// Truncate if too long
 	text = TruncateForEmbedding(text)
 
+	if s.provider == EmbeddingProviderOllama {
+		embedding, err := embedWithOllama(ctx, s.client, s.baseURL, s.model, text)
+		if err != nil {
+			log.Printf("[Embedding] Ollama error: %v", err)
+			return nil, err
+		}
+		log.Printf("[Embedding] Successfully generated Ollama embedding (dimension: %d)", len(embedding))
+		return embedding, nil
+	}
+
 	// Enforce rate limiting
 	s.rateLimit()
 
@@ -234,8 +295,13 @@ func (s *EmbeddingService) EmbedBatch(ctx context.Context, texts []string, input
 	return embeddings, nil
 }
 
-// HealthCheck checks if NIM API is accessible
+// HealthCheck checks if the embedding API is accessible
 func (s *EmbeddingService) HealthCheck() bool {
+	if s.provider == EmbeddingProviderOllama {
+		_, err := listOllamaModels(s.baseURL)
+		return err == nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// learnCategories are marked to learn when a memory is saved in them
+var learnCategories = map[string]bool{
+	"Learnings": true,
+	"Quotes":    true,
+}
+
+const (
+	defaultResurfaceLimit = 10
+	maxResurfaceLimit     = 50
+	reviewHistoryLimit    = 20
+
+	// SM-2 starting and minimum ease factors
+	initialEase = 2.5
+	minEase     = 1.3
+	// easyBonus stretches the interval of reviews answered "easy"
+	easyBonus = 1.3
+)
+
+var (
+	// ErrInvalidDate is returned for dates that aren't YYYY-MM-DD
+	ErrInvalidDate = errors.New("invalid date, expected YYYY-MM-DD")
+	// ErrNotLearning is returned when reviewing a memory that isn't marked to learn
+	ErrNotLearning = errors.New("memory is not marked to learn")
+)
+
+// resurfaceDay parses the caller's local date, defaulting to today on the server.
+// Feeds and schedules work in whole days, so clients pass their own date.
+func resurfaceDay(date *string) (time.Time, error) {
+	if date == nil || *date == "" {
+		return today(), nil
+	}
+	day, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidDate, *date)
+	}
+	return day, nil
+}
+
+// GetResurfaceFeed returns memories from the same date in past years and the
+// memories marked to learn that are due for review on date
+func (s *MemoryService) GetResurfaceFeed(userID string, date *string, limit int) (*models.ResurfaceFeed, error) {
+	day, err := resurfaceDay(date)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultResurfaceLimit
+	}
+	if limit > maxResurfaceLimit {
+		limit = maxResurfaceLimit
+	}
+
+	feed := &models.ResurfaceFeed{
+		Date:      day.Format("2006-01-02"),
+		OnThisDay: []models.ResurfacedMemory{},
+		Due:       []models.ResurfacedMemory{},
+	}
+
+	// Memories from February 29 come back on the 28th in common years
+	monthDays := []string{day.Format("01-02")}
+	if day.Month() == time.February && day.Day() == 28 && !isLeapYear(day.Year()) {
+		monthDays = append(monthDays, "02-29")
+	}
+	memories, err := s.memoryRepo.GetOnThisDay(userID, monthDays, day.Year())
+	if err != nil {
+		return nil, err
+	}
+	for _, memory := range memories {
+		if len(feed.OnThisDay) == limit {
+			break
+		}
+		feed.OnThisDay = append(feed.OnThisDay, models.ResurfacedMemory{
+			Memory:   memory,
+			YearsAgo: day.Year() - memory.CreatedAt.Year(),
+		})
+	}
+
+	reviews, err := s.memoryRepo.ListDueReviews(userID, feed.Date, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reviews {
+		memory, err := s.memoryRepo.GetByID(reviews[i].MemoryID)
+		if err != nil {
+			return nil, err
+		}
+		if memory == nil {
+			continue
+		}
+		feed.Due = append(feed.Due, models.ResurfacedMemory{Memory: *memory, Review: &reviews[i]})
+	}
+
+	return feed, nil
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// GetLearnState returns a memory's review schedule and recent reviews. The
+// schedule is nil if the memory was never marked to learn; both are nil if the
+// memory doesn't exist or isn't the user's.
+func (s *MemoryService) GetLearnState(userID, memoryID string) (*models.MemoryReview, []models.MemoryReviewLog, error) {
+	memory, err := s.memoryRepo.GetByID(memoryID)
+	if err != nil || memory == nil || memory.UserID != userID {
+		return nil, nil, err
+	}
+
+	review, err := s.memoryRepo.GetReview(memoryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	history, err := s.memoryRepo.ListReviewLog(memoryID, reviewHistoryLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return review, history, nil
+}
+
+// SetLearn marks or unmarks a memory to learn. Newly marked memories are first due
+// the next day. It returns nil if the memory doesn't exist or isn't the user's.
+func (s *MemoryService) SetLearn(userID, memoryID string, learn bool) (*models.MemoryReview, error) {
+	memory, err := s.memoryRepo.GetByID(memoryID)
+	if err != nil || memory == nil || memory.UserID != userID {
+		return nil, err
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	if err := s.memoryRepo.SetLearn(memoryID, userID, learn, tomorrow); err != nil {
+		return nil, err
+	}
+	return s.memoryRepo.GetReview(memoryID)
+}
+
+// markForLearning marks memories saved as learnings or quotes to learn, unless
+// they were unmarked before
+func (s *MemoryService) markForLearning(memory *models.Memory) {
+	if !learnCategories[memory.Category] {
+		return
+	}
+
+	existing, err := s.memoryRepo.GetReview(memory.ID)
+	if err == nil && existing == nil {
+		tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+		err = s.memoryRepo.SetLearn(memory.ID, memory.UserID, true, tomorrow)
+	}
+	if err != nil {
+		log.Printf("[MemoryService] Failed to mark memory %s to learn: %v", memory.ID, err)
+	}
+}
+
+// ReviewMemory records how well a memory marked to learn was recalled and
+// schedules its next review. It returns nil if the memory doesn't exist or isn't
+// the user's.
+func (s *MemoryService) ReviewMemory(userID, memoryID string, req *models.MemoryReviewRequest) (*models.MemoryReview, error) {
+	day, err := resurfaceDay(req.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	memory, err := s.memoryRepo.GetByID(memoryID)
+	if err != nil || memory == nil || memory.UserID != userID {
+		return nil, err
+	}
+
+	review, err := s.memoryRepo.GetReview(memoryID)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil || !review.Learn {
+		return nil, ErrNotLearning
+	}
+
+	scheduleReview(review, req.Outcome, day)
+	entry := &models.MemoryReviewLog{
+		MemoryID:     memoryID,
+		Outcome:      req.Outcome,
+		IntervalDays: review.IntervalDays,
+		DueDate:      review.DueDate,
+		ReviewedAt:   *review.LastReviewedAt,
+	}
+	if err := s.memoryRepo.SaveReview(review, entry); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// scheduleReview applies a review outcome to a schedule using SM-2: "again" starts
+// the memory over, other outcomes grow the interval by the ease factor, which
+// harder recalls lower and easy ones raise
+func scheduleReview(review *models.MemoryReview, outcome models.ReviewOutcome, day time.Time) {
+	quality := map[models.ReviewOutcome]float64{
+		models.ReviewAgain: 1,
+		models.ReviewHard:  3,
+		models.ReviewGood:  4,
+		models.ReviewEasy:  5,
+	}[outcome]
+
+	if review.Ease == 0 {
+		review.Ease = initialEase
+	}
+
+	if outcome == models.ReviewAgain {
+		review.Repetitions = 0
+		review.Lapses++
+		review.IntervalDays = 1
+	} else {
+		review.Repetitions++
+		switch review.Repetitions {
+		case 1:
+			review.IntervalDays = 1
+		case 2:
+			review.IntervalDays = 6
+		default:
+			review.IntervalDays = int(math.Round(float64(review.IntervalDays) * review.Ease))
+		}
+		if outcome == models.ReviewEasy {
+			review.IntervalDays = int(math.Round(float64(review.IntervalDays) * easyBonus))
+		}
+	}
+
+	review.Ease += 0.1 - (5-quality)*(0.08+(5-quality)*0.02)
+	if review.Ease < minEase {
+		review.Ease = minEase
+	}
+
+	now := time.Now()
+	review.ReviewCount++
+	review.DueDate = day.AddDate(0, 0, review.IntervalDays).Format("2006-01-02")
+	review.LastOutcome = &outcome
+	review.LastReviewedAt = &now
+}
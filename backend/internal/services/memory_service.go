@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -13,27 +14,33 @@ import (
 type MemoryService struct {
 	memoryRepo        *repository.MemoryRepository
 	todoRepo          *repository.TodoRepository
+	groupRepo         *repository.GroupRepository
 	aiService         *AIService
 	aiProviderService *AIProviderService
 	scraperService    *ScraperService
 	ragService        *RAGService
+	promptService     *PromptTemplateService
 }
 
 func NewMemoryService(
 	memoryRepo *repository.MemoryRepository,
 	todoRepo *repository.TodoRepository,
+	groupRepo *repository.GroupRepository,
 	aiService *AIService,
 	aiProviderService *AIProviderService,
 	scraperService *ScraperService,
 	ragService *RAGService,
+	promptService *PromptTemplateService,
 ) *MemoryService {
 	return &MemoryService{
 		memoryRepo:        memoryRepo,
 		todoRepo:          todoRepo,
+		groupRepo:         groupRepo,
 		aiService:         aiService,
 		aiProviderService: aiProviderService,
 		scraperService:    scraperService,
 		ragService:        ragService,
+		promptService:     promptService,
 	}
 }
 
@@ -41,17 +48,10 @@ func NewMemoryService(
 func (s *MemoryService) Create(userID string, req *models.MemoryCreateRequest) (*models.Memory, error) {
 	log.Printf("[MemoryService] Creating memory for user %s: %q", userID, req.Content)
 
-	// Get max position for new memory
-	maxPos, err := s.memoryRepo.GetMaxPosition(userID)
-	if err != nil {
-		maxPos = 0
-	}
-
 	memory := &models.Memory{
 		UserID:   userID,
 		Content:  req.Content,
 		Category: "Uncategorized",
-		Position: fmt.Sprintf("%d", maxPos+1000),
 	}
 
 	// Get AI config
@@ -126,6 +126,7 @@ func (s *MemoryService) Create(userID string, req *models.MemoryCreateRequest) (
 	if err := s.memoryRepo.Create(memory); err != nil {
 		return nil, err
 	}
+	s.markForLearning(memory)
 
 	// Async RAG indexing - fire and forget
 	if s.ragService != nil && s.ragService.IsConfigured() {
@@ -149,17 +150,10 @@ func (s *MemoryService) Create(userID string, req *models.MemoryCreateRequest) (
 func (s *MemoryService) CreateWithCategory(userID string, req *models.MemoryCreateRequest, category, summary string) (*models.Memory, error) {
 	log.Printf("[MemoryService] Creating memory with category for user %s: category=%s", userID, category)
 
-	// Get max position for new memory
-	maxPos, err := s.memoryRepo.GetMaxPosition(userID)
-	if err != nil {
-		maxPos = 0
-	}
-
 	memory := &models.Memory{
 		UserID:   userID,
 		Content:  req.Content,
 		Category: category,
-		Position: fmt.Sprintf("%d", maxPos+1000),
 	}
 
 	if summary != "" {
@@ -170,6 +164,7 @@ func (s *MemoryService) CreateWithCategory(userID string, req *models.MemoryCrea
 	if err := s.memoryRepo.Create(memory); err != nil {
 		return nil, err
 	}
+	s.markForLearning(memory)
 
 	// Async RAG indexing - fire and forget
 	if s.ragService != nil && s.ragService.IsConfigured() {
@@ -197,11 +192,15 @@ func (s *MemoryService) getAIConfig(userID string) *AIProviderConfig {
 		if err == nil && provider != nil && provider.SelectedModel != nil {
 			apiKey, err := s.aiProviderService.GetDecryptedAPIKey(provider)
 			if err == nil {
+				caps, _ := s.aiProviderService.GetModelCapabilities(provider.ID, *provider.SelectedModel)
 				return &AIProviderConfig{
-					ProviderType: provider.ProviderType,
-					BaseURL:      provider.BaseURL,
-					APIKey:       apiKey,
-					Model:        *provider.SelectedModel,
+					ProviderType:  provider.ProviderType,
+					BaseURL:       provider.BaseURL,
+					APIKey:        apiKey,
+					Model:         *provider.SelectedModel,
+					Prompts:       s.promptService.GetPromptSet(userID),
+					UserID:        userID,
+					ContextWindow: caps.ContextWindow,
 				}
 			}
 		}
@@ -214,12 +213,45 @@ func (s *MemoryService) getAIConfig(userID string) *AIProviderConfig {
 			BaseURL:      s.aiService.baseURL,
 			APIKey:       s.aiService.apiKey,
 			Model:        s.aiService.model,
+			Prompts:      s.promptService.GetPromptSet(userID),
+			UserID:       userID,
 		}
 	}
 
 	return nil
 }
 
+// routeForContext switches to a long-context model from the user's providers when the
+// configured model's window is known to be smaller than the tokens needed. The config
+// is kept when the window is unknown or no larger model is available.
+func (s *MemoryService) routeForContext(userID string, config *AIProviderConfig, tokens int) *AIProviderConfig {
+	if s.aiProviderService == nil || config.ContextWindow == 0 || config.ContextWindow >= tokens {
+		return config
+	}
+
+	longProvider, model, err := s.aiProviderService.FindCapableModel(userID, models.ModelRequirements{MinContext: tokens})
+	if err != nil {
+		log.Printf("[MemoryService] %d tokens exceed %s's %d token window and no larger model is available", tokens, config.Model, config.ContextWindow)
+		return config
+	}
+	apiKey, err := s.aiProviderService.GetDecryptedAPIKey(longProvider)
+	if err != nil {
+		return config
+	}
+
+	log.Printf("[MemoryService] Routing %d token request from %s to long-context model %s", tokens, config.Model, model)
+	caps, _ := s.aiProviderService.GetModelCapabilities(longProvider.ID, model)
+	return &AIProviderConfig{
+		ProviderType:  longProvider.ProviderType,
+		BaseURL:       longProvider.BaseURL,
+		APIKey:        apiKey,
+		Model:         model,
+		Prompts:       config.Prompts,
+		UserID:        userID,
+		ContextWindow: caps.ContextWindow,
+	}
+}
+
 // GetAll retrieves memories with pagination
 func (s *MemoryService) GetAll(userID string, limit, offset int) ([]models.Memory, error) {
 	return s.memoryRepo.GetAllByUserID(userID, limit, offset)
@@ -284,6 +316,9 @@ func (s *MemoryService) Update(userID, memoryID string, req *models.MemoryUpdate
 	if err != nil {
 		return nil, err
 	}
+	if req.Category != nil && updatedMemory != nil {
+		s.markForLearning(updatedMemory)
+	}
 
 	// Async RAG re-indexing - fire and forget
 	if s.ragService != nil && s.ragService.IsConfigured() && updatedMemory != nil {
@@ -365,12 +400,6 @@ func (s *MemoryService) ConvertToTodo(userID, memoryID string, req *models.Memor
 		priority = models.Priority(*req.Priority)
 	}
 
-	// Get max position
-	maxPos, err := s.todoRepo.GetMaxPosition(userID)
-	if err != nil {
-		maxPos = 0
-	}
-
 	// Create the todo
 	todo := &models.Todo{
 		UserID:      userID,
@@ -378,7 +407,6 @@ func (s *MemoryService) ConvertToTodo(userID, memoryID string, req *models.Memor
 		Title:       title,
 		Description: description,
 		Priority:    priority,
-		Position:    fmt.Sprintf("%d", maxPos+1000),
 		Tags:        []string{"from-memory"},
 	}
 
@@ -405,10 +433,19 @@ func (s *MemoryService) GetCategories(userID string) ([]models.MemoryCategory, e
 	return s.memoryRepo.GetCategories(userID)
 }
 
-// Reorder updates positions for multiple memories
+// Reorder puts memories in the order of the positions sent. They take the
+// places they hold between them now (see reorderSlots), so other memories
+// don't move.
 func (s *MemoryService) Reorder(userID string, req *models.MemoryReorderRequest) error {
 	// Verify all memories belong to user before updating
+	seen := make(map[string]bool, len(req.Memories))
+	var sent, current []string
+	var memories []models.MemoryPosition
 	for _, m := range req.Memories {
+		if seen[m.ID] {
+			continue
+		}
+		seen[m.ID] = true
 		memory, err := s.memoryRepo.GetByID(m.ID)
 		if err != nil {
 			return err
@@ -416,9 +453,48 @@ func (s *MemoryService) Reorder(userID string, req *models.MemoryReorderRequest)
 		if memory == nil || memory.UserID != userID {
 			return fmt.Errorf("memory %s not found or unauthorized", m.ID)
 		}
+		sent = append(sent, m.Position)
+		current = append(current, memory.Position)
+		memories = append(memories, models.MemoryPosition{ID: m.ID})
+	}
+
+	for i, position := range reorderSlots(sent, current) {
+		memories[i].Position = position
+	}
+	return s.memoryRepo.UpdatePositions(userID, memories)
+}
+
+// MoveAfter puts a memory right after another in the user's list, or first
+// when req has no AfterID. Only the moved memory's position changes. It
+// returns nil if the memory doesn't exist or isn't the user's.
+func (s *MemoryService) MoveAfter(userID, memoryID string, req *models.MemoryMoveAfterRequest) (*models.Memory, error) {
+	memory, err := s.GetByID(userID, memoryID)
+	if err != nil || memory == nil {
+		return nil, err
+	}
+
+	afterID := ""
+	if req.AfterID != nil {
+		afterID = *req.AfterID
+	}
+	if afterID == memoryID {
+		return nil, fmt.Errorf("%w: a memory can't be moved after itself", ErrInvalidPosition)
+	}
+	if afterID != "" {
+		after, err := s.GetByID(userID, afterID)
+		if err != nil {
+			return nil, err
+		}
+		if after == nil {
+			return nil, fmt.Errorf("%w: no memory %s to move after", ErrInvalidPosition, afterID)
+		}
 	}
 
-	return s.memoryRepo.UpdatePositions(req.Memories)
+	moved, err := s.memoryRepo.MoveAfter(userID, memoryID, afterID)
+	if err != nil || !moved {
+		return nil, err
+	}
+	return s.GetByID(userID, memoryID)
 }
 
 // GetStats returns memory statistics
@@ -426,55 +502,247 @@ func (s *MemoryService) GetStats(userID string) (*models.MemoryStats, error) {
 	return s.memoryRepo.GetStats(userID)
 }
 
-// GetOrGenerateDigest retrieves or creates weekly digest
+// GetOrGenerateDigest retrieves or creates the digest of the user's current period,
+// following their digest cadence, timezone and week start
 func (s *MemoryService) GetOrGenerateDigest(userID string, forceRegenerate bool) (*models.MemoryDigest, error) {
-	// Calculate current week start (Sunday)
-	now := time.Now()
-	weekday := int(now.Weekday())
-	weekStart := now.AddDate(0, 0, -weekday)
-	weekStart = time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day(), 0, 0, 0, 0, weekStart.Location())
-	weekEnd := weekStart.AddDate(0, 0, 6)
+	settings, err := s.memoryRepo.GetDigestSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(digestLocation(settings))
+	periodStart := digestPeriodStart(settings.Cadence, now, time.Weekday(settings.WeekStart))
 
 	// Check if digest already exists
 	if !forceRegenerate {
-		existing, err := s.memoryRepo.GetDigest(userID, weekStart)
+		existing, err := s.memoryRepo.GetDigest(userID, settings.Cadence, periodStart)
 		if err == nil && existing != nil {
 			return existing, nil
 		}
 	}
 
-	// Get memories from this week
-	memories, err := s.memoryRepo.GetByDateRange(userID, weekStart, weekEnd.Add(24*time.Hour))
+	memories, err := s.periodMemories(userID, settings.Cadence, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	todos, err := s.periodTodos(userID, settings.Cadence, periodStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.generateDigest(userID, settings.Cadence, periodStart, memories, todos)
+}
+
+// periodMemories returns the memories created in the period starting at periodStart.
+// Timestamps are stored in the server's zone, so the bounds are converted to match.
+func (s *MemoryService) periodMemories(userID string, period models.DigestPeriod, periodStart time.Time) ([]models.Memory, error) {
+	periodEnd := nextDigestPeriod(period, periodStart)
+	return s.memoryRepo.GetByDateRange(userID, periodStart.In(time.Local), periodEnd.Add(-time.Nanosecond).In(time.Local))
+}
+
+// periodTodos returns the todo activity of the period starting at periodStart,
+// by group: todos created or completed during it, and todos that were past due
+// and still open when it ended. Groups follow the user's group order, with ungrouped todos last.
+func (s *MemoryService) periodTodos(userID string, period models.DigestPeriod, periodStart time.Time) ([]models.DigestTodoGroup, error) {
+	periodEnd := nextDigestPeriod(period, periodStart)
+	todos, err := s.todoRepo.GetActivityByDateRange(userID, periodStart.In(time.Local), periodEnd.Add(-time.Nanosecond).In(time.Local))
 	if err != nil {
 		return nil, err
 	}
+	if len(todos) == 0 {
+		return []models.DigestTodoGroup{}, nil
+	}
+
+	groups, err := s.groupRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make([]models.DigestTodoGroup, len(groups)+1)
+	index := make(map[string]int, len(groups))
+	for i, group := range groups {
+		groupID := group.ID
+		sections[i] = models.DigestTodoGroup{GroupID: &groupID, Name: group.Name, ColorCode: group.ColorCode}
+		index[group.ID] = i
+	}
+	ungrouped := len(groups)
+	sections[ungrouped] = models.DigestTodoGroup{Name: "No group"}
 
+	inPeriod := func(t time.Time) bool {
+		return !t.Before(periodStart) && t.Before(periodEnd)
+	}
+	endDay := periodEnd.Format("2006-01-02")
+
+	for _, todo := range todos {
+		i := ungrouped
+		if todo.GroupID != nil {
+			if gi, ok := index[*todo.GroupID]; ok {
+				i = gi
+			}
+		}
+		item := models.DigestTodo{ID: todo.ID, Title: todo.Title, DueDate: todo.DueDate, Priority: todo.Priority}
+
+		if inPeriod(todo.CreatedAt) {
+			sections[i].Created = append(sections[i].Created, item)
+		}
+		if todo.CompletedAt != nil && inPeriod(*todo.CompletedAt) {
+			sections[i].Completed = append(sections[i].Completed, item)
+		}
+
+		// Done todos without a completion time (including cancelled ones) are taken
+		// to be done long ago
+		openAtEnd := !todo.Status.IsDone()
+		if todo.CompletedAt != nil {
+			openAtEnd = !todo.CompletedAt.Before(periodEnd)
+		}
+		if todo.DueDate != nil && openAtEnd {
+			if due, ok := dueDay(*todo.DueDate); ok && due < endDay {
+				sections[i].Overdue = append(sections[i].Overdue, item)
+			}
+		}
+	}
+
+	active := []models.DigestTodoGroup{}
+	for _, section := range sections {
+		if len(section.Created)+len(section.Completed)+len(section.Overdue) == 0 {
+			continue
+		}
+		for _, list := range []*[]models.DigestTodo{&section.Completed, &section.Created, &section.Overdue} {
+			if *list == nil {
+				*list = []models.DigestTodo{}
+			}
+		}
+		active = append(active, section)
+	}
+	return active, nil
+}
+
+// generateDigest writes and saves the digest of a period's memories and todo activity
+func (s *MemoryService) generateDigest(userID string, period models.DigestPeriod, periodStart time.Time, memories []models.Memory, todos []models.DigestTodoGroup) (*models.MemoryDigest, error) {
 	// Generate digest with AI
 	config := s.getAIConfig(userID)
 	if config == nil {
 		return nil, fmt.Errorf("AI not configured")
 	}
 
-	digestContent, err := GenerateWeeklyDigestWithProvider(memories, config)
+	// A busy period can outgrow the selected model's context window
+	config = s.routeForContext(userID, config, digestTokens(memories, todos, period, config))
+
+	digestContent, report, err := GenerateDigestWithProvider(memories, todos, period, config)
 	if err != nil {
 		return nil, err
 	}
 
+	// Insights are extra; a failure leaves the digest without them
+	insights, err := GenerateDigestInsightsWithProvider(memories, todos, period, config)
+	if err != nil {
+		log.Printf("[MemoryService] Failed to generate digest insights for user %s: %v", userID, err)
+		insights = []models.DigestInsight{}
+	}
+
 	// Save digest
 	digest := &models.MemoryDigest{
 		UserID:        userID,
-		WeekStart:     weekStart.Format("2006-01-02"),
-		WeekEnd:       weekEnd.Format("2006-01-02"),
+		Period:        period,
+		WeekStart:     periodStart.Format("2006-01-02"),
+		WeekEnd:       nextDigestPeriod(period, periodStart).AddDate(0, 0, -1).Format("2006-01-02"),
 		DigestContent: digestContent,
+		Sections:      &models.DigestSections{Todos: todos, Insights: insights},
 	}
 
 	if err := s.memoryRepo.SaveDigest(digest); err != nil {
 		return nil, err
 	}
+	digest.Context = &report
+
+	return digest, nil
+}
+
+// ListDigests returns the user's digest history, newest first, optionally for one period
+func (s *MemoryService) ListDigests(userID string, period models.DigestPeriod, limit, offset int) ([]models.MemoryDigest, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.memoryRepo.ListDigests(userID, period, limit, offset)
+}
 
+// GetDigestByID returns one of the user's digests, or nil if it doesn't exist or isn't theirs
+func (s *MemoryService) GetDigestByID(userID, id string) (*models.MemoryDigest, error) {
+	digest, err := s.memoryRepo.GetDigestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if digest == nil || digest.UserID != userID {
+		return nil, nil
+	}
 	return digest, nil
 }
 
+// ErrInvalidTimezone is returned for digest timezones that aren't IANA zone names
+var ErrInvalidTimezone = errors.New("unknown timezone")
+
+// GetDigestSettings returns the user's digest schedule
+func (s *MemoryService) GetDigestSettings(userID string) (*models.DigestSettings, error) {
+	return s.memoryRepo.GetDigestSettings(userID)
+}
+
+// UpdateDigestSettings changes the user's digest schedule
+func (s *MemoryService) UpdateDigestSettings(userID string, req *models.DigestSettingsUpdate) (*models.DigestSettings, error) {
+	settings, err := s.memoryRepo.GetDigestSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.Cadence != nil {
+		settings.Cadence = *req.Cadence
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, *req.Timezone)
+		}
+		settings.Timezone = *req.Timezone
+	}
+	if req.WeekStart != nil {
+		settings.WeekStart = *req.WeekStart
+	}
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+	// Every digest email carries an unsubscribe link, which needs a token
+	if settings.EmailEnabled && settings.UnsubscribeToken == "" {
+		settings.UnsubscribeToken = randomHex(32)
+	}
+
+	if err := s.memoryRepo.SaveDigestSettings(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// CheckDigestUnsubscribeToken reports whether an unsubscribe link's token is
+// valid, without turning anything off
+func (s *MemoryService) CheckDigestUnsubscribeToken(token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	return s.memoryRepo.HasUnsubscribeToken(token)
+}
+
+// UnsubscribeDigestEmail turns off digest emails for an unsubscribe link's token.
+// It reports whether the token was valid.
+func (s *MemoryService) UnsubscribeDigestEmail(token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	return s.memoryRepo.DisableDigestEmail(token)
+}
+
 // WebSearch searches the web using SearXNG
 func (s *MemoryService) WebSearch(query string) ([]models.WebSearchResult, error) {
 	if s.scraperService == nil {
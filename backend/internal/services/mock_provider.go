@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// MockScript scripts the responses of a "mock" AI provider so AI features can be
+// exercised offline. Rules are checked in order and the first rule whose Match text
+// appears in the prompt answers it. Prompts no rule matches get a minimal valid answer:
+// plain text, JSON built from the output schema, or no tool calls.
+type MockScript struct {
+	Rules  []MockRule
+	Models []string // returned by test connection / fetch models; defaults to "mock-model"
+	// Capabilities reported in the model listing, keyed by model ID
+	Capabilities map[string]models.ModelCapabilities
+
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+// MockRule is one scripted response
+type MockRule struct {
+	Match     string         // substring the prompt must contain; empty matches every prompt
+	Response  string         // text (or JSON) returned for text and structured requests
+	ToolCalls []MockToolCall // returned for function calling requests
+	Error     string         // returned as a provider error instead of a response
+	Times     int            // how many prompts this rule answers; 0 means unlimited
+
+	used int
+}
+
+// MockToolCall is a scripted function call
+type MockToolCall struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// MockCall records a prompt the mock provider received
+type MockCall struct {
+	Kind   string // "text", "json" or "tools"
+	Model  string
+	Prompt string
+}
+
+var (
+	mockScriptsMu sync.Mutex
+	mockScripts   = make(map[string]*MockScript)
+)
+
+// RegisterMockScript makes a script available to mock providers with base URL "mock://<name>"
+func RegisterMockScript(name string, script *MockScript) {
+	mockScriptsMu.Lock()
+	defer mockScriptsMu.Unlock()
+	mockScripts[name] = script
+}
+
+// mockScriptFor returns the script named by a mock provider's base URL.
+// Unregistered names get an empty script that only gives default answers.
+func mockScriptFor(config *AIProviderConfig) *MockScript {
+	name := strings.TrimPrefix(config.BaseURL, "mock://")
+
+	mockScriptsMu.Lock()
+	defer mockScriptsMu.Unlock()
+
+	script, ok := mockScripts[name]
+	if !ok {
+		script = &MockScript{}
+		mockScripts[name] = script
+	}
+	return script
+}
+
+// Calls returns the prompts the script has answered, oldest first
+func (m *MockScript) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// match records the call and returns the first applicable rule, or nil
+func (m *MockScript) match(kind, model, prompt string) *MockRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, MockCall{Kind: kind, Model: model, Prompt: prompt})
+
+	for i := range m.Rules {
+		rule := &m.Rules[i]
+		if rule.Times > 0 && rule.used >= rule.Times {
+			continue
+		}
+		if rule.Match != "" && !strings.Contains(prompt, rule.Match) {
+			continue
+		}
+		rule.used++
+		return rule
+	}
+	return nil
+}
+
+func (m *MockScript) models() []string {
+	if len(m.Models) == 0 {
+		return []string{"mock-model"}
+	}
+	return m.Models
+}
+
+// callMock answers a plain text prompt
+func callMock(config *AIProviderConfig, prompt string) (string, error) {
+	rule := mockScriptFor(config).match("text", config.Model, prompt)
+	if rule == nil {
+		return "Mock response", nil
+	}
+	if rule.Error != "" {
+		return "", fmt.Errorf("mock provider error: %s", rule.Error)
+	}
+	return rule.Response, nil
+}
+
+// callMockJSON answers a structured output prompt, defaulting to the smallest valid value for schema
+func callMockJSON(config *AIProviderConfig, prompt string, schema *OutputSchema) (string, error) {
+	rule := mockScriptFor(config).match("json", config.Model, prompt)
+	if rule == nil || (rule.Response == "" && rule.Error == "") {
+		data, err := json.Marshal(mockValueForSchema(schema.Schema))
+		return string(data), err
+	}
+	if rule.Error != "" {
+		return "", fmt.Errorf("mock provider error: %s", rule.Error)
+	}
+	return rule.Response, nil
+}
+
+// callMockWithTools answers a function calling prompt
+func callMockWithTools(config *AIProviderConfig, content string) ([]ToolCall, error) {
+	rule := mockScriptFor(config).match("tools", config.Model, buildFunctionCallingPrompt(config, content))
+	if rule == nil {
+		return nil, nil
+	}
+	if rule.Error != "" {
+		return nil, fmt.Errorf("mock provider error: %s", rule.Error)
+	}
+
+	toolCalls := make([]ToolCall, 0, len(rule.ToolCalls))
+	for i, call := range rule.ToolCalls {
+		args, err := json.Marshal(call.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		var toolCall ToolCall
+		toolCall.ID = fmt.Sprintf("call_%d", i)
+		toolCall.Type = "function"
+		toolCall.Function.Name = call.Name
+		toolCall.Function.Arguments = string(args)
+		toolCalls = append(toolCalls, toolCall)
+	}
+
+	log.Printf("[AI-Mock] Returning %d scripted tool calls", len(toolCalls))
+	return toolCalls, nil
+}
+
+// mockValueForSchema builds the smallest value that satisfies an OutputSchema:
+// required fields only, empty strings and arrays, and the first enum value
+func mockValueForSchema(schema map[string]interface{}) interface{} {
+	switch schema["type"] {
+	case "object":
+		obj := make(map[string]interface{})
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]string)
+		for _, field := range required {
+			if propSchema, ok := properties[field].(map[string]interface{}); ok {
+				obj[field] = mockValueForSchema(propSchema)
+			}
+		}
+		return obj
+	case "array":
+		return []interface{}{}
+	case "string":
+		if enum, ok := schema["enum"].([]string); ok && len(enum) > 0 {
+			return enum[0]
+		}
+		return ""
+	case "boolean":
+		return false
+	case "number", "integer":
+		return 0
+	}
+	return nil
+}
+
+// testMock reports the scripted model list for a mock provider
+func testMock(baseURL string) *models.TestConnectionResponse {
+	script := mockScriptFor(&AIProviderConfig{BaseURL: baseURL})
+	return &models.TestConnectionResponse{
+		Success:      true,
+		Message:      "Connection successful",
+		Models:       script.models(),
+		Capabilities: script.Capabilities,
+	}
+}
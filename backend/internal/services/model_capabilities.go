@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// knownModelCapabilities is the built-in capability table, used for models whose
+// provider listing doesn't report capabilities. Entries match model ID prefixes
+// (after any "vendor/" path) and are checked in order, so specific prefixes come
+// before the families they belong to.
+var knownModelCapabilities = []struct {
+	prefix string
+	caps   models.ModelCapabilities
+}{
+	// OpenAI
+	{"gpt-4.1", chatModel(1047576, true)},
+	{"gpt-4o", chatModel(128000, true)},
+	{"gpt-4-turbo", chatModel(128000, true)},
+	{"gpt-4", chatModel(8192, false)},
+	{"gpt-3.5-turbo", chatModel(16385, false)},
+	{"o1-mini", models.ModelCapabilities{ContextWindow: 128000, Streaming: true}},
+	{"o1", chatModel(200000, true)},
+	{"o3", chatModel(200000, true)},
+	{"o4-mini", chatModel(200000, true)},
+	{"text-embedding-3", embeddingModel(8191)},
+	{"text-embedding-ada", embeddingModel(8191)},
+
+	// Anthropic
+	{"claude-opus-4", chatModel(200000, true)},
+	{"claude-sonnet-4", chatModel(200000, true)},
+	{"claude-3-7-sonnet", chatModel(200000, true)},
+	{"claude-3-5-haiku", chatModel(200000, false)},
+	{"claude-3", chatModel(200000, true)},
+	{"claude", chatModel(100000, false)},
+
+	// Google
+	{"gemini-2.5", chatModel(1048576, true)},
+	{"gemini-2.0", chatModel(1048576, true)},
+	{"gemini-1.5-pro", chatModel(2097152, true)},
+	{"gemini-1.5-flash", chatModel(1048576, true)},
+	{"gemini-1.0-pro-vision", models.ModelCapabilities{ContextWindow: 12288, Vision: true, Streaming: true}},
+	{"gemini-1.0-pro", chatModel(30720, false)},
+	{"gemini-embedding", embeddingModel(2048)},
+	{"text-embedding-004", embeddingModel(2048)},
+
+	// Zhipu (server default)
+	{"glm-4.5v", chatModel(65536, true)},
+	{"glm-4v", chatModel(8192, true)},
+	{"glm-4", chatModel(128000, false)},
+
+	// Common open models (Ollama, NIM, OpenRouter)
+	{"llama3.2-vision", chatModel(128000, true)},
+	{"llama-3.2-11b-vision", chatModel(128000, true)},
+	{"llama-3.2-90b-vision", chatModel(128000, true)},
+	{"llama3.1", chatModel(128000, false)},
+	{"llama-3.1", chatModel(128000, false)},
+	{"llama3", models.ModelCapabilities{ContextWindow: 8192, Streaming: true}},
+	{"llava", models.ModelCapabilities{ContextWindow: 4096, Vision: true, Streaming: true}},
+	{"qwen2.5vl", chatModel(128000, true)},
+	{"qwen2.5", chatModel(32768, false)},
+	{"mistral-large", chatModel(128000, false)},
+	{"mistral", chatModel(32768, false)},
+	{"nomic-embed-text", embeddingModel(8192)},
+	{"mxbai-embed-large", embeddingModel(512)},
+	{"nvidia/nv-embed", embeddingModel(512)},
+	{"nv-embedqa", embeddingModel(512)},
+}
+
+// chatModel is a streaming chat model with tool calling and JSON mode
+func chatModel(contextWindow int, vision bool) models.ModelCapabilities {
+	return models.ModelCapabilities{
+		ContextWindow: contextWindow,
+		Vision:        vision,
+		Tools:         true,
+		JSONMode:      true,
+		Streaming:     true,
+	}
+}
+
+func embeddingModel(contextWindow int) models.ModelCapabilities {
+	return models.ModelCapabilities{ContextWindow: contextWindow, Embedding: true}
+}
+
+// lookupModelCapabilities finds a model in the built-in table
+func lookupModelCapabilities(modelID string) (models.ModelCapabilities, bool) {
+	id := strings.ToLower(modelID)
+	name := id
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		name = id[i+1:]
+	}
+
+	for _, known := range knownModelCapabilities {
+		// Vendor-qualified entries match the full ID, the rest match the bare name
+		if strings.HasPrefix(name, known.prefix) || strings.HasPrefix(id, known.prefix) {
+			return known.caps, true
+		}
+	}
+	return models.ModelCapabilities{}, false
+}
+
+// inferModelCapabilities combines what a provider listing reported with the built-in
+// table. Listed values win; the table fills in what the listing leaves out, and
+// unknown models get name-based guesses.
+func inferModelCapabilities(modelID string, listed *models.ModelCapabilities) models.ModelCapabilities {
+	caps, known := lookupModelCapabilities(modelID)
+	if !known {
+		name := strings.ToLower(modelID)
+		switch {
+		case strings.Contains(name, "embed"):
+			caps = models.ModelCapabilities{Embedding: true}
+		case strings.Contains(name, "vision") || strings.Contains(name, "-vl") || strings.Contains(name, "llava"):
+			caps = models.ModelCapabilities{Vision: true, Streaming: true}
+		default:
+			caps = models.ModelCapabilities{Streaming: true}
+		}
+	}
+
+	if listed == nil {
+		return caps
+	}
+	if listed.ContextWindow > 0 {
+		caps.ContextWindow = listed.ContextWindow
+	}
+	if listed.Embedding {
+		caps = models.ModelCapabilities{ContextWindow: caps.ContextWindow, Embedding: true}
+	}
+	caps.Vision = caps.Vision || listed.Vision
+	caps.Tools = caps.Tools || listed.Tools
+	caps.JSONMode = caps.JSONMode || listed.JSONMode
+	caps.Streaming = caps.Streaming || listed.Streaming
+	return caps
+}
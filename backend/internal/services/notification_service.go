@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+// ErrInvalidWebhookURL is returned for webhook URLs that aren't http or https
+var ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+
+// NotificationService manages where a user's reminders are sent
+type NotificationService struct {
+	reminderRepo *repository.ReminderRepository
+	push         *WebPush
+}
+
+// NewNotificationService creates the service; push may be unconfigured, which
+// turns off Web Push subscriptions
+func NewNotificationService(reminderRepo *repository.ReminderRepository, push *WebPush) *NotificationService {
+	return &NotificationService{
+		reminderRepo: reminderRepo,
+		push:         push,
+	}
+}
+
+// GetSettings returns the user's notification settings
+func (s *NotificationService) GetSettings(userID string) (*models.NotificationSettings, error) {
+	settings, err := s.reminderRepo.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings.PushPublicKey = s.push.PublicKey()
+	return settings, nil
+}
+
+// UpdateSettings changes the user's notification settings. Setting a webhook
+// for the first time generates the secret its requests are signed with.
+func (s *NotificationService) UpdateSettings(userID string, req *models.NotificationSettingsUpdate) (*models.NotificationSettings, error) {
+	settings, err := s.reminderRepo.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.EmailEnabled != nil {
+		settings.EmailEnabled = *req.EmailEnabled
+	}
+	if req.WebhookURL != nil {
+		if *req.WebhookURL == "" {
+			settings.WebhookURL = nil
+		} else {
+			u, err := url.Parse(*req.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidWebhookURL, *req.WebhookURL)
+			}
+			settings.WebhookURL = req.WebhookURL
+		}
+	}
+	if settings.WebhookURL != nil && settings.WebhookSecret == nil {
+		secret := randomHex(32)
+		settings.WebhookSecret = &secret
+	}
+
+	if err := s.reminderRepo.SaveSettings(settings); err != nil {
+		return nil, err
+	}
+	settings.PushPublicKey = s.push.PublicKey()
+	return settings, nil
+}
+
+// GetPushSubscriptions lists the browsers the user subscribed for Web Push
+func (s *NotificationService) GetPushSubscriptions(userID string) ([]models.PushSubscription, error) {
+	return s.reminderRepo.GetPushSubscriptions(userID)
+}
+
+// Subscribe registers a browser for Web Push
+func (s *NotificationService) Subscribe(userID string, req *models.PushSubscriptionRequest) (*models.PushSubscription, error) {
+	if !s.push.IsConfigured() {
+		return nil, ErrPushNotConfigured
+	}
+	if err := checkSubscription(req.Keys.P256dh, req.Keys.Auth); err != nil {
+		return nil, err
+	}
+
+	sub := &models.PushSubscription{
+		UserID:   userID,
+		Endpoint: req.Endpoint,
+		P256dh:   req.Keys.P256dh,
+		Auth:     req.Keys.Auth,
+	}
+	if err := s.reminderRepo.SavePushSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Unsubscribe removes one of the user's push subscriptions and reports whether
+// it existed
+func (s *NotificationService) Unsubscribe(userID, id string) (bool, error) {
+	return s.reminderRepo.DeletePushSubscription(userID, id)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ollama native API types (https://github.com/ollama/ollama/blob/main/docs/api.md)
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name    string `json:"name"`
+		Model   string `json:"model"`
+		Details struct {
+			Family        string `json:"family"`
+			ParameterSize string `json:"parameter_size"`
+		} `json:"details"`
+	} `json:"models"`
+}
+
+type ollamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+type ollamaPullResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ollamaEmbedRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float32 `json:"embeddings"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// ollamaRootURL returns the server root for Ollama's native API.
+// Provider base URLs point at the OpenAI-compatible "/v1" endpoint so chat
+// requests can reuse the OpenAI code path; native endpoints live under "/api".
+func ollamaRootURL(baseURL string) string {
+	root := strings.TrimSuffix(baseURL, "/")
+	root = strings.TrimSuffix(root, "/v1")
+	return strings.TrimSuffix(root, "/")
+}
+
+// listOllamaModels lists locally available models via the native tags API
+func listOllamaModels(baseURL string) ([]string, error) {
+	url := ollamaRootURL(baseURL) + "/api/tags"
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Ollama API error: %s - %s", resp.Status, string(body))
+	}
+
+	var tagsResp ollamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tagsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Ollama tags: %w", err)
+	}
+
+	modelIDs := make([]string, 0, len(tagsResp.Models))
+	for _, m := range tagsResp.Models {
+		name := m.Name
+		if name == "" {
+			name = m.Model
+		}
+		modelIDs = append(modelIDs, name)
+	}
+
+	return modelIDs, nil
+}
+
+// hasOllamaModel reports whether a model is already present on the server.
+// Ollama names models "name:tag" and treats a bare name as ":latest".
+func hasOllamaModel(available []string, model string) bool {
+	want := model
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	for _, m := range available {
+		if m == model || m == want {
+			return true
+		}
+	}
+	return false
+}
+
+// pullOllamaModel downloads a model onto the Ollama server.
+// This blocks until the pull completes, which can take minutes for large models.
+func pullOllamaModel(ctx context.Context, baseURL, model string) error {
+	jsonBody, err := json.Marshal(ollamaPullRequest{Model: model, Stream: false})
+	if err != nil {
+		return err
+	}
+
+	url := ollamaRootURL(baseURL) + "/api/pull"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	log.Printf("[Ollama] Pulling model %s from %s", model, ollamaRootURL(baseURL))
+
+	// No client timeout - the caller's context bounds the pull
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ollama pull error: %s - %s", resp.Status, string(body))
+	}
+
+	var pullResp ollamaPullResponse
+	if err := json.Unmarshal(body, &pullResp); err == nil && pullResp.Error != "" {
+		return fmt.Errorf("Ollama pull error: %s", pullResp.Error)
+	}
+
+	log.Printf("[Ollama] Pulled model %s (status: %s)", model, pullResp.Status)
+	return nil
+}
+
+// ensureOllamaModel pulls a model only if the server doesn't already have it
+func ensureOllamaModel(ctx context.Context, baseURL, model string) error {
+	available, err := listOllamaModels(baseURL)
+	if err != nil {
+		return err
+	}
+	if hasOllamaModel(available, model) {
+		return nil
+	}
+	return pullOllamaModel(ctx, baseURL, model)
+}
+
+// embedWithOllama generates an embedding using Ollama's native embed API
+func embedWithOllama(ctx context.Context, client *http.Client, baseURL, model, text string) ([]float32, error) {
+	jsonBody, err := json.Marshal(ollamaEmbedRequest{Model: model, Input: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := ollamaRootURL(baseURL) + "/api/embed"
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error: %s - %s", resp.Status, string(body))
+	}
+
+	var embedResp ollamaEmbedResponse
+	if err := json.Unmarshal(body, &embedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(embedResp.Embeddings) == 0 {
+		return nil, fmt.Errorf("no embedding returned")
+	}
+
+	return embedResp.Embeddings[0], nil
+}
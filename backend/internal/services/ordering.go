@@ -0,0 +1,40 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// ErrInvalidPosition is returned for positions that aren't fractional index
+// keys, and for moving an item after itself or after one that isn't the user's
+var ErrInvalidPosition = errors.New("invalid position")
+
+// reorderSlots returns new positions for items, putting them in the order of
+// the positions a client sent while reusing the positions they hold now, so
+// that items not sent keep their places and no key grows. Sent positions are
+// compared as numbers when both are, as clients used to send 1000, 2000 and
+// so on.
+func reorderSlots(sent, current []string) []string {
+	order := make([]int, len(sent))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		x, errX := strconv.ParseInt(sent[order[a]], 10, 64)
+		y, errY := strconv.ParseInt(sent[order[b]], 10, 64)
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return sent[order[a]] < sent[order[b]]
+	})
+
+	slots := append([]string(nil), current...)
+	sort.Strings(slots)
+
+	positions := make([]string, len(sent))
+	for rank, i := range order {
+		positions[i] = slots[rank]
+	}
+	return positions
+}
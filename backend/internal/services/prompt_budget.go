@@ -0,0 +1,151 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/tokenizer"
+)
+
+const (
+	// defaultContextWindow is assumed for models whose window is unknown
+	defaultContextWindow = 8192
+	// responseReserveTokens is left free for the model's answer
+	responseReserveTokens = 1024
+	// minTruncatedTokens is the smallest useful piece of a truncated item
+	minTruncatedTokens = 64
+)
+
+// tokenizerForModel returns the tokenizer for a model. Models without a
+// bundled tokenizer (or whose vocabulary wasn't embedded) use TokenCounter's
+// conservative estimate.
+func tokenizerForModel(model string) tokenizer.Tokenizer {
+	if tok := tokenizer.ForModel(model); tok != nil {
+		return tok
+	}
+	return GetTokenCounter()
+}
+
+// embeddingTokenizer returns the tokenizer of the E5 embedding model, falling
+// back to TokenCounter's estimate when its vocabulary wasn't embedded
+func embeddingTokenizer() tokenizer.Tokenizer {
+	if wp, err := tokenizer.E5(); err == nil {
+		return wp
+	}
+	return GetTokenCounter()
+}
+
+// contextWindowFor returns the input token window of a config's model
+func contextWindowFor(config *AIProviderConfig) int {
+	if config.ContextWindow > 0 {
+		return config.ContextWindow
+	}
+	if caps, ok := lookupModelCapabilities(config.Model); ok && caps.ContextWindow > 0 {
+		return caps.ContextWindow
+	}
+	return defaultContextWindow
+}
+
+// ContextItem is one piece of retrieved text competing for room in a prompt
+type ContextItem struct {
+	ID      string  // Identifies the source, e.g. a Document's ContentID
+	Label   string  // Names the item in reports of what was cut
+	Text    string  // Full text as it should appear in the prompt
+	Summary string  // Shorter stand-in used when Text doesn't fit; optional
+	Score   float64 // Relevance; higher-scoring items get room first
+}
+
+// PromptBudget tracks the tokens a model has left for context once the
+// fixed parts of a prompt and the answer are accounted for
+type PromptBudget struct {
+	tokenizer tokenizer.Tokenizer
+	window    int
+	remaining int
+}
+
+// NewPromptBudget starts a budget for the config's model, reserving room for the answer
+func NewPromptBudget(config *AIProviderConfig) *PromptBudget {
+	window := contextWindowFor(config)
+	return &PromptBudget{
+		tokenizer: tokenizerForModel(config.Model),
+		window:    window,
+		remaining: window - responseReserveTokens,
+	}
+}
+
+// Reserve sets aside tokens for fixed prompt text such as instructions and the question
+func (b *PromptBudget) Reserve(text string) {
+	b.remaining -= b.tokenizer.CountTokens(text)
+}
+
+// Remaining returns the tokens still available for context
+func (b *PromptBudget) Remaining() int {
+	return max(b.remaining, 0)
+}
+
+// CountTokens counts text with the budget's tokenizer
+func (b *PromptBudget) CountTokens(text string) int {
+	return b.tokenizer.CountTokens(text)
+}
+
+// Fit chooses the items that fit in at most limit tokens (0 means all that remain),
+// spending the budget on them. Items are considered from highest score down; one that
+// doesn't fit is replaced by its summary, then truncated, then dropped. The chosen
+// items keep their input order, with Text set to what will be sent.
+func (b *PromptBudget) Fit(items []ContextItem, limit int) ([]ContextItem, models.ContextReport) {
+	available := b.Remaining()
+	if limit > 0 && limit < available {
+		available = limit
+	}
+	report := models.ContextReport{Budget: available}
+
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, c int) bool {
+		return items[order[a]].Score > items[order[c]].Score
+	})
+
+	chosen := make(map[int]string)
+	for _, i := range order {
+		item := items[i]
+		// Items are joined by a blank line
+		tokens := b.tokenizer.CountTokens(item.Text) + 1
+
+		switch {
+		case tokens <= available:
+			chosen[i] = item.Text
+		case item.Summary != "" && b.tokenizer.CountTokens(item.Summary)+1 <= available:
+			tokens = b.tokenizer.CountTokens(item.Summary) + 1
+			chosen[i] = item.Summary
+			report.Summarized = append(report.Summarized, item.Label)
+		case available-1 >= minTruncatedTokens:
+			text := b.tokenizer.TruncateToTokens(item.Text, available-1)
+			tokens = b.tokenizer.CountTokens(text) + 1
+			if text == "" || tokens > available {
+				report.Dropped = append(report.Dropped, item.Label)
+				continue
+			}
+			chosen[i] = text
+			report.Truncated = append(report.Truncated, item.Label)
+		default:
+			report.Dropped = append(report.Dropped, item.Label)
+			continue
+		}
+
+		available -= tokens
+		report.Used += tokens
+	}
+
+	fitted := make([]ContextItem, 0, len(chosen))
+	for i, item := range items {
+		if text, ok := chosen[i]; ok {
+			item.Text = text
+			fitted = append(fitted, item)
+		}
+	}
+
+	b.remaining -= report.Used
+	return fitted, report
+}
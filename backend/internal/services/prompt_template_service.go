@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+var (
+	ErrUnknownPromptTemplate = errors.New("unknown prompt template")
+	ErrInvalidPromptTemplate = errors.New("invalid template")
+	ErrPreviewMemoryNotFound = errors.New("memory not found")
+)
+
+// sampleMemory is rendered by the preview endpoint when no memory is given
+func sampleMemory() *models.Memory {
+	url := "https://www.feliceatestaccio.com"
+	return &models.Memory{
+		Content:  "Try the cacio e pepe at Felice a Testaccio next time I'm in Rome - " + url,
+		Category: "Food",
+		URL:      &url,
+	}
+}
+
+type PromptTemplateService struct {
+	promptRepo *repository.PromptTemplateRepository
+	memoryRepo *repository.MemoryRepository
+}
+
+func NewPromptTemplateService(promptRepo *repository.PromptTemplateRepository, memoryRepo *repository.MemoryRepository) *PromptTemplateService {
+	return &PromptTemplateService{
+		promptRepo: promptRepo,
+		memoryRepo: memoryRepo,
+	}
+}
+
+// GetPromptSet returns the prompt templates to use for a user's AI requests.
+// Lookup errors fall back to the defaults rather than failing the request.
+func (s *PromptTemplateService) GetPromptSet(userID string) *PromptSet {
+	if s == nil {
+		return nil
+	}
+
+	overrides, err := s.promptRepo.GetActiveByUserID(userID)
+	if err != nil {
+		log.Printf("[Prompts] Failed to load templates for user %s: %v", userID, err)
+		return nil
+	}
+	return NewPromptSet(overrides)
+}
+
+// GetAll returns the active template for every task
+func (s *PromptTemplateService) GetAll(userID string) ([]models.PromptTemplateInfo, error) {
+	overrides, err := s.promptRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	set := NewPromptSet(overrides)
+
+	templates := make([]models.PromptTemplateInfo, 0, len(defaultPrompts))
+	for _, name := range defaultPromptNames() {
+		templates = append(templates, s.buildInfo(set, name))
+	}
+	return templates, nil
+}
+
+// Get returns the active template for one task
+func (s *PromptTemplateService) Get(userID, name string) (*models.PromptTemplateInfo, error) {
+	if _, ok := defaultPrompts[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPromptTemplate, name)
+	}
+
+	overrides, err := s.promptRepo.GetActiveByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := s.buildInfo(NewPromptSet(overrides), name)
+	return &info, nil
+}
+
+// GetVersions returns the user's saved versions of a template, newest first
+func (s *PromptTemplateService) GetVersions(userID, name string) ([]models.PromptTemplate, error) {
+	if _, ok := defaultPrompts[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPromptTemplate, name)
+	}
+	return s.promptRepo.GetVersions(userID, name)
+}
+
+// Update saves a new version of a user's template after checking that it renders
+func (s *PromptTemplateService) Update(userID, name, text string) (*models.PromptTemplateInfo, error) {
+	if _, ok := defaultPrompts[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPromptTemplate, name)
+	}
+
+	if _, err := executePromptTemplate(name, text, previewData(sampleMemory())); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+
+	tmpl := &models.PromptTemplate{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Template:  text,
+		CreatedAt: time.Now(),
+	}
+	if err := s.promptRepo.Create(tmpl); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Prompts] User %s saved %s template v%d", userID, name, tmpl.Version)
+	return s.Get(userID, name)
+}
+
+// Reset deletes a user's overrides for a template so the default is used again
+func (s *PromptTemplateService) Reset(userID, name string) (*models.PromptTemplateInfo, error) {
+	if _, ok := defaultPrompts[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPromptTemplate, name)
+	}
+
+	if err := s.promptRepo.DeleteByName(userID, name); err != nil {
+		return nil, err
+	}
+	return s.Get(userID, name)
+}
+
+// Preview renders a template against a memory without saving it
+func (s *PromptTemplateService) Preview(userID, name string, req *models.PromptPreviewRequest) (*models.PromptPreviewResponse, error) {
+	info, err := s.Get(userID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	text := info.Template
+	if req.Template != nil {
+		text = *req.Template
+	}
+
+	memory := sampleMemory()
+	if req.MemoryID != nil && *req.MemoryID != "" {
+		memory, err = s.memoryRepo.GetByID(*req.MemoryID)
+		if err != nil {
+			return nil, err
+		}
+		if memory == nil || memory.UserID != userID {
+			return nil, ErrPreviewMemoryNotFound
+		}
+	}
+
+	prompt, err := executePromptTemplate(name, text, previewData(memory))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPromptTemplate, err)
+	}
+
+	return &models.PromptPreviewResponse{
+		Name:   name,
+		Prompt: prompt,
+	}, nil
+}
+
+func (s *PromptTemplateService) buildInfo(set *PromptSet, name string) models.PromptTemplateInfo {
+	def := defaultPrompts[name]
+	info := models.PromptTemplateInfo{
+		Name:            name,
+		Description:     def.Description,
+		Variables:       def.Variables,
+		Template:        def.Template,
+		Version:         set.Version(name),
+		DefaultTemplate: def.Template,
+	}
+
+	if override, ok := set.overrides[name]; ok {
+		info.Template = override.Template
+		info.IsCustom = true
+		info.UpdatedAt = &override.CreatedAt
+	}
+	return info
+}
+
+// previewData fills every template variable from a single memory so any task can be previewed
+func previewData(memory *models.Memory) PromptData {
+	data := PromptData{
+		Title:    memory.Content,
+		Content:  memory.Content,
+		Question: memory.Content,
+		Notes:    fmt.Sprintf("[%s] %s", memory.Category, memory.Content),
+		Period:   "week",
+		Memories: []PromptMemory{
+			{Ref: "M1", Category: memory.Category, Content: memory.Content},
+		},
+		Todos: []PromptTodoGroup{
+			{Name: "Personal", Todos: []PromptTodo{{Ref: "T1", Title: memory.Content, Activity: "added"}}},
+		},
+	}
+	if memory.URL != nil {
+		data.URL = *memory.URL
+	}
+	return data
+}
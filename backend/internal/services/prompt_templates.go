@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"text/template"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// Prompt template names. Each names one AI task whose prompt users can override.
+const (
+	PromptTodoProcessing        = "todo_processing"
+	PromptTodoParsing           = "todo_parsing"
+	PromptMemoryCategorization  = "memory_categorization"
+	PromptMemoryFunctionCalling = "memory_function_calling"
+	PromptURLSummary            = "url_summary"
+	PromptWeeklyDigest          = "weekly_digest"
+	PromptDigestInsights        = "digest_insights"
+	PromptSearchQueries         = "search_queries"
+	PromptVisionExtraction      = "vision_extraction"
+)
+
+// PromptData holds the variables available to prompt templates.
+// Each task only fills in the fields listed in its definition.
+type PromptData struct {
+	Title    string
+	Content  string
+	URL      string
+	Question string
+	Notes    string
+	Period   string // "day", "week" or "month"
+	Now      string // the user's local date and time, e.g. "Wednesday, 2024-03-06 14:30"
+	Timezone string
+	Groups   []string
+	Memories []PromptMemory
+	Todos    []PromptTodoGroup
+}
+
+// PromptMemory is a memory as seen by prompt templates
+type PromptMemory struct {
+	Ref      string // short reference such as "M1", for prompts whose answer points at memories
+	Category string
+	Content  string
+}
+
+// PromptTodoGroup is one group's todos as seen by prompt templates
+type PromptTodoGroup struct {
+	Name  string
+	Todos []PromptTodo
+}
+
+// PromptTodo is a todo as seen by prompt templates. Activity says what happened
+// to it during the period, e.g. "added, completed" or "overdue, due 2024-03-01".
+type PromptTodo struct {
+	Ref      string // short reference such as "T1"
+	ID       string // not shown to the model; maps refs in the answer back
+	Title    string
+	Activity string
+}
+
+// promptDefinition is a built-in prompt template shipped with the binary.
+// Bump Version whenever Template changes so cached responses are invalidated.
+type promptDefinition struct {
+	Name        string
+	Description string
+	Variables   []string
+	Version     int
+	Template    string
+}
+
+var defaultPrompts = map[string]promptDefinition{
+	PromptTodoProcessing: {
+		Name:        PromptTodoProcessing,
+		Description: "Cleans a todo title and extracts tags",
+		Variables:   []string{"Title"},
+		Version:     1,
+		Template: `You are a todo assistant. Clean the following todo input and extract tags.
+
+Input: "{{.Title}}"
+
+INSTRUCTIONS:
+1. title: Clean the title - fix typos, capitalize first letter, keep it concise. The title has already been cleaned of date/time references by the frontend, so just focus on grammar and clarity.
+2. tags: Extract 1-5 relevant tags (lowercase, single words like "shopping", "work", "health", "meeting", "errand")
+
+Respond with ONLY valid JSON (no markdown, no code blocks, no explanation):
+{"title": "cleaned title", "tags": ["tag1", "tag2"]}`,
+	},
+	PromptTodoParsing: {
+		Name:        PromptTodoParsing,
+		Description: "Reads due date, priority, group and recurrence from a todo the built-in parser couldn't",
+		Variables:   []string{"Title", "Now", "Timezone", "Groups"},
+		Version:     1,
+		Template: `You are a todo assistant. Read this todo, written in plain language, and extract its details.
+
+Input: "{{.Title}}"
+It is now {{.Now}} ({{.Timezone}}).
+{{if .Groups}}The user's groups: {{range $i, $g := .Groups}}{{if $i}}, {{end}}{{$g}}{{end}}{{end}}
+
+INSTRUCTIONS:
+1. title: The task itself with every date, time, priority, group and repetition phrase removed. Fix typos, capitalize the first letter, keep it concise.
+2. tags: 1-5 relevant tags (lowercase, single words like "shopping", "work", "health")
+3. due_date: When it is due as YYYY-MM-DD, relative to now. Empty string if no date or time is mentioned.
+4. due_time: The time of day as HH:MM (24-hour). Empty string if none is mentioned.
+5. priority: "high", "medium" or "low" only if the input says how important or urgent it is, otherwise empty string.
+6. group: One of the user's groups, spelled exactly as listed, only if the input clearly names it. Otherwise empty string.
+7. recurrence: An RFC 5545 RRULE without the "RRULE:" prefix (e.g. "FREQ=WEEKLY;BYDAY=MO") if the task repeats, otherwise empty string.
+
+Respond with ONLY valid JSON (no markdown, no code blocks, no explanation):
+{"title": "...", "tags": ["tag1"], "due_date": "", "due_time": "", "priority": "", "group": "", "recurrence": ""}`,
+	},
+	PromptMemoryCategorization: {
+		Name:        PromptMemoryCategorization,
+		Description: "Summarizes and categorizes a memory when function calling is unavailable",
+		Variables:   []string{"Content"},
+		Version:     1,
+		Template: `You are a personal memory organizer. Analyze this note/memory and categorize it.
+
+Input: "{{.Content}}"
+
+INSTRUCTIONS:
+1. summary: If the content is longer than 50 characters, provide a concise 1-sentence summary. Otherwise leave empty string.
+2. category: Choose the BEST matching category from this list ONLY:
+   - Websites (for links, tools, apps, online resources)
+   - Food (for restaurants, recipes, dishes, drinks)
+   - Movies (for films, TV shows, videos, streaming content)
+   - Books (for books, articles, reading material)
+   - Ideas (for thoughts, concepts, project ideas)
+   - Places (for locations, travel destinations, venues)
+   - Products (for items to buy, gadgets, purchases)
+   - People (for contacts, people met, networking)
+   - Learnings (for lessons learned, TIL, insights)
+   - Quotes (for memorable phrases, sayings)
+   - Uncategorized (if nothing else fits)
+
+Respond with ONLY valid JSON (no markdown, no code blocks):
+{"summary": "", "category": "Category Name"}`,
+	},
+	PromptMemoryFunctionCalling: {
+		Name:        PromptMemoryFunctionCalling,
+		Description: "Chooses between categorizing a memory and searching the web",
+		Variables:   []string{"Content"},
+		Version:     1,
+		Template: `Analyze this memory/note and take the appropriate action.
+
+Content: "{{.Content}}"
+
+Instructions:
+1. If the content indicates the user wants to search/research something (e.g., "search about X", "find info on Y", "look up Z", "what is X", "research about W"), use the web_search function with the extracted search query.
+2. If the content contains a URL (http/https), use categorize_memory with has_url=true and include the URL.
+3. Otherwise, use categorize_memory to categorize the note with a summary and category.
+
+Choose the most appropriate function based on the content.`,
+	},
+	PromptURLSummary: {
+		Name:        PromptURLSummary,
+		Description: "Summarizes a scraped webpage",
+		Variables:   []string{"URL", "Content"},
+		Version:     1,
+		Template: `Summarize this webpage content concisely.
+
+URL: {{.URL}}
+Content: {{.Content}}
+
+Respond with ONLY valid JSON:
+{"title": "page title or descriptive title", "summary": "1-2 sentence summary of what this page is about"}`,
+	},
+	PromptWeeklyDigest: {
+		Name:        PromptWeeklyDigest,
+		Description: "Writes the daily, weekly or monthly digest of memories and todos",
+		Variables:   []string{"Period", "Memories", "Todos"},
+		Version:     3,
+		Template: `You are a personal assistant reviewing someone's memories/notes from the past {{.Period}}.
+{{if .Memories}}
+Here are the memories from this {{.Period}}:
+{{range .Memories}}- [{{.Category}}] {{.Content}}
+{{end}}{{end}}{{if .Todos}}
+Here is their todo activity this {{.Period}}, by list:
+{{range .Todos}}{{.Name}}:
+{{range .Todos}}- {{.Title}} ({{.Activity}})
+{{end}}{{end}}{{end}}
+Create a brief, friendly digest of the {{.Period}} that:
+1. Highlights interesting patterns or themes
+2. Mentions standout items worth revisiting
+3. Notes any categories that were particularly active
+4. Recaps what got done and calls out todos that are falling behind
+5. Keeps a conversational, helpful tone
+
+Keep the digest to 3-4 short paragraphs. Be specific and reference actual items.`,
+	},
+	PromptDigestInsights: {
+		Name:        PromptDigestInsights,
+		Description: "Finds connections between a digest period's memories and todos",
+		Variables:   []string{"Period", "Memories", "Todos"},
+		Version:     1,
+		Template: `You are a personal assistant looking for connections between someone's notes and their todos from the past {{.Period}}.
+
+Memories:
+{{range .Memories}}- {{.Ref}} [{{.Category}}] {{.Content}}
+{{end}}
+Todos:
+{{range .Todos}}{{$group := .Name}}{{range .Todos}}- {{.Ref}} [{{$group}}] {{.Title}} ({{.Activity}})
+{{end}}{{end}}
+Find up to 3 insights that link related memories and todos, for example a note that could help with an open todo, a theme shared by notes and finished work, or a todo that keeps slipping while related notes pile up. Refer to items by their reference (M1, T2, ...). Only link items that are genuinely related, and return an empty list if nothing is.
+
+Respond with ONLY valid JSON (no markdown, no code blocks):
+{"insights": [{"text": "one or two sentences", "memories": ["M1"], "todos": ["T2"]}]}`,
+	},
+	PromptSearchQueries: {
+		Name:        PromptSearchQueries,
+		Description: "Generates web search queries for internet and hybrid Ask modes",
+		Variables:   []string{"Question", "Notes"},
+		Version:     1,
+		Template: `{{if .Notes}}Based on this question and the user's personal notes, generate 2-3 focused web search queries.
+
+QUESTION: {{.Question}}
+
+USER'S NOTES:
+{{.Notes}}
+
+Generate queries that would help validate or expand on specific points from their notes.
+{{else}}Convert this question into 2-3 focused web search queries.
+
+QUESTION: {{.Question}}
+
+Break it down into specific, searchable topics.
+{{end}}Return ONLY a JSON object, no other text: {"queries": ["query1", "query2"]}`,
+	},
+	PromptVisionExtraction: {
+		Name:        PromptVisionExtraction,
+		Description: "Extracts notes and details from an uploaded image",
+		Variables:   []string{},
+		Version:     1,
+		Template: `Analyze this image carefully and extract all relevant information. Focus on:
+
+1. **Notes & Text**: Extract any handwritten or printed text, lists, bullet points
+2. **Planning Items**: Identify any tasks, to-dos, action items, deadlines, or scheduling information
+3. **Key Details**: Important facts, numbers, names, dates, or references
+4. **Ideas & Concepts**: Main themes, ideas, or concepts shown
+5. **Structure**: How the information is organized (lists, mind maps, diagrams, etc.)
+
+Respond with ONLY valid JSON (no markdown, no code blocks):
+{
+  "content": "The complete extracted text and information from the image, formatted clearly with line breaks where appropriate",
+  "summary": "A brief 1-2 sentence summary of what this image contains",
+  "category": "Choose the best category from: Ideas, Learnings, Quotes, Products, Places, People, Books, Movies, Food, Websites, Uncategorized",
+  "tags": ["tag1", "tag2", "tag3"]
+}`,
+	},
+}
+
+// defaultPromptNames returns the built-in template names in a stable order
+func defaultPromptNames() []string {
+	names := make([]string, 0, len(defaultPrompts))
+	for name := range defaultPrompts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parsePromptTemplate compiles template text, reporting syntax errors with the template name
+func parsePromptTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Parse(text)
+}
+
+// executePromptTemplate renders template text with data
+func executePromptTemplate(name, text string, data PromptData) (string, error) {
+	tmpl, err := parsePromptTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// PromptSet resolves prompt templates for one user. A nil PromptSet uses the built-in defaults.
+type PromptSet struct {
+	overrides map[string]*models.PromptTemplate
+}
+
+// NewPromptSet builds a PromptSet from a user's active template overrides
+func NewPromptSet(overrides []models.PromptTemplate) *PromptSet {
+	set := &PromptSet{overrides: make(map[string]*models.PromptTemplate, len(overrides))}
+	for i := range overrides {
+		set.overrides[overrides[i].Name] = &overrides[i]
+	}
+	return set
+}
+
+// Version identifies the template text used for a task, e.g. "default-v1" or "custom-v3"
+func (p *PromptSet) Version(name string) string {
+	if p != nil {
+		if override, ok := p.overrides[name]; ok {
+			return fmt.Sprintf("custom-v%d", override.Version)
+		}
+	}
+	return fmt.Sprintf("default-v%d", defaultPrompts[name].Version)
+}
+
+// cacheVersion identifies a template for response caching. Custom version numbers
+// are per user, so overrides are identified by a hash of their text instead.
+func (p *PromptSet) cacheVersion(name string) string {
+	if p != nil {
+		if override, ok := p.overrides[name]; ok {
+			sum := sha256.Sum256([]byte(override.Template))
+			return "custom-" + hex.EncodeToString(sum[:8])
+		}
+	}
+	return p.Version(name)
+}
+
+// Render renders the named prompt with data. A user override that fails to render
+// falls back to the built-in default so a bad template never blocks AI processing.
+func (p *PromptSet) Render(name string, data PromptData) string {
+	def, ok := defaultPrompts[name]
+	if !ok {
+		log.Printf("[Prompts] Unknown prompt template %q", name)
+		return ""
+	}
+
+	if p != nil {
+		if override, ok := p.overrides[name]; ok {
+			prompt, err := executePromptTemplate(name, override.Template, data)
+			if err == nil {
+				return prompt
+			}
+			log.Printf("[Prompts] Custom %s template v%d failed, using default: %v", name, override.Version, err)
+		}
+	}
+
+	prompt, err := executePromptTemplate(name, def.Template, data)
+	if err != nil {
+		// Defaults are covered by the binary, so this only happens on a programming error
+		log.Printf("[Prompts] Default %s template failed: %v", name, err)
+		return ""
+	}
+	return prompt
+}
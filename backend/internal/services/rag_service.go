@@ -24,6 +24,7 @@ type RAGService struct {
 	aiService        *AIService
 	aiProviderSvc    *AIProviderService
 	scraperService   *ScraperService
+	promptService    *PromptTemplateService
 }
 
 // RAGConfig holds configuration for the RAG service
@@ -42,6 +43,7 @@ func NewRAGService(
 	aiService *AIService,
 	aiProviderSvc *AIProviderService,
 	scraperService *ScraperService,
+	promptService *PromptTemplateService,
 ) *RAGService {
 	return &RAGService{
 		vectorRepo:       vectorRepo,
@@ -52,6 +54,7 @@ func NewRAGService(
 		aiService:        aiService,
 		aiProviderSvc:    aiProviderSvc,
 		scraperService:   scraperService,
+		promptService:    promptService,
 	}
 }
 
@@ -286,15 +289,23 @@ func (s *RAGService) Ask(ctx context.Context, userID string, req *models.AskRequ
 
 	var contextStr string
 	var sources []models.SearchResult
+	var report *models.ContextReport
+
+	// Retrieved context is fitted into what the model's window leaves after the answer prompt
+	budget := s.newAnswerBudget(userID, req.Question)
 
 	switch req.Mode {
 	case models.AskModeMemories:
 		// Search memories/todos (current behavior)
-		contextStr, sources = s.getMemoriesContext(ctx, userID, req)
+		memItems, memSources := s.getMemoriesContext(ctx, userID, req)
+		fitted, memReport := budget.Fit(memItems, 0)
+		contextStr = joinContextItems(fitted)
+		sources = fittedSources(memSources, fitted)
+		report = &memReport
 
 	case models.AskModeInternet:
 		// Web search + scrape top results
-		webCtx, webSources, err := s.getInternetContext(ctx, req.Question)
+		webItems, webSources, err := s.getInternetContext(ctx, req.Question)
 		if err != nil {
 			log.Printf("[RAG] Internet search error: %v", err)
 			return &models.AskResponse{
@@ -304,8 +315,10 @@ func (s *RAGService) Ask(ctx context.Context, userID string, req *models.AskRequ
 				TimeTaken: float64(time.Since(startTime).Milliseconds()),
 			}, nil
 		}
-		contextStr = webCtx
-		sources = webSources
+		fitted, webReport := budget.Fit(webItems, 0)
+		contextStr = joinContextItems(fitted)
+		sources = fittedSources(webSources, fitted)
+		report = &webReport
 
 	case models.AskModeHybrid:
 		// Enhanced 4-step hybrid pipeline:
@@ -314,8 +327,11 @@ func (s *RAGService) Ask(ctx context.Context, userID string, req *models.AskRequ
 		// Step 3: Web search with generated queries
 		// Step 4: Final synthesis with all context
 
-		// Step 1: Get memories context
-		memCtx, memSources := s.getMemoriesContext(ctx, userID, req)
+		// Step 1: Get memories context, keeping at least half the budget for the web
+		memItems, memSources := s.getMemoriesContext(ctx, userID, req)
+		fittedMem, memReport := budget.Fit(memItems, budget.Remaining()/2)
+		memCtx := joinContextItems(fittedMem)
+		memSources = fittedSources(memSources, fittedMem)
 		log.Printf("[RAG Hybrid] Step 1: Got %d memory sources", len(memSources))
 
 		// Step 2: Generate smart search queries using LLM
@@ -328,34 +344,45 @@ func (s *RAGService) Ask(ctx context.Context, userID string, req *models.AskRequ
 		}
 
 		// Step 3: Web search with each generated query (max 3)
-		var allWebCtx strings.Builder
+		var webItems []ContextItem
 		var webSources []models.SearchResult
+		seenURLs := make(map[string]bool)
 
 		for i, query := range searchQueries {
 			if i >= 3 {
 				break // Limit to 3 queries
 			}
 
-			webCtx, webSrcs, err := s.getInternetContext(ctx, query)
+			items, webSrcs, err := s.getInternetContext(ctx, query)
 			if err != nil {
 				log.Printf("[RAG Hybrid] Step 3: Web search failed for query '%s': %v", query, err)
 				continue
 			}
 
-			if webCtx != "" {
-				allWebCtx.WriteString(fmt.Sprintf("\n--- Search: %s ---\n%s\n", query, webCtx))
-				webSources = append(webSources, webSrcs...)
+			// Different queries often find the same page
+			for j, item := range items {
+				if !seenURLs[item.ID] {
+					seenURLs[item.ID] = true
+					webItems = append(webItems, item)
+					webSources = append(webSources, webSrcs[j])
+				}
 			}
 		}
 		log.Printf("[RAG Hybrid] Step 3: Got %d web sources from %d queries", len(webSources), len(searchQueries))
 
+		fittedWeb, webReport := budget.Fit(webItems, 0)
+		webCtx := joinContextItems(fittedWeb)
+		webSources = fittedSources(webSources, fittedWeb)
+		memReport.Add(webReport)
+		report = &memReport
+
 		// Step 4: Build combined context
-		if memCtx != "" && allWebCtx.Len() > 0 {
-			contextStr = fmt.Sprintf("YOUR PERSONAL DATA:\n%s\n\nWEB RESEARCH:\n%s", memCtx, allWebCtx.String())
+		if memCtx != "" && webCtx != "" {
+			contextStr = fmt.Sprintf("YOUR PERSONAL DATA:\n%s\n\nWEB RESEARCH:\n%s", memCtx, webCtx)
 		} else if memCtx != "" {
 			contextStr = memCtx
 		} else {
-			contextStr = allWebCtx.String()
+			contextStr = webCtx
 		}
 
 		sources = append(memSources, webSources...)
@@ -418,16 +445,62 @@ func (s *RAGService) Ask(ctx context.Context, userID string, req *models.AskRequ
 		return nil, fmt.Errorf("failed to generate answer: %w", err)
 	}
 
+	if report != nil && (len(report.Dropped) > 0 || len(report.Truncated) > 0 || len(report.Summarized) > 0) {
+		log.Printf("[RAG] Context over budget (%d tokens): dropped=%v truncated=%v summarized=%v",
+			report.Budget, report.Dropped, report.Truncated, report.Summarized)
+	}
+
 	return &models.AskResponse{
 		Answer:    answer,
 		Sources:   sources,
 		Question:  req.Question,
 		TimeTaken: float64(time.Since(startTime).Milliseconds()),
+		Context:   report,
 	}, nil
 }
 
-// getMemoriesContext retrieves context from user's memories and todos
-func (s *RAGService) getMemoriesContext(ctx context.Context, userID string, req *models.AskRequest) (string, []models.SearchResult) {
+// answerInstructionTokens covers the fixed instructions of the answer prompts
+const answerInstructionTokens = 400
+
+// newAnswerBudget starts a prompt budget for the user's model with the answer prompt's
+// instructions and question reserved. Without a configured model the defaults apply.
+func (s *RAGService) newAnswerBudget(userID, question string) *PromptBudget {
+	config, err := s.resolveAIConfig(userID)
+	if err != nil {
+		config = &AIProviderConfig{}
+	}
+	budget := NewPromptBudget(config)
+	budget.Reserve(question)
+	budget.remaining -= answerInstructionTokens
+	return budget
+}
+
+// joinContextItems renders fitted context items as prompt context
+func joinContextItems(items []ContextItem) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = item.Text
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// fittedSources keeps the sources whose context made it into the prompt
+func fittedSources(sources []models.SearchResult, fitted []ContextItem) []models.SearchResult {
+	kept := make(map[string]bool, len(fitted))
+	for _, item := range fitted {
+		kept[item.ID] = true
+	}
+	result := make([]models.SearchResult, 0, len(fitted))
+	for _, source := range sources {
+		if kept[source.Document.ContentID] {
+			result = append(result, source)
+		}
+	}
+	return result
+}
+
+// getMemoriesContext retrieves context items from user's memories and todos, best match first
+func (s *RAGService) getMemoriesContext(ctx context.Context, userID string, req *models.AskRequest) ([]ContextItem, []models.SearchResult) {
 	searchReq := &models.SearchRequest{
 		Query:        req.Question,
 		ContentTypes: req.ContentTypes,
@@ -438,17 +511,17 @@ func (s *RAGService) getMemoriesContext(ctx context.Context, userID string, req
 	searchResp, err := s.Search(ctx, userID, searchReq)
 	if err != nil {
 		log.Printf("[RAG] Memory search error: %v", err)
-		return "", nil
+		return nil, nil
 	}
 
 	if len(searchResp.Results) == 0 {
-		return "", nil
+		return nil, nil
 	}
 
 	// Build context from search results
-	contextParts := make([]string, 0, len(searchResp.Results))
+	items := make([]ContextItem, 0, len(searchResp.Results))
 	for i, result := range searchResp.Results {
-		var contextItem string
+		var contextItem, summaryItem string
 		switch result.Document.ContentType {
 		case models.ContentTypeTodo:
 			contextItem = fmt.Sprintf("[Todo %d] %s", i+1, result.Document.Title)
@@ -472,31 +545,47 @@ func (s *RAGService) getMemoriesContext(ctx context.Context, userID string, req
 			}
 			if summary, ok := result.Document.Metadata["summary"]; ok && summary != "" {
 				contextItem += "\n  Summary: " + summary
+				// A long memory can stand in as just its summary
+				summaryItem = fmt.Sprintf("[Memory %d] %s", i+1, summary)
+				if result.Document.Title != "" {
+					summaryItem = fmt.Sprintf("[Memory %d - %s] %s", i+1, result.Document.Title, summary)
+				}
 			}
 		}
-		contextParts = append(contextParts, contextItem)
+
+		label := result.Document.Title
+		if label == "" {
+			label = truncateText(result.Document.Content, 60)
+		}
+		items = append(items, ContextItem{
+			ID:      result.Document.ContentID,
+			Label:   label,
+			Text:    contextItem,
+			Summary: summaryItem,
+			Score:   result.Score,
+		})
 	}
 
-	return strings.Join(contextParts, "\n\n"), searchResp.Results
+	return items, searchResp.Results
 }
 
-// getInternetContext searches the web and scrapes top results
-func (s *RAGService) getInternetContext(ctx context.Context, question string) (string, []models.SearchResult, error) {
+// getInternetContext searches the web and scrapes top results into context items, one per page
+func (s *RAGService) getInternetContext(ctx context.Context, question string) ([]ContextItem, []models.SearchResult, error) {
 	if s.scraperService == nil {
-		return "", nil, fmt.Errorf("web search not configured")
+		return nil, nil, fmt.Errorf("web search not configured")
 	}
 
 	// Search the web
 	searchResults, err := s.scraperService.SearchWeb(question)
 	if err != nil {
-		return "", nil, fmt.Errorf("web search failed: %w", err)
+		return nil, nil, fmt.Errorf("web search failed: %w", err)
 	}
 
 	if len(searchResults) == 0 {
-		return "", nil, fmt.Errorf("no web results found")
+		return nil, nil, fmt.Errorf("no web results found")
 	}
 
-	var contextParts []string
+	var items []ContextItem
 	var sources []models.SearchResult
 	successfulScrapes := 0
 
@@ -524,8 +613,20 @@ func (s *RAGService) getInternetContext(ctx context.Context, question string) (s
 			content = result.Snippet
 		}
 
-		contextItem := fmt.Sprintf("[Web %d - %s]\nURL: %s\n%s", i+1, title, result.URL, content)
-		contextParts = append(contextParts, contextItem)
+		score := 1.0 - float64(i)*0.1 // Decreasing score by rank
+
+		// The search snippet stands in for a page too long to include
+		var summaryItem string
+		if result.Snippet != "" && result.Snippet != content {
+			summaryItem = fmt.Sprintf("[Web %d - %s]\nURL: %s\n%s", i+1, title, result.URL, result.Snippet)
+		}
+		items = append(items, ContextItem{
+			ID:      result.URL,
+			Label:   title,
+			Text:    fmt.Sprintf("[Web %d - %s]\nURL: %s\n%s", i+1, title, result.URL, content),
+			Summary: summaryItem,
+			Score:   score,
+		})
 
 		// Create synthetic SearchResult for source attribution
 		webDoc := &models.Document{
@@ -542,62 +643,35 @@ func (s *RAGService) getInternetContext(ctx context.Context, question string) (s
 
 		sources = append(sources, models.SearchResult{
 			Document:  webDoc,
-			Score:     1.0 - float64(i)*0.1, // Decreasing score by rank
+			Score:     score,
 			MatchType: "web",
 		})
 	}
 
-	if len(contextParts) == 0 {
-		return "", nil, fmt.Errorf("failed to scrape any web results")
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("failed to scrape any web results")
 	}
 
-	return strings.Join(contextParts, "\n\n"), sources, nil
+	return items, sources, nil
 }
 
 // generateSearchQueries uses LLM to create optimized web search queries based on question and context
 func (s *RAGService) generateSearchQueries(ctx context.Context, userID, question, memoriesContext string) ([]string, error) {
-	var prompt string
-
-	if memoriesContext != "" {
-		prompt = fmt.Sprintf(`Based on this question and the user's personal notes, generate 2-3 focused web search queries.
-
-QUESTION: %s
-
-USER'S NOTES:
-%s
-
-Generate queries that would help validate or expand on specific points from their notes.
-Return ONLY a JSON array of strings, no other text: ["query1", "query2"]`, question, memoriesContext)
-	} else {
-		prompt = fmt.Sprintf(`Convert this question into 2-3 focused web search queries.
-
-QUESTION: %s
-
-Break it down into specific, searchable topics.
-Return ONLY a JSON array of strings, no other text: ["query1", "query2"]`, question)
-	}
-
-	response, err := s.callAIProvider(ctx, userID, prompt)
+	config, err := s.resolveAIConfig(userID)
 	if err != nil {
 		return nil, err
 	}
+	prompt := config.Prompts.Render(PromptSearchQueries, PromptData{Question: question, Notes: memoriesContext})
 
-	// Parse JSON array
-	var queries []string
-	// Try to extract JSON from the response (LLM might add extra text)
-	response = strings.TrimSpace(response)
-	// Find the JSON array in the response
-	startIdx := strings.Index(response, "[")
-	endIdx := strings.LastIndex(response, "]")
-	if startIdx != -1 && endIdx != -1 && endIdx > startIdx {
-		jsonStr := response[startIdx : endIdx+1]
-		if err := json.Unmarshal([]byte(jsonStr), &queries); err == nil && len(queries) > 0 {
-			log.Printf("[RAG] Generated search queries: %v", queries)
-			return queries, nil
-		}
+	var result struct {
+		Queries []string `json:"queries"`
+	}
+	if err := generateStructured(config, prompt, searchQueriesOutputSchema, &result); err == nil && len(result.Queries) > 0 {
+		log.Printf("[RAG] Generated search queries: %v", result.Queries)
+		return result.Queries, nil
 	}
 
-	// Fallback: return original question if JSON parsing fails
+	// Fallback: return original question if no valid queries came back
 	log.Printf("[RAG] Failed to parse search queries, using original question")
 	return []string{question}, nil
 }
@@ -701,7 +775,15 @@ ANSWER:`, sourceDescription, contextStr, question)
 
 // callAIProvider calls the configured AI provider with the given prompt
 func (s *RAGService) callAIProvider(ctx context.Context, userID, prompt string) (string, error) {
+	config, err := s.resolveAIConfig(userID)
+	if err != nil {
+		return "", err
+	}
+	return callProvider(config, prompt)
+}
 
+// resolveAIConfig returns the user's default AI provider config, falling back to the env config
+func (s *RAGService) resolveAIConfig(userID string) (*AIProviderConfig, error) {
 	// Try to use user's configured AI provider first
 	if s.aiProviderSvc != nil {
 		provider, err := s.aiProviderSvc.GetDefaultByUserID(userID)
@@ -712,36 +794,33 @@ func (s *RAGService) callAIProvider(ctx context.Context, userID, prompt string)
 				if provider.SelectedModel != nil {
 					model = *provider.SelectedModel
 				}
-				config := &AIProviderConfig{
-					ProviderType: provider.ProviderType,
-					BaseURL:      provider.BaseURL,
-					APIKey:       apiKey,
-					Model:        model,
-				}
-				switch config.ProviderType {
-				case models.ProviderTypeAnthropic:
-					return callAnthropic(config, prompt)
-				case models.ProviderTypeGoogle:
-					return callGoogle(config, prompt)
-				default:
-					return callOpenAICompatible(config, prompt)
-				}
+				caps, _ := s.aiProviderSvc.GetModelCapabilities(provider.ID, model)
+				return &AIProviderConfig{
+					ProviderType:  provider.ProviderType,
+					BaseURL:       provider.BaseURL,
+					APIKey:        apiKey,
+					Model:         model,
+					Prompts:       s.promptService.GetPromptSet(userID),
+					UserID:        userID,
+					ContextWindow: caps.ContextWindow,
+				}, nil
 			}
 		}
 	}
 
 	// Fall back to default AI service
 	if s.aiService != nil && s.aiService.IsConfigured() {
-		config := &AIProviderConfig{
+		return &AIProviderConfig{
 			ProviderType: models.ProviderTypeOpenAI,
 			BaseURL:      s.aiService.baseURL,
 			APIKey:       s.aiService.apiKey,
 			Model:        s.aiService.model,
-		}
-		return callOpenAICompatible(config, prompt)
+			Prompts:      s.promptService.GetPromptSet(userID),
+			UserID:       userID,
+		}, nil
 	}
 
-	return "", fmt.Errorf("no AI service configured")
+	return nil, fmt.Errorf("no AI service configured")
 }
 
 // ==========================================
@@ -760,6 +839,11 @@ func (s *RAGService) IndexAllForUser(ctx context.Context, userID string) (*model
 	if err != nil {
 		log.Printf("[RAG] Error fetching todos: %v", err)
 	} else {
+		byID := make(map[string]*models.Todo, len(todos))
+		for i := range todos {
+			byID[todos[i].ID] = &todos[i]
+		}
+
 		for _, todo := range todos {
 			// Check if already indexed
 			if s.vectorRepo.GetByContentID(models.ContentTypeTodo, todo.ID) != nil {
@@ -767,7 +851,17 @@ func (s *RAGService) IndexAllForUser(ctx context.Context, userID string) (*model
 				continue
 			}
 
-			doc := s.todoToDocument(&todo)
+			var ancestors []models.Todo
+			for parentID := todo.ParentID; parentID != nil && len(ancestors) < len(todos); {
+				parent, ok := byID[*parentID]
+				if !ok {
+					break
+				}
+				ancestors = append([]models.Todo{*parent}, ancestors...)
+				parentID = parent.ParentID
+			}
+
+			doc := s.todoToDocument(&todo, ancestors)
 			if err := s.vectorRepo.Add(ctx, doc); err != nil {
 				log.Printf("[RAG] Error indexing todo %s: %v", todo.ID, err)
 				errors++
@@ -818,7 +912,13 @@ func (s *RAGService) IndexTodo(ctx context.Context, todo *models.Todo) error {
 	// Delete existing if present
 	s.vectorRepo.DeleteByContentID(ctx, models.ContentTypeTodo, todo.ID)
 
-	doc := s.todoToDocument(todo)
+	// Subtasks carry the titles of the todos above them
+	ancestors, err := s.todoRepo.GetAncestors(todo.ID)
+	if err != nil {
+		return err
+	}
+
+	doc := s.todoToDocument(todo, ancestors)
 	return s.vectorRepo.Add(ctx, doc)
 }
 
@@ -847,11 +947,20 @@ func (s *RAGService) DeleteFromIndex(ctx context.Context, contentType models.Con
 // Helpers
 // ==========================================
 
-func (s *RAGService) todoToDocument(todo *models.Todo) *models.Document {
+// todoToDocument builds a todo's document. ancestors are the todos above a
+// subtask, from the top level down.
+func (s *RAGService) todoToDocument(todo *models.Todo, ancestors []models.Todo) *models.Document {
 	content := todo.Title
 	if todo.Description != nil && *todo.Description != "" {
 		content += "\n" + *todo.Description
 	}
+	if len(ancestors) > 0 {
+		titles := make([]string, len(ancestors))
+		for i, ancestor := range ancestors {
+			titles[i] = ancestor.Title
+		}
+		content += "\nSubtask of: " + strings.Join(titles, " > ")
+	}
 
 	metadata := map[string]string{
 		"priority": string(todo.Priority),
@@ -871,6 +980,10 @@ func (s *RAGService) todoToDocument(todo *models.Todo) *models.Document {
 		metadata["due_date"] = *todo.DueDate
 	}
 
+	if todo.ParentID != nil {
+		metadata["parent_id"] = *todo.ParentID
+	}
+
 	return &models.Document{
 		ContentType: models.ContentTypeTodo,
 		ContentID:   todo.ID,
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+// ReminderChannel delivers reminders to one kind of destination
+type ReminderChannel interface {
+	Name() models.NotificationChannel
+	// Targets lists where the user receives reminders through this channel,
+	// such as an email address. Deliveries are recorded per target, so a retry
+	// only resends to the targets that failed.
+	Targets(userID string) ([]string, error)
+	Send(userID, target string, notification *models.ReminderNotification) error
+}
+
+// EmailReminderChannel emails reminders to the user's account address
+type EmailReminderChannel struct {
+	email        *EmailService
+	userRepo     *repository.UserRepository
+	reminderRepo *repository.ReminderRepository
+}
+
+func NewEmailReminderChannel(email *EmailService, userRepo *repository.UserRepository, reminderRepo *repository.ReminderRepository) *EmailReminderChannel {
+	return &EmailReminderChannel{
+		email:        email,
+		userRepo:     userRepo,
+		reminderRepo: reminderRepo,
+	}
+}
+
+func (c *EmailReminderChannel) Name() models.NotificationChannel {
+	return models.ChannelEmail
+}
+
+func (c *EmailReminderChannel) Targets(userID string) ([]string, error) {
+	if !c.email.IsConfigured() {
+		return nil, nil
+	}
+	settings, err := c.reminderRepo.GetSettings(userID)
+	if err != nil || !settings.EmailEnabled {
+		return nil, err
+	}
+	user, err := c.userRepo.GetByID(userID)
+	if err != nil || user == nil || user.Email == "" {
+		return nil, err
+	}
+	return []string{user.Email}, nil
+}
+
+func (c *EmailReminderChannel) Send(userID, target string, notification *models.ReminderNotification) error {
+	var text strings.Builder
+	text.WriteString(notification.Title + "\n")
+	if due, ok := parseDueTime(notification.DueDate); ok {
+		fmt.Fprintf(&text, "\nDue %s\n", due.Format("Mon, Jan 2 2006 at 15:04 MST"))
+	}
+	if notification.Description != nil && *notification.Description != "" {
+		text.WriteString("\n" + *notification.Description + "\n")
+	}
+
+	return c.email.Send(&Email{
+		To:      target,
+		Subject: "Reminder: " + notification.Title,
+		Text:    text.String(),
+	})
+}
+
+// WebhookReminderChannel posts reminders as JSON to the user's webhook URL,
+// signed with HMAC-SHA256 of the body in the X-Memlane-Signature header
+type WebhookReminderChannel struct {
+	reminderRepo *repository.ReminderRepository
+	client       *http.Client
+}
+
+func NewWebhookReminderChannel(reminderRepo *repository.ReminderRepository) *WebhookReminderChannel {
+	return &WebhookReminderChannel{
+		reminderRepo: reminderRepo,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *WebhookReminderChannel) Name() models.NotificationChannel {
+	return models.ChannelWebhook
+}
+
+func (c *WebhookReminderChannel) Targets(userID string) ([]string, error) {
+	settings, err := c.reminderRepo.GetSettings(userID)
+	if err != nil || settings.WebhookURL == nil {
+		return nil, err
+	}
+	return []string{*settings.WebhookURL}, nil
+}
+
+func (c *WebhookReminderChannel) Send(userID, target string, notification *models.ReminderNotification) error {
+	settings, err := c.reminderRepo.GetSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Memlane-Webhook/1.0")
+	req.Header.Set("X-Memlane-Event", "reminder")
+	if settings.WebhookSecret != nil {
+		mac := hmac.New(sha256.New, []byte(*settings.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Memlane-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PushReminderChannel sends reminders to every browser the user subscribed
+// for Web Push. Subscriptions the push service has dropped are deleted.
+type PushReminderChannel struct {
+	push         *WebPush
+	reminderRepo *repository.ReminderRepository
+}
+
+func NewPushReminderChannel(push *WebPush, reminderRepo *repository.ReminderRepository) *PushReminderChannel {
+	return &PushReminderChannel{
+		push:         push,
+		reminderRepo: reminderRepo,
+	}
+}
+
+func (c *PushReminderChannel) Name() models.NotificationChannel {
+	return models.ChannelPush
+}
+
+func (c *PushReminderChannel) Targets(userID string) ([]string, error) {
+	if !c.push.IsConfigured() {
+		return nil, nil
+	}
+	subs, err := c.reminderRepo.GetPushSubscriptions(userID)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]string, len(subs))
+	for i, sub := range subs {
+		targets[i] = sub.ID
+	}
+	return targets, nil
+}
+
+func (c *PushReminderChannel) Send(userID, target string, notification *models.ReminderNotification) error {
+	subs, err := c.reminderRepo.GetPushSubscriptions(userID)
+	if err != nil {
+		return err
+	}
+	var sub *models.PushSubscription
+	for i := range subs {
+		if subs[i].ID == target {
+			sub = &subs[i]
+		}
+	}
+	if sub == nil {
+		// Unsubscribed since the reminder started going out
+		return nil
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPushPayload {
+		trimmed := *notification
+		trimmed.Description = nil
+		if payload, err = json.Marshal(&trimmed); err != nil {
+			return err
+		}
+	}
+
+	err = c.push.Send(sub, payload)
+	if errors.Is(err, ErrPushSubscriptionGone) {
+		if _, err := c.reminderRepo.DeletePushSubscription(userID, sub.ID); err != nil {
+			log.Printf("[PushReminderChannel] Failed to delete push subscription %s: %v", sub.ID, err)
+		}
+		return nil
+	}
+	return err
+}
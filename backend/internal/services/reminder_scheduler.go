@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/repository"
+)
+
+const (
+	// reminderBatchSize is how many due reminders one run sends at most
+	reminderBatchSize = 100
+	// reminderClaimTimeout is how long a reminder may stay claimed before
+	// another run assumes the one sending it died and takes over
+	reminderClaimTimeout = 5 * time.Minute
+	// maxReminderAttempts is how often a failing reminder is tried before it
+	// is given up on
+	maxReminderAttempts = 5
+	// reminderRetryDelay is the wait before the first retry, doubling after that
+	reminderRetryDelay = time.Minute
+)
+
+// ReminderScheduler sends due reminders through every channel the user set up.
+// Delivery state lives in the database: reminders are claimed before sending,
+// and each successful delivery is recorded, so a restart neither drops due
+// reminders nor repeats deliveries that went through.
+type ReminderScheduler struct {
+	reminderRepo *repository.ReminderRepository
+	todoRepo     *repository.TodoRepository
+	channels     []ReminderChannel
+}
+
+func NewReminderScheduler(reminderRepo *repository.ReminderRepository, todoRepo *repository.TodoRepository, channels ...ReminderChannel) *ReminderScheduler {
+	return &ReminderScheduler{
+		reminderRepo: reminderRepo,
+		todoRepo:     todoRepo,
+		channels:     channels,
+	}
+}
+
+// Run sends due reminders immediately and then every interval until ctx is done
+func (s *ReminderScheduler) Run(ctx context.Context, interval time.Duration) {
+	s.RunOnce(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.RunOnce(now)
+		}
+	}
+}
+
+// RunOnce sends every reminder due at now and returns how many went out
+func (s *ReminderScheduler) RunOnce(now time.Time) int {
+	staleBefore := now.Add(-reminderClaimTimeout)
+	reminders, err := s.reminderRepo.GetDue(now, staleBefore, reminderBatchSize)
+	if err != nil {
+		log.Printf("[ReminderScheduler] Failed to list due reminders: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for i := range reminders {
+		reminder := &reminders[i]
+		claimed, err := s.reminderRepo.Claim(reminder.ID, now, staleBefore)
+		if err != nil {
+			log.Printf("[ReminderScheduler] Failed to claim reminder %s: %v", reminder.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if s.deliver(reminder, now) {
+			sent++
+		}
+	}
+
+	if sent > 0 {
+		log.Printf("[ReminderScheduler] Sent %d reminders", sent)
+	}
+	return sent
+}
+
+// deliver sends a claimed reminder to the targets it hasn't reached yet and
+// records the outcome. It reports whether the reminder is now fully sent.
+func (s *ReminderScheduler) deliver(reminder *models.Reminder, now time.Time) bool {
+	todo, err := s.todoRepo.GetByID(reminder.TodoID)
+	if err != nil {
+		s.retry(reminder, now, []string{err.Error()})
+		return false
+	}
+	// Todos finished before their reminder don't need one
+	if todo == nil || todo.Status.IsDone() {
+		s.finish(reminder, models.ReminderSkipped, reminder.Attempts, "todo is already done", nil, nil)
+		return false
+	}
+
+	delivered, err := s.reminderRepo.GetDeliveries(reminder.ID)
+	if err != nil {
+		s.retry(reminder, now, []string{err.Error()})
+		return false
+	}
+
+	notification := &models.ReminderNotification{
+		ReminderID:  reminder.ID,
+		TodoID:      todo.ID,
+		Title:       todo.Title,
+		Description: todo.Description,
+		DueDate:     todo.DueDate,
+		FireAt:      *reminder.FireAt,
+	}
+
+	targets := 0
+	var failures []string
+	for _, channel := range s.channels {
+		list, err := channel.Targets(reminder.UserID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", channel.Name(), err))
+			continue
+		}
+		for _, target := range list {
+			targets++
+			if delivered[string(channel.Name())+":"+target] {
+				continue
+			}
+			if err := channel.Send(reminder.UserID, target, notification); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", channel.Name(), err))
+				continue
+			}
+			if err := s.reminderRepo.AddDelivery(reminder.ID, channel.Name(), target); err != nil {
+				log.Printf("[ReminderScheduler] Failed to record delivery of reminder %s: %v", reminder.ID, err)
+			}
+		}
+	}
+
+	switch {
+	case len(failures) > 0:
+		s.retry(reminder, now, failures)
+		return false
+	case targets == 0:
+		s.finish(reminder, models.ReminderSkipped, reminder.Attempts, "no notification channels are set up", nil, nil)
+		return false
+	default:
+		s.finish(reminder, models.ReminderSent, reminder.Attempts+1, "", nil, &now)
+		return true
+	}
+}
+
+// retry puts a reminder back to be tried again with exponential backoff, or
+// marks it failed once it has used up its attempts
+func (s *ReminderScheduler) retry(reminder *models.Reminder, now time.Time, failures []string) {
+	attempts := reminder.Attempts + 1
+	message := strings.Join(failures, "; ")
+	log.Printf("[ReminderScheduler] Failed to send reminder %s (attempt %d): %s", reminder.ID, attempts, message)
+
+	if attempts >= maxReminderAttempts {
+		s.finish(reminder, models.ReminderFailed, attempts, message, nil, nil)
+		return
+	}
+	retryAt := now.Add(reminderRetryDelay << (attempts - 1))
+	s.finish(reminder, models.ReminderPending, attempts, message, &retryAt, nil)
+}
+
+func (s *ReminderScheduler) finish(reminder *models.Reminder, status models.ReminderStatus, attempts int, message string, retryAt, sentAt *time.Time) {
+	var lastError *string
+	if message != "" {
+		lastError = &message
+	}
+	if err := s.reminderRepo.Finish(reminder.ID, status, attempts, lastError, retryAt, sentAt); err != nil {
+		log.Printf("[ReminderScheduler] Failed to update reminder %s: %v", reminder.ID, err)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache is an in-memory LRU cache of LLM results for deterministic tasks
+// (categorization, URL summaries). Entries expire after a TTL and the least
+// recently used entry is evicted once the size limit is reached.
+type ResponseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+
+	hits      int64
+	misses    int64
+	evictions int64
+	expired   int64
+}
+
+type responseCacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// ResponseCacheStats reports cache usage
+type ResponseCacheStats struct {
+	Enabled    bool    `json:"enabled"`
+	Entries    int     `json:"entries"`
+	MaxEntries int     `json:"max_entries"`
+	TTLSeconds int64   `json:"ttl_seconds"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRate    float64 `json:"hit_rate"`
+	Evictions  int64   `json:"evictions"`
+	Expired    int64   `json:"expired"`
+}
+
+// responseCache is shared by all AI calls. It stays nil (disabled) unless
+// EnableResponseCache is called at startup.
+var responseCache *ResponseCache
+
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// EnableResponseCache turns on LLM response caching for deterministic tasks
+func EnableResponseCache(ttl time.Duration, maxEntries int) {
+	responseCache = NewResponseCache(ttl, maxEntries)
+}
+
+// GetResponseCacheStats returns cache hit/miss counters
+func GetResponseCacheStats() ResponseCacheStats {
+	if responseCache == nil {
+		return ResponseCacheStats{Enabled: false}
+	}
+	return responseCache.Stats()
+}
+
+// Get returns the cached value for key if present and not expired
+func (c *ResponseCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*responseCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		c.expired++
+		c.misses++
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	c.hits++
+	return entry.value, true
+}
+
+// Set stores value under key, evicting the least recently used entries over the size limit
+func (c *ResponseCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*responseCacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&responseCacheEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+		c.evictions++
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *ResponseCache) Stats() ResponseCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := ResponseCacheStats{
+		Enabled:    true,
+		Entries:    c.lru.Len(),
+		MaxEntries: c.maxEntries,
+		TTLSeconds: int64(c.ttl.Seconds()),
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+		Expired:    c.expired,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+func (c *ResponseCache) removeElement(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*responseCacheEntry).key)
+}
+
+// responseCacheKey identifies an LLM result by user, provider credentials, model,
+// prompt template version and normalized input. Any change to one of them
+// produces a new key, so one user's results are never served to another.
+func responseCacheKey(task string, config *AIProviderConfig, inputs ...string) string {
+	apiKey := sha256.Sum256([]byte(config.APIKey))
+	h := sha256.New()
+	for _, part := range []string{
+		task,
+		config.UserID,
+		string(config.ProviderType),
+		strings.TrimSuffix(config.BaseURL, "/"),
+		hex.EncodeToString(apiKey[:]),
+		config.Model,
+		config.Prompts.cacheVersion(task),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	for _, input := range inputs {
+		h.Write([]byte(normalizeCacheInput(input)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeCacheInput collapses whitespace so re-uploads with different
+// line endings or indentation still hit the cache
+func normalizeCacheInput(input string) string {
+	return strings.Join(strings.Fields(input), " ")
+}
+
+// cacheLookup decodes a cached result into out. Returns false when caching is
+// disabled, the key is missing, or the entry can't be decoded.
+func cacheLookup(key string, out interface{}) bool {
+	if responseCache == nil {
+		return false
+	}
+
+	value, ok := responseCache.Get(key)
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(value, out); err != nil {
+		log.Printf("[AI-Cache] Failed to decode cached entry: %v", err)
+		return false
+	}
+	return true
+}
+
+// cacheStore saves a result when caching is enabled
+func cacheStore(key string, value interface{}) {
+	if responseCache == nil {
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("[AI-Cache] Failed to encode entry: %v", err)
+		return
+	}
+	responseCache.Set(key, data)
+}
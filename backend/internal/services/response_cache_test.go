@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResponseCacheCounts(t *testing.T) {
+	c := NewResponseCache(time.Minute, 10)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected a miss on an empty cache")
+	}
+	c.Set("a", []byte("1"))
+	if value, ok := c.Get("a"); !ok || string(value) != "1" {
+		t.Fatalf("expected a hit with 1, got %q, %v", value, ok)
+	}
+	c.Get("a")
+	c.Get("b")
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Fatalf("expected 2 hits, 2 misses and 1 entry, got %+v", stats)
+	}
+	if stats.HitRate != 0.5 {
+		t.Fatalf("expected hit rate 0.5, got %v", stats.HitRate)
+	}
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	c := NewResponseCache(20*time.Millisecond, 10)
+	c.Set("a", []byte("1"))
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expected the entry to have expired")
+	}
+	stats := c.Stats()
+	if stats.Expired != 1 || stats.Misses != 1 || stats.Entries != 0 {
+		t.Fatalf("expected 1 expired miss and no entries, got %+v", stats)
+	}
+
+	// Setting again renews the entry
+	c.Set("a", []byte("2"))
+	if value, ok := c.Get("a"); !ok || string(value) != "2" {
+		t.Fatalf("expected a hit with 2, got %q, %v", value, ok)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	c := NewResponseCache(time.Minute, 2)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	// Using a makes b the least recently used
+	c.Get("a")
+	c.Set("c", []byte("3"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Fatalf("expected %s to be kept", key)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Fatalf("expected 1 eviction and 2 entries, got %+v", stats)
+	}
+}
+
+func TestResponseCacheKeyScope(t *testing.T) {
+	config := &AIProviderConfig{BaseURL: "http://llm", APIKey: "key-1", Model: "m", UserID: "user-1"}
+	key := responseCacheKey(PromptMemoryCategorization, config, "some  note\n")
+
+	same := *config
+	if responseCacheKey(PromptMemoryCategorization, &same, "some note") != key {
+		t.Fatal("expected inputs differing only in whitespace to share a key")
+	}
+
+	otherUser := *config
+	otherUser.UserID = "user-2"
+	otherKey := *config
+	otherKey.APIKey = "key-2"
+	for _, other := range []*AIProviderConfig{&otherUser, &otherKey} {
+		if responseCacheKey(PromptMemoryCategorization, other, "some note") == key {
+			t.Fatalf("expected a different key for %+v", other)
+		}
+	}
+}
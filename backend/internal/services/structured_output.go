@@ -0,0 +1,508 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// OutputSchema describes the JSON object a prompt must return.
+// Schema is a JSON Schema subset (type, properties, required, enum, items)
+// that every provider's structured output mode understands.
+type OutputSchema struct {
+	Name        string
+	Description string
+	Schema      map[string]interface{}
+}
+
+// memoryCategoryNames is the fixed set of categories the AI may assign
+var memoryCategoryNames = []string{
+	"Websites", "Food", "Movies", "Books", "Ideas",
+	"Places", "Products", "People", "Learnings", "Quotes", "Uncategorized",
+}
+
+var todoOutputSchema = &OutputSchema{
+	Name:        "todo_result",
+	Description: "Cleaned todo title and extracted tags",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "string"},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required": []string{"title", "tags"},
+	},
+}
+
+var todoParseOutputSchema = &OutputSchema{
+	Name:        "todo_parse",
+	Description: "Todo title, tags and the schedule read from plain text",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "string"},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"due_date":   map[string]interface{}{"type": "string"},
+			"due_time":   map[string]interface{}{"type": "string"},
+			"priority":   map[string]interface{}{"type": "string", "enum": []string{"", "low", "medium", "high"}},
+			"group":      map[string]interface{}{"type": "string"},
+			"recurrence": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"title", "tags", "due_date", "due_time", "priority", "group", "recurrence"},
+	},
+}
+
+var memoryOutputSchema = &OutputSchema{
+	Name:        "memory_result",
+	Description: "Summary and category for a memory",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"summary":  map[string]interface{}{"type": "string"},
+			"category": map[string]interface{}{"type": "string", "enum": memoryCategoryNames},
+		},
+		"required": []string{"category"},
+	},
+}
+
+var urlSummaryOutputSchema = &OutputSchema{
+	Name:        "url_summary",
+	Description: "Title and summary of a webpage",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title":   map[string]interface{}{"type": "string"},
+			"summary": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"title", "summary"},
+	},
+}
+
+var visionOutputSchema = &OutputSchema{
+	Name:        "vision_result",
+	Description: "Information extracted from an image",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content":  map[string]interface{}{"type": "string"},
+			"summary":  map[string]interface{}{"type": "string"},
+			"category": map[string]interface{}{"type": "string", "enum": memoryCategoryNames},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required": []string{"content", "category"},
+	},
+}
+
+var searchQueriesOutputSchema = &OutputSchema{
+	Name:        "search_queries",
+	Description: "Focused web search queries",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"queries": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required": []string{"queries"},
+	},
+}
+
+var digestInsightsOutputSchema = &OutputSchema{
+	Name:        "digest_insights",
+	Description: "Insights linking a period's memories and todos",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"insights": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"text": map[string]interface{}{"type": "string"},
+						"memories": map[string]interface{}{
+							"type":  "array",
+							"items": map[string]interface{}{"type": "string"},
+						},
+						"todos": map[string]interface{}{
+							"type":  "array",
+							"items": map[string]interface{}{"type": "string"},
+						},
+					},
+					"required": []string{"text", "memories", "todos"},
+				},
+			},
+		},
+		"required": []string{"insights"},
+	},
+}
+
+// ========================================
+// Parse failure tracking
+// ========================================
+
+// StructuredOutputStats counts structured output outcomes for one of a user's models
+type StructuredOutputStats struct {
+	Model          string `json:"model"`
+	Requests       int64  `json:"requests"`
+	ParseFailures  int64  `json:"parse_failures"`
+	Repaired       int64  `json:"repaired"`
+	RepairFailures int64  `json:"repair_failures"`
+}
+
+// structuredStats holds each user's counters by model, so users only see
+// outcomes of their own requests
+var (
+	structuredStatsMu sync.Mutex
+	structuredStats   = make(map[string]map[string]*StructuredOutputStats)
+)
+
+func recordStructuredOutcome(config *AIProviderConfig, update func(*StructuredOutputStats)) {
+	structuredStatsMu.Lock()
+	defer structuredStatsMu.Unlock()
+
+	byModel, ok := structuredStats[config.UserID]
+	if !ok {
+		byModel = make(map[string]*StructuredOutputStats)
+		structuredStats[config.UserID] = byModel
+	}
+	stats, ok := byModel[config.Model]
+	if !ok {
+		stats = &StructuredOutputStats{Model: config.Model}
+		byModel[config.Model] = stats
+	}
+	update(stats)
+}
+
+// GetStructuredOutputStats returns the user's per-model parse failure counters, sorted by model
+func GetStructuredOutputStats(userID string) []StructuredOutputStats {
+	structuredStatsMu.Lock()
+	defer structuredStatsMu.Unlock()
+
+	byModel := structuredStats[userID]
+	result := make([]StructuredOutputStats, 0, len(byModel))
+	for _, stats := range byModel {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
+
+// ========================================
+// Generation with validation and repair
+// ========================================
+
+// generateStructured asks the provider for JSON matching schema and decodes it into out.
+// If the response fails validation, the model gets one repair round-trip with the
+// validation error before giving up.
+func generateStructured(config *AIProviderConfig, prompt string, schema *OutputSchema, out interface{}) error {
+	recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.Requests++ })
+
+	raw, err := callProviderJSON(config, prompt, schema)
+	if err != nil {
+		return err
+	}
+
+	validationErr := decodeStructured(raw, schema, out)
+	if validationErr == nil {
+		return nil
+	}
+
+	return repairStructured(config, prompt, raw, validationErr, schema, out)
+}
+
+// repairStructured records a parse failure and sends the original prompt and invalid
+// response back to the model with the validation error, decoding the corrected
+// response into out
+func repairStructured(config *AIProviderConfig, prompt, raw string, validationErr error, schema *OutputSchema, out interface{}) error {
+	recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.ParseFailures++ })
+	log.Printf("[AI-Structured] %s response from %s failed validation: %v", schema.Name, config.Model, validationErr)
+
+	repaired, err := callProviderJSON(config, buildRepairPrompt(prompt, raw, validationErr, schema), schema)
+	if err != nil {
+		recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.RepairFailures++ })
+		return fmt.Errorf("repair request failed: %w", err)
+	}
+
+	if err := decodeStructured(repaired, schema, out); err != nil {
+		recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.RepairFailures++ })
+		log.Printf("[AI-Structured] %s repair from %s still invalid: %v", schema.Name, config.Model, err)
+		return fmt.Errorf("invalid AI response after repair: %w", err)
+	}
+
+	recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.Repaired++ })
+	log.Printf("[AI-Structured] %s response from %s repaired", schema.Name, config.Model)
+	return nil
+}
+
+// decodeToolArguments validates a tool call's arguments against the declared tool
+// parameters and unmarshals them into out. Failures are counted against the user's model.
+func decodeToolArguments(config *AIProviderConfig, toolCall ToolCall, tools []Tool, out interface{}) error {
+	for _, tool := range tools {
+		if tool.Function.Name != toolCall.Function.Name {
+			continue
+		}
+		schema := &OutputSchema{Name: tool.Function.Name, Schema: tool.Function.Parameters}
+		if err := decodeStructured(toolCall.Function.Arguments, schema, out); err != nil {
+			recordStructuredOutcome(config, func(s *StructuredOutputStats) { s.ParseFailures++ })
+			return fmt.Errorf("%s: %w", tool.Function.Name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown tool %q", toolCall.Function.Name)
+}
+
+// buildRepairPrompt asks the model to fix a response that failed validation. The
+// original prompt is repeated so the model can redo the task, not just the syntax.
+func buildRepairPrompt(prompt, previous string, validationErr error, schema *OutputSchema) string {
+	schemaJSON, _ := json.Marshal(schema.Schema)
+	return fmt.Sprintf(`%s
+
+Your previous response to the request above could not be used because it was not valid JSON for the required schema.
+
+Validation error: %s
+
+Previous response:
+%s
+
+Required JSON schema:
+%s
+
+Respond with ONLY the corrected JSON object (no markdown, no code blocks, no explanation).`, prompt, validationErr, previous, string(schemaJSON))
+}
+
+// decodeStructured extracts JSON from a model response, validates it against
+// schema and unmarshals it into out
+func decodeStructured(raw string, schema *OutputSchema, out interface{}) error {
+	jsonStr := extractJSON(raw)
+	if jsonStr == "" {
+		return fmt.Errorf("no JSON object found in response")
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if err := validateSchema(value, schema.Schema, "$"); err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(jsonStr), out)
+}
+
+// extractJSON strips markdown fences and surrounding prose from a model response
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return ""
+	}
+
+	// Remove ```json ... ``` wrappers
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		if end := strings.LastIndex(content, "```"); end != -1 {
+			content = content[:end]
+		}
+		content = strings.TrimSpace(content)
+	}
+
+	if json.Valid([]byte(content)) {
+		return content
+	}
+
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start != -1 && end > start {
+		return content[start : end+1]
+	}
+	return ""
+}
+
+// validateSchema checks a decoded JSON value against the JSON Schema subset used by OutputSchema
+func validateSchema(value interface{}, schema map[string]interface{}, path string) error {
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		if required, ok := schema["required"].([]string); ok {
+			for _, field := range required {
+				if _, exists := obj[field]; !exists {
+					return fmt.Errorf("%s: missing required field %q", path, field)
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			for name, propSchema := range properties {
+				fieldValue, exists := obj[name]
+				if !exists || fieldValue == nil {
+					continue
+				}
+				if err := validateSchema(fieldValue, propSchema.(map[string]interface{}), path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				if err := validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+		if enum, ok := schema["enum"].([]string); ok {
+			for _, allowed := range enum {
+				if str == allowed {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: %q is not one of %s", path, str, strings.Join(enum, ", "))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+
+	case "number", "integer":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	}
+
+	return nil
+}
+
+// ========================================
+// Provider-native structured output modes
+// ========================================
+
+// callProviderJSON sends a prompt using each provider's native structured output support:
+// JSON mode for OpenAI-compatible APIs, a forced tool call for Anthropic, and a
+// response schema for Gemini
+func callProviderJSON(config *AIProviderConfig, prompt string, schema *OutputSchema) (string, error) {
+	switch config.ProviderType {
+	case models.ProviderTypeMock:
+		return callMockJSON(config, prompt, schema)
+	case models.ProviderTypeAnthropic:
+		return callAnthropicWithSchema(config, prompt, schema)
+	case models.ProviderTypeGoogle:
+		return callGoogleWithGenConfig(config, prompt, googleGenConfig{
+			MaxOutputTokens:  1000,
+			Temperature:      0.3,
+			ResponseMimeType: "application/json",
+			ResponseSchema:   schema.Schema,
+		})
+	default:
+		return callOpenAICompatibleWithFormat(config, prompt, supportsJSONMode(config))
+	}
+}
+
+// supportsJSONMode reports whether an OpenAI-compatible endpoint accepts response_format=json_object.
+// Custom endpoints vary, so JSON mode is only requested where it is known to work.
+func supportsJSONMode(config *AIProviderConfig) bool {
+	return strings.Contains(config.BaseURL, "openai.com") || config.ProviderType == models.ProviderTypeOllama
+}
+
+// callAnthropicWithSchema gets structured output from Anthropic by forcing a single tool call
+// whose input schema is the output schema
+func callAnthropicWithSchema(config *AIProviderConfig, prompt string, schema *OutputSchema) (string, error) {
+	reqBody := anthropicRequestWithTools{
+		Model:     config.Model,
+		MaxTokens: 1000,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: prompt},
+		},
+		Tools: []anthropicTool{
+			{
+				Name:        schema.Name,
+				Description: schema.Description,
+				InputSchema: schema.Schema,
+			},
+		},
+		ToolChoice: &anthropicToolChoice{Type: "tool", Name: schema.Name},
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	url := strings.TrimSuffix(config.BaseURL, "/") + "/messages"
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", config.APIKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Anthropic API error: %s - %s", resp.Status, string(body))
+	}
+
+	var anthropicResp anthropicResponseWithTools
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return "", err
+	}
+
+	// Prefer the forced tool call, fall back to any text the model returned
+	var text string
+	for _, block := range anthropicResp.Content {
+		if block.Type == "tool_use" && block.Name == schema.Name {
+			return string(block.Input), nil
+		}
+		if block.Type == "text" && text == "" {
+			text = block.Text
+		}
+	}
+
+	if text == "" {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+	return strings.TrimSpace(text), nil
+}
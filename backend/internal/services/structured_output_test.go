@@ -0,0 +1,80 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"valid", `{"title": "Buy milk", "tags": ["shopping"], "due_date": "", "due_time": "", "priority": "high", "group": "", "recurrence": ""}`, ""},
+		{"missing required field", `{"title": "Buy milk", "tags": []}`, `$: missing required field "due_date"`},
+		{"value outside enum", `{"title": "x", "tags": [], "due_date": "", "due_time": "", "priority": "urgent", "group": "", "recurrence": ""}`, `$.priority: "urgent" is not one of`},
+		{"wrong type", `{"title": 3, "tags": [], "due_date": "", "due_time": "", "priority": "", "group": "", "recurrence": ""}`, "$.title: expected string"},
+		{"wrong item type", `{"title": "x", "tags": ["a", 1], "due_date": "", "due_time": "", "priority": "", "group": "", "recurrence": ""}`, "$.tags[1]: expected string"},
+		{"not an object", `["x"]`, "$: expected object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out AIParsedTodo
+			err := decodeStructured(tt.value, todoParseOutputSchema, &out)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestStructuredRepair(t *testing.T) {
+	script := &MockScript{Rules: []MockRule{
+		{Match: "Validation error", Response: `{"summary": "A note", "category": "Ideas"}`},
+		{Match: "Categorize this", Response: `{"summary": "A note", "category": "Thoughts"}`},
+	}}
+	RegisterMockScript("structured-repair", script)
+	config := &AIProviderConfig{
+		ProviderType: models.ProviderTypeMock,
+		BaseURL:      "mock://structured-repair",
+		Model:        "repair-model",
+		UserID:       "repair-user",
+	}
+
+	var result models.AIProcessedMemory
+	if err := generateStructured(config, "Categorize this note", memoryOutputSchema, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Category != "Ideas" {
+		t.Fatalf("expected the repaired category, got %q", result.Category)
+	}
+
+	calls := script.Calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected a request and a repair, got %d calls", len(calls))
+	}
+	repair := calls[1].Prompt
+	for _, want := range []string{"Categorize this note", `"Thoughts" is not one of`, `"category": "Thoughts"`} {
+		if !strings.Contains(repair, want) {
+			t.Errorf("expected repair prompt to contain %q:\n%s", want, repair)
+		}
+	}
+
+	stats := GetStructuredOutputStats("repair-user")
+	want := StructuredOutputStats{Model: "repair-model", Requests: 1, ParseFailures: 1, Repaired: 1}
+	if len(stats) != 1 || stats[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+	if other := GetStructuredOutputStats("other-user"); len(other) != 0 {
+		t.Fatalf("expected no stats for another user, got %+v", other)
+	}
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// maxBoardColumns caps the columns of a board
+const maxBoardColumns = 20
+
+var (
+	// ErrBoardGroupNotFound is returned for boards of groups that don't exist
+	// or aren't the user's
+	ErrBoardGroupNotFound = errors.New("group not found")
+	// ErrColumnNotFound is returned when a board column doesn't exist or isn't the user's
+	ErrColumnNotFound = errors.New("board column not found")
+	// ErrInvalidColumn is returned for columns without a name or with an unknown
+	// status, and for moves to a column of another group's board
+	ErrInvalidColumn = errors.New("invalid board column")
+)
+
+// defaultBoardColumns are the columns a board starts with
+var defaultBoardColumns = []struct {
+	name   string
+	status models.Status
+}{
+	{"To Do", models.StatusPending},
+	{"In Progress", models.StatusInProgress},
+	{"Blocked", models.StatusBlocked},
+	{"Done", models.StatusCompleted},
+}
+
+// boardGroup checks that the user can see a group's board
+func (s *TodoService) boardGroup(userID, groupID string) error {
+	group, err := s.groupRepo.GetByID(groupID)
+	if err != nil {
+		return err
+	}
+	if group == nil || !(group.IsDefault || (group.UserID != nil && *group.UserID == userID)) {
+		return ErrBoardGroupNotFound
+	}
+	return nil
+}
+
+// boardColumns returns the columns of the user's board for a group, setting
+// up the default ones the first time it is shown
+func (s *TodoService) boardColumns(userID, groupID string) ([]models.BoardColumn, error) {
+	columns, err := s.boardRepo.GetColumns(userID, groupID)
+	if err != nil || len(columns) > 0 {
+		return columns, err
+	}
+
+	defaults := make([]*models.BoardColumn, len(defaultBoardColumns))
+	for i, column := range defaultBoardColumns {
+		status := column.status
+		defaults[i] = &models.BoardColumn{UserID: userID, GroupID: groupID, Name: column.name, Status: &status, Position: i}
+	}
+	if err := s.boardRepo.CreateColumns(defaults); err != nil {
+		return nil, err
+	}
+	return s.boardRepo.GetColumns(userID, groupID)
+}
+
+// layOutBoard puts todos in the columns they belong in, as described on
+// models.Board. Todos moved within a column keep the order they were moved
+// to, and the others follow in list order.
+func layOutBoard(columns []models.BoardColumn, todos []models.Todo) []models.BoardLane {
+	lanes := make([]models.BoardLane, len(columns))
+	byID := make(map[string]int, len(columns))
+	for i, column := range columns {
+		lanes[i] = models.BoardLane{BoardColumn: column, Todos: []models.Todo{}}
+		byID[column.ID] = i
+	}
+
+	for _, todo := range todos {
+		lane := -1
+		if todo.ColumnID != nil {
+			if i, ok := byID[*todo.ColumnID]; ok && (columns[i].Status == nil || *columns[i].Status == todo.Status) {
+				lane = i
+			}
+		}
+		for i := 0; lane < 0 && i < len(columns); i++ {
+			if columns[i].Status != nil && *columns[i].Status == todo.Status {
+				lane = i
+			}
+		}
+		if lane < 0 && !todo.Status.IsDone() && len(columns) > 0 {
+			lane = 0
+		}
+		if lane >= 0 {
+			lanes[lane].Todos = append(lanes[lane].Todos, todo)
+		}
+	}
+
+	for i := range lanes {
+		lane := &lanes[i]
+		placed := func(todo *models.Todo) (int, bool) {
+			if todo.ColumnID == nil || *todo.ColumnID != lane.ID || todo.ColumnPosition == nil {
+				return 0, false
+			}
+			return *todo.ColumnPosition, true
+		}
+		sort.SliceStable(lane.Todos, func(a, b int) bool {
+			posA, okA := placed(&lane.Todos[a])
+			posB, okB := placed(&lane.Todos[b])
+			if okA != okB {
+				return okA
+			}
+			return okA && posA < posB
+		})
+	}
+	return lanes
+}
+
+// GetBoard returns the user's board for a group
+func (s *TodoService) GetBoard(userID, groupID string) (*models.Board, error) {
+	if err := s.boardGroup(userID, groupID); err != nil {
+		return nil, err
+	}
+	columns, err := s.boardColumns(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	todos, _, err := s.todoRepo.List(userID, &models.TodoFilter{GroupIDs: []string{groupID}})
+	if err != nil {
+		return nil, err
+	}
+	return &models.Board{GroupID: groupID, Columns: layOutBoard(columns, todos)}, nil
+}
+
+// CreateColumn adds a column to the end of the user's board for a group
+func (s *TodoService) CreateColumn(userID, groupID string, req *models.BoardColumnCreateRequest) (*models.BoardColumn, error) {
+	if err := s.boardGroup(userID, groupID); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidColumn)
+	}
+
+	columns, err := s.boardColumns(userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) >= maxBoardColumns {
+		return nil, fmt.Errorf("%w: boards can have at most %d columns", ErrInvalidColumn, maxBoardColumns)
+	}
+
+	column := &models.BoardColumn{UserID: userID, GroupID: groupID, Name: name, Status: req.Status, Position: len(columns)}
+	if err := s.boardRepo.CreateColumns([]*models.BoardColumn{column}); err != nil {
+		return nil, err
+	}
+	return column, nil
+}
+
+// getColumn returns one of the user's columns on a group's board
+func (s *TodoService) getColumn(userID, groupID, columnID string) (*models.BoardColumn, error) {
+	column, err := s.boardRepo.GetColumn(columnID)
+	if err != nil {
+		return nil, err
+	}
+	if column == nil || column.UserID != userID || column.GroupID != groupID {
+		return nil, ErrColumnNotFound
+	}
+	return column, nil
+}
+
+// UpdateColumn renames a column, changes its status or moves it on the board
+func (s *TodoService) UpdateColumn(userID, groupID, columnID string, req *models.BoardColumnUpdateRequest) (*models.BoardColumn, error) {
+	column, err := s.getColumn(userID, groupID, columnID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidColumn)
+		}
+		column.Name = name
+	}
+	if req.Status != nil {
+		switch {
+		case *req.Status == "":
+			column.Status = nil
+		case req.Status.IsValid():
+			column.Status = req.Status
+		default:
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidColumn, *req.Status)
+		}
+	}
+	if err := s.boardRepo.UpdateColumn(column); err != nil {
+		return nil, err
+	}
+
+	if req.Position != nil {
+		columns, err := s.boardRepo.GetColumns(userID, groupID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(columns))
+		for _, other := range columns {
+			if other.ID != columnID {
+				ids = append(ids, other.ID)
+			}
+		}
+		position := *req.Position
+		if position > len(ids) {
+			position = len(ids)
+		}
+		ids = append(ids[:position], append([]string{columnID}, ids[position:]...)...)
+		if err := s.boardRepo.SetOrder(ids); err != nil {
+			return nil, err
+		}
+		column.Position = position
+	}
+	return column, nil
+}
+
+// DeleteColumn deletes a column from the user's board. Its todos go back to
+// the column for their status.
+func (s *TodoService) DeleteColumn(userID, groupID, columnID string) error {
+	if _, err := s.getColumn(userID, groupID, columnID); err != nil {
+		return err
+	}
+	return s.boardRepo.DeleteColumn(columnID)
+}
+
+// MoveTodo moves a todo to a place in a column of its group's board. Moving to
+// a column with a status sets the todo's status too, with the same effects as
+// setting it by hand; column, status and order are saved together.
+func (s *TodoService) MoveTodo(userID, todoID string, req *models.TodoMoveRequest) (*models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	column, err := s.boardRepo.GetColumn(req.ColumnID)
+	if err != nil {
+		return nil, err
+	}
+	if column == nil || column.UserID != userID {
+		return nil, ErrColumnNotFound
+	}
+	if todo.GroupID == nil || *todo.GroupID != column.GroupID {
+		return nil, fmt.Errorf("%w: the column is on another group's board", ErrInvalidColumn)
+	}
+
+	updates := make(map[string]interface{})
+	if column.Status != nil && *column.Status != todo.Status {
+		updates["status"] = *column.Status
+		updates["resume_status"] = nil
+		if *column.Status == models.StatusCompleted {
+			updates["completed_at"] = time.Now()
+		} else {
+			updates["completed_at"] = nil
+		}
+	}
+
+	// Place the todo among the column's todos as they are shown, read in the
+	// same transaction as the move
+	columns, err := s.boardColumns(userID, column.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	place := func(todos []models.Todo) []string {
+		order := []string{}
+		for _, lane := range layOutBoard(columns, todos) {
+			if lane.ID != column.ID {
+				continue
+			}
+			for _, other := range lane.Todos {
+				if other.ID != todoID {
+					order = append(order, other.ID)
+				}
+			}
+		}
+		index := req.Index
+		if index > len(order) {
+			index = len(order)
+		}
+		return append(order[:index], append([]string{todoID}, order[index:]...)...)
+	}
+
+	if err := s.todoRepo.MoveToColumn(todoID, column.ID, updates, place); err != nil {
+		return nil, err
+	}
+
+	// As in Update: todos reopened while their blockers are open are blocked
+	// again, and status changes carry over to series, dependents and parents
+	if _, ok := updates["status"]; ok && !column.Status.IsDone() {
+		s.syncBlocked(todoID)
+	}
+	moved, err := s.todoRepo.GetByID(todoID)
+	if err != nil {
+		return nil, err
+	}
+	if moved == nil {
+		return nil, ErrTodoNotFound
+	}
+	if todo.Status != moved.Status {
+		if !todo.Status.IsDone() && moved.Status.IsDone() {
+			s.continueSeries(moved)
+		}
+		if todo.Status.IsDone() != moved.Status.IsDone() {
+			s.syncDependents(todoID)
+		}
+		s.syncParent(moved.ParentID)
+		s.indexAsync(moved)
+	}
+	return moved, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// ErrInvalidDependency is returned for dependencies on missing todos or ones that
+// would form a cycle
+var ErrInvalidDependency = errors.New("invalid dependency")
+
+// AddBlocker makes a todo depend on another one, blocking it while the other one
+// is open, and returns the updated todo
+func (s *TodoService) AddBlocker(userID, todoID, blockerID string) (*models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	blocker, err := s.GetByID(userID, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	if blocker == nil {
+		return nil, fmt.Errorf("%w: blocking todo not found", ErrInvalidDependency)
+	}
+	if blockerID == todoID {
+		return nil, fmt.Errorf("%w: a todo can't block itself", ErrInvalidDependency)
+	}
+
+	// The new link would close a loop if the blocker already waits on the todo
+	cycle, err := s.todoRepo.DependsOn(blockerID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if cycle {
+		return nil, fmt.Errorf("%w: %q already depends on %q", ErrInvalidDependency, blocker.Title, todo.Title)
+	}
+
+	if err := s.todoRepo.AddDependency(todoID, blockerID); err != nil {
+		return nil, err
+	}
+	s.syncBlocked(todoID)
+
+	return s.todoRepo.GetByID(todoID)
+}
+
+// RemoveBlocker removes a dependency, unblocking the todo once nothing else
+// blocks it, and returns the updated todo
+func (s *TodoService) RemoveBlocker(userID, todoID, blockerID string) (*models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	if _, err := s.todoRepo.RemoveDependency(todoID, blockerID); err != nil {
+		return nil, err
+	}
+	s.syncBlocked(todoID)
+
+	return s.todoRepo.GetByID(todoID)
+}
+
+// syncBlocked blocks a pending or in-progress todo while any of its blockers is
+// open, and puts a todo it blocked back to its earlier status once none are.
+// Todos marked blocked by hand stay blocked.
+func (s *TodoService) syncBlocked(todoID string) {
+	open, err := s.todoRepo.CountOpenBlockers(todoID)
+	if err == nil {
+		var changed bool
+		changed, err = s.todoRepo.SetBlocked(todoID, open > 0)
+		if err == nil && changed {
+			if todo, err := s.todoRepo.GetByID(todoID); err == nil && todo != nil {
+				s.indexAsync(todo)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[TodoService] Failed to update blocked state of todo %s: %v", todoID, err)
+	}
+}
+
+// syncDependents updates the todos blocked by a todo that was just finished or
+// reopened
+func (s *TodoService) syncDependents(blockerID string) {
+	dependents, err := s.todoRepo.GetDependents(blockerID)
+	if err != nil {
+		log.Printf("[TodoService] Failed to load todos blocked by %s: %v", blockerID, err)
+		return
+	}
+	for _, dependent := range dependents {
+		s.syncBlocked(dependent.ID)
+	}
+}
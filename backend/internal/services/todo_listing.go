@@ -0,0 +1,121 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// maxTodoPageSize caps the todos listed on one page
+const maxTodoPageSize = 500
+
+var (
+	// ErrInvalidTodoFilter is returned for filters with an unknown sort order
+	// or malformed dates
+	ErrInvalidTodoFilter = errors.New("invalid todo filter")
+	// ErrInvalidCursor is returned for cursors that weren't issued for the
+	// order requested
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// List returns a page of the user's todos matching filter, continuing from
+// cursor if given. Overdue todos are judged in timezone, as userLocation reads
+// it. Without a limit or cursor all matching todos are listed.
+func (s *TodoService) List(userID string, filter models.TodoFilter, cursor string, timezone *string) (*models.TodoPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = models.SortPosition
+	}
+	if !filter.Sort.IsValid() {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidTodoFilter, filter.Sort)
+	}
+	for _, date := range []string{filter.DueFrom, filter.DueTo} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDate, err)
+		}
+	}
+
+	if filter.Overdue {
+		loc, err := s.userLocation(userID, timezone)
+		if err != nil {
+			return nil, err
+		}
+		filter.Now = time.Now()
+		filter.Today = filter.Now.In(loc).Format("2006-01-02")
+	}
+
+	if cursor != "" {
+		after, err := decodeTodoCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if after.Sort != filter.Sort || after.Descending != filter.Descending {
+			return nil, fmt.Errorf("%w: cursor is for a different sort order", ErrInvalidCursor)
+		}
+		filter.After = after
+	}
+
+	// Paged once a limit or cursor is given; one more todo than the page
+	// holds tells whether there is a next one
+	limit := filter.Limit
+	if limit > 0 || cursor != "" {
+		if limit <= 0 || limit > maxTodoPageSize {
+			limit = maxTodoPageSize
+		}
+		filter.Limit = limit + 1
+	}
+
+	todos, keys, err := s.todoRepo.List(userID, &filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.TodoPage{Todos: todos}
+	if filter.Limit > 0 && len(todos) > limit {
+		page.Todos = todos[:limit]
+		last := page.Todos[limit-1]
+		next, err := encodeTodoCursor(&models.TodoCursor{
+			Sort:       filter.Sort,
+			Descending: filter.Descending,
+			Key:        keys[limit-1],
+			ID:         last.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
+// Cursors are opaque to clients: base64url JSON
+func encodeTodoCursor(cursor *models.TodoCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeTodoCursor(value string) (*models.TodoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor models.TodoCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	switch cursor.Key.(type) {
+	case string, float64:
+	default:
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
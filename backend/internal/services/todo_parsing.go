@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/todoparse"
+)
+
+// parseTitle reads the due date, priority, group and recurrence from a todo's
+// title in the user's timezone and fills in the ones the request left empty.
+// The built-in rules go first; only if they find nothing is the model asked,
+// and then its cleanup of the title is returned too so it needn't be asked
+// twice. It returns nil if nothing was inferred.
+func (s *TodoService) parseTitle(userID string, req *models.TodoCreateRequest) (*models.TodoParse, *AIProcessedTodo, error) {
+	loc, err := s.userLocation(userID, req.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups, err := s.groupRepo.GetAllByUserID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, len(groups))
+	for i, group := range groups {
+		names[i] = group.Name
+	}
+
+	now := time.Now().In(loc)
+	result := todoparse.Parse(req.Title, now, names)
+	source := "rules"
+
+	var cleaned *AIProcessedTodo
+	if !result.Found() {
+		config := s.getAIConfig(userID)
+		if config == nil {
+			return nil, nil, nil
+		}
+		parsed, err := ParseTodoWithProvider(req.Title, now, names, config)
+		if err != nil {
+			log.Printf("[TodoService] Failed to parse %q with AI: %v", req.Title, err)
+			return nil, nil, nil
+		}
+		result = checkParsedTodo(req.Title, parsed, now, names)
+		cleaned = parseAIResponse(req.Title, aiResult{Title: result.Title, Tags: parsed.Tags})
+		source = "ai"
+	}
+
+	req.Title = result.Title
+	if !result.Found() {
+		return nil, cleaned, nil
+	}
+
+	inferred := &models.TodoParse{Source: source, Timezone: loc.String()}
+	if result.HasDate && (req.DueDate == nil || *req.DueDate == "") {
+		dueDate := result.Due.Format("2006-01-02")
+		if result.HasTime {
+			dueDate = result.Due.Format(time.RFC3339)
+		}
+		req.DueDate = &dueDate
+		inferred.DueDate = &dueDate
+	}
+	if result.Priority != "" && req.Priority == "" {
+		priority := models.Priority(result.Priority)
+		req.Priority = priority
+		inferred.Priority = &priority
+	}
+	if result.Group != "" && req.GroupID == nil {
+		for _, group := range groups {
+			if group.Name == result.Group {
+				req.GroupID = &group.ID
+				inferred.GroupID = &group.ID
+				break
+			}
+		}
+	}
+	if result.Recurrence != "" && (req.Recurrence == nil || *req.Recurrence == "") {
+		recurrence := result.Recurrence
+		req.Recurrence = &recurrence
+		inferred.Recurrence = &recurrence
+	}
+
+	log.Printf("[TodoService] Parsed todo with %s - title: %q, dueDate: %v, priority: %q, group: %q, recurrence: %q",
+		source, req.Title, result.Due, result.Priority, result.Group, result.Recurrence)
+	return inferred, cleaned, nil
+}
+
+// checkParsedTodo turns the model's answer into a parse result, dropping
+// whatever doesn't hold up: malformed dates, unknown priorities and groups,
+// and rules the recurrence parser rejects
+func checkParsedTodo(text string, parsed *AIParsedTodo, now time.Time, groups []string) todoparse.Result {
+	result := todoparse.Result{Title: strings.TrimSpace(parsed.Title)}
+	if result.Title == "" {
+		result.Title = text
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", parsed.DueDate, now.Location()); err == nil {
+		result.Due, result.HasDate = day, true
+		if clock, err := time.Parse("15:04", parsed.DueTime); err == nil {
+			result.Due = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+			result.HasTime = true
+		}
+	}
+
+	switch models.Priority(parsed.Priority) {
+	case models.PriorityLow, models.PriorityMedium, models.PriorityHigh:
+		result.Priority = parsed.Priority
+	}
+
+	for _, name := range groups {
+		if strings.EqualFold(name, strings.TrimSpace(parsed.Group)) {
+			result.Group = name
+			break
+		}
+	}
+
+	recurrence := strings.TrimPrefix(strings.TrimSpace(parsed.Recurrence), "RRULE:")
+	if recurrence != "" {
+		if _, err := parseRecurrence(recurrence, nil); err == nil {
+			result.Recurrence = recurrence
+		}
+	}
+
+	return result
+}
+
+// userLocation returns the timezone to read dates in: the request's if given,
+// else the user's digest timezone, else UTC
+func (s *TodoService) userLocation(userID string, timezone *string) (*time.Location, error) {
+	if timezone != nil && *timezone != "" {
+		loc, err := time.LoadLocation(*timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, *timezone)
+		}
+		return loc, nil
+	}
+
+	settings, err := s.memoryRepo.GetDigestSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	if loc, err := time.LoadLocation(settings.Timezone); err == nil {
+		return loc, nil
+	}
+	return time.UTC, nil
+}
+
+// getAIConfig returns the user's default AI provider, falling back to the one
+// configured in the environment, or nil if there is neither
+func (s *TodoService) getAIConfig(userID string) *AIProviderConfig {
+	prompts := s.promptService.GetPromptSet(userID)
+
+	if s.aiProviderService != nil {
+		provider, err := s.aiProviderService.GetDefaultByUserID(userID)
+		if err == nil && provider != nil && provider.SelectedModel != nil {
+			apiKey, err := s.aiProviderService.GetDecryptedAPIKey(provider)
+			if err == nil {
+				return &AIProviderConfig{
+					ProviderType: provider.ProviderType,
+					BaseURL:      provider.BaseURL,
+					APIKey:       apiKey,
+					Model:        *provider.SelectedModel,
+					Prompts:      prompts,
+					UserID:       userID,
+				}
+			}
+		}
+	}
+
+	if s.aiService != nil && s.aiService.IsConfigured() {
+		return &AIProviderConfig{
+			ProviderType: models.ProviderTypeOpenAI,
+			BaseURL:      s.aiService.baseURL,
+			APIKey:       s.aiService.apiKey,
+			Model:        s.aiService.model,
+			Prompts:      prompts,
+			UserID:       userID,
+		}
+	}
+
+	return nil
+}
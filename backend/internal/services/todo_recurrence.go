@@ -0,0 +1,457 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+	"github.com/todomyday/backend/internal/rrule"
+)
+
+const (
+	defaultUpcomingDays = 14
+	maxUpcomingDays     = 90
+	maxUpcomingTodos    = 200
+)
+
+var (
+	// ErrTodoNotFound is returned when a todo doesn't exist or isn't the user's
+	ErrTodoNotFound = errors.New("todo not found")
+	// ErrInvalidRecurrence is returned for recurrence rules that can't be parsed
+	ErrInvalidRecurrence = errors.New("invalid recurrence")
+	// ErrNotRecurring is returned when skipping a todo that isn't part of a series
+	ErrNotRecurring = errors.New("todo is not recurring")
+)
+
+// today returns the server's current date as a day at midnight UTC
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// parseRecurrence parses a todo's RRULE, using end (YYYY-MM-DD) as its UNTIL date
+func parseRecurrence(text string, end *string) (*rrule.Rule, error) {
+	rule, err := rrule.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecurrence, err)
+	}
+	if end != nil && *end != "" {
+		until, err := time.Parse("2006-01-02", *end)
+		if err != nil {
+			return nil, fmt.Errorf("%w: recurrence_end must be YYYY-MM-DD", ErrInvalidRecurrence)
+		}
+		if rule.Count > 0 {
+			return nil, fmt.Errorf("%w: recurrence_end can't be combined with COUNT", ErrInvalidRecurrence)
+		}
+		rule.Until = until
+	}
+	return rule, nil
+}
+
+// splitDueDate splits a due date into its day and the rest, so "2025-03-01T09:30"
+// becomes March 1 and "T09:30"
+func splitDueDate(dueDate *string) (time.Time, string, bool) {
+	if dueDate == nil || len(*dueDate) < 10 {
+		return time.Time{}, "", false
+	}
+	day, err := time.Parse("2006-01-02", (*dueDate)[:10])
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return day, (*dueDate)[10:], true
+}
+
+// startSeries creates a series following rule with todo as its template and first
+// instance, and links todo to it. Todos without a due date become due today.
+func (s *TodoService) startSeries(todo *models.Todo, rule *rrule.Rule) error {
+	day, dueTime, ok := splitDueDate(todo.DueDate)
+	if !ok {
+		day, dueTime = today(), ""
+	}
+
+	series := &models.TodoSeries{
+		UserID:      todo.UserID,
+		RRule:       rule.String(),
+		DTStart:     day.Format("2006-01-02"),
+		DueTime:     dueTime,
+		Title:       todo.Title,
+		Description: todo.Description,
+		Priority:    todo.Priority,
+		GroupID:     todo.GroupID,
+		Tags:        todo.Tags,
+	}
+	if series.Priority == "" {
+		series.Priority = models.PriorityMedium
+	}
+	if err := s.todoRepo.CreateSeries(series); err != nil {
+		return err
+	}
+
+	occurrence := series.DTStart
+	todo.SeriesID = &series.ID
+	todo.Occurrence = &occurrence
+	todo.Recurrence = &series.RRule
+	if todo.DueDate == nil {
+		todo.DueDate = &occurrence
+	}
+	return nil
+}
+
+// updateRecurrence applies an edit's recurrence changes to the todo's series and,
+// with scope "series", its other changes to the series and its later pending
+// instances. todo is the todo as it was before the edit; rule is the new rule,
+// if any.
+func (s *TodoService) updateRecurrence(todo *models.Todo, req *models.TodoUpdateRequest, rule *rrule.Rule) error {
+	if todo.SeriesID == nil {
+		updated, err := s.todoRepo.GetByID(todo.ID)
+		if err != nil {
+			return err
+		}
+		if err := s.startSeries(updated, rule); err != nil {
+			return err
+		}
+		return s.todoRepo.Update(todo.ID, map[string]interface{}{
+			"series_id":  *updated.SeriesID,
+			"occurrence": *updated.Occurrence,
+			"due_date":   *updated.DueDate,
+		})
+	}
+
+	series, err := s.todoRepo.GetSeries(*todo.SeriesID)
+	if err != nil || series == nil {
+		return err
+	}
+
+	// Clearing the recurrence ends the series, leaving this todo as a one-off
+	if req.Recurrence != nil && *req.Recurrence == "" {
+		deleted, err := s.todoRepo.DeletePendingInstances(series.ID, todo.ID)
+		if err != nil {
+			return err
+		}
+		s.unindexAsync(deleted...)
+		return s.todoRepo.DeleteSeries(series.ID)
+	}
+
+	occurrence := series.DTStart
+	if todo.Occurrence != nil {
+		occurrence = *todo.Occurrence
+	}
+	// Later pending instances are dropped when their dates may no longer fit the
+	// series; the next one is generated as usual when this one is done
+	dropLater := false
+
+	if req.Scope == models.ScopeSeries {
+		updates := make(map[string]interface{})
+		if req.Title != nil {
+			series.Title = *req.Title
+			updates["title"] = *req.Title
+		}
+		if req.Description != nil {
+			series.Description = req.Description
+			updates["description"] = *req.Description
+		}
+		if req.Priority != nil {
+			series.Priority = *req.Priority
+			updates["priority"] = *req.Priority
+		}
+		if req.GroupID != nil {
+			series.GroupID = req.GroupID
+			updates["group_id"] = *req.GroupID
+		}
+		if req.Tags != nil {
+			series.Tags = req.Tags
+			updates["tags"] = req.Tags
+		}
+		if err := s.todoRepo.UpdatePendingInstances(series.ID, occurrence, updates); err != nil {
+			return err
+		}
+
+		// Moving the series re-anchors it at the new date
+		if day, dueTime, ok := splitDueDate(req.DueDate); ok {
+			occurrence = day.Format("2006-01-02")
+			series.DTStart = occurrence
+			series.DueTime = dueTime
+			dropLater = true
+		}
+	}
+
+	// A new rule starts over from this occurrence, so earlier instances keep
+	// their dates
+	if rule != nil {
+		series.RRule = rule.String()
+		series.DTStart = occurrence
+		dropLater = true
+	}
+
+	if dropLater {
+		deleted, err := s.todoRepo.DeletePendingInstances(series.ID, todo.ID)
+		if err != nil {
+			return err
+		}
+		s.unindexAsync(deleted...)
+		if err := s.todoRepo.Update(todo.ID, map[string]interface{}{"occurrence": occurrence}); err != nil {
+			return err
+		}
+	}
+	return s.todoRepo.UpdateSeries(series)
+}
+
+// generateNext creates a series' next instance after the given occurrence,
+// skipping excluded dates. Occurrences already past are skipped too, so a todo
+// completed late comes back today at the earliest. It returns the existing
+// instance if that occurrence was already generated, and nil once the series
+// has ended.
+func (s *TodoService) generateNext(series *models.TodoSeries, after string) (*models.Todo, error) {
+	rule, err := rrule.Parse(series.RRule)
+	if err != nil {
+		return nil, fmt.Errorf("series %s: %w", series.ID, err)
+	}
+	start, err := time.Parse("2006-01-02", series.DTStart)
+	if err != nil {
+		return nil, fmt.Errorf("series %s: invalid start %q", series.ID, series.DTStart)
+	}
+
+	floor := today().AddDate(0, 0, -1)
+	if afterDay, err := time.Parse("2006-01-02", after); err == nil && afterDay.After(floor) {
+		floor = afterDay
+	}
+	next, ok := nextOccurrence(rule, start, floor, series.ExDates)
+	if !ok {
+		return nil, nil
+	}
+
+	occurrence := next.Format("2006-01-02")
+	existing, err := s.todoRepo.GetSeriesInstance(series.ID, occurrence)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	dueDate := occurrence + series.DueTime
+	todo := &models.Todo{
+		UserID:      series.UserID,
+		GroupID:     series.GroupID,
+		Title:       series.Title,
+		Description: series.Description,
+		DueDate:     &dueDate,
+		Priority:    series.Priority,
+		Tags:        series.Tags,
+		SeriesID:    &series.ID,
+		Occurrence:  &occurrence,
+		Recurrence:  &series.RRule,
+	}
+	if err := s.todoRepo.Create(todo); err != nil {
+		return nil, err
+	}
+	s.indexAsync(todo)
+
+	return todo, nil
+}
+
+// continueSeries generates the next occurrence after a recurring todo is completed,
+// carrying its reminders relative to the due date over
+func (s *TodoService) continueSeries(todo *models.Todo) {
+	if todo.SeriesID == nil || todo.Occurrence == nil {
+		return
+	}
+	series, err := s.todoRepo.GetSeries(*todo.SeriesID)
+	var next *models.Todo
+	if err == nil && series != nil {
+		next, err = s.generateNext(series, *todo.Occurrence)
+	}
+	if err != nil {
+		log.Printf("[TodoService] Failed to generate next occurrence of todo %s: %v", todo.ID, err)
+		return
+	}
+	if next != nil {
+		if reminders, err := s.reminderRepo.GetByTodoID(todo.ID); err == nil {
+			s.carryReminders(reminders, next)
+		}
+	}
+}
+
+// nextOccurrence returns the first occurrence after floor that isn't excluded
+func nextOccurrence(rule *rrule.Rule, start, floor time.Time, exdates []string) (time.Time, bool) {
+	excluded := make(map[string]bool, len(exdates))
+	for _, date := range exdates {
+		excluded[date] = true
+	}
+
+	var next time.Time
+	found := false
+	rule.Iterate(start, func(date time.Time) bool {
+		if date.After(floor) && !excluded[date.Format("2006-01-02")] {
+			next, found = date, true
+			return false
+		}
+		return true
+	})
+	return next, found
+}
+
+// Skip skips a recurring todo's occurrence: the todo is deleted, its date is
+// excluded from the series, and the next occurrence is generated and returned
+// (nil if the series has ended)
+func (s *TodoService) Skip(userID, todoID string) (*models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+	if todo.SeriesID == nil {
+		return nil, ErrNotRecurring
+	}
+	return s.skip(todo)
+}
+
+func (s *TodoService) skip(todo *models.Todo) (*models.Todo, error) {
+	series, err := s.todoRepo.GetSeries(*todo.SeriesID)
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		return nil, ErrNotRecurring
+	}
+
+	occurrence := series.DTStart
+	if todo.Occurrence != nil {
+		occurrence = *todo.Occurrence
+	}
+	series.ExDates = append(series.ExDates, occurrence)
+	if err := s.todoRepo.UpdateSeries(series); err != nil {
+		return nil, err
+	}
+
+	// The todo's reminders are deleted with it; the next one keeps them
+	reminders, err := s.reminderRepo.GetByTodoID(todo.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.todoRepo.Delete(todo.ID); err != nil {
+		return nil, err
+	}
+	s.unindexAsync(todo.ID)
+
+	next, err := s.generateNext(series, occurrence)
+	if err == nil && next != nil {
+		s.carryReminders(reminders, next)
+	}
+	return next, err
+}
+
+// deleteSeries deletes a recurring todo's series along with its pending
+// instances. Completed instances are kept as one-off todos.
+func (s *TodoService) deleteSeries(todo *models.Todo) error {
+	deleted, err := s.todoRepo.DeletePendingInstances(*todo.SeriesID, todo.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.todoRepo.Delete(todo.ID); err != nil {
+		return err
+	}
+	s.unindexAsync(append(deleted, todo.ID)...)
+	return s.todoRepo.DeleteSeries(*todo.SeriesID)
+}
+
+// GetUpcoming lists the user's pending recurring todos due within the next days
+// (and any overdue ones), along with the occurrences that will follow them in
+// that window
+func (s *TodoService) GetUpcoming(userID string, days int) (*models.UpcomingTodos, error) {
+	if days <= 0 {
+		days = defaultUpcomingDays
+	}
+	if days > maxUpcomingDays {
+		days = maxUpcomingDays
+	}
+	from := today()
+	to := from.AddDate(0, 0, days)
+
+	seriesList, err := s.todoRepo.GetSeriesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	upcoming := []models.UpcomingTodo{}
+	for i := range seriesList {
+		series := &seriesList[i]
+		instances, err := s.todoRepo.GetSeriesInstances(series.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Occurrences are only generated going forward, so projections start
+		// after the latest instance
+		floor := from.AddDate(0, 0, -1)
+		for _, instance := range instances {
+			day, _, ok := splitDueDate(instance.Occurrence)
+			if !ok {
+				continue
+			}
+			if day.After(floor) {
+				floor = day
+			}
+			if !instance.Status.IsDone() && !day.After(to) {
+				upcoming = append(upcoming, models.UpcomingTodo{Todo: instance})
+			}
+		}
+
+		rule, err := rrule.Parse(series.RRule)
+		if err != nil {
+			log.Printf("[TodoService] Skipping series %s with invalid rule %q: %v", series.ID, series.RRule, err)
+			continue
+		}
+		start, err := time.Parse("2006-01-02", series.DTStart)
+		if err != nil {
+			continue
+		}
+		excluded := make(map[string]bool, len(series.ExDates))
+		for _, date := range series.ExDates {
+			excluded[date] = true
+		}
+		for _, date := range rule.Between(start, floor.AddDate(0, 0, 1), to, maxUpcomingTodos) {
+			if !excluded[date.Format("2006-01-02")] {
+				upcoming = append(upcoming, projectOccurrence(series, date))
+			}
+		}
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return *upcoming[i].Occurrence < *upcoming[j].Occurrence
+	})
+	if len(upcoming) > maxUpcomingTodos {
+		upcoming = upcoming[:maxUpcomingTodos]
+	}
+
+	return &models.UpcomingTodos{
+		From:  from.Format("2006-01-02"),
+		To:    to.Format("2006-01-02"),
+		Todos: upcoming,
+	}, nil
+}
+
+// projectOccurrence describes an occurrence of a series that hasn't been
+// generated yet
+func projectOccurrence(series *models.TodoSeries, date time.Time) models.UpcomingTodo {
+	occurrence := date.Format("2006-01-02")
+	dueDate := occurrence + series.DueTime
+	return models.UpcomingTodo{
+		Todo: models.Todo{
+			UserID:      series.UserID,
+			GroupID:     series.GroupID,
+			Title:       series.Title,
+			Description: series.Description,
+			DueDate:     &dueDate,
+			Priority:    series.Priority,
+			Status:      models.StatusPending,
+			Tags:        series.Tags,
+			SeriesID:    &series.ID,
+			Occurrence:  &occurrence,
+			Recurrence:  &series.RRule,
+		},
+		Projected: true,
+	}
+}
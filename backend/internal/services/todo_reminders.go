@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// maxRemindersPerTodo caps how many reminders a single todo can have
+const maxRemindersPerTodo = 10
+
+var (
+	// ErrInvalidReminder is returned for reminders without exactly one time, or
+	// with a time already past
+	ErrInvalidReminder = errors.New("invalid reminder")
+	// ErrReminderNotFound is returned when a reminder doesn't exist or isn't the todo's
+	ErrReminderNotFound = errors.New("reminder not found")
+)
+
+// parseDueTime reads a todo's due date. Dates without a zone are UTC, and
+// dates without a time are due at midnight.
+func parseDueTime(dueDate *string) (time.Time, bool) {
+	if dueDate == nil {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, *dueDate); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// reminderFireAt returns when a reminder for todo should go out, or nil if it
+// is relative and the todo has no due date
+func reminderFireAt(reminder *models.Reminder, todo *models.Todo) *time.Time {
+	if reminder.RemindAt != nil {
+		fireAt := reminder.RemindAt.UTC()
+		return &fireAt
+	}
+	due, ok := parseDueTime(todo.DueDate)
+	if !ok || reminder.OffsetMinutes == nil {
+		return nil
+	}
+	fireAt := due.Add(-time.Duration(*reminder.OffsetMinutes) * time.Minute)
+	return &fireAt
+}
+
+// GetReminders returns a todo's reminders, earliest first
+func (s *TodoService) GetReminders(userID, todoID string) ([]models.Reminder, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+	return s.reminderRepo.GetByTodoID(todoID)
+}
+
+// CreateReminder adds a reminder at a fixed time or a number of minutes before
+// the todo is due. Relative reminders on todos without a due date wait for one.
+func (s *TodoService) CreateReminder(userID, todoID string, req *models.ReminderCreateRequest) (*models.Reminder, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	if (req.RemindAt == nil) == (req.OffsetMinutes == nil) {
+		return nil, fmt.Errorf("%w: set either remind_at or offset_minutes", ErrInvalidReminder)
+	}
+	if req.RemindAt != nil && req.RemindAt.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: remind_at is in the past", ErrInvalidReminder)
+	}
+
+	existing, err := s.reminderRepo.GetByTodoID(todoID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxRemindersPerTodo {
+		return nil, fmt.Errorf("%w: todos can have at most %d reminders", ErrInvalidReminder, maxRemindersPerTodo)
+	}
+
+	reminder := &models.Reminder{
+		TodoID:        todoID,
+		UserID:        userID,
+		RemindAt:      req.RemindAt,
+		OffsetMinutes: req.OffsetMinutes,
+	}
+	reminder.FireAt = reminderFireAt(reminder, todo)
+	if err := s.reminderRepo.Create(reminder); err != nil {
+		return nil, err
+	}
+	return reminder, nil
+}
+
+// DeleteReminder deletes one of a todo's reminders
+func (s *TodoService) DeleteReminder(userID, todoID, reminderID string) error {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return err
+	}
+	if todo == nil {
+		return ErrTodoNotFound
+	}
+
+	reminder, err := s.reminderRepo.GetByID(reminderID)
+	if err != nil {
+		return err
+	}
+	if reminder == nil || reminder.TodoID != todoID {
+		return ErrReminderNotFound
+	}
+	return s.reminderRepo.Delete(reminderID)
+}
+
+// rescheduleReminders moves a todo's relative reminders after its due date
+// changed. Moved reminders go out again even if they were already sent.
+func (s *TodoService) rescheduleReminders(todo *models.Todo) {
+	reminders, err := s.reminderRepo.GetByTodoID(todo.ID)
+	if err != nil {
+		log.Printf("[TodoService] Failed to load reminders of todo %s: %v", todo.ID, err)
+		return
+	}
+	for i := range reminders {
+		reminder := &reminders[i]
+		if reminder.OffsetMinutes == nil {
+			continue
+		}
+		fireAt := reminderFireAt(reminder, todo)
+		if sameTime(fireAt, reminder.FireAt) {
+			continue
+		}
+		if err := s.reminderRepo.Reschedule(reminder.ID, fireAt); err != nil {
+			log.Printf("[TodoService] Failed to reschedule reminder %s: %v", reminder.ID, err)
+		}
+	}
+}
+
+// carryReminders gives the next instance of a recurring todo the relative
+// reminders its previous instance had
+func (s *TodoService) carryReminders(reminders []models.Reminder, next *models.Todo) {
+	existing, err := s.reminderRepo.GetByTodoID(next.ID)
+	if err != nil {
+		log.Printf("[TodoService] Failed to load reminders of todo %s: %v", next.ID, err)
+		return
+	}
+	offsets := make(map[int]bool, len(existing))
+	for _, reminder := range existing {
+		if reminder.OffsetMinutes != nil {
+			offsets[*reminder.OffsetMinutes] = true
+		}
+	}
+
+	for _, previous := range reminders {
+		if previous.OffsetMinutes == nil || offsets[*previous.OffsetMinutes] {
+			continue
+		}
+		offsets[*previous.OffsetMinutes] = true
+
+		reminder := &models.Reminder{
+			TodoID:        next.ID,
+			UserID:        next.UserID,
+			OffsetMinutes: previous.OffsetMinutes,
+		}
+		reminder.FireAt = reminderFireAt(reminder, next)
+		if err := s.reminderRepo.Create(reminder); err != nil {
+			log.Printf("[TodoService] Failed to copy reminder to todo %s: %v", next.ID, err)
+		}
+	}
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -6,39 +6,100 @@ import (
 	"log"
 	"time"
 
+	"github.com/todomyday/backend/internal/fracindex"
 	"github.com/todomyday/backend/internal/models"
 	"github.com/todomyday/backend/internal/repository"
+	"github.com/todomyday/backend/internal/rrule"
 )
 
 type TodoService struct {
 	todoRepo          *repository.TodoRepository
+	reminderRepo      *repository.ReminderRepository
+	timeEntryRepo     *repository.TimeEntryRepository
+	boardRepo         *repository.BoardRepository
+	groupRepo         *repository.GroupRepository
+	memoryRepo        *repository.MemoryRepository
 	aiService         *AIService
 	aiProviderService *AIProviderService
 	ragService        *RAGService
+	promptService     *PromptTemplateService
 }
 
-func NewTodoService(todoRepo *repository.TodoRepository, aiService *AIService, aiProviderService *AIProviderService, ragService *RAGService) *TodoService {
+func NewTodoService(todoRepo *repository.TodoRepository, reminderRepo *repository.ReminderRepository, timeEntryRepo *repository.TimeEntryRepository, boardRepo *repository.BoardRepository, groupRepo *repository.GroupRepository, memoryRepo *repository.MemoryRepository, aiService *AIService, aiProviderService *AIProviderService, ragService *RAGService, promptService *PromptTemplateService) *TodoService {
 	return &TodoService{
 		todoRepo:          todoRepo,
+		reminderRepo:      reminderRepo,
+		timeEntryRepo:     timeEntryRepo,
+		boardRepo:         boardRepo,
+		groupRepo:         groupRepo,
+		memoryRepo:        memoryRepo,
 		aiService:         aiService,
 		aiProviderService: aiProviderService,
 		ragService:        ragService,
+		promptService:     promptService,
 	}
 }
 
 func (s *TodoService) Create(userID string, req *models.TodoCreateRequest) (*models.Todo, error) {
-	// Get max position for ordering
-	maxPos, err := s.todoRepo.GetMaxPosition(userID)
-	if err != nil {
-		return nil, err
-	}
+	return s.create(userID, req, nil)
+}
 
-	// Process with AI if available
+// importedTodo is a todo read from another app, such as a calendar entry
+type importedTodo struct {
+	tags []string
+	uid  string // iCalendar UID, unique per user
+}
+
+// CreateImported creates a todo read from another app as it is, without
+// parsing or AI processing. uid, if set, marks the entry it came from so it
+// isn't imported twice.
+func (s *TodoService) CreateImported(userID string, req *models.TodoCreateRequest, tags []string, uid string) (*models.Todo, error) {
+	return s.create(userID, req, &importedTodo{tags: tags, uid: uid})
+}
+
+func (s *TodoService) create(userID string, req *models.TodoCreateRequest, imported *importedTodo) (*models.Todo, error) {
+	// A title the model parsed is already cleaned up, so it isn't asked twice,
+	// and imported todos are kept as they are
 	var aiResult *AIProcessedTodo
 	aiProcessed := false
+	if imported != nil {
+		aiResult = &AIProcessedTodo{Title: req.Title, Tags: imported.tags}
+		aiProcessed = true
+	}
+
+	var parsed *models.TodoParse
+	if req.Parse && imported == nil {
+		// Work on a copy so the caller's request keeps the title as written
+		parseReq := *req
+		req = &parseReq
+		var err error
+		if parsed, aiResult, err = s.parseTitle(userID, req); err != nil {
+			return nil, err
+		}
+		aiProcessed = aiResult != nil
+	}
+
+	var rule *rrule.Rule
+	if req.Recurrence != nil && *req.Recurrence != "" {
+		var err error
+		if rule, err = parseRecurrence(*req.Recurrence, req.RecurrenceEnd); err != nil {
+			return nil, err
+		}
+	}
+
+	var parent *models.Todo
+	if req.ParentID != nil && *req.ParentID != "" {
+		var err error
+		if parent, err = s.checkParent(userID, nil, *req.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Process with AI if available
+	prompts := s.promptService.GetPromptSet(userID)
 
 	// First, try to use user's configured AI provider
-	if s.aiProviderService != nil {
+	if !aiProcessed && s.aiProviderService != nil {
 		provider, err := s.aiProviderService.GetDefaultByUserID(userID)
 		if err == nil && provider != nil && provider.SelectedModel != nil {
 			// Get decrypted API key
@@ -49,6 +110,8 @@ func (s *TodoService) Create(userID string, req *models.TodoCreateRequest) (*mod
 					BaseURL:      provider.BaseURL,
 					APIKey:       apiKey,
 					Model:        *provider.SelectedModel,
+					Prompts:      prompts,
+					UserID:       userID,
 				}
 				result, err := ProcessTodoWithProvider(req.Title, config)
 				if err == nil && result != nil {
@@ -61,7 +124,7 @@ func (s *TodoService) Create(userID string, req *models.TodoCreateRequest) (*mod
 
 	// Fall back to default AI service from env if user provider didn't work
 	if !aiProcessed && s.aiService != nil && s.aiService.IsConfigured() {
-		result, err := s.aiService.ProcessTodo(req.Title)
+		result, err := s.aiService.ProcessTodo(req.Title, prompts)
 		if err == nil && result != nil {
 			aiResult = result
 			aiProcessed = true
@@ -69,10 +132,11 @@ func (s *TodoService) Create(userID string, req *models.TodoCreateRequest) (*mod
 	}
 
 	// Use AI results or fall back to original input
-	// Note: Date is parsed by frontend, AI only handles title cleanup and tags
+	// Note: Dates come from the frontend or from parseTitle; AI here only
+	// handles title cleanup and tags
 	title := req.Title
 	tags := []string{}
-	dueDate := req.DueDate // Frontend is source of truth for dates
+	dueDate := req.DueDate
 
 	if aiProcessed && aiResult != nil {
 		title = aiResult.Title
@@ -92,32 +156,41 @@ func (s *TodoService) Create(userID string, req *models.TodoCreateRequest) (*mod
 		Description: req.Description,
 		DueDate:     dueDate,
 		Priority:    req.Priority,
-		Position:    fmt.Sprintf("%d", maxPos+1000),
 		Tags:        tags,
 	}
+	todo.AutoComplete = req.AutoComplete
+	todo.EstimateMinutes = req.EstimateMinutes
+	if imported != nil && imported.uid != "" {
+		todo.ICalUID = &imported.uid
+	}
+	if parent != nil {
+		todo.ParentID = &parent.ID
+		if todo.GroupID == nil {
+			todo.GroupID = parent.GroupID
+		}
+	}
+
+	if rule != nil {
+		if err := s.startSeries(todo, rule); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.todoRepo.Create(todo); err != nil {
+		if todo.SeriesID != nil {
+			s.todoRepo.DeleteSeries(*todo.SeriesID)
+		}
 		return nil, err
 	}
 
-	// Async RAG indexing - fire and forget
-	if s.ragService != nil && s.ragService.IsConfigured() {
-		go func(t *models.Todo) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			if err := s.ragService.IndexTodo(ctx, t); err != nil {
-				log.Printf("[TodoService] Failed to index todo %s: %v", t.ID, err)
-			}
-		}(todo)
-	}
+	todo.Parsed = parsed
+	s.indexAsync(todo)
+	// A new subtask reopens a parent that was auto-completed
+	s.syncParent(todo.ParentID)
 
 	return todo, nil
 }
 
-func (s *TodoService) GetAll(userID string) ([]models.Todo, error) {
-	return s.todoRepo.GetAllByUserID(userID)
-}
-
 func (s *TodoService) GetByID(userID, todoID string) (*models.Todo, error) {
 	todo, err := s.todoRepo.GetByID(todoID)
 	if err != nil {
@@ -136,11 +209,38 @@ func (s *TodoService) Update(userID, todoID string, req *models.TodoUpdateReques
 		return nil, err
 	}
 	if todo == nil || todo.UserID != userID {
-		return nil, fmt.Errorf("todo not found")
+		return nil, ErrTodoNotFound
+	}
+
+	// Validate the recurrence before changing anything. An end date on its own
+	// ends the current rule.
+	var rule *rrule.Rule
+	if req.Recurrence != nil && *req.Recurrence != "" {
+		if rule, err = parseRecurrence(*req.Recurrence, req.RecurrenceEnd); err != nil {
+			return nil, err
+		}
+	} else if req.Recurrence == nil && req.RecurrenceEnd != nil && todo.Recurrence != nil {
+		if rule, err = parseRecurrence(*todo.Recurrence, req.RecurrenceEnd); err != nil {
+			return nil, err
+		}
 	}
 
 	updates := make(map[string]interface{})
 
+	if req.ParentID != nil {
+		if *req.ParentID == "" {
+			updates["parent_id"] = nil
+		} else {
+			if _, err := s.checkParent(userID, todo, *req.ParentID); err != nil {
+				return nil, err
+			}
+			updates["parent_id"] = *req.ParentID
+		}
+	}
+	if req.AutoComplete != nil {
+		updates["auto_complete"] = *req.AutoComplete
+	}
+
 	if req.Title != nil {
 		updates["title"] = *req.Title
 	}
@@ -154,17 +254,36 @@ func (s *TodoService) Update(userID, todoID string, req *models.TodoUpdateReques
 		updates["priority"] = *req.Priority
 	}
 	if req.Status != nil {
+		// A status set by hand replaces any the todo was blocked from
 		updates["status"] = *req.Status
+		updates["resume_status"] = nil
+		if *req.Status != todo.Status {
+			if *req.Status == models.StatusCompleted {
+				updates["completed_at"] = time.Now()
+			} else {
+				updates["completed_at"] = nil
+			}
+		}
 	}
 	if req.GroupID != nil {
 		updates["group_id"] = *req.GroupID
 	}
 	if req.Position != nil {
+		if !fracindex.Valid(*req.Position) {
+			return nil, fmt.Errorf("%w: %q is not a fractional index key", ErrInvalidPosition, *req.Position)
+		}
 		updates["position"] = *req.Position
 	}
 	if req.Tags != nil {
 		updates["tags"] = req.Tags
 	}
+	if req.EstimateMinutes != nil {
+		if *req.EstimateMinutes == 0 {
+			updates["estimate_minutes"] = nil
+		} else {
+			updates["estimate_minutes"] = *req.EstimateMinutes
+		}
+	}
 
 	if len(updates) > 0 {
 		if err := s.todoRepo.Update(todoID, updates); err != nil {
@@ -172,52 +291,160 @@ func (s *TodoService) Update(userID, todoID string, req *models.TodoUpdateReques
 		}
 	}
 
+	if rule != nil || (todo.SeriesID != nil && (req.Recurrence != nil || req.Scope == models.ScopeSeries)) {
+		if err := s.updateRecurrence(todo, req, rule); err != nil {
+			return nil, err
+		}
+	}
+
+	// Todos reopened while their blockers are open are blocked again
+	if req.Status != nil && !req.Status.IsDone() {
+		s.syncBlocked(todoID)
+	}
+
 	updatedTodo, err := s.todoRepo.GetByID(todoID)
 	if err != nil {
 		return nil, err
 	}
+	if updatedTodo == nil {
+		return nil, ErrTodoNotFound
+	}
 
-	// Async RAG indexing - fire and forget
-	if s.ragService != nil && s.ragService.IsConfigured() && updatedTodo != nil {
-		go func(t *models.Todo) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			if err := s.ragService.IndexTodo(ctx, t); err != nil {
-				log.Printf("[TodoService] Failed to re-index todo %s: %v", t.ID, err)
-			}
-		}(updatedTodo)
+	// Reminders relative to the due date move with it
+	if req.DueDate != nil || rule != nil {
+		s.rescheduleReminders(updatedTodo)
+	}
+
+	// Finishing an instance of a recurring todo brings up the next one, and
+	// finishing or reopening a todo updates the todos it blocks
+	if !todo.Status.IsDone() && updatedTodo.Status.IsDone() {
+		s.continueSeries(updatedTodo)
+	}
+	if todo.Status.IsDone() != updatedTodo.Status.IsDone() {
+		s.syncDependents(todoID)
+	}
+
+	// Parents that auto-complete follow their subtasks
+	moved := req.ParentID != nil && !sameParent(todo.ParentID, updatedTodo.ParentID)
+	if moved {
+		s.syncParent(todo.ParentID)
+	}
+	if moved || todo.Status != updatedTodo.Status {
+		s.syncParent(updatedTodo.ParentID)
+	}
+	if req.AutoComplete != nil && *req.AutoComplete && updatedTodo.Progress != nil {
+		s.syncParent(&todoID)
+		if updatedTodo, err = s.todoRepo.GetByID(todoID); err != nil {
+			return nil, err
+		}
+	}
+
+	s.indexAsync(updatedTodo)
+	if moved || req.Title != nil {
+		s.reindexSubtasks(todoID)
 	}
 
 	return updatedTodo, nil
 }
 
-func (s *TodoService) Delete(userID, todoID string) error {
+// Delete deletes a todo. Deleting a pending instance of a recurring todo skips
+// that occurrence so the series carries on; scope "series" deletes the series
+// and its pending instances instead.
+func (s *TodoService) Delete(userID, todoID string, scope models.TodoScope) error {
 	// Verify ownership
 	todo, err := s.todoRepo.GetByID(todoID)
 	if err != nil {
 		return err
 	}
 	if todo == nil || todo.UserID != userID {
-		return fmt.Errorf("todo not found")
+		return ErrTodoNotFound
+	}
+
+	// Subtasks are deleted along with the todo
+	descendants, err := s.todoRepo.GetDescendants(todoID)
+	if err != nil {
+		return err
+	}
+	dependents, err := s.todoRepo.GetDependents(todoID)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, descendant := range descendants {
+		ids = append(ids, descendant.ID)
+	}
+
+	switch {
+	case todo.SeriesID != nil && scope == models.ScopeSeries:
+		err = s.deleteSeries(todo)
+	case todo.SeriesID != nil && !todo.Status.IsDone():
+		_, err = s.skip(todo)
+	default:
+		if err = s.todoRepo.Delete(todoID); err == nil {
+			s.unindexAsync(todoID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.unindexAsync(ids...)
+	s.syncParent(todo.ParentID)
+	for _, dependent := range dependents {
+		s.syncBlocked(dependent.ID)
+	}
+	return nil
+}
+
+func sameParent(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return *a == *b
+}
+
+// indexAsync indexes a todo for RAG in the background
+func (s *TodoService) indexAsync(todo *models.Todo) {
+	if s.ragService == nil || !s.ragService.IsConfigured() {
+		return
+	}
+	go func(t *models.Todo) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.ragService.IndexTodo(ctx, t); err != nil {
+			log.Printf("[TodoService] Failed to index todo %s: %v", t.ID, err)
+		}
+	}(todo)
+}
 
-	// Async RAG deletion - fire and forget
-	if s.ragService != nil && s.ragService.IsConfigured() {
-		go func(id string) {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
+// unindexAsync removes deleted todos from the RAG index in the background
+func (s *TodoService) unindexAsync(ids ...string) {
+	if s.ragService == nil || !s.ragService.IsConfigured() || len(ids) == 0 {
+		return
+	}
+	go func(ids []string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for _, id := range ids {
 			if err := s.ragService.DeleteFromIndex(ctx, models.ContentTypeTodo, id); err != nil {
 				log.Printf("[TodoService] Failed to delete todo %s from index: %v", id, err)
 			}
-		}(todoID)
-	}
-
-	return s.todoRepo.Delete(todoID)
+		}
+	}(ids)
 }
 
+// Reorder puts todos in the order of the positions sent. They take the places
+// they hold between them now (see reorderSlots), so other todos don't move.
 func (s *TodoService) Reorder(userID string, req *models.TodoReorderRequest) error {
 	// Verify all todos belong to user before updating
+	seen := make(map[string]bool, len(req.Todos))
+	var sent, current []string
+	var todos []models.TodoPosition
 	for _, t := range req.Todos {
+		if seen[t.ID] {
+			continue
+		}
+		seen[t.ID] = true
 		todo, err := s.todoRepo.GetByID(t.ID)
 		if err != nil {
 			return err
@@ -225,7 +452,51 @@ func (s *TodoService) Reorder(userID string, req *models.TodoReorderRequest) err
 		if todo == nil || todo.UserID != userID {
 			return fmt.Errorf("todo %s not found or unauthorized", t.ID)
 		}
+		sent = append(sent, t.Position)
+		current = append(current, todo.Position)
+		todos = append(todos, models.TodoPosition{ID: t.ID})
+	}
+
+	for i, position := range reorderSlots(sent, current) {
+		todos[i].Position = position
+	}
+	return s.todoRepo.UpdatePositions(userID, todos)
+}
+
+// MoveAfter puts a todo right after another in the user's list, or first
+// when req has no AfterID. Only the moved todo's position changes.
+func (s *TodoService) MoveAfter(userID, todoID string, req *models.TodoMoveAfterRequest) (*models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	afterID := ""
+	if req.AfterID != nil {
+		afterID = *req.AfterID
+	}
+	if afterID == todoID {
+		return nil, fmt.Errorf("%w: a todo can't be moved after itself", ErrInvalidPosition)
+	}
+	if afterID != "" {
+		after, err := s.GetByID(userID, afterID)
+		if err != nil {
+			return nil, err
+		}
+		if after == nil {
+			return nil, fmt.Errorf("%w: no todo %s to move after", ErrInvalidPosition, afterID)
+		}
 	}
 
-	return s.todoRepo.UpdatePositions(req.Todos)
+	moved, err := s.todoRepo.MoveAfter(userID, todoID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	if !moved {
+		return nil, ErrTodoNotFound
+	}
+	return s.GetByID(userID, todoID)
 }
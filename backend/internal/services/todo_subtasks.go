@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// maxTodoDepth is how many levels deep todos may nest, counting the top level
+const maxTodoDepth = 5
+
+// ErrInvalidParent is returned when a todo can't be made a subtask of the given parent
+var ErrInvalidParent = errors.New("invalid parent todo")
+
+// checkParent verifies that todo (nil for a new todo) can become a subtask of
+// parentID and returns the parent
+func (s *TodoService) checkParent(userID string, todo *models.Todo, parentID string) (*models.Todo, error) {
+	parent, err := s.GetByID(userID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, fmt.Errorf("%w: parent not found", ErrInvalidParent)
+	}
+
+	ancestors, err := s.todoRepo.GetAncestors(parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A moved todo brings its own subtasks along
+	height := 1
+	if todo != nil {
+		if parentID == todo.ID {
+			return nil, fmt.Errorf("%w: a todo can't be its own subtask", ErrInvalidParent)
+		}
+		for _, ancestor := range ancestors {
+			if ancestor.ID == todo.ID {
+				return nil, fmt.Errorf("%w: a todo can't be a subtask of its own subtask", ErrInvalidParent)
+			}
+		}
+
+		descendants, err := s.todoRepo.GetDescendants(todo.ID)
+		if err != nil {
+			return nil, err
+		}
+		levels := map[string]int{todo.ID: 1}
+		for _, descendant := range descendants {
+			levels[descendant.ID] = levels[*descendant.ParentID] + 1
+			if levels[descendant.ID] > height {
+				height = levels[descendant.ID]
+			}
+		}
+	}
+
+	if len(ancestors)+1+height > maxTodoDepth {
+		return nil, fmt.Errorf("%w: todos can only nest %d levels deep", ErrInvalidParent, maxTodoDepth)
+	}
+	return parent, nil
+}
+
+// GetSubtasks returns a todo's direct subtasks, or nil if the todo doesn't exist
+// or isn't the user's
+func (s *TodoService) GetSubtasks(userID, todoID string) ([]models.Todo, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil || todo == nil {
+		return nil, err
+	}
+	return s.todoRepo.GetSubtasks(todoID)
+}
+
+// syncParent completes an open auto-completing parent once all its subtasks are
+// done, and reopens a completed one when a subtask is reopened or added, then
+// does the same for the parent's own parent. Other statuses, such as in
+// progress or cancelled, are the user's and left alone.
+func (s *TodoService) syncParent(parentID *string) {
+	for parentID != nil {
+		parent, err := s.todoRepo.GetByID(*parentID)
+		if err != nil || parent == nil || !parent.AutoComplete || parent.Progress == nil {
+			if err != nil {
+				log.Printf("[TodoService] Failed to load parent todo %s: %v", *parentID, err)
+			}
+			return
+		}
+
+		var status models.Status
+		done := parent.Progress.Completed == parent.Progress.Total
+		switch {
+		case done && !parent.Status.IsDone():
+			status = models.StatusCompleted
+		case !done && parent.Status == models.StatusCompleted:
+			status = models.StatusPending
+		default:
+			return
+		}
+		if err := s.setStatus(parent, status); err != nil {
+			log.Printf("[TodoService] Failed to update parent todo %s: %v", parent.ID, err)
+			return
+		}
+		// As in Update: a reopened parent whose blockers are open is blocked again
+		if status == models.StatusPending {
+			s.syncBlocked(parent.ID)
+		}
+		parentID = parent.ParentID
+	}
+}
+
+// setStatus changes a todo's status outside of an edit, as auto-completion does
+func (s *TodoService) setStatus(todo *models.Todo, status models.Status) error {
+	updates := map[string]interface{}{
+		"status":       status,
+		"completed_at": nil,
+	}
+	if status == models.StatusCompleted {
+		updates["completed_at"] = time.Now()
+	}
+	if err := s.todoRepo.Update(todo.ID, updates); err != nil {
+		return err
+	}
+
+	wasDone := todo.Status.IsDone()
+	todo.Status = status
+	if status == models.StatusCompleted {
+		s.continueSeries(todo)
+	}
+	if wasDone != status.IsDone() {
+		s.syncDependents(todo.ID)
+	}
+	if updated, err := s.todoRepo.GetByID(todo.ID); err == nil && updated != nil {
+		s.indexAsync(updated)
+	}
+	return nil
+}
+
+// reindexSubtasks re-indexes a todo's subtasks, whose documents include the
+// titles of the todos above them
+func (s *TodoService) reindexSubtasks(todoID string) {
+	if s.ragService == nil || !s.ragService.IsConfigured() {
+		return
+	}
+	descendants, err := s.todoRepo.GetDescendants(todoID)
+	if err != nil {
+		log.Printf("[TodoService] Failed to load subtasks of todo %s: %v", todoID, err)
+		return
+	}
+	for i := range descendants {
+		s.indexAsync(&descendants[i])
+	}
+}
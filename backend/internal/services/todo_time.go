@@ -0,0 +1,312 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/todomyday/backend/internal/models"
+)
+
+// maxReportDays caps the range of a time report
+const maxReportDays = 366
+
+var (
+	// ErrTimerRunning is returned when starting a timer while another one runs
+	ErrTimerRunning = errors.New("a timer is already running")
+	// ErrTimerNotRunning is returned when stopping a todo's timer that isn't running
+	ErrTimerNotRunning = errors.New("no timer is running on this todo")
+	// ErrInvalidTimeEntry is returned for entries that don't end after they
+	// start, or end in the future
+	ErrInvalidTimeEntry = errors.New("invalid time entry")
+	// ErrTimeEntryNotFound is returned when an entry doesn't exist or isn't the todo's
+	ErrTimeEntryNotFound = errors.New("time entry not found")
+	// ErrInvalidTimeReport is returned for report ranges and groupings that
+	// can't be reported on
+	ErrInvalidTimeReport = errors.New("invalid time report")
+)
+
+// StartTimer starts tracking time on a todo. A user has at most one timer
+// running; starting another returns ErrTimerRunning.
+func (s *TodoService) StartTimer(userID, todoID string, req *models.TimerStartRequest) (*models.TimeEntry, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	entry := &models.TimeEntry{
+		TodoID:    todoID,
+		UserID:    userID,
+		StartedAt: time.Now().UTC().Truncate(time.Second),
+		Note:      req.Note,
+	}
+	started, err := s.timeEntryRepo.Start(entry)
+	if err != nil {
+		return nil, err
+	}
+	if !started {
+		return nil, ErrTimerRunning
+	}
+	return entry, nil
+}
+
+// StopTimer stops the timer running on a todo and returns its entry
+func (s *TodoService) StopTimer(userID, todoID string) (*models.TimeEntry, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	running, err := s.timeEntryRepo.GetRunning(userID)
+	if err != nil {
+		return nil, err
+	}
+	if running == nil || running.TodoID != todoID {
+		return nil, ErrTimerNotRunning
+	}
+	if _, err := s.timeEntryRepo.Stop(userID, todoID, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.timeEntryRepo.GetByID(running.ID)
+}
+
+// GetRunningTimer returns the user's running timer, or nil if none is running
+func (s *TodoService) GetRunningTimer(userID string) (*models.TimeEntry, error) {
+	return s.timeEntryRepo.GetRunning(userID)
+}
+
+// GetTime returns the time tracked on a todo and its estimate
+func (s *TodoService) GetTime(userID, todoID string) (*models.TodoTime, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	entries, err := s.timeEntryRepo.GetByTodoID(todoID)
+	if err != nil {
+		return nil, err
+	}
+	total := &models.TodoTime{Entries: entries, EstimateMinutes: todo.EstimateMinutes}
+	for _, entry := range entries {
+		total.TrackedSeconds += entry.Seconds
+	}
+	return total, nil
+}
+
+// CreateTimeEntry records time spent on a todo without a timer
+func (s *TodoService) CreateTimeEntry(userID, todoID string, req *models.TimeEntryCreateRequest) (*models.TimeEntry, error) {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return nil, err
+	}
+	if todo == nil {
+		return nil, ErrTodoNotFound
+	}
+
+	if !req.EndedAt.After(req.StartedAt) {
+		return nil, fmt.Errorf("%w: ended_at must be after started_at", ErrInvalidTimeEntry)
+	}
+	if req.EndedAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: ended_at is in the future", ErrInvalidTimeEntry)
+	}
+
+	startedAt := req.StartedAt.UTC().Truncate(time.Second)
+	endedAt := req.EndedAt.UTC().Truncate(time.Second)
+	entry := &models.TimeEntry{
+		TodoID:    todoID,
+		UserID:    userID,
+		StartedAt: startedAt,
+		EndedAt:   &endedAt,
+		Note:      req.Note,
+		Seconds:   int64(endedAt.Sub(startedAt) / time.Second),
+	}
+	if err := s.timeEntryRepo.Create(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DeleteTimeEntry deletes one of a todo's time entries, stopping its timer if
+// it is running
+func (s *TodoService) DeleteTimeEntry(userID, todoID, entryID string) error {
+	todo, err := s.GetByID(userID, todoID)
+	if err != nil {
+		return err
+	}
+	if todo == nil {
+		return ErrTodoNotFound
+	}
+
+	entry, err := s.timeEntryRepo.GetByID(entryID)
+	if err != nil {
+		return err
+	}
+	if entry == nil || entry.TodoID != todoID {
+		return ErrTimeEntryNotFound
+	}
+	return s.timeEntryRepo.Delete(entryID)
+}
+
+// GetTimeReport totals the time tracked from one day to another in timezone,
+// by group or by tag. Days default to the last week.
+func (s *TodoService) GetTimeReport(userID, from, to string, groupBy models.TimeReportGrouping, timezone *string) (*models.TimeReport, error) {
+	if groupBy == "" {
+		groupBy = models.ReportByGroup
+	}
+	if groupBy != models.ReportByGroup && groupBy != models.ReportByTag {
+		return nil, fmt.Errorf("%w: unknown group_by %q", ErrInvalidTimeReport, groupBy)
+	}
+
+	loc, err := s.userLocation(userID, timezone)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	today := now.In(loc)
+	if to == "" {
+		to = today.Format("2006-01-02")
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDate, to)
+	}
+	if from == "" {
+		from = end.AddDate(0, 0, -6).Format("2006-01-02")
+	}
+	start, err := time.ParseInLocation("2006-01-02", from, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDate, from)
+	}
+	// The range ends at the start of the day after to
+	end = end.AddDate(0, 0, 1)
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: from is after to", ErrInvalidTimeReport)
+	}
+	if end.After(start.AddDate(0, 0, maxReportDays)) {
+		return nil, fmt.Errorf("%w: reports cover at most %d days", ErrInvalidTimeReport, maxReportDays)
+	}
+
+	entries, err := s.timeEntryRepo.GetInRange(userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	// Total each todo's time inside the range
+	seconds := make(map[string]int64)
+	var order []string
+	for _, entry := range entries {
+		entryStart, entryEnd := entry.StartedAt, now
+		if entry.EndedAt != nil {
+			entryEnd = *entry.EndedAt
+		}
+		if entryStart.Before(start) {
+			entryStart = start
+		}
+		if entryEnd.After(end) {
+			entryEnd = end
+		}
+		if !entryEnd.After(entryStart) {
+			continue
+		}
+		if _, ok := seconds[entry.TodoID]; !ok {
+			order = append(order, entry.TodoID)
+		}
+		seconds[entry.TodoID] += int64(entryEnd.Sub(entryStart) / time.Second)
+	}
+
+	groupNames := make(map[string]string)
+	if groupBy == models.ReportByGroup {
+		groups, err := s.groupRepo.GetAllByUserID(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			groupNames[group.ID] = group.Name
+		}
+	}
+
+	report := &models.TimeReport{
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		GroupBy:  groupBy,
+		Rows:     []models.TimeReportRow{},
+		Todos:    []models.TodoTimeTotal{},
+	}
+	rows := make(map[string]*models.TimeReportRow)
+	var rowKeys []string
+	addTo := func(key string, id *string, name string, todo *models.Todo, tracked int64) {
+		row, ok := rows[key]
+		if !ok {
+			row = &models.TimeReportRow{ID: id, Name: name}
+			rows[key] = row
+			rowKeys = append(rowKeys, key)
+		}
+		row.Seconds += tracked
+		row.Todos++
+		if todo.EstimateMinutes != nil {
+			row.EstimateMinutes += *todo.EstimateMinutes
+		}
+	}
+
+	for _, todoID := range order {
+		// Entries are deleted with their todo, so it is only missing if it
+		// was deleted since the entries were read
+		todo, err := s.todoRepo.GetByID(todoID)
+		if err != nil {
+			return nil, err
+		}
+		if todo == nil {
+			continue
+		}
+		tracked := seconds[todoID]
+		report.TotalSeconds += tracked
+		report.Todos = append(report.Todos, models.TodoTimeTotal{
+			TodoID:          todo.ID,
+			Title:           todo.Title,
+			Seconds:         tracked,
+			EstimateMinutes: todo.EstimateMinutes,
+		})
+
+		switch {
+		case groupBy == models.ReportByTag && len(todo.Tags) > 0:
+			seen := make(map[string]bool)
+			for _, tag := range todo.Tags {
+				key := strings.ToLower(tag)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				id := tag
+				addTo("tag:"+key, &id, tag, todo, tracked)
+			}
+		case groupBy == models.ReportByGroup && todo.GroupID != nil && groupNames[*todo.GroupID] != "":
+			addTo("group:"+*todo.GroupID, todo.GroupID, groupNames[*todo.GroupID], todo, tracked)
+		default:
+			addTo("", nil, "", todo, tracked)
+		}
+	}
+
+	for _, key := range rowKeys {
+		report.Rows = append(report.Rows, *rows[key])
+	}
+	// Most time first
+	sort.SliceStable(report.Rows, func(i, j int) bool {
+		return report.Rows[i].Seconds > report.Rows[j].Seconds
+	})
+	sort.SliceStable(report.Todos, func(i, j int) bool {
+		return report.Todos[i].Seconds > report.Todos[j].Seconds
+	})
+	return report, nil
+}
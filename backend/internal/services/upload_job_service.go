@@ -143,11 +143,15 @@ func (s *UploadJobService) cleanupOldJobs() {
 	}
 }
 
-// GetJobStatus returns the current status of a job
+// GetJobStatus returns the current status of a job.
+// The snapshot is taken under the lock since the job is updated while it's being processed.
 func (s *UploadJobService) GetJobStatus(jobID string) (*models.UploadJobStatusResponse, error) {
-	job, err := s.GetJob(jobID)
-	if err != nil {
-		return nil, err
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, exists := s.jobs[jobID]
+	if !exists {
+		return nil, fmt.Errorf("job not found")
 	}
 
 	return &models.UploadJobStatusResponse{
@@ -156,7 +160,7 @@ func (s *UploadJobService) GetJobStatus(jobID string) (*models.UploadJobStatusRe
 		Progress:       job.Progress,
 		TotalItems:     job.TotalItems,
 		ProcessedItems: job.ProcessedItems,
-		Memories:       job.Memories,
+		Memories:       append([]models.Memory(nil), job.Memories...),
 		ErrorMessage:   job.ErrorMessage,
 		CreatedAt:      job.CreatedAt,
 		UpdatedAt:      job.UpdatedAt,
@@ -10,14 +10,20 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/todomyday/backend/internal/models"
 )
 
-// VisionService handles image analysis using GLM-4.5V
+// VisionService handles image analysis using the vision model a user selected in
+// their AI provider settings or, failing that, a vision-capable model among their
+// providers, falling back to the server's GLM-4.5V configuration
 type VisionService struct {
-	baseURL string
-	apiKey  string
-	model   string
-	client  *http.Client
+	baseURL           string
+	apiKey            string
+	model             string
+	client            *http.Client
+	aiProviderService *AIProviderService
+	promptService     *PromptTemplateService
 }
 
 // VisionResult contains extracted information from an image
@@ -65,7 +71,51 @@ type visionResponse struct {
 	} `json:"error,omitempty"`
 }
 
-func NewVisionService(baseURL, apiKey, model string) *VisionService {
+// Anthropic vision types (https://docs.anthropic.com/en/docs/build-with-claude/vision)
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicContentBlock struct {
+	Type   string                `json:"type"` // "image" or "text"
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicVisionMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicVisionRequest struct {
+	Model     string                   `json:"model"`
+	MaxTokens int                      `json:"max_tokens"`
+	Messages  []anthropicVisionMessage `json:"messages"`
+}
+
+// Gemini vision types (https://ai.google.dev/gemini-api/docs/vision)
+type googleInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type googleVisionPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *googleInlineData `json:"inlineData,omitempty"`
+}
+
+type googleVisionContent struct {
+	Parts []googleVisionPart `json:"parts"`
+}
+
+type googleVisionRequest struct {
+	Contents         []googleVisionContent `json:"contents"`
+	GenerationConfig googleGenConfig       `json:"generationConfig"`
+}
+
+func NewVisionService(baseURL, apiKey, model string, aiProviderService *AIProviderService, promptService *PromptTemplateService) *VisionService {
 	// If no specific vision model provided, use glm-4.5v (or glm-4v-flash for faster responses)
 	if model == "" {
 		model = "glm-4.5v"
@@ -77,45 +127,117 @@ func NewVisionService(baseURL, apiKey, model string) *VisionService {
 		client: &http.Client{
 			Timeout: 60 * time.Second, // Vision models can take longer
 		},
+		aiProviderService: aiProviderService,
+		promptService:     promptService,
 	}
 }
 
+// IsConfigured reports whether the server-wide fallback vision model is configured
 func (s *VisionService) IsConfigured() bool {
 	return s.baseURL != "" && s.apiKey != ""
 }
 
+// IsConfiguredForUser reports whether the user has a vision model selected or the fallback is configured
+func (s *VisionService) IsConfiguredForUser(userID string) bool {
+	return s.getVisionConfig(userID) != nil
+}
+
+// getVisionConfig returns the provider configuration for a user's image requests
+func (s *VisionService) getVisionConfig(userID string) *AIProviderConfig {
+	if s.aiProviderService != nil {
+		// Try the user's selected vision model first
+		provider, err := s.aiProviderService.GetVisionByUserID(userID)
+		if err == nil && provider != nil && provider.VisionModel != nil {
+			if config := s.providerConfig(userID, provider, *provider.VisionModel); config != nil {
+				return config
+			}
+		}
+
+		// Then any vision-capable model among the user's providers
+		provider, model, err := s.aiProviderService.FindCapableModel(userID, models.ModelRequirements{Vision: true})
+		if err == nil {
+			if config := s.providerConfig(userID, provider, model); config != nil {
+				return config
+			}
+		}
+	}
+
+	// Fall back to the server's vision model
+	if s.IsConfigured() {
+		return &AIProviderConfig{
+			ProviderType: models.ProviderTypeOpenAI,
+			BaseURL:      s.baseURL,
+			APIKey:       s.apiKey,
+			Model:        s.model,
+			Prompts:      s.promptService.GetPromptSet(userID),
+			UserID:       userID,
+		}
+	}
+
+	return nil
+}
+
+// providerConfig builds the request config for one of the user's providers, or nil if its key can't be decrypted
+func (s *VisionService) providerConfig(userID string, provider *models.AIProvider, model string) *AIProviderConfig {
+	apiKey, err := s.aiProviderService.GetDecryptedAPIKey(provider)
+	if err != nil {
+		return nil
+	}
+	return &AIProviderConfig{
+		ProviderType: provider.ProviderType,
+		BaseURL:      provider.BaseURL,
+		APIKey:       apiKey,
+		Model:        model,
+		Prompts:      s.promptService.GetPromptSet(userID),
+		UserID:       userID,
+	}
+}
+
 // ProcessImage analyzes an image and extracts notes, details, planning items, etc.
-func (s *VisionService) ProcessImage(imageData []byte, mimeType string) (*VisionResult, error) {
-	if !s.IsConfigured() {
+// using the user's vision model in the request format its provider expects
+func (s *VisionService) ProcessImage(userID string, imageData []byte, mimeType string) (*VisionResult, error) {
+	config := s.getVisionConfig(userID)
+	if config == nil {
 		return nil, fmt.Errorf("vision service not configured")
 	}
 
-	// Convert image to base64 data URI
+	log.Printf("[Vision] Processing image with %s model %s, size: %d bytes, type: %s",
+		config.ProviderType, config.Model, len(imageData), mimeType)
+
+	// Build the prompt for extracting notes and details
+	prompt := config.Prompts.Render(PromptVisionExtraction, PromptData{})
 	base64Image := base64.StdEncoding.EncodeToString(imageData)
-	dataURI := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Image)
 
-	log.Printf("[Vision] Processing image with model %s, size: %d bytes, type: %s", s.model, len(imageData), mimeType)
+	var content string
+	var err error
+	switch config.ProviderType {
+	case models.ProviderTypeMock:
+		content, err = callMockJSON(config, prompt, visionOutputSchema)
+	case models.ProviderTypeAnthropic:
+		content, err = s.callAnthropicVision(config, prompt, base64Image, mimeType)
+	case models.ProviderTypeGoogle:
+		content, err = s.callGoogleVision(config, prompt, base64Image, mimeType)
+	default:
+		content, err = s.callOpenAIVision(config, prompt, base64Image, mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	// Build the prompt for extracting notes and details
-	prompt := `Analyze this image carefully and extract all relevant information. Focus on:
-
-1. **Notes & Text**: Extract any handwritten or printed text, lists, bullet points
-2. **Planning Items**: Identify any tasks, to-dos, action items, deadlines, or scheduling information
-3. **Key Details**: Important facts, numbers, names, dates, or references
-4. **Ideas & Concepts**: Main themes, ideas, or concepts shown
-5. **Structure**: How the information is organized (lists, mind maps, diagrams, etc.)
-
-Respond with ONLY valid JSON (no markdown, no code blocks):
-{
-  "content": "The complete extracted text and information from the image, formatted clearly with line breaks where appropriate",
-  "summary": "A brief 1-2 sentence summary of what this image contains",
-  "category": "Choose the best category from: Ideas, Learnings, Quotes, Products, Places, People, Books, Movies, Food, Websites, Uncategorized",
-  "tags": ["tag1", "tag2", "tag3"]
-}`
+	content = strings.TrimSpace(content)
+	log.Printf("[Vision] Raw content: %s", content)
+
+	// Parse the JSON response
+	return s.parseVisionResponse(config, prompt, content)
+}
+
+// callOpenAIVision sends the image as a data URI in the OpenAI multimodal format
+func (s *VisionService) callOpenAIVision(config *AIProviderConfig, prompt, base64Image, mimeType string) (string, error) {
+	dataURI := fmt.Sprintf("data:%s;base64,%s", mimeType, base64Image)
 
 	// Build multimodal request
 	reqBody := visionRequest{
-		Model: s.model,
+		Model: config.Model,
 		Messages: []visionMessage{
 			{
 				Role: "user",
@@ -137,21 +259,140 @@ Respond with ONLY valid JSON (no markdown, no code blocks):
 		Temperature: 0.3,
 	}
 
+	url := strings.TrimSuffix(config.BaseURL, "/") + "/chat/completions"
+	log.Printf("[Vision] Request URL: %s", url)
+
+	headers := map[string]string{}
+	if config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + config.APIKey
+	}
+
+	body, err := s.post(url, headers, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var visionResp visionResponse
+	if err := json.Unmarshal(body, &visionResp); err != nil {
+		log.Printf("[Vision] JSON decode error: %v", err)
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Check for API error in response body
+	if visionResp.Error != nil {
+		return "", fmt.Errorf("vision API error: %s", visionResp.Error.Message)
+	}
+
+	if len(visionResp.Choices) == 0 {
+		return "", fmt.Errorf("no response from vision model")
+	}
+
+	return visionResp.Choices[0].Message.Content, nil
+}
+
+// callAnthropicVision sends the image as a base64 image content block
+func (s *VisionService) callAnthropicVision(config *AIProviderConfig, prompt, base64Image, mimeType string) (string, error) {
+	reqBody := anthropicVisionRequest{
+		Model:     config.Model,
+		MaxTokens: 2000,
+		Messages: []anthropicVisionMessage{
+			{
+				Role: "user",
+				Content: []anthropicContentBlock{
+					{
+						Type: "image",
+						Source: &anthropicImageSource{
+							Type:      "base64",
+							MediaType: mimeType,
+							Data:      base64Image,
+						},
+					},
+					{
+						Type: "text",
+						Text: prompt,
+					},
+				},
+			},
+		},
+	}
+
+	url := strings.TrimSuffix(config.BaseURL, "/") + "/messages"
+	body, err := s.post(url, map[string]string{
+		"x-api-key":         config.APIKey,
+		"anthropic-version": "2023-06-01",
+	}, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var anthropicResp anthropicResponse
+	if err := json.Unmarshal(body, &anthropicResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(anthropicResp.Content) == 0 {
+		return "", fmt.Errorf("no response from vision model")
+	}
+
+	return anthropicResp.Content[0].Text, nil
+}
+
+// callGoogleVision sends the image as inline data alongside the prompt
+func (s *VisionService) callGoogleVision(config *AIProviderConfig, prompt, base64Image, mimeType string) (string, error) {
+	reqBody := googleVisionRequest{
+		Contents: []googleVisionContent{
+			{
+				Parts: []googleVisionPart{
+					{InlineData: &googleInlineData{MimeType: mimeType, Data: base64Image}},
+					{Text: prompt},
+				},
+			},
+		},
+		GenerationConfig: googleGenConfig{
+			MaxOutputTokens:  2000,
+			Temperature:      0.3,
+			ResponseMimeType: "application/json",
+		},
+	}
+
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s",
+		strings.TrimSuffix(config.BaseURL, "/"),
+		config.Model,
+		config.APIKey,
+	)
+	body, err := s.post(url, nil, reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	var googleResp googleResponse
+	if err := json.Unmarshal(body, &googleResp); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(googleResp.Candidates) == 0 || len(googleResp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no response from vision model")
+	}
+
+	return googleResp.Candidates[0].Content.Parts[0].Text, nil
+}
+
+// post sends a JSON request and returns the response body, treating non-200 statuses as errors
+func (s *VisionService) post(url string, headers map[string]string, reqBody interface{}) ([]byte, error) {
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	url := s.baseURL + "/chat/completions"
-	log.Printf("[Vision] Request URL: %s", url)
-
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -168,50 +409,20 @@ Respond with ONLY valid JSON (no markdown, no code blocks):
 		return nil, fmt.Errorf("vision API error: %s - %s", resp.Status, string(body))
 	}
 
-	var visionResp visionResponse
-	if err := json.Unmarshal(body, &visionResp); err != nil {
-		log.Printf("[Vision] JSON decode error: %v", err)
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Check for API error in response body
-	if visionResp.Error != nil {
-		return nil, fmt.Errorf("vision API error: %s", visionResp.Error.Message)
-	}
-
-	if len(visionResp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from vision model")
-	}
-
-	content := strings.TrimSpace(visionResp.Choices[0].Message.Content)
-	log.Printf("[Vision] Raw content: %s", content)
-
-	// Parse the JSON response
-	return parseVisionResponse(content)
+	return body, nil
 }
 
-func parseVisionResponse(content string) (*VisionResult, error) {
-	var result VisionResult
+// parseVisionResponse validates the model's JSON against the vision schema.
+// Invalid output gets one text-only repair round-trip; if that also fails the
+// raw content is kept so the extracted text isn't lost.
+func (s *VisionService) parseVisionResponse(config *AIProviderConfig, prompt, content string) (*VisionResult, error) {
+	recordStructuredOutcome(config, func(st *StructuredOutputStats) { st.Requests++ })
 
-	// Try to parse as JSON directly
-	if err := json.Unmarshal([]byte(content), &result); err != nil {
-		// Try to extract JSON from the response (might have markdown wrapper)
-		start := strings.Index(content, "{")
-		end := strings.LastIndex(content, "}")
-		if start != -1 && end != -1 && end > start {
-			jsonStr := content[start : end+1]
-			if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-				log.Printf("[Vision] Failed to parse JSON: %v", err)
-				// Fall back to using raw content
-				result = VisionResult{
-					Content:  content,
-					Summary:  "",
-					Category: "Uncategorized",
-					Tags:     []string{},
-				}
-			}
-		} else {
-			// No JSON found, use raw content
+	var result VisionResult
+	if err := decodeStructured(content, visionOutputSchema, &result); err != nil {
+		if err := repairStructured(config, prompt, content, err, visionOutputSchema, &result); err != nil {
+			log.Printf("[Vision] Failed to parse JSON: %v", err)
+			// Fall back to using raw content
 			result = VisionResult{
 				Content:  content,
 				Summary:  "",
@@ -221,21 +432,11 @@ func parseVisionResponse(content string) (*VisionResult, error) {
 		}
 	}
 
-	// Validate and clean result
+	// Clean result
 	if result.Content == "" {
 		result.Content = content
 	}
 
-	// Validate category
-	validCategories := map[string]bool{
-		"Websites": true, "Food": true, "Movies": true, "Books": true,
-		"Ideas": true, "Places": true, "Products": true, "People": true,
-		"Learnings": true, "Quotes": true, "Uncategorized": true,
-	}
-	if !validCategories[result.Category] {
-		result.Category = "Uncategorized"
-	}
-
 	// Clean tags
 	cleanedTags := []string{}
 	for i, tag := range result.Tags {
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/todomyday/backend/internal/models"
+)
+
+const (
+	// pushTTL is how long push services hold a message for an offline browser
+	pushTTL = 24 * time.Hour
+	// maxPushPayload is the most plaintext that fits in one aes128gcm record
+	// accepted by every push service
+	maxPushPayload = 3800
+)
+
+var (
+	// ErrPushNotConfigured is returned when Web Push is used without a VAPID key
+	ErrPushNotConfigured = errors.New("web push not configured")
+	// ErrInvalidPushSubscription is returned for subscriptions with malformed keys
+	ErrInvalidPushSubscription = errors.New("invalid push subscription")
+	// ErrPushSubscriptionGone is returned when the push service no longer knows
+	// a subscription, because the browser unsubscribed or it expired
+	ErrPushSubscriptionGone = errors.New("push subscription gone")
+)
+
+// WebPush sends Web Push messages, encrypted for the browser (RFC 8291) and
+// signed with the server's VAPID key (RFC 8292)
+type WebPush struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  string // base64url uncompressed point, what browsers subscribe with
+	subject    string
+	client     *http.Client
+}
+
+// NewWebPush creates a sender from a base64url P-256 private key, as generated
+// by `npx web-push generate-vapid-keys`. subject is a mailto: or https: contact
+// for push services. Without a key, Web Push stays disabled.
+func NewWebPush(privateKey, subject string) (*WebPush, error) {
+	w := &WebPush{
+		subject: subject,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+	if privateKey == "" {
+		return w, nil
+	}
+
+	d, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	point := key.PublicKey().Bytes()
+	w.privateKey = &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(d),
+	}
+	w.publicKey = base64.RawURLEncoding.EncodeToString(point)
+	return w, nil
+}
+
+// IsConfigured checks if a VAPID key is set
+func (w *WebPush) IsConfigured() bool {
+	return w != nil && w.privateKey != nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with, or "" when
+// Web Push is disabled
+func (w *WebPush) PublicKey() string {
+	if !w.IsConfigured() {
+		return ""
+	}
+	return w.publicKey
+}
+
+// checkSubscription verifies a subscription's keys can be encrypted for
+func checkSubscription(p256dh, auth string) error {
+	key, err := decodeBase64URL(p256dh)
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(key)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: p256dh must be a base64url P-256 public key", ErrInvalidPushSubscription)
+	}
+	if secret, err := decodeBase64URL(auth); err != nil || len(secret) != 16 {
+		return fmt.Errorf("%w: auth must be a base64url 16-byte secret", ErrInvalidPushSubscription)
+	}
+	return nil
+}
+
+// Send delivers payload to a subscription
+func (w *WebPush) Send(sub *models.PushSubscription, payload []byte) error {
+	if !w.IsConfigured() {
+		return ErrPushNotConfigured
+	}
+
+	body, err := encryptPushPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := w.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprintf("%d", int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrPushSubscriptionGone
+	case resp.StatusCode >= 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// vapidAuthorization signs a JWT for the endpoint's push service
+func (w *WebPush) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad endpoint", ErrInvalidPushSubscription)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.subject,
+	})
+	signed, err := token.SignedString(w.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + signed + ", k=" + w.publicKey, nil
+}
+
+// encryptPushPayload encrypts payload as a single aes128gcm record for the
+// subscription's keys
+func encryptPushPayload(sub *models.PushSubscription, payload []byte) ([]byte, error) {
+	if err := checkSubscription(sub.P256dh, sub.Auth); err != nil {
+		return nil, err
+	}
+	uaPublicBytes, _ := decodeBase64URL(sub.P256dh)
+	authSecret, _ := decodeBase64URL(sub.Auth)
+	uaPublic, _ := ecdh.P256().NewPublicKey(uaPublicBytes)
+
+	// A fresh key pair per message, so every message has its own shared secret
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	// Header: salt, record size, key id length, and the server's public key
+	body := make([]byte, 0, 16+4+1+len(asPublic)+len(ciphertext))
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, 4096)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	return append(body, ciphertext...), nil
+}
+
+// decodeBase64URL decodes base64url with or without padding, as browsers and
+// key generators disagree on it
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
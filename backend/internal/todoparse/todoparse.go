@@ -0,0 +1,535 @@
+// Package todoparse picks due dates, times, priorities, groups and recurrence
+// out of a todo written in plain English, such as "call mom tomorrow 5pm high
+// priority". It is deterministic: the same text and clock give the same result.
+package todoparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Result is what Parse found. Title is the text with the recognized phrases
+// taken out.
+type Result struct {
+	Title string
+	// Due is the due date in the clock's location, at midnight unless HasTime
+	Due     time.Time
+	HasDate bool
+	HasTime bool
+	// Priority is "low", "medium" or "high", or empty
+	Priority string
+	// Group is the name of the group a #hashtag matched, as given to Parse
+	Group string
+	// Recurrence is an RRULE such as "FREQ=WEEKLY;BYDAY=MO"
+	Recurrence string
+}
+
+// Found reports whether anything besides the title was recognized
+func (r *Result) Found() bool {
+	return r.HasDate || r.HasTime || r.Priority != "" || r.Group != "" || r.Recurrence != ""
+}
+
+const (
+	weekdayNames = `monday|tuesday|wednesday|thursday|friday|saturday|sunday`
+	weekdayAbbr  = `mon|tues?|wed|thu(?:rs?)?|fri|sat|sun`
+	monthNames   = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+	numberWords  = `\d+|an?|one|two|three|four|five|six|seven|eight|nine|ten|twelve`
+	// connective words that only make sense with the phrase they introduce
+	lead = `(?:(?:due|by|on|at|for|starting|from)\s+)*`
+)
+
+var (
+	// Recurrence
+	everyWeekdayRe  = regexp.MustCompile(`(?i)\b` + lead + `every\s+(weekday|weekend)s?\b`)
+	everyDaysRe     = regexp.MustCompile(`(?i)\b` + lead + `every\s+((?:` + weekdayNames + `|` + weekdayAbbr + `)(?:\s*(?:,|and|&)\s*(?:` + weekdayNames + `|` + weekdayAbbr + `))*)\b`)
+	everyPeriodRe   = regexp.MustCompile(`(?i)\b` + lead + `every\s+(?:(other|\d+)\s+)?(day|week|month|year)s?\b`)
+	everyMonthDayRe = regexp.MustCompile(`(?i)\b` + lead + `every\s+(\d{1,2})(?:st|nd|rd|th)(?:\s+of\s+the\s+month)?\b`)
+	periodicRe      = regexp.MustCompile(`(?i)\b(daily|weekly|monthly|yearly|annually)\b`)
+	wordRe          = regexp.MustCompile(`[A-Za-z]+`)
+
+	// Priority
+	priorityRe     = regexp.MustCompile(`(?i)\b(?:(high|medium|low)\s+priority|priority\s+(high|medium|low))\b`)
+	priorityCodeRe = regexp.MustCompile(`(?i)(?:^|\s)(?:!(high|medium|low)|p([123]))\b`)
+	urgentRe       = regexp.MustCompile(`(?i)\burgent(?:ly)?\b`)
+
+	// Groups
+	hashtagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_-]+)`)
+
+	// Dates
+	isoDateRe     = regexp.MustCompile(`(?i)\b` + lead + `(\d{4})-(\d{2})-(\d{2})\b`)
+	monthDayRe    = regexp.MustCompile(`(?i)\b` + lead + `(` + monthNames + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?\b`)
+	dayMonthRe    = regexp.MustCompile(`(?i)\b` + lead + `(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthNames + `)\.?(?:,?\s+(\d{4}))?\b`)
+	ordinalDayRe  = regexp.MustCompile(`(?i)\b` + lead + `the\s+(\d{1,2})(?:st|nd|rd|th)\b`)
+	dayAfterRe    = regexp.MustCompile(`(?i)\b` + lead + `(?:the\s+)?day\s+after\s+tomorrow\b`)
+	relativeDayRe = regexp.MustCompile(`(?i)\b` + lead + `(today|tonight|tomorrow|tmrw?|tmw)\b`)
+	nextPeriodRe  = regexp.MustCompile(`(?i)\b` + lead + `next\s+(week|month|year)\b`)
+	weekendRe     = regexp.MustCompile(`(?i)\b` + lead + `(?:this\s+|next\s+)?weekend\b`)
+	inDurationRe  = regexp.MustCompile(`(?i)\b` + lead + `in\s+(` + numberWords + `)\s+(minute|min|hour|hr|day|week|month|year)s?\b`)
+	weekdayRe     = regexp.MustCompile(`(?i)\b(?:(?:due|by|on)\s+)*(?:(this|next)\s+)?(` + weekdayNames + `)\b`)
+	weekdayAbbrRe = regexp.MustCompile(`(?i)\b(?:(?:due|by|on)\s+)+(?:(this|next)\s+)?(` + weekdayAbbr + `)\b|\b(this|next)\s+(` + weekdayAbbr + `)\b`)
+
+	// Times
+	clock12Re  = regexp.MustCompile(`(?i)\b` + lead + `(\d{1,2})(?::(\d{2}))?\s*(am|pm|a\.m\.|p\.m\.)`)
+	clock24Re  = regexp.MustCompile(`(?i)\b` + lead + `([01]?\d|2[0-3]):([0-5]\d)\b`)
+	atHourRe   = regexp.MustCompile(`(?i)\bat\s+(\d{1,2})\b`)
+	namedTime  = regexp.MustCompile(`(?i)\b` + lead + `(noon|midday|midnight|(?:in\s+the\s+|this\s+)?(?:morning|afternoon|evening))\b`)
+	leftoverRe = regexp.MustCompile(`(?i)(?:^|\s)(?:due|by|on|at|for|starting|from|,|-)\s*$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var rruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+var smallNumbers = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "twelve": 12,
+}
+
+// parser carries the text as phrases are cut out of it
+type parser struct {
+	text string
+	now  time.Time
+	res  Result
+
+	date           time.Time
+	hour, minute   int
+	weekdaysInRule []time.Weekday
+	monthDayInRule int
+	exact          bool // date and time both come from a duration such as "in 2 hours"
+	tonight        bool
+	dateFromTime   bool // the date was filled in because only a time was given
+}
+
+// Parse reads a todo's text relative to now, whose location is the user's
+// timezone. groups are the names of the user's groups, which #hashtags match
+// case-insensitively, ignoring spaces and punctuation.
+func Parse(text string, now time.Time, groups []string) Result {
+	p := &parser{text: text, now: now}
+
+	p.parseRecurrence()
+	p.parsePriority()
+	p.parseGroup(groups)
+	p.parseDate()
+	p.parseTime()
+	p.resolve()
+
+	p.res.Title = cleanTitle(p.text)
+	if p.res.Title == "" {
+		p.res.Title = strings.TrimSpace(text)
+	}
+	return p.res
+}
+
+// cut finds the first match of re that accept takes, removes it from the text
+// and reports whether there was one
+func (p *parser) cut(re *regexp.Regexp, accept func(m []string) bool) bool {
+	for _, loc := range re.FindAllStringSubmatchIndex(p.text, -1) {
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = p.text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		if accept(m) {
+			p.text = p.text[:loc[0]] + " " + p.text[loc[1]:]
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseRecurrence() {
+	switch {
+	case p.cut(everyWeekdayRe, func(m []string) bool {
+		if strings.EqualFold(m[1], "weekday") {
+			p.weekdaysInRule = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+		} else {
+			p.weekdaysInRule = []time.Weekday{time.Saturday, time.Sunday}
+		}
+		return true
+	}):
+		p.res.Recurrence = "FREQ=WEEKLY;BYDAY=" + joinDays(p.weekdaysInRule)
+	case p.cut(everyDaysRe, func(m []string) bool {
+		for _, word := range wordRe.FindAllString(m[1], -1) {
+			if day, ok := weekdays[strings.ToLower(word)[:3]]; ok {
+				p.weekdaysInRule = append(p.weekdaysInRule, day)
+			}
+		}
+		return len(p.weekdaysInRule) > 0
+	}):
+		p.res.Recurrence = "FREQ=WEEKLY;BYDAY=" + joinDays(p.weekdaysInRule)
+	case p.cut(everyMonthDayRe, func(m []string) bool {
+		day, _ := strconv.Atoi(m[1])
+		if day < 1 || day > 31 {
+			return false
+		}
+		p.monthDayInRule = day
+		return true
+	}):
+		p.res.Recurrence = "FREQ=MONTHLY;BYMONTHDAY=" + strconv.Itoa(p.monthDayInRule)
+	case p.cut(everyPeriodRe, func(m []string) bool {
+		interval := 1
+		switch {
+		case strings.EqualFold(m[1], "other"):
+			interval = 2
+		case m[1] != "":
+			interval, _ = strconv.Atoi(m[1])
+		}
+		if interval < 1 {
+			return false
+		}
+		p.res.Recurrence = "FREQ=" + frequency(m[2])
+		if interval > 1 {
+			p.res.Recurrence += ";INTERVAL=" + strconv.Itoa(interval)
+		}
+		return true
+	}):
+	case p.cut(periodicRe, func(m []string) bool {
+		p.res.Recurrence = "FREQ=" + frequency(m[1])
+		return true
+	}):
+	}
+}
+
+func frequency(word string) string {
+	switch strings.ToLower(word) {
+	case "day", "daily":
+		return "DAILY"
+	case "week", "weekly":
+		return "WEEKLY"
+	case "month", "monthly":
+		return "MONTHLY"
+	default:
+		return "YEARLY"
+	}
+}
+
+func joinDays(days []time.Weekday) string {
+	names := make([]string, len(days))
+	for i, day := range days {
+		names[i] = rruleDays[day]
+	}
+	return strings.Join(names, ",")
+}
+
+func (p *parser) parsePriority() {
+	_ = p.cut(priorityRe, func(m []string) bool {
+		p.res.Priority = strings.ToLower(m[1] + m[2])
+		return true
+	}) || p.cut(priorityCodeRe, func(m []string) bool {
+		if m[1] != "" {
+			p.res.Priority = strings.ToLower(m[1])
+		} else {
+			p.res.Priority = map[string]string{"1": "high", "2": "medium", "3": "low"}[m[2]]
+		}
+		return true
+	}) || p.cut(urgentRe, func(m []string) bool {
+		p.res.Priority = "high"
+		return true
+	})
+}
+
+func (p *parser) parseGroup(groups []string) {
+	byKey := make(map[string]string, len(groups))
+	for _, name := range groups {
+		byKey[groupKey(name)] = name
+	}
+	p.cut(hashtagRe, func(m []string) bool {
+		name, ok := byKey[groupKey(m[1])]
+		if ok {
+			p.res.Group = name
+		}
+		return ok
+	})
+}
+
+// groupKey folds a group name so "#side-project" matches "Side Project"
+func groupKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (p *parser) setDate(t time.Time) {
+	p.date = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, p.now.Location())
+	p.res.HasDate = true
+}
+
+func (p *parser) today() time.Time {
+	return time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.now.Location())
+}
+
+func (p *parser) parseDate() {
+	today := p.today()
+
+	_ = p.cut(isoDateRe, func(m []string) bool {
+		t, err := time.ParseInLocation("2006-01-02", m[1]+"-"+m[2]+"-"+m[3], p.now.Location())
+		if err != nil {
+			return false
+		}
+		p.setDate(t)
+		return true
+	}) || p.cut(monthDayRe, func(m []string) bool {
+		return p.setMonthDay(m[1], m[2], m[3])
+	}) || p.cut(dayMonthRe, func(m []string) bool {
+		return p.setMonthDay(m[2], m[1], m[3])
+	}) || p.cut(dayAfterRe, func(m []string) bool {
+		p.setDate(today.AddDate(0, 0, 2))
+		return true
+	}) || p.cut(relativeDayRe, func(m []string) bool {
+		switch strings.ToLower(m[1]) {
+		case "today":
+			p.setDate(today)
+		case "tonight":
+			p.setDate(today)
+			p.tonight = true
+		default:
+			p.setDate(today.AddDate(0, 0, 1))
+		}
+		return true
+	}) || p.cut(nextPeriodRe, func(m []string) bool {
+		switch strings.ToLower(m[1]) {
+		case "week":
+			p.setDate(startOfWeek(today).AddDate(0, 0, 7))
+		case "month":
+			p.setDate(time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()))
+		default:
+			p.setDate(time.Date(today.Year()+1, 1, 1, 0, 0, 0, 0, today.Location()))
+		}
+		return true
+	}) || p.cut(weekendRe, func(m []string) bool {
+		p.setDate(nextWeekday(today, time.Saturday, true))
+		return true
+	}) || p.cut(inDurationRe, func(m []string) bool {
+		n, ok := smallNumbers[strings.ToLower(m[1])]
+		if !ok {
+			n, _ = strconv.Atoi(m[1])
+		}
+		if n < 1 {
+			return false
+		}
+		switch unit := strings.ToLower(m[2]); unit {
+		case "minute", "min", "hour", "hr":
+			d := time.Duration(n) * time.Minute
+			if unit == "hour" || unit == "hr" {
+				d = time.Duration(n) * time.Hour
+			}
+			t := p.now.Add(d)
+			p.setDate(t)
+			p.hour, p.minute = t.Hour(), t.Minute()
+			p.res.HasTime, p.exact = true, true
+		case "day":
+			p.setDate(today.AddDate(0, 0, n))
+		case "week":
+			p.setDate(today.AddDate(0, 0, 7*n))
+		case "month":
+			p.setDate(today.AddDate(0, n, 0))
+		default:
+			p.setDate(today.AddDate(n, 0, 0))
+		}
+		return true
+	}) || p.cut(weekdayRe, p.setWeekday) || p.cut(weekdayAbbrRe, func(m []string) bool {
+		if m[2] == "" {
+			m = []string{m[0], m[3], m[4]}
+		}
+		return p.setWeekday(m)
+	}) || p.cut(ordinalDayRe, func(m []string) bool {
+		day, _ := strconv.Atoi(m[1])
+		if day < 1 || day > 31 {
+			return false
+		}
+		p.setDayOfMonth(day)
+		return true
+	})
+}
+
+// setMonthDay sets a date from a month name, day and optional year. Dates
+// without a year are the next time that day comes around.
+func (p *parser) setMonthDay(monthName, dayText, yearText string) bool {
+	month := monthNumber(monthName)
+	day, _ := strconv.Atoi(dayText)
+	year := p.now.Year()
+	if yearText != "" {
+		year, _ = strconv.Atoi(yearText)
+	}
+
+	date := time.Date(year, month, day, 0, 0, 0, 0, p.now.Location())
+	if day < 1 || date.Month() != month {
+		return false
+	}
+	if yearText == "" && date.Before(p.today()) {
+		date = date.AddDate(1, 0, 0)
+	}
+	p.setDate(date)
+	return true
+}
+
+func monthNumber(name string) time.Month {
+	prefix := strings.ToLower(name)[:3]
+	for m := time.January; m <= time.December; m++ {
+		if strings.ToLower(m.String())[:3] == prefix {
+			return m
+		}
+	}
+	return 0
+}
+
+// setWeekday handles "friday", "this friday" and "next friday". A plain or
+// "this" weekday is the next one after today; "next" is that day in the
+// following week, weeks starting on Monday.
+func (p *parser) setWeekday(m []string) bool {
+	day, ok := weekdays[strings.ToLower(m[2])[:3]]
+	if !ok {
+		return false
+	}
+	today := p.today()
+	if strings.EqualFold(m[1], "next") {
+		offset := (int(day) - int(time.Monday) + 7) % 7
+		p.setDate(startOfWeek(today).AddDate(0, 0, 7+offset))
+	} else {
+		p.setDate(nextWeekday(today, day, strings.EqualFold(m[1], "this")))
+	}
+	return true
+}
+
+// startOfWeek returns the Monday of t's week
+func startOfWeek(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) - int(time.Monday) + 7) % 7))
+}
+
+// nextWeekday returns the first given weekday after t, or t itself if
+// inclusive and it's that day
+func nextWeekday(t time.Time, day time.Weekday, inclusive bool) time.Time {
+	offset := (int(day) - int(t.Weekday()) + 7) % 7
+	if offset == 0 && !inclusive {
+		offset = 7
+	}
+	return t.AddDate(0, 0, offset)
+}
+
+func (p *parser) parseTime() {
+	if p.exact {
+		return
+	}
+	found := p.cut(clock12Re, func(m []string) bool {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return false
+		}
+		hour %= 12
+		if strings.HasPrefix(strings.ToLower(m[3]), "p") {
+			hour += 12
+		}
+		p.hour, p.minute = hour, minute
+		return true
+	}) || p.cut(clock24Re, func(m []string) bool {
+		p.hour, _ = strconv.Atoi(m[1])
+		p.minute, _ = strconv.Atoi(m[2])
+		return true
+	}) || p.cut(atHourRe, func(m []string) bool {
+		// A bare "at 5" is in the afternoon; "at 9" is in the morning
+		hour, _ := strconv.Atoi(m[1])
+		if hour > 23 {
+			return false
+		}
+		if hour >= 1 && hour <= 7 {
+			hour += 12
+		}
+		p.hour, p.minute = hour, 0
+		return true
+	}) || p.cut(namedTime, func(m []string) bool {
+		word := strings.ToLower(m[1])
+		switch {
+		case word == "noon" || word == "midday":
+			p.hour, p.minute = 12, 0
+		case word == "midnight":
+			p.hour, p.minute = 23, 59
+		case strings.HasSuffix(word, "morning"):
+			p.hour, p.minute = 9, 0
+		case strings.HasSuffix(word, "afternoon"):
+			p.hour, p.minute = 15, 0
+		default:
+			p.hour, p.minute = 19, 0
+		}
+		return true
+	})
+
+	if !found && p.tonight {
+		p.hour, p.minute, found = 20, 0, true
+	}
+	p.res.HasTime = found
+}
+
+// resolve settles the due date: times without a date are today if still ahead
+// and tomorrow otherwise, and recurring todos without one start on their first
+// occurrence
+func (p *parser) resolve() {
+	today := p.today()
+	if !p.res.HasDate {
+		switch {
+		case len(p.weekdaysInRule) > 0:
+			first := nextWeekday(today, p.weekdaysInRule[0], true)
+			for _, day := range p.weekdaysInRule[1:] {
+				if next := nextWeekday(today, day, true); next.Before(first) {
+					first = next
+				}
+			}
+			p.setDate(first)
+		case p.monthDayInRule > 0:
+			p.setDayOfMonth(p.monthDayInRule)
+		case p.res.HasTime:
+			p.setDate(today)
+			p.dateFromTime = true
+		}
+	}
+
+	if !p.res.HasDate {
+		return
+	}
+	p.res.Due = p.date
+	if p.res.HasTime {
+		p.res.Due = time.Date(p.date.Year(), p.date.Month(), p.date.Day(), p.hour, p.minute, 0, 0, p.now.Location())
+		// A time alone that already passed today means tomorrow
+		if p.dateFromTime && p.res.Due.Before(p.now) {
+			p.res.Due = p.res.Due.AddDate(0, 0, 1)
+		}
+	}
+}
+
+// setDayOfMonth sets the date to the next time the day of the month comes
+// around, today included, skipping months too short to have it
+func (p *parser) setDayOfMonth(day int) {
+	today := p.today()
+	for t := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location()); ; t = t.AddDate(0, 1, 0) {
+		date := time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, t.Location())
+		if date.Month() == t.Month() && !date.Before(today) {
+			p.setDate(date)
+			return
+		}
+	}
+}
+
+// cleanTitle tidies the text once phrases were cut from it: spaces collapse
+// and connectives left dangling at the end go
+func cleanTitle(text string) string {
+	title := strings.Join(strings.Fields(text), " ")
+	for {
+		trimmed := strings.TrimSpace(leftoverRe.ReplaceAllString(title, ""))
+		trimmed = strings.TrimRight(trimmed, " ,;-")
+		if trimmed == title {
+			return title
+		}
+		title = trimmed
+	}
+}
@@ -0,0 +1,61 @@
+package todoparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	// A Wednesday morning
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, loc)
+	groups := []string{"Work", "Side Project"}
+
+	tests := []struct {
+		text, title, due, priority, group, rule string
+	}{
+		{"call mom tomorrow 5pm high priority", "call mom", "2026-10-15 17:00", "high", "", ""},
+		{"Pay rent on Oct 1st", "Pay rent", "2027-10-01", "", "", ""},
+		{"Submit report by friday #work p1", "Submit report", "2026-10-16", "high", "Work", ""},
+		// "next" is the following week, a plain weekday the next one ahead
+		{"Plan sprint next monday at 9:30", "Plan sprint", "2026-10-19 09:30", "", "", ""},
+		{"Retro next friday", "Retro", "2026-10-23", "", "", ""},
+		// A time that already passed today is tomorrow
+		{"stretch at 8am", "stretch", "2026-10-15 08:00", "", "", ""},
+		{"lunch with Sam at noon", "lunch with Sam", "2026-10-14 12:00", "", "", ""},
+		{"take out bins tonight", "take out bins", "2026-10-14 20:00", "", "", ""},
+		{"check oven in 2 hours", "check oven", "2026-10-14 12:00", "", "", ""},
+		{"renew passport in three weeks !low", "renew passport", "2026-11-04", "low", "", ""},
+		{"Standup every weekday at 9am", "Standup", "2026-10-14 09:00", "", "", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		{"Gym every tue and thu 7pm", "Gym", "2026-10-15 19:00", "", "", "FREQ=WEEKLY;BYDAY=TU,TH"},
+		{"Water plants every other day", "Water plants", "", "", "", "FREQ=DAILY;INTERVAL=2"},
+		{"Invoice clients every 1st", "Invoice clients", "2026-11-01", "", "", "FREQ=MONTHLY;BYMONTHDAY=1"},
+		{"Release 2026-12-01 #side-project", "Release", "2026-12-01", "", "Side Project", ""},
+		// Unknown groups and plain words are left alone
+		{"Read about #golang on the sun", "Read about #golang on the sun", "", "", "", ""},
+		{"tomorrow", "tomorrow", "2026-10-15", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		res := Parse(tt.text, now, groups)
+
+		due := ""
+		switch {
+		case res.HasTime:
+			due = res.Due.Format("2006-01-02 15:04")
+		case res.HasDate:
+			due = res.Due.Format("2006-01-02")
+		}
+		if res.Title != tt.title || due != tt.due || res.Priority != tt.priority || res.Group != tt.group || res.Recurrence != tt.rule {
+			t.Errorf("%q: expected %q due %q priority %q group %q rule %q, got %q due %q priority %q group %q rule %q",
+				tt.text, tt.title, tt.due, tt.priority, tt.group, tt.rule,
+				res.Title, due, res.Priority, res.Group, res.Recurrence)
+		}
+		if res.HasDate && res.Due.Location() != loc {
+			t.Errorf("%q: due date in %v, expected the clock's location", tt.text, res.Due.Location())
+		}
+	}
+}
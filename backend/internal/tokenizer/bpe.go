@@ -0,0 +1,219 @@
+package tokenizer
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// BPE is a byte-level byte pair encoder in the style of OpenAI's tiktoken.
+// Text is pre-split like cl100k_base, then each piece's bytes are merged
+// pairwise in rank order until no ranked pair remains.
+type BPE struct {
+	ranks map[string]int
+}
+
+// NewBPE creates an encoder from a map of byte sequence to rank (which is also its token ID)
+func NewBPE(ranks map[string]int) *BPE {
+	return &BPE{ranks: ranks}
+}
+
+// Encode splits text into tokens
+func (b *BPE) Encode(text string) []Token {
+	var tokens []Token
+	for _, piece := range pretokenize(text) {
+		tokens = append(tokens, b.encodePiece(text[piece.start:piece.end], piece.start)...)
+	}
+	return tokens
+}
+
+// CountTokens counts the tokens in text
+func (b *BPE) CountTokens(text string) int {
+	return len(b.Encode(text))
+}
+
+// TruncateToTokens cuts text so it encodes to at most maxTokens
+func (b *BPE) TruncateToTokens(text string, maxTokens int) string {
+	tokens := b.Encode(text)
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	if maxTokens <= 0 {
+		return ""
+	}
+	return truncateAt(text, tokens, maxTokens)
+}
+
+func (b *BPE) encodePiece(piece string, offset int) []Token {
+	if id, ok := b.ranks[piece]; ok {
+		return []Token{{ID: id, Start: offset, End: offset + len(piece)}}
+	}
+
+	// bounds[i] is where part i starts; parts begin as single bytes
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+
+	tokens := make([]Token, 0, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		id, ok := b.ranks[piece[bounds[i]:bounds[i+1]]]
+		if !ok {
+			// Every single byte is ranked in a complete vocabulary
+			id = -1
+		}
+		tokens = append(tokens, Token{ID: id, Start: offset + bounds[i], End: offset + bounds[i+1]})
+	}
+	return tokens
+}
+
+// pretokenize splits text the way cl100k_base's pattern does:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// Go's regexp has no lookahead, so the alternatives are matched by hand, first match wins.
+func pretokenize(text string) []span {
+	var spans []span
+	for pos := 0; pos < len(text); {
+		n := matchContraction(text[pos:])
+		if n == 0 {
+			n = matchLetters(text[pos:])
+		}
+		if n == 0 {
+			n = matchDigits(text[pos:])
+		}
+		if n == 0 {
+			n = matchSymbols(text[pos:])
+		}
+		if n == 0 {
+			n = matchWhitespace(text[pos:])
+		}
+		if n == 0 {
+			// Unreachable for valid input; consume a rune to guarantee progress
+			_, n = utf8.DecodeRuneInString(text[pos:])
+		}
+		spans = append(spans, span{pos, pos + n})
+		pos += n
+	}
+	return spans
+}
+
+func matchContraction(s string) int {
+	if len(s) < 2 || s[0] != '\'' {
+		return 0
+	}
+	lower := func(c byte) byte {
+		if c >= 'A' && c <= 'Z' {
+			return c + 'a' - 'A'
+		}
+		return c
+	}
+	if len(s) >= 3 {
+		switch string([]byte{lower(s[1]), lower(s[2])}) {
+		case "re", "ve", "ll":
+			return 3
+		}
+	}
+	switch lower(s[1]) {
+	case 's', 't', 'm', 'd':
+		return 2
+	}
+	return 0
+}
+
+// matchLetters: [^\r\n\p{L}\p{N}]?\p{L}+
+func matchLetters(s string) int {
+	n := 0
+	if r, size := utf8.DecodeRuneInString(s); r != '\r' && r != '\n' && !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+		n = size
+	}
+	start := n
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !unicode.IsLetter(r) {
+			break
+		}
+		n += size
+	}
+	if n == start {
+		return 0
+	}
+	return n
+}
+
+// matchDigits: \p{N}{1,3}
+func matchDigits(s string) int {
+	n := 0
+	for count := 0; count < 3 && n < len(s); count++ {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !unicode.IsNumber(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+// matchSymbols: ?[^\s\p{L}\p{N}]+[\r\n]*
+func matchSymbols(s string) int {
+	n := 0
+	if s[0] == ' ' {
+		n = 1
+	}
+	start := n
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.IsNumber(r) {
+			break
+		}
+		n += size
+	}
+	if n == start {
+		return 0
+	}
+	for n < len(s) && (s[n] == '\r' || s[n] == '\n') {
+		n++
+	}
+	return n
+}
+
+// matchWhitespace: \s*[\r\n]+ | \s+(?!\S) | \s+
+func matchWhitespace(s string) int {
+	// The whole whitespace run, and where its last newline ends
+	run, lastNewline := 0, 0
+	lastRuneSize := 0
+	for run < len(s) {
+		r, size := utf8.DecodeRuneInString(s[run:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		run += size
+		lastRuneSize = size
+		if r == '\r' || r == '\n' {
+			lastNewline = run
+		}
+	}
+	if run == 0 {
+		return 0
+	}
+	if lastNewline > 0 {
+		return lastNewline
+	}
+	// Leave the last space for the following word unless the run ends the text
+	if run < len(s) && run > lastRuneSize {
+		return run - lastRuneSize
+	}
+	return run
+}
@@ -0,0 +1,71 @@
+// Package tokenizer counts and truncates text in the tokens a model actually sees.
+// WordPiece covers BERT-style embedding models such as E5 and BPE covers
+// OpenAI-style chat and embedding models. Vocabularies are embedded from the
+// vocab directory, which scripts/fetch-tokenizers.sh fills before the build;
+// when one is missing, ForModel returns nil and callers fall back to an
+// estimate.
+package tokenizer
+
+import (
+	"strings"
+)
+
+// Tokenizer counts and truncates text in a model's tokens
+type Tokenizer interface {
+	CountTokens(text string) int
+	TruncateToTokens(text string, maxTokens int) string
+}
+
+// Token is one encoded token and the bytes of the input it came from.
+// WordPiece continuation pieces share the span of their whole word.
+type Token struct {
+	ID    int
+	Start int
+	End   int
+}
+
+// ForModel returns the tokenizer for a model ID, or nil when the model's
+// tokenizer isn't bundled or its vocabulary wasn't embedded
+func ForModel(model string) Tokenizer {
+	id := strings.ToLower(model)
+	name := id
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		name = id[i+1:]
+	}
+
+	switch {
+	case strings.Contains(name, "e5") || strings.Contains(name, "bert") ||
+		strings.HasPrefix(name, "nv-embed") || strings.HasPrefix(name, "nomic-embed"):
+		if wp, err := E5(); err == nil {
+			return wp
+		}
+	case usesCL100K(name):
+		if bpe, err := CL100K(); err == nil {
+			return bpe
+		}
+	}
+	return nil
+}
+
+// usesCL100K reports whether a model encodes with cl100k_base. GPT-4o, GPT-4.1 and
+// the o-series moved to o200k_base, which isn't bundled.
+func usesCL100K(name string) bool {
+	if strings.HasPrefix(name, "gpt-4o") || strings.HasPrefix(name, "gpt-4.") {
+		return false
+	}
+	return strings.HasPrefix(name, "gpt-4") || strings.HasPrefix(name, "gpt-3.5") ||
+		strings.HasPrefix(name, "text-embedding-3") || strings.HasPrefix(name, "text-embedding-ada")
+}
+
+// truncateAt cuts text before the token at index n, backing up to a rune boundary
+func truncateAt(text string, tokens []Token, n int) string {
+	cut := tokens[n].Start
+	for cut > 0 && cut < len(text) && !isRuneStart(text[cut]) {
+		cut--
+	}
+	return strings.TrimRight(text[:cut], " \t\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,85 @@
+package tokenizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func pieces(text string, tokens []Token) []string {
+	var out []string
+	for _, tok := range tokens {
+		out = append(out, text[tok.Start:tok.End])
+	}
+	return out
+}
+
+func TestWordPiece(t *testing.T) {
+	vocab := map[string]int{}
+	for i, piece := range []string{"[UNK]", "[CLS]", "[SEP]", "the", "un", "##aff", "##able", "cafe", ",", "runn", "##ing"} {
+		vocab[piece] = i
+	}
+	wp := NewWordPiece(vocab)
+
+	text := "The unaffable café, running!!"
+	var ids []int
+	for _, tok := range wp.Encode(text) {
+		ids = append(ids, tok.ID)
+	}
+	// the un ##aff ##able cafe , runn ##ing [UNK] [UNK]
+	want := []int{3, 4, 5, 6, 7, 8, 9, 10, 0, 0}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected ids %v, got %v", want, ids)
+	}
+	if got := wp.CountTokens(text); got != len(want) {
+		t.Fatalf("expected %d tokens, got %d", len(want), got)
+	}
+
+	// Truncation never splits a word into some of its pieces
+	if got := wp.TruncateToTokens(text, 4); got != "The unaffable" {
+		t.Fatalf("expected cut before café, got %q", got)
+	}
+	if got := wp.TruncateToTokens(text, 3); got != "The" {
+		t.Fatalf("expected cut before unaffable, got %q", got)
+	}
+	if got := wp.TruncateToTokens(text, 20); got != text {
+		t.Fatalf("expected text that fits to be unchanged, got %q", got)
+	}
+}
+
+func TestPretokenize(t *testing.T) {
+	text := "Hello world's 12345  end\n\nx"
+	var got []string
+	for _, s := range pretokenize(text) {
+		got = append(got, text[s.start:s.end])
+	}
+	want := []string{"Hello", " world", "'s", " ", "123", "45", " ", " end", "\n\n", "x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestBPE(t *testing.T) {
+	ranks := map[string]int{}
+	for _, b := range []byte("helowrd ") {
+		ranks[string([]byte{b})] = len(ranks)
+	}
+	for _, merge := range []string{"ll", "he", "hell", "hello", " w", "or", " wor", "ld"} {
+		ranks[merge] = len(ranks)
+	}
+	bpe := NewBPE(ranks)
+
+	text := "hello world"
+	got := pieces(text, bpe.Encode(text))
+	want := []string{"hello", " wor", "ld"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got := bpe.TruncateToTokens(text, 2); got != "hello wor" {
+		t.Fatalf("expected cut before the last token, got %q", got)
+	}
+	// Multi-byte runes are never cut in half
+	if got := bpe.TruncateToTokens("he é", 3); got != "he" {
+		t.Fatalf("expected cut before the partial rune, got %q", got)
+	}
+}
@@ -0,0 +1,131 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// vocabFS holds the vocabularies listed in vocab/SOURCES, as downloaded and
+// checked against their sha256 by scripts/fetch-tokenizers.sh before the build
+//
+//go:embed vocab
+var vocabFS embed.FS
+
+const (
+	bertVocabFile   = "vocab/bert-base-uncased-vocab.txt"
+	cl100kRanksFile = "vocab/cl100k_base.tiktoken"
+)
+
+var (
+	e5Once  sync.Once
+	e5      *WordPiece
+	e5Err   error
+	bpeOnce sync.Once
+	cl100k  *BPE
+	bpeErr  error
+)
+
+func loadE5() (*WordPiece, error) {
+	e5Once.Do(func() {
+		vocab, err := loadWordPieceVocab(bertVocabFile)
+		if err != nil {
+			e5Err = fmt.Errorf("WordPiece vocabulary unavailable (run scripts/fetch-tokenizers.sh before building): %w", err)
+			return
+		}
+		e5 = NewWordPiece(vocab)
+	})
+	return e5, e5Err
+}
+
+func loadCL100K() (*BPE, error) {
+	bpeOnce.Do(func() {
+		ranks, err := loadBPERanks(cl100kRanksFile)
+		if err != nil {
+			bpeErr = fmt.Errorf("BPE ranks unavailable (run scripts/fetch-tokenizers.sh before building): %w", err)
+			return
+		}
+		cl100k = NewBPE(ranks)
+	})
+	return cl100k, bpeErr
+}
+
+// Check loads the embedded vocabularies, returning an error if the binary was
+// built without them. The server calls it at startup to warn that token counts
+// will be estimated.
+func Check() error {
+	if _, err := loadE5(); err != nil {
+		return err
+	}
+	_, err := loadCL100K()
+	return err
+}
+
+// E5 returns the WordPiece tokenizer shared by the English E5 embedding models
+// (bert-base-uncased), or an error if the vocabulary wasn't embedded
+func E5() (*WordPiece, error) {
+	return loadE5()
+}
+
+// CL100K returns the cl100k_base encoder used by GPT-4-era OpenAI models, or an
+// error if the ranks weren't embedded
+func CL100K() (*BPE, error) {
+	return loadCL100K()
+}
+
+// loadWordPieceVocab reads a vocab.txt with one piece per line; the line number is the ID
+func loadWordPieceVocab(name string) (map[string]int, error) {
+	data, err := vocabFS.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	vocab := make(map[string]int, 32000)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for id := 0; scanner.Scan(); id++ {
+		vocab[scanner.Text()] = id
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if len(vocab) == 0 {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+	return vocab, nil
+}
+
+// loadBPERanks reads a .tiktoken file: one base64-encoded byte sequence and its rank per line
+func loadBPERanks(name string) (map[string]int, error) {
+	data, err := vocabFS.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ranks := make(map[string]int, 100000)
+	for lineNo, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		fields := bytes.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected token and rank", name, lineNo+1)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo+1, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, lineNo+1, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+	return ranks, nil
+}
@@ -0,0 +1,61 @@
+package tokenizer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestEmbeddedVocab loads the vocabularies built into the binary and checks
+// them against their pinned sha256. It is skipped when
+// scripts/fetch-tokenizers.sh wasn't run.
+func TestEmbeddedVocab(t *testing.T) {
+	if err := Check(); errors.Is(err, fs.ErrNotExist) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := vocabFS.ReadFile("vocab/SOURCES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(sources)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		data, err := vocabFS.ReadFile("vocab/" + fields[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != fields[1] {
+			t.Errorf("%s: expected sha256 %s, got %s", fields[0], fields[1], got)
+		}
+	}
+
+	wp, _ := E5()
+	var ids []int
+	for _, tok := range wp.Encode("Hello world") {
+		ids = append(ids, tok.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{7592, 2088}) {
+		t.Errorf("expected bert-base-uncased IDs for \"Hello world\", got %v", ids)
+	}
+
+	bpe, _ := CL100K()
+	ids = nil
+	for _, tok := range bpe.Encode("hello world") {
+		ids = append(ids, tok.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{15339, 1917}) {
+		t.Errorf("expected cl100k_base IDs for \"hello world\", got %v", ids)
+	}
+}
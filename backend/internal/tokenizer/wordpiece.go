@@ -0,0 +1,159 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SpecialTokens is the [CLS] and [SEP] pair a BERT-style model adds around every
+// input. WordPiece counts leave them out so that counts of parts add up; callers
+// checking a model's input limit reserve them.
+const SpecialTokens = 2
+
+const (
+	unknownToken      = "[UNK]"
+	maxWordPieceRunes = 100 // Longer words encode as [UNK], as in BERT
+)
+
+// WordPiece is BERT's uncased tokenizer: text is lowercased, stripped of accents
+// and split on whitespace and punctuation, then each word is split greedily into
+// the longest vocabulary pieces, continuations prefixed with "##".
+type WordPiece struct {
+	vocab     map[string]int
+	unknownID int
+}
+
+// NewWordPiece creates a tokenizer from a vocabulary of piece to ID
+func NewWordPiece(vocab map[string]int) *WordPiece {
+	unknownID, ok := vocab[unknownToken]
+	if !ok {
+		unknownID = -1
+	}
+	return &WordPiece{vocab: vocab, unknownID: unknownID}
+}
+
+// Encode splits text into word pieces, without the [CLS] and [SEP] tokens
+func (wp *WordPiece) Encode(text string) []Token {
+	var tokens []Token
+	for _, word := range basicTokenize(text) {
+		tokens = append(tokens, wp.encodeWord(text[word.start:word.end], word.start, word.end)...)
+	}
+	return tokens
+}
+
+// CountTokens counts the word pieces in text
+func (wp *WordPiece) CountTokens(text string) int {
+	return len(wp.Encode(text))
+}
+
+// TruncateToTokens cuts text at a word boundary so it encodes to at most maxTokens pieces
+func (wp *WordPiece) TruncateToTokens(text string, maxTokens int) string {
+	tokens := wp.Encode(text)
+	if len(tokens) <= maxTokens {
+		return text
+	}
+	if maxTokens <= 0 {
+		return ""
+	}
+	return truncateAt(text, tokens, maxTokens)
+}
+
+func (wp *WordPiece) encodeWord(word string, start, end int) []Token {
+	normalized := []rune(normalizeWord(word))
+	if len(normalized) == 0 {
+		return nil
+	}
+	if len(normalized) > maxWordPieceRunes {
+		return []Token{{ID: wp.unknownID, Start: start, End: end}}
+	}
+
+	var tokens []Token
+	for pos := 0; pos < len(normalized); {
+		matched := false
+		for stop := len(normalized); stop > pos; stop-- {
+			piece := string(normalized[pos:stop])
+			if pos > 0 {
+				piece = "##" + piece
+			}
+			if id, ok := wp.vocab[piece]; ok {
+				tokens = append(tokens, Token{ID: id, Start: start, End: end})
+				pos = stop
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// A word with any unmatchable part is a single [UNK]
+			return []Token{{ID: wp.unknownID, Start: start, End: end}}
+		}
+	}
+	return tokens
+}
+
+// normalizeWord lowercases and strips accents
+func normalizeWord(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(word)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type span struct {
+	start, end int
+}
+
+// basicTokenize splits text into words, punctuation and CJK characters, as byte spans.
+// Control characters are dropped like whitespace.
+func basicTokenize(text string) []span {
+	var spans []span
+	wordStart := -1
+	flush := func(at int) {
+		if wordStart >= 0 {
+			spans = append(spans, span{wordStart, at})
+			wordStart = -1
+		}
+	}
+
+	for i, r := range text {
+		size := len(string(r))
+		switch {
+		case unicode.IsSpace(r) || r == 0 || r == unicode.ReplacementChar || (unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r'):
+			flush(i)
+		case isPunctuation(r) || isCJK(r):
+			flush(i)
+			spans = append(spans, span{i, i + size})
+		default:
+			if wordStart < 0 {
+				wordStart = i
+			}
+		}
+	}
+	flush(len(text))
+	return spans
+}
+
+// isPunctuation matches BERT: all non-alphanumeric ASCII plus Unicode punctuation
+func isPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+	return unicode.IsPunct(r)
+}
+
+// isCJK matches the CJK Unified Ideograph blocks BERT splits per character
+func isCJK(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B820 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
@@ -0,0 +1,32 @@
+#!/bin/sh
+# Downloads the tokenizer vocabularies listed in internal/tokenizer/vocab/SOURCES
+# so they are embedded into the server binary, and checks each against its
+# pinned sha256. Run from the backend directory before `go build`; existing
+# files are kept if their checksum matches.
+# Usage: ./scripts/fetch-tokenizers.sh
+
+set -e
+
+VOCAB_DIR="$(dirname "$0")/../internal/tokenizer/vocab"
+
+# verify FILE SHA256 exits non-zero unless FILE has the given checksum
+verify() {
+    echo "$2  $1" | sha256sum -c - >/dev/null 2>&1
+}
+
+grep -v '^#' "${VOCAB_DIR}/SOURCES" | while read -r FILE SHA256 URL; do
+    [ -z "${FILE}" ] && continue
+    if [ -s "${VOCAB_DIR}/${FILE}" ] && verify "${VOCAB_DIR}/${FILE}" "${SHA256}"; then
+        echo "✓ ${FILE} already present"
+        continue
+    fi
+    echo "Downloading ${FILE}..."
+    wget -q -O "${VOCAB_DIR}/${FILE}.tmp" "${URL}"
+    if ! verify "${VOCAB_DIR}/${FILE}.tmp" "${SHA256}"; then
+        rm -f "${VOCAB_DIR}/${FILE}.tmp"
+        echo "✗ ${FILE} does not match its sha256 ${SHA256}" >&2
+        exit 1
+    fi
+    mv "${VOCAB_DIR}/${FILE}.tmp" "${VOCAB_DIR}/${FILE}"
+    echo "✓ ${FILE}"
+done